@@ -0,0 +1,177 @@
+package dnsdisco
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// adaptiveScale keeps the precision of the weights multiplied by the
+	// adaptive factors.
+	adaptiveScale = 100
+
+	// defaultAdaptiveSmoothing is the weight of each new result in the moving
+	// averages, when not defined.
+	defaultAdaptiveSmoothing = 0.1
+)
+
+// AdaptiveWeights defines how the effective weight of each server is adjusted
+// by the observed results (see ReportResult). The effective weight is the
+// published SRV weight multiplied by a factor, that decreases with the error
+// rate and with the latency above the reference, and converges back to the
+// published weight when the results normalize.
+type AdaptiveWeights struct {
+	// MinFactor is the lower bound of the factor (e.g. 0.1), so a bad server
+	// still receives some requests to detect its recovery.
+	MinFactor float64
+
+	// MaxFactor is the upper bound of the factor (e.g. 2), that rewards the
+	// servers faster than the reference. A zero MaxFactor disables the
+	// adaptive weights.
+	MaxFactor float64
+
+	// TargetLatency is the reference latency. If zero the average latency of
+	// all servers is used.
+	TargetLatency time.Duration
+
+	// Smoothing is the weight (0-1) of each new result in the moving averages
+	// of the error rate and the latency. If zero 0.1 is used.
+	Smoothing float64
+}
+
+// WeightFactorLoadBalancer is the interface that the load balancers can
+// implement to receive the adaptive factors of the servers (see
+// SetAdaptiveWeights). The default load balancer implements it.
+type WeightFactorLoadBalancer interface {
+	// SetWeightFactor defines the function that returns the factor that
+	// multiplies the weight of a server.
+	SetWeightFactor(factor func(target string, port uint16) float64)
+}
+
+// adaptiveResults stores the moving averages of the results of a server.
+type adaptiveResults struct {
+	errorRate float64
+	latency   float64
+}
+
+// SetAdaptiveWeights adjusts the effective weight of each server based on the
+// error rate and the latency reported with ReportResult, bounded around the
+// published weight, as static weights go stale quickly in dynamic fleets. A
+// zero configuration disables it (default). It only works with load balancers
+// that implement the WeightFactorLoadBalancer interface. It is go routine
+// safe.
+func (d *discovery) SetAdaptiveWeights(config AdaptiveWeights) {
+	if config.Smoothing <= 0 || config.Smoothing > 1 {
+		config.Smoothing = defaultAdaptiveSmoothing
+	}
+	config.MinFactor = math.Max(0, config.MinFactor)
+	config.MaxFactor = math.Max(config.MinFactor, config.MaxFactor)
+
+	d.adaptiveLock.Lock()
+	d.adaptive = config
+	d.adaptiveLock.Unlock()
+
+	d.loadBalancerLock.Lock()
+	defer d.loadBalancerLock.Unlock()
+	d.shareWeightFactor(d.loadBalancer)
+}
+
+// ReportResult feeds the adaptive weights with the result of a request sent to
+// the server: its latency and error, if any. The latency of the failed
+// requests is ignored. It has no effect when the adaptive weights are
+// disabled. It is go routine safe.
+func (d *discovery) ReportResult(target string, port uint16, latency time.Duration, err error) {
+	d.adaptiveLock.Lock()
+	defer d.adaptiveLock.Unlock()
+
+	if d.adaptive.MaxFactor == 0 {
+		return
+	}
+
+	if d.adaptiveResults == nil {
+		d.adaptiveResults = make(map[string]*adaptiveResults)
+	}
+
+	key := drainKey(target, port)
+	results, ok := d.adaptiveResults[key]
+	if !ok {
+		results = new(adaptiveResults)
+		d.adaptiveResults[key] = results
+	}
+
+	smoothing := d.adaptive.Smoothing
+
+	var failure float64
+	if err != nil {
+		failure = 1
+	}
+	results.errorRate += smoothing * (failure - results.errorRate)
+
+	if err == nil && latency > 0 {
+		if results.latency == 0 {
+			results.latency = float64(latency)
+		} else {
+			results.latency += smoothing * (float64(latency) - results.latency)
+		}
+	}
+}
+
+// shareWeightFactor makes the load balancer use the adaptive factors when it
+// supports it. The caller must hold the load balancer write lock.
+func (d *discovery) shareWeightFactor(b LoadBalancer) {
+	if loadBalancer, ok := b.(WeightFactorLoadBalancer); ok {
+		loadBalancer.SetWeightFactor(d.weightFactor)
+	}
+}
+
+// weightFactor returns the adaptive factor of the server weight, or 1 when
+// the adaptive weights are disabled or there's no result of the server.
+func (d *discovery) weightFactor(target string, port uint16) float64 {
+	d.adaptiveLock.RLock()
+	defer d.adaptiveLock.RUnlock()
+
+	config := d.adaptive
+	if config.MaxFactor == 0 {
+		return 1
+	}
+
+	results, ok := d.adaptiveResults[drainKey(target, port)]
+	if !ok {
+		return 1
+	}
+
+	reference := float64(config.TargetLatency)
+	if reference == 0 {
+		var total float64
+		var n int
+		for _, other := range d.adaptiveResults {
+			if other.latency > 0 {
+				total += other.latency
+				n++
+			}
+		}
+		if n > 0 {
+			reference = total / float64(n)
+		}
+	}
+
+	success := 1 - results.errorRate
+	factor := success * success
+	if reference > 0 && results.latency > 0 {
+		factor *= reference / results.latency
+	}
+
+	return math.Max(config.MinFactor, math.Min(config.MaxFactor, factor))
+}
+
+// applyWeightFactor multiplies the weights of the servers by their adaptive
+// factors.
+func applyWeightFactor(servers []defaultLoadBalancerServer, weights []int, factor func(target string, port uint16) float64) {
+	if factor == nil {
+		return
+	}
+
+	for i, server := range servers {
+		weights[i] = int(math.Round(float64(weights[i]) * factor(server.Target, server.Port) * adaptiveScale))
+	}
+}
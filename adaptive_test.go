@@ -0,0 +1,142 @@
+package dnsdisco
+
+import (
+	"errors"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWeightFactor(t *testing.T) {
+	t.Parallel()
+
+	type result struct {
+		target  string
+		latency time.Duration
+		err     error
+	}
+
+	scenarios := []struct {
+		description    string
+		config         AdaptiveWeights
+		results        []result
+		target         string
+		expectedFactor float64
+	}{
+		{
+			description: "it should ignore the results when disabled",
+			results: []result{
+				{target: "server1.example.com.", err: errors.New("generic error")},
+			},
+			target:         "server1.example.com.",
+			expectedFactor: 1,
+		},
+		{
+			description:    "it should keep the weight of an unknown server",
+			config:         AdaptiveWeights{MinFactor: 0.1, MaxFactor: 2},
+			target:         "server1.example.com.",
+			expectedFactor: 1,
+		},
+		{
+			description: "it should reduce the weight of a failing server",
+			config:      AdaptiveWeights{MinFactor: 0.1, MaxFactor: 2, Smoothing: 0.5},
+			results: []result{
+				{target: "server1.example.com.", latency: time.Second, err: errors.New("generic error")},
+			},
+			target:         "server1.example.com.",
+			expectedFactor: 0.25,
+		},
+		{
+			description: "it should respect the lower bound",
+			config:      AdaptiveWeights{MinFactor: 0.5, MaxFactor: 2, Smoothing: 1},
+			results: []result{
+				{target: "server1.example.com.", err: errors.New("generic error")},
+			},
+			target:         "server1.example.com.",
+			expectedFactor: 0.5,
+		},
+		{
+			description: "it should compare the latency with the target latency",
+			config:      AdaptiveWeights{MinFactor: 0.1, MaxFactor: 2, TargetLatency: 100 * time.Millisecond},
+			results: []result{
+				{target: "server1.example.com.", latency: 400 * time.Millisecond},
+			},
+			target:         "server1.example.com.",
+			expectedFactor: 0.25,
+		},
+		{
+			description: "it should compare the latency with the average latency",
+			config:      AdaptiveWeights{MinFactor: 0.1, MaxFactor: 1.5},
+			results: []result{
+				{target: "server1.example.com.", latency: 100 * time.Millisecond},
+				{target: "server2.example.com.", latency: 500 * time.Millisecond},
+			},
+			target:         "server1.example.com.",
+			expectedFactor: 1.5,
+		},
+		{
+			description: "it should converge back when the server recovers",
+			config:      AdaptiveWeights{MinFactor: 0.1, MaxFactor: 2, Smoothing: 0.5},
+			results: func() []result {
+				results := []result{
+					{target: "server1.example.com.", latency: time.Second, err: errors.New("generic error")},
+				}
+				for i := 0; i < 20; i++ {
+					results = append(results, result{target: "server1.example.com.", latency: time.Second})
+				}
+				return results
+			}(),
+			target:         "server1.example.com.",
+			expectedFactor: 1,
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			d := buildDiscovery("", "", "")
+			d.SetAdaptiveWeights(item.config)
+
+			for _, result := range item.results {
+				d.ReportResult(result.target, 1111, result.latency, result.err)
+			}
+
+			if factor := d.weightFactor(item.target, 1111); math.Abs(factor-item.expectedFactor) > 0.001 {
+				t.Errorf("mismatch factor. Expecting: “%f”; found “%f”", item.expectedFactor, factor)
+			}
+		})
+	}
+}
+
+func TestApplyWeightFactor(t *testing.T) {
+	t.Parallel()
+
+	d := buildDiscovery("", "", "")
+	d.SetAdaptiveWeights(AdaptiveWeights{MinFactor: 0.1, MaxFactor: 2, Smoothing: 1})
+	d.ReportResult("server1.example.com.", 1111, 0, errors.New("generic error"))
+
+	loadBalancer, ok := d.loadBalancer.(*defaultLoadBalancer)
+	if !ok {
+		t.Fatalf("unexpected load balancer type %T", d.loadBalancer)
+	}
+
+	if loadBalancer.weightFactor == nil {
+		t.Fatal("weight factor not shared with the load balancer")
+	}
+
+	servers := []defaultLoadBalancerServer{
+		{SRV: net.SRV{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 30}},
+		{SRV: net.SRV{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10}},
+	}
+	weights := []int{30, 10}
+
+	applyWeightFactor(servers, weights, loadBalancer.weightFactor)
+
+	if weights[0] != 300 || weights[1] != 1000 {
+		t.Errorf("mismatch weights. Expecting: “[300 1000]”; found “%v”", weights)
+	}
+}
@@ -0,0 +1,121 @@
+package dnsdisco
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// adminMaxBodySize limits the body of the admin requests, so a misbehaving
+// client can't exhaust the memory.
+const adminMaxBodySize = 1 << 20
+
+// AdminHandler returns an http.Handler that allows the operators to control
+// the discovery at runtime. Only the POST method is accepted, and the paths
+// are relative to the handler (see http.StripPrefix):
+//
+//	/refresh        forces a refresh (see ForceRefresh)
+//	/drain          drains the server of the target and port query parameters
+//	/undrain        undrains the server of the target and port query parameters
+//	/weights        replaces the weights with the JSON object of the body
+//	                (e.g. {"server1.example.com:1111": 20}, up to 1 MiB),
+//	                refreshing the servers (see SetWeightOverride)
+//	/flush-health   checks all servers again (see FlushHealth)
+//
+// The successful operations answer with 204 (No Content), and the operations
+// not supported by the discovery (see the Refresher, Drainer,
+// BalancingConfigurer and HealthManager interfaces) with 501 (Not
+// Implemented). The auth middleware wraps all operations, and must reject the
+// requests of unauthorized users. As the handler changes the discovery, a nil
+// auth rejects all requests.
+func AdminHandler(discovery Discovery, auth func(http.Handler) http.Handler) http.Handler {
+	if auth == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+
+	mux := http.NewServeMux()
+
+	refresher, refreshable := discovery.(Refresher)
+	mux.HandleFunc("/refresh", adminSupported(refreshable, func(w http.ResponseWriter, r *http.Request) {
+		if err := refresher.ForceRefresh(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	if drainer, ok := discovery.(Drainer); ok {
+		mux.HandleFunc("/drain", adminServerHandler(drainer.Drain))
+		mux.HandleFunc("/undrain", adminServerHandler(drainer.Undrain))
+	} else {
+		mux.HandleFunc("/drain", adminSupported(false, nil))
+		mux.HandleFunc("/undrain", adminSupported(false, nil))
+	}
+
+	configurer, configurable := discovery.(BalancingConfigurer)
+	mux.HandleFunc("/weights", adminSupported(configurable, func(w http.ResponseWriter, r *http.Request) {
+		var weights map[string]uint16
+		body := http.MaxBytesReader(w, r.Body, adminMaxBodySize)
+		if err := json.NewDecoder(body).Decode(&weights); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		configurer.SetWeightOverride(weights)
+		if err := discovery.Refresh(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	healthManager, manageable := discovery.(HealthManager)
+	mux.HandleFunc("/flush-health", adminSupported(manageable, func(w http.ResponseWriter, r *http.Request) {
+		healthManager.FlushHealth()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	return auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+// adminSupported returns the handler of the operation, or a handler that
+// answers with 501 (Not Implemented) when the discovery doesn't support it.
+func adminSupported(supported bool, handler http.HandlerFunc) http.HandlerFunc {
+	if supported {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+	}
+}
+
+// adminServerHandler runs the operation for the server identified by the
+// target and port query parameters.
+func adminServerHandler(operation func(target string, port uint16)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "missing target", http.StatusBadRequest)
+			return
+		}
+
+		port, err := strconv.ParseUint(r.URL.Query().Get("port"), 10, 16)
+		if err != nil {
+			http.Error(w, "invalid port", http.StatusBadRequest)
+			return
+		}
+
+		operation(target, uint16(port))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,214 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestAdminHandler(t *testing.T) {
+	t.Parallel()
+
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	server := func(discovery dnsdisco.Discovery) dnsdisco.Server {
+		for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+			if server.Target == "server1.example.com." {
+				return server
+			}
+		}
+		return dnsdisco.Server{}
+	}
+
+	scenarios := []struct {
+		description    string
+		auth           func(http.Handler) http.Handler
+		token          string
+		method         string
+		path           string
+		body           string
+		setup          func(dnsdisco.Discovery)
+		expectedStatus int
+		check          func(*testing.T, dnsdisco.Discovery)
+	}{
+		{
+			description:    "it should reject all requests without auth",
+			token:          "secret",
+			method:         http.MethodPost,
+			path:           "/refresh",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:    "it should reject unauthorized users",
+			auth:           auth,
+			method:         http.MethodPost,
+			path:           "/refresh",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			description:    "it should refuse other methods",
+			auth:           auth,
+			token:          "secret",
+			method:         http.MethodGet,
+			path:           "/refresh",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			description:    "it should force a refresh",
+			auth:           auth,
+			token:          "secret",
+			method:         http.MethodPost,
+			path:           "/refresh",
+			expectedStatus: http.StatusNoContent,
+			check: func(t *testing.T, discovery dnsdisco.Discovery) {
+				if len(discovery.(dnsdisco.Inspector).Servers()) != 2 {
+					t.Errorf("mismatch number of servers. Expecting: “2”; found “%d”", len(discovery.(dnsdisco.Inspector).Servers()))
+				}
+			},
+		},
+		{
+			description:    "it should drain a server",
+			auth:           auth,
+			token:          "secret",
+			method:         http.MethodPost,
+			path:           "/drain?target=SERVER1.example.com&port=1111",
+			setup:          func(discovery dnsdisco.Discovery) { discovery.Refresh() },
+			expectedStatus: http.StatusNoContent,
+			check: func(t *testing.T, discovery dnsdisco.Discovery) {
+				if status := server(discovery).HealthStatus; status != dnsdisco.HealthStatusDraining {
+					t.Errorf("mismatch health status. Expecting: “draining”; found “%s”", status)
+				}
+
+				// the server keeps draining after the next refresh
+				discovery.Refresh()
+				if status := server(discovery).HealthStatus; status != dnsdisco.HealthStatusDraining {
+					t.Errorf("mismatch health status after refresh. Expecting: “draining”; found “%s”", status)
+				}
+			},
+		},
+		{
+			description: "it should undrain a server",
+			auth:        auth,
+			token:       "secret",
+			method:      http.MethodPost,
+			path:        "/undrain?target=server1.example.com.&port=1111",
+			setup: func(discovery dnsdisco.Discovery) {
+				discovery.Refresh()
+				discovery.(dnsdisco.Drainer).Drain("server1.example.com.", 1111)
+			},
+			expectedStatus: http.StatusNoContent,
+			check: func(t *testing.T, discovery dnsdisco.Discovery) {
+				if status := server(discovery).HealthStatus; status != dnsdisco.HealthStatusHealthy {
+					t.Errorf("mismatch health status. Expecting: “healthy”; found “%s”", status)
+				}
+			},
+		},
+		{
+			description:    "it should reject an invalid server",
+			auth:           auth,
+			token:          "secret",
+			method:         http.MethodPost,
+			path:           "/drain?target=server1.example.com.",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			description:    "it should override the weights",
+			auth:           auth,
+			token:          "secret",
+			method:         http.MethodPost,
+			path:           "/weights",
+			body:           `{"server1.example.com:1111": 50}`,
+			expectedStatus: http.StatusNoContent,
+			check: func(t *testing.T, discovery dnsdisco.Discovery) {
+				if weight := server(discovery).Weight; weight != 50 {
+					t.Errorf("mismatch weight. Expecting: “50”; found “%d”", weight)
+				}
+			},
+		},
+		{
+			description:    "it should reject invalid weights",
+			auth:           auth,
+			token:          "secret",
+			method:         http.MethodPost,
+			path:           "/weights",
+			body:           `{"server1.example.com:1111": "high"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			description:    "it should reject large weights bodies",
+			auth:           auth,
+			token:          "secret",
+			method:         http.MethodPost,
+			path:           "/weights",
+			body:           strings.Repeat(" ", 1<<20) + `{"server1.example.com:1111": 50}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			description: "it should flush the health status",
+			auth:        auth,
+			token:       "secret",
+			method:      http.MethodPost,
+			path:        "/flush-health",
+			setup: func(discovery dnsdisco.Discovery) {
+				discovery.Refresh()
+				discovery.(dnsdisco.HealthManager).MarkUnhealthy("server1.example.com.", 1111)
+			},
+			expectedStatus: http.StatusNoContent,
+			check: func(t *testing.T, discovery dnsdisco.Discovery) {
+				if !server(discovery).Healthy {
+					t.Error("the server should be healthy after the health checks")
+				}
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+					{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+
+			if scenario.setup != nil {
+				scenario.setup(discovery)
+			}
+
+			r := httptest.NewRequest(scenario.method, scenario.path, strings.NewReader(scenario.body))
+			if scenario.token != "" {
+				r.Header.Set("Authorization", "Bearer "+scenario.token)
+			}
+
+			w := httptest.NewRecorder()
+			dnsdisco.AdminHandler(discovery, scenario.auth).ServeHTTP(w, r)
+
+			if w.Code != scenario.expectedStatus {
+				t.Fatalf("mismatch status. Expecting: “%d”; found “%d” (%s)", scenario.expectedStatus, w.Code, w.Body)
+			}
+
+			if scenario.check != nil {
+				scenario.check(t, discovery)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package dnsdisco
+
+import (
+	"math"
+	"net"
+	"time"
+)
+
+// SelectionLimit limits how many times per second each target can be chosen,
+// with a token bucket per target.
+type SelectionLimit struct {
+	// Rate is the maximum number of selections per second of each target. Zero
+	// means no limit.
+	Rate float64
+
+	// Burst is the number of selections that a target can receive at once,
+	// the size of its bucket. If zero the rate rounded up is used, at least
+	// one selection.
+	Burst int
+
+	// Targets defines the rates of specific servers, identified by the target
+	// (e.g. "server1.example.com") or by the target and port (e.g.
+	// "server1.example.com:1111"), that has precedence. A zero rate removes
+	// the limit of the server.
+	Targets map[string]float64
+}
+
+// FilteredLoadBalancer is an optional interface that a LoadBalancer can
+// implement to skip the targets without available selections (see
+// SetSelectionLimit), so a single choice is made with its own algorithm. The
+// default, canary and epoch load balancers implement it.
+type FilteredLoadBalancer interface {
+	// LoadBalanceWhere works like LoadBalance, but only the servers accepted
+	// by the filter can be chosen.
+	LoadBalanceWhere(accept func(target string, port uint16) bool) (target string, port uint16)
+}
+
+// tokenBucket stores the selections available for a target.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// SetSelectionLimit limits the selections per second of each target in Choose
+// and ChooseWhere, protecting small servers (e.g. low weight backups) from
+// bursts when the primaries fail. The targets without available selections
+// are skipped by the load balancer when it implements the
+// FilteredLoadBalancer interface. Otherwise, when the load balancer chooses a
+// target without available selections, it is replaced by one of the targets
+// with available selections using the RFC 2782 algorithm, respecting the
+// selection policy (see SetPolicy). If no target has selections available an
+// empty target and a zero port are returned. A zero limit removes it
+// (default). It is go routine safe.
+func (d *discovery) SetSelectionLimit(limit SelectionLimit) {
+	targets := make(map[string]float64, len(limit.Targets))
+	for key, rate := range limit.Targets {
+		targets[priorityOverrideKey(key)] = rate
+	}
+	limit.Targets = targets
+
+	d.selectionLimitLock.Lock()
+	defer d.selectionLimitLock.Unlock()
+	d.selectionLimit = limit
+	d.selectionBuckets = make(map[string]*tokenBucket)
+}
+
+// admit consumes a selection of the target, returning false when there's no
+// selection available.
+func (d *discovery) admit(target string, port uint16) bool {
+	if target == "" && port == 0 {
+		return true
+	}
+
+	now := d.currentClock().Now()
+
+	d.selectionLimitLock.Lock()
+	defer d.selectionLimitLock.Unlock()
+
+	bucket := d.selectionBucket(target, port, now)
+	if bucket == nil {
+		return true
+	}
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// admissible checks if the server has a selection available, without
+// consuming it.
+func (d *discovery) admissible(server Server) bool {
+	now := d.currentClock().Now()
+
+	d.selectionLimitLock.Lock()
+	defer d.selectionLimitLock.Unlock()
+
+	bucket := d.selectionBucket(server.Target, server.Port, now)
+	return bucket == nil || bucket.tokens >= 1
+}
+
+// loadBalanceWhere chooses with the load balancer one of the targets accepted
+// by the filter, that only receives the target and the port, without recording
+// the choice. The caller must hold the servers read lock and the choice lock.
+func (d *discovery) loadBalanceWhere(filter func(Server) bool) (target string, port uint16) {
+	accept := func(target string, port uint16) bool {
+		return filter(Server{SRV: net.SRV{Target: target, Port: port}})
+	}
+
+	d.loadBalancerLock.RLock()
+	_, filtered := d.loadBalancer.(FilteredLoadBalancer)
+	if filtered {
+		target, port = d.loadBalance(accept)
+	} else {
+		target, port = d.loadBalance(nil)
+	}
+	d.loadBalancerLock.RUnlock()
+
+	if filtered || (target == "" && port == 0) || accept(target, port) {
+		return target, port
+	}
+
+	// the load balancer can't skip the rejected target, so it is replaced
+	// considering the same servers given to the load balancer: the selection
+	// policy falls back to all servers only when no server with the label can
+	// be chosen
+	var labelFilter func(Server) bool
+	if d.preferredLabel != "" {
+		labeled := func(server Server) bool {
+			return hasLabel(server, d.preferredLabel)
+		}
+		if len(chooseable(d.servers, labeled)) > 0 {
+			labelFilter = labeled
+		}
+	}
+	return d.chooseFiltered(admissibleFilter(labelFilter, filter))
+}
+
+// limitedSelections checks if the selections are limited.
+func (d *discovery) limitedSelections() bool {
+	d.selectionLimitLock.Lock()
+	defer d.selectionLimitLock.Unlock()
+	return d.selectionLimit.Rate > 0 || len(d.selectionLimit.Targets) > 0
+}
+
+// selectionRefill returns the time until one of the healthy servers has a
+// selection available again. False is returned when any healthy server isn't
+// blocked by the selection limits, or there's no healthy server.
+func (d *discovery) selectionRefill(now time.Time) (time.Duration, bool) {
+	if !d.limitedSelections() {
+		return 0, false
+	}
+	servers := chooseable(d.Servers(), nil)
+
+	d.selectionLimitLock.Lock()
+	defer d.selectionLimitLock.Unlock()
+
+	var refill time.Duration
+	for i, server := range servers {
+		bucket := d.selectionBucket(server.Target, server.Port, now)
+		if bucket == nil || bucket.tokens >= 1 {
+			return 0, false
+		}
+
+		wait := time.Duration((1 - bucket.tokens) / d.selectionRate(server.Target, server.Port) * float64(time.Second))
+		if i == 0 || wait < refill {
+			refill = wait
+		}
+	}
+	return refill, len(servers) > 0
+}
+
+// selectionRate returns the selections per second of the target, zero when it
+// isn't limited. The caller must hold the selection limit lock.
+func (d *discovery) selectionRate(target string, port uint16) float64 {
+	rate, ok := d.selectionLimit.Targets[drainKey(target, port)]
+	if !ok {
+		rate, ok = d.selectionLimit.Targets[canonicalKey(target)]
+	}
+	if !ok {
+		rate = d.selectionLimit.Rate
+	}
+	return rate
+}
+
+// selectionBucket returns the bucket of the target refilled until now, or nil
+// if the target isn't limited. The caller must hold the selection limit lock.
+func (d *discovery) selectionBucket(target string, port uint16, now time.Time) *tokenBucket {
+	key := drainKey(target, port)
+
+	rate := d.selectionRate(target, port)
+	if rate <= 0 {
+		return nil
+	}
+
+	burst := float64(d.selectionLimit.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(rate))
+	}
+
+	bucket, found := d.selectionBuckets[key]
+	if !found {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		d.selectionBuckets[key] = bucket
+	}
+
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(burst, bucket.tokens+elapsed.Seconds()*rate)
+		bucket.last = now
+	}
+	return bucket
+}
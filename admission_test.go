@@ -0,0 +1,220 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/soaktest"
+)
+
+func TestSetSelectionLimit(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		limit           dnsdisco.SelectionLimit
+		primaryHealthy  bool
+		advance         time.Duration
+		expectedTargets []string
+	}{
+		{
+			description:    "it should not limit the selections by default",
+			primaryHealthy: false,
+			expectedTargets: []string{
+				"backup.example.com.",
+				"backup.example.com.",
+				"backup.example.com.",
+				"backup.example.com.",
+			},
+		},
+		{
+			description: "it should skip the target without selections",
+			limit: dnsdisco.SelectionLimit{
+				Targets: map[string]float64{"backup.example.com": 2},
+			},
+			primaryHealthy: false,
+			expectedTargets: []string{
+				"backup.example.com.",
+				"backup.example.com.",
+				"",
+				"",
+			},
+		},
+		{
+			description: "it should refill the selections",
+			limit: dnsdisco.SelectionLimit{
+				Targets: map[string]float64{"backup.example.com:2222": 2},
+			},
+			primaryHealthy: false,
+			advance:        time.Second,
+			expectedTargets: []string{
+				"backup.example.com.",
+				"backup.example.com.",
+				"backup.example.com.",
+				"backup.example.com.",
+			},
+		},
+		{
+			description: "it should choose another target when the best one is limited",
+			limit: dnsdisco.SelectionLimit{
+				Rate:    10,
+				Targets: map[string]float64{"primary.example.com": 1},
+			},
+			primaryHealthy: true,
+			expectedTargets: []string{
+				"primary.example.com.",
+				"backup.example.com.",
+				"backup.example.com.",
+				"backup.example.com.",
+			},
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			clock := soaktest.NewFakeClock(time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC))
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.(dnsdisco.Scheduler).SetClock(clock)
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "primary.example.com.", Port: 1111, Priority: 10, Weight: 100},
+					{Target: "backup.example.com.", Port: 2222, Priority: 20, Weight: 1},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return target != "primary.example.com." || item.primaryHealthy, nil
+			}))
+			discovery.(dnsdisco.BalancingConfigurer).SetSelectionLimit(item.limit)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var targets []string
+			for i := 0; i < len(item.expectedTargets); i++ {
+				if i == len(item.expectedTargets)/2 {
+					clock.Advance(item.advance)
+				}
+
+				target, _ := discovery.Choose()
+				targets = append(targets, target)
+			}
+
+			if !reflect.DeepEqual(targets, item.expectedTargets) {
+				t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", item.expectedTargets, targets)
+			}
+		})
+	}
+}
+
+func TestSetSelectionLimitLoadBalancer(t *testing.T) {
+	t.Parallel()
+
+	clock := soaktest.NewFakeClock(time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC))
+	loadBalancer := dnsdisco.NewCanaryLoadBalancer(100, dnsdisco.CanaryTargetPattern("canary*.example.com."))
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.(dnsdisco.Scheduler).SetClock(clock)
+	discovery.SetLoadBalancer(loadBalancer)
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "canary1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			{Target: "canary2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+			{Target: "stable.example.com.", Port: 3333, Priority: 10, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}))
+	discovery.(dnsdisco.BalancingConfigurer).SetSelectionLimit(dnsdisco.SelectionLimit{
+		Targets: map[string]float64{"canary1.example.com": 1},
+	})
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if target, _ := discovery.Choose(); target == "stable.example.com." {
+			t.Errorf("unexpected stable target chosen in choice %d", i)
+		}
+	}
+
+	// each choice is a single decision of the load balancer
+	expectedStats := dnsdisco.CanaryStats{Canary: 4}
+	if stats := loadBalancer.Stats(); stats != expectedStats {
+		t.Errorf("mismatch load balancer stats. Expecting: “%+v”; found “%+v”", expectedStats, stats)
+	}
+}
+
+func TestSetSelectionLimitPolicy(t *testing.T) {
+	t.Parallel()
+
+	clock := soaktest.NewFakeClock(time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.(dnsdisco.Scheduler).SetClock(clock)
+	discovery.SetLoadBalancer(&firstLoadBalancer{})
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "a.green.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			{Target: "b.blue.example.com.", Port: 2222, Priority: 20, Weight: 10},
+			{Target: "c.green.example.com.", Port: 3333, Priority: 20, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}))
+	discovery.(dnsdisco.BalancingConfigurer).SetPolicy(dnsdisco.TXTRetrieverFunc(func(name string) ([]string, error) {
+		return []string{"v=disco1; prefer=green"}, nil
+	}), nil)
+	discovery.(dnsdisco.BalancingConfigurer).SetSelectionLimit(dnsdisco.SelectionLimit{
+		Targets: map[string]float64{"a.green.example.com": 1},
+	})
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var targets []string
+	for i := 0; i < 4; i++ {
+		target, _ := discovery.Choose()
+		targets = append(targets, target)
+	}
+
+	expectedTargets := []string{
+		"a.green.example.com.",
+		"c.green.example.com.",
+		"c.green.example.com.",
+		"c.green.example.com.",
+	}
+
+	if !reflect.DeepEqual(targets, expectedTargets) {
+		t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", expectedTargets, targets)
+	}
+}
+
+// firstLoadBalancer always chooses the first server, and can't skip the
+// servers without available selections.
+type firstLoadBalancer struct {
+	servers []*net.SRV
+}
+
+func (f *firstLoadBalancer) ChangeServers(servers []*net.SRV) {
+	f.servers = servers
+}
+
+func (f *firstLoadBalancer) LoadBalance() (target string, port uint16) {
+	if len(f.servers) == 0 {
+		return "", 0
+	}
+	return f.servers[0].Target, f.servers[0].Port
+}
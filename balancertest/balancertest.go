@@ -0,0 +1,255 @@
+// Package balancertest helps the authors of custom load balancers to validate
+// their fairness. It runs a load balancer against a synthetic set of servers
+// and compares the selection distribution with the expected one using the
+// chi-square goodness of fit test. It also simulates the server churn, health
+// flaps and concurrent choices of a real deployment (SimulateChurn), reporting
+// the throughput and the fairness, to compare the load balancers (see
+// BenchmarkChurn).
+package balancertest
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+// Result stores the selections made by a load balancer in a simulation.
+type Result struct {
+	// Iterations is the number of times that the load balancer was called.
+	Iterations int
+
+	// Selections is the number of times that each server was selected, indexed
+	// by the server key (see Key).
+	Selections map[string]int
+
+	// Empty is the number of times that no server was selected.
+	Empty int
+}
+
+// Key identifies the server in the selections and expected distributions.
+func Key(target string, port uint16) string {
+	return net.JoinHostPort(target, strconv.FormatUint(uint64(port), 10))
+}
+
+// Simulate sends the servers to the load balancer (ChangeServers) and selects
+// a server the given number of iterations, returning the selection
+// distribution. The servers must be already sorted by priority, as the
+// discovery does before calling the load balancer.
+func Simulate(balancer dnsdisco.LoadBalancer, servers []*net.SRV, iterations int) Result {
+	balancer.ChangeServers(servers)
+
+	result := Result{
+		Iterations: iterations,
+		Selections: make(map[string]int),
+	}
+
+	for i := 0; i < iterations; i++ {
+		target, port := balancer.LoadBalance()
+		if target == "" && port == 0 {
+			result.Empty++
+			continue
+		}
+		result.Selections[Key(target, port)]++
+	}
+
+	return result
+}
+
+// ExpectedUniform returns a distribution where all servers have the same
+// chance, as the default load balancer does over time, choosing the least used
+// servers first.
+func ExpectedUniform(servers []*net.SRV) map[string]float64 {
+	expected := make(map[string]float64)
+	for _, server := range servers {
+		expected[Key(server.Target, server.Port)] = 1 / float64(len(servers))
+	}
+	return expected
+}
+
+// ExpectedByWeight returns a distribution where only the servers of the best
+// priority are selected, proportionally to their weights, as described in RFC
+// 2782.
+func ExpectedByWeight(servers []*net.SRV) map[string]float64 {
+	expected := make(map[string]float64)
+	if len(servers) == 0 {
+		return expected
+	}
+
+	priority := servers[0].Priority
+	for _, server := range servers {
+		if server.Priority < priority {
+			priority = server.Priority
+		}
+	}
+
+	var totalWeight float64
+	for _, server := range servers {
+		if server.Priority == priority {
+			totalWeight += float64(server.Weight)
+		}
+	}
+
+	for _, server := range servers {
+		key := Key(server.Target, server.Port)
+		if server.Priority != priority {
+			expected[key] = 0
+		} else if totalWeight == 0 {
+			expected[key] = 1
+		} else {
+			expected[key] = float64(server.Weight)
+		}
+	}
+
+	// normalize the proportions, also covering the groups with all weights zero
+	var sum float64
+	for _, proportion := range expected {
+		sum += proportion
+	}
+	for key := range expected {
+		expected[key] /= sum
+	}
+	return expected
+}
+
+// ChiSquare returns the chi-square statistic and the p-value of the selections
+// compared with the expected proportions (that must sum 1). The p-value is the
+// probability of a distribution at least as different as the observed one
+// happening by chance, so a small p-value means that the load balancer isn't
+// following the expected distribution. Servers selected but not expected, or
+// expected with a zero proportion, result in an infinite statistic and a zero
+// p-value.
+func (r Result) ChiSquare(expected map[string]float64) (statistic, pValue float64) {
+	selected := r.Iterations - r.Empty
+	categories := 0
+
+	for key, proportion := range expected {
+		observed := float64(r.Selections[key])
+		if proportion <= 0 {
+			if observed > 0 {
+				return math.Inf(1), 0
+			}
+			continue
+		}
+
+		expectedSelections := proportion * float64(selected)
+		statistic += (observed - expectedSelections) * (observed - expectedSelections) / expectedSelections
+		categories++
+	}
+
+	for key := range r.Selections {
+		if _, ok := expected[key]; !ok {
+			return math.Inf(1), 0
+		}
+	}
+
+	if categories < 2 {
+		return statistic, 1
+	}
+
+	return statistic, chiSquareSurvival(statistic, float64(categories-1))
+}
+
+// Check compares the selections with the expected proportions, returning an
+// error that describes the distribution when the p-value of the chi-square
+// test is below the significance level (e.g. 0.001). Smaller significance
+// levels reduce the false alarms of randomized load balancers.
+func (r Result) Check(expected map[string]float64, significance float64) error {
+	statistic, pValue := r.ChiSquare(expected)
+	if pValue >= significance {
+		return nil
+	}
+
+	var keys []string
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	description := ""
+	for _, key := range keys {
+		description += fmt.Sprintf("; %s selected %d time(s), expected %.1f", key, r.Selections[key],
+			expected[key]*float64(r.Iterations-r.Empty))
+	}
+
+	return fmt.Errorf("balancertest: unexpected distribution (chi-square %.2f, p-value %g < %g)%s",
+		statistic, pValue, significance, description)
+}
+
+// AssertDistribution simulates the load balancer and reports a test error when
+// the selection distribution doesn't match the expected proportions, with the
+// given significance level (see Result.Check).
+func AssertDistribution(t testing.TB, balancer dnsdisco.LoadBalancer, servers []*net.SRV, iterations int,
+	expected map[string]float64, significance float64) {
+
+	t.Helper()
+
+	if err := Simulate(balancer, servers, iterations).Check(expected, significance); err != nil {
+		t.Error(err)
+	}
+}
+
+// chiSquareSurvival returns the probability of a chi-square distribution with
+// the degrees of freedom being greater than x, that is the regularized upper
+// incomplete gamma function Q(k/2, x/2).
+func chiSquareSurvival(x, degreesOfFreedom float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	return upperIncompleteGamma(degreesOfFreedom/2, x/2)
+}
+
+// upperIncompleteGamma computes the regularized upper incomplete gamma
+// function Q(a, x), using the series expansion when x < a+1 and the continued
+// fraction otherwise (Numerical Recipes, section 6.2).
+func upperIncompleteGamma(a, x float64) float64 {
+	const (
+		maxIterations = 1000
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1; n < maxIterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*epsilon {
+				break
+			}
+		}
+		return 1 - sum*prefix
+	}
+
+	// modified Lentz's method
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < maxIterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return prefix * h
+}
@@ -0,0 +1,289 @@
+package balancertest_test
+
+import (
+	"math"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/balancertest"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	servers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 30},
+		{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+		{Target: "server3.example.com.", Port: 3333, Priority: 20, Weight: 10},
+	}
+
+	scenarios := []struct {
+		description string
+		balancer    dnsdisco.LoadBalancer
+		expected    map[string]float64
+		expectError bool
+	}{
+		{
+			description: "it should accept the default load balancer distribution",
+			balancer:    dnsdisco.NewDefaultLoadBalancer(),
+			expected:    balancertest.ExpectedUniform(servers),
+		},
+		{
+			description: "it should accept a weighted load balancer distribution",
+			balancer:    &weightedLoadBalancer{},
+			expected:    balancertest.ExpectedByWeight(servers),
+		},
+		{
+			description: "it should detect a biased load balancer",
+			balancer:    &firstLoadBalancer{},
+			expected:    balancertest.ExpectedUniform(servers),
+			expectError: true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			err := balancertest.Simulate(scenario.balancer, servers, 10000).Check(scenario.expected, 0.0001)
+
+			if scenario.expectError && err == nil {
+				t.Error("expected an error for a biased distribution")
+			} else if !scenario.expectError && err != nil {
+				t.Errorf("unexpected error “%v”", err)
+			}
+		})
+	}
+}
+
+func TestChiSquare(t *testing.T) {
+	t.Parallel()
+
+	// known value: chi-square 4 with 1 degree of freedom has p-value 0.0455
+	result := balancertest.Result{
+		Iterations: 100,
+		Selections: map[string]int{"a:1": 40, "b:2": 60},
+	}
+
+	statistic, pValue := result.ChiSquare(map[string]float64{"a:1": 0.5, "b:2": 0.5})
+	if statistic != 4 {
+		t.Errorf("mismatch statistics. Expecting: “4”; found “%g”", statistic)
+	}
+
+	if math.Abs(pValue-0.0455) > 0.0001 {
+		t.Errorf("mismatch p-values. Expecting: “0.0455”; found “%g”", pValue)
+	}
+}
+
+// weightedLoadBalancer selects the servers of the best priority proportionally
+// to their weights.
+type weightedLoadBalancer struct {
+	servers []*net.SRV
+	next    int
+}
+
+func (w *weightedLoadBalancer) ChangeServers(servers []*net.SRV) {
+	w.servers = servers
+}
+
+func (w *weightedLoadBalancer) LoadBalance() (string, uint16) {
+	// deterministic round robin over the weight units of the best priority
+	var units []*net.SRV
+	for _, server := range w.servers {
+		if server.Priority == w.servers[0].Priority {
+			for i := 0; i < int(server.Weight); i++ {
+				units = append(units, server)
+			}
+		}
+	}
+
+	server := units[w.next%len(units)]
+	w.next++
+	return server.Target, server.Port
+}
+
+// firstLoadBalancer always selects the first server.
+type firstLoadBalancer struct {
+	servers []*net.SRV
+}
+
+func (f *firstLoadBalancer) ChangeServers(servers []*net.SRV) {
+	f.servers = servers
+}
+
+func (f *firstLoadBalancer) LoadBalance() (string, uint16) {
+	return f.servers[0].Target, f.servers[0].Port
+}
+
+// lowestLoadBalancer always selects the server with the lowest target, no
+// matter the order of the servers.
+type lowestLoadBalancer struct {
+	servers []*net.SRV
+}
+
+func (l *lowestLoadBalancer) ChangeServers(servers []*net.SRV) {
+	l.servers = servers
+}
+
+func (l *lowestLoadBalancer) LoadBalance() (string, uint16) {
+	if len(l.servers) == 0 {
+		return "", 0
+	}
+
+	lowest := l.servers[0]
+	for _, server := range l.servers[1:] {
+		if server.Target < lowest.Target {
+			lowest = server
+		}
+	}
+	return lowest.Target, lowest.Port
+}
+
+// churnServers is the pool of servers of the churn simulations.
+var churnServers = []*net.SRV{
+	{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+	{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+	{Target: "server3.example.com.", Port: 3333, Priority: 10, Weight: 10},
+	{Target: "server4.example.com.", Port: 4444, Priority: 10, Weight: 10},
+}
+
+func TestSimulateChurn(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		balancer        dnsdisco.LoadBalancer
+		minimumFairness float64
+		maximumFairness float64
+	}{
+		{
+			description:     "it should detect a fair load balancer",
+			balancer:        dnsdisco.NewDefaultLoadBalancer(),
+			minimumFairness: 0.9,
+			maximumFairness: 1,
+		},
+		{
+			description:     "it should detect an unfair load balancer",
+			balancer:        new(lowestLoadBalancer),
+			maximumFairness: 0.6,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			result := balancertest.SimulateChurn(scenario.balancer, balancertest.ChurnConfig{
+				Servers:           churnServers,
+				Iterations:        4000,
+				Concurrency:       4,
+				RefreshEvery:      100,
+				RemoveProbability: 0.1,
+				FlapProbability:   0.1,
+				Seed:              42,
+			})
+
+			if result.Iterations != 4000 {
+				t.Errorf("mismatch iterations. Expecting: “4000”; found “%d”", result.Iterations)
+			}
+
+			selected := result.Empty
+			for _, count := range result.Selections {
+				selected += count
+			}
+
+			if selected != result.Iterations {
+				t.Errorf("mismatch selections. Expecting: “%d”; found “%d”", result.Iterations, selected)
+			}
+
+			if result.Refreshes != 41 {
+				t.Errorf("mismatch refreshes. Expecting: “41”; found “%d”", result.Refreshes)
+			}
+
+			fairness := result.Fairness(balancertest.ExpectedUniform(churnServers))
+			if fairness < scenario.minimumFairness || fairness > scenario.maximumFairness {
+				t.Errorf("mismatch fairness. Expecting: “%.2f-%.2f”; found “%.2f”", scenario.minimumFairness, scenario.maximumFairness, fairness)
+			}
+		})
+	}
+}
+
+func TestFairness(t *testing.T) {
+	t.Parallel()
+
+	expected := map[string]float64{"a": 0.5, "b": 0.25, "c": 0.25, "d": 0}
+
+	scenarios := []struct {
+		description      string
+		selections       map[string]int
+		expectedFairness float64
+	}{
+		{
+			description:      "it should be fair when following the proportions",
+			selections:       map[string]int{"a": 200, "b": 100, "c": 100},
+			expectedFairness: 1,
+		},
+		{
+			description:      "it should be unfair when only one server is selected",
+			selections:       map[string]int{"a": 400},
+			expectedFairness: 1.0 / 3,
+		},
+		{
+			description: "it should be zero without selections",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			result := balancertest.Result{Selections: scenario.selections}
+			if fairness := result.Fairness(expected); math.Abs(fairness-scenario.expectedFairness) > 1e-9 {
+				t.Errorf("mismatch fairness. Expecting: “%f”; found “%f”", scenario.expectedFairness, fairness)
+			}
+		})
+	}
+}
+
+// BenchmarkChurn compares the provided load balancers while the servers change
+// and are chosen concurrently. Run it with:
+//
+//	go test -bench Churn ./balancertest
+func BenchmarkChurn(b *testing.B) {
+	balancers := []struct {
+		name     string
+		balancer func() dnsdisco.LoadBalancer
+	}{
+		{
+			name:     "default",
+			balancer: dnsdisco.NewDefaultLoadBalancer,
+		},
+		{
+			name: "canary",
+			balancer: func() dnsdisco.LoadBalancer {
+				return dnsdisco.NewCanaryLoadBalancer(0.25, func(server *net.SRV) bool {
+					return strings.HasPrefix(server.Target, "server1.")
+				})
+			},
+		},
+	}
+
+	for _, item := range balancers {
+		item := item
+		b.Run(item.name, func(b *testing.B) {
+			result := balancertest.SimulateChurn(item.balancer(), balancertest.ChurnConfig{
+				Servers:           churnServers,
+				Iterations:        b.N,
+				Concurrency:       4,
+				RefreshEvery:      1000,
+				RemoveProbability: 0.1,
+				FlapProbability:   0.1,
+			})
+
+			b.ReportMetric(result.Fairness(balancertest.ExpectedUniform(churnServers)), "fairness")
+			b.ReportMetric(float64(result.Empty)/float64(b.N), "empty/op")
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package balancertest
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+// ChurnConfig defines a simulation where the servers change while the load
+// balancer is used concurrently, as in a real deployment.
+type ChurnConfig struct {
+	// Servers is the pool of servers published in the DNS. They must be already
+	// sorted by priority.
+	Servers []*net.SRV
+
+	// Iterations is the number of choices of the simulation.
+	Iterations int
+
+	// Concurrency is the number of go routines choosing servers at the same
+	// time. If zero only one is used.
+	Concurrency int
+
+	// RefreshEvery is the number of choices between the refreshes. If zero the
+	// servers are only retrieved once.
+	RefreshEvery int
+
+	// RemoveProbability is the probability (0-1) of each server being absent
+	// in a refresh, simulating the servers being replaced.
+	RemoveProbability float64
+
+	// FlapProbability is the probability (0-1) of each server being unhealthy
+	// in a refresh.
+	FlapProbability float64
+
+	// Seed makes the churn reproducible. If zero the current time is used.
+	Seed int64
+}
+
+// ChurnResult stores the selections made by a load balancer in a churn
+// simulation.
+type ChurnResult struct {
+	Result
+
+	// Refreshes is the number of refreshes during the simulation.
+	Refreshes int
+
+	// Duration is the time spent in the simulation.
+	Duration time.Duration
+}
+
+// Throughput returns the number of choices per second.
+func (c ChurnResult) Throughput() float64 {
+	if c.Duration <= 0 {
+		return 0
+	}
+	return float64(c.Iterations) / c.Duration.Seconds()
+}
+
+// SimulateChurn uses the load balancer in a discovery whose servers change on
+// each refresh (absent and unhealthy servers), choosing servers from
+// concurrent go routines, and returns the selection distribution. As the
+// servers change the distribution can't be compared with the chi-square test,
+// so the fairness should be checked instead (see Result.Fairness).
+func SimulateChurn(balancer dnsdisco.LoadBalancer, config ChurnConfig) ChurnResult {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+
+	var randomLock sync.Mutex
+	random := rand.New(rand.NewSource(config.Seed))
+	happens := func(probability float64) bool {
+		randomLock.Lock()
+		defer randomLock.Unlock()
+		return probability > 0 && random.Float64() < probability
+	}
+
+	discovery := dnsdisco.NewDiscovery("balancertest", "tcp", "example.com")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		servers := make([]*net.SRV, 0, len(config.Servers))
+		for _, server := range config.Servers {
+			if !happens(config.RemoveProbability) {
+				copied := *server
+				servers = append(servers, &copied)
+			}
+		}
+		return servers, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return !happens(config.FlapProbability), nil
+	}))
+	discovery.SetLoadBalancer(balancer)
+
+	result := ChurnResult{
+		Result: Result{
+			Iterations: config.Iterations,
+			Selections: make(map[string]int),
+		},
+	}
+
+	var resultLock sync.Mutex
+	var refreshes, choices int64
+
+	refresh := func() {
+		discovery.Refresh()
+		atomic.AddInt64(&refreshes, 1)
+	}
+	refresh()
+
+	begin := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < config.Concurrency; i++ {
+		iterations := config.Iterations / config.Concurrency
+		if i < config.Iterations%config.Concurrency {
+			iterations++
+		}
+
+		wg.Add(1)
+		go func(iterations int) {
+			defer wg.Done()
+
+			// each go routine counts its own selections, so the simulation doesn't
+			// add contention to the load balancer
+			selections := make(map[string]int)
+			empty := 0
+
+			for j := 0; j < iterations; j++ {
+				choice := atomic.AddInt64(&choices, 1)
+				if config.RefreshEvery > 0 && choice%int64(config.RefreshEvery) == 0 {
+					refresh()
+				}
+
+				target, port := discovery.Choose()
+				if target == "" && port == 0 {
+					empty++
+					continue
+				}
+				selections[Key(target, port)]++
+			}
+
+			resultLock.Lock()
+			defer resultLock.Unlock()
+
+			for key, count := range selections {
+				result.Selections[key] += count
+			}
+			result.Empty += empty
+		}(iterations)
+	}
+	wg.Wait()
+
+	result.Duration = time.Since(begin)
+	result.Refreshes = int(atomic.LoadInt64(&refreshes))
+	return result
+}
+
+// Fairness returns the Jain's fairness index of the selections relative to
+// the expected proportions: 1 when all servers were selected exactly in
+// proportion to what was expected, down to 1/n when a single server of n
+// received all selections. The servers expected with a zero proportion are
+// ignored.
+func (r Result) Fairness(expected map[string]float64) float64 {
+	var sum, squares float64
+	var n int
+
+	for key, proportion := range expected {
+		if proportion <= 0 {
+			continue
+		}
+
+		ratio := float64(r.Selections[key]) / proportion
+		sum += ratio
+		squares += ratio * ratio
+		n++
+	}
+
+	if n == 0 || squares == 0 {
+		return 0
+	}
+	return sum * sum / (float64(n) * squares)
+}
@@ -0,0 +1,40 @@
+package dnsdisco
+
+import "context"
+
+// WithBaseContext defines the context that controls the lifecycle of the
+// discovery. When it is cancelled the asynchronous refreshes and snapshot
+// publications stop, the running health checks are cancelled and the pools
+// of the discovery stop creating connections. A nil context restores the
+// background one. It is go routine safe.
+func (d *discovery) WithBaseContext(ctx context.Context) {
+	d.refreshStateLock.Lock()
+	defer d.refreshStateLock.Unlock()
+	d.baseCtx = ctx
+}
+
+// BaseContext returns the context defined by WithBaseContext, or the
+// background context if there's none.
+func (d *discovery) BaseContext() context.Context {
+	d.refreshStateLock.Lock()
+	defer d.refreshStateLock.Unlock()
+
+	if d.baseCtx == nil {
+		return context.Background()
+	}
+	return d.baseCtx
+}
+
+// mergeContext returns a context that is done when any of the contexts is
+// done. The cancel function must be called to release the resources.
+func mergeContext(ctx, base context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(base, func() {
+		cancel(context.Cause(base))
+	})
+
+	return ctx, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
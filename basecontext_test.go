@@ -0,0 +1,79 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestWithBaseContext(t *testing.T) {
+	t.Parallel()
+
+	var refreshes int
+	var checkErr error
+	var lock sync.Mutex
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.(dnsdisco.Scheduler).WithBaseContext(ctx)
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		lock.Lock()
+		refreshes++
+		lock.Unlock()
+
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		}, nil
+	}))
+	discovery.(dnsdisco.HealthManager).SetServerHealthChecker(dnsdisco.ServerHealthCheckerFunc(func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+		lock.Lock()
+		checkErr = ctx.Err()
+		lock.Unlock()
+		return dnsdisco.HealthStatusHealthy, nil
+	}))
+
+	finish := discovery.RefreshAsync(10 * time.Millisecond)
+	defer close(finish)
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+
+	lock.Lock()
+	refreshesAfterCancel := refreshes
+	lock.Unlock()
+
+	if refreshesAfterCancel == 0 {
+		t.Fatal("no refresh before the cancellation")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	lock.Lock()
+	if refreshes != refreshesAfterCancel {
+		t.Errorf("refreshes continued after the cancellation. Expecting: “%d”; found “%d”", refreshesAfterCancel, refreshes)
+	}
+	lock.Unlock()
+
+	// refresh directly to check the context received by the health checker
+	discovery.Refresh()
+
+	lock.Lock()
+	if !errors.Is(checkErr, context.Canceled) {
+		t.Errorf("mismatch health check context error. Expecting: “%v”; found “%v”", context.Canceled, checkErr)
+	}
+	lock.Unlock()
+
+	pool := dnsdisco.NewPool(discovery, dnsdisco.PoolConfig{})
+	defer pool.Close()
+
+	if _, err := pool.Get(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Errorf("mismatch pool error. Expecting: “%v”; found “%v”", context.Canceled, err)
+	}
+}
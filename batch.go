@@ -0,0 +1,87 @@
+package dnsdisco
+
+import (
+	"net"
+	"sync"
+)
+
+// BatchQuery identifies the SRV records of a service retrieved in a batch.
+type BatchQuery struct {
+	ServiceSpec
+
+	// Name is the domain name where the SRV records are published.
+	Name string
+}
+
+// BatchResult is the answer of a service retrieved in a batch.
+type BatchResult struct {
+	// Servers are the retrieved servers, if there was no error.
+	Servers []*net.SRV
+
+	// Metadata stores the extra information of each server, in the same order
+	// of the servers, when the retriever is a MetadataRetriever.
+	Metadata []map[string]string
+
+	// Err is the error of the retrieval.
+	Err error
+}
+
+// BatchRetriever is an optional interface that a Retriever can implement to
+// resolve many services in one logical operation, so applications with many
+// services (e.g. a Manager) don't pay the latency of each lookup in sequence.
+type BatchRetriever interface {
+	Retriever
+
+	// RetrieveBatch retrieves the servers of all services, returning the
+	// result of each one. A failure of one service doesn't affect the others.
+	RetrieveBatch(queries []BatchQuery) map[BatchQuery]BatchResult
+}
+
+// RetrieveBatch resolves the services using the retriever, returning the
+// result of each one. When the retriever implements the BatchRetriever
+// interface it is used, otherwise the services are retrieved concurrently. If
+// the retriever is nil the default one is used.
+func RetrieveBatch(retriever Retriever, queries []BatchQuery) map[BatchQuery]BatchResult {
+	if retriever == nil {
+		retriever = configuredRetriever()
+	}
+
+	if batchRetriever, ok := retriever.(BatchRetriever); ok {
+		return batchRetriever.RetrieveBatch(queries)
+	}
+
+	results := make(map[BatchQuery]BatchResult, len(queries))
+	var resultsLock sync.Mutex
+
+	var wg sync.WaitGroup
+	for _, query := range queries {
+		resultsLock.Lock()
+		_, found := results[query]
+		results[query] = BatchResult{}
+		resultsLock.Unlock()
+
+		// the same service is only retrieved once
+		if found {
+			continue
+		}
+
+		wg.Add(1)
+		go func(query BatchQuery) {
+			defer wg.Done()
+
+			var result BatchResult
+			if metadataRetriever, ok := retriever.(MetadataRetriever); ok {
+				result.Servers, result.Metadata, result.Err = metadataRetriever.RetrieveMetadata(query.Service, query.Proto, query.Name)
+			} else {
+				result.Servers, result.Err = retriever.Retrieve(query.Service, query.Proto, query.Name)
+			}
+
+			resultsLock.Lock()
+			results[query] = result
+			resultsLock.Unlock()
+		}(query)
+	}
+	wg.Wait()
+
+	return results
+}
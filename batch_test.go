@@ -0,0 +1,57 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestRetrieveBatch(t *testing.T) {
+	t.Parallel()
+
+	jabber := dnsdisco.BatchQuery{ServiceSpec: dnsdisco.ServiceSpec{Service: "jabber", Proto: "tcp"}, Name: "registro.br"}
+	ldap := dnsdisco.BatchQuery{ServiceSpec: dnsdisco.ServiceSpec{Service: "ldap", Proto: "tcp"}, Name: "registro.br"}
+	failure := errors.New("server failure")
+
+	var retrievalsLock sync.Mutex
+	retrievals := 0
+
+	retriever := dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		retrievalsLock.Lock()
+		retrievals++
+		retrievalsLock.Unlock()
+
+		if service == "ldap" {
+			return nil, failure
+		}
+
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		}, nil
+	})
+
+	results := dnsdisco.RetrieveBatch(retriever, []dnsdisco.BatchQuery{jabber, ldap, jabber})
+
+	expectedResults := map[dnsdisco.BatchQuery]dnsdisco.BatchResult{
+		jabber: {
+			Servers: []*net.SRV{
+				{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			},
+		},
+		ldap: {
+			Err: failure,
+		},
+	}
+
+	if !reflect.DeepEqual(results, expectedResults) {
+		t.Errorf("mismatch results. Expecting: “%#v”; found “%#v”", expectedResults, results)
+	}
+
+	if retrievals != 2 {
+		t.Errorf("mismatch number of retrievals. Expecting: “2”; found “%d”", retrievals)
+	}
+}
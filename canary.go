@@ -0,0 +1,188 @@
+package dnsdisco
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"sync"
+)
+
+// CanaryStats stores how many times each group of servers was selected by the
+// CanaryLoadBalancer.
+type CanaryStats struct {
+	// Canary is the number of selections of canary servers.
+	Canary uint64
+
+	// Stable is the number of selections of stable servers.
+	Stable uint64
+}
+
+// CanaryLoadBalancer routes a percentage of the selections to the canary
+// servers, and the remaining to the stable ones. Inside each group the server
+// is selected with the default load balancer (RFC 2782). When one of the
+// groups has no server available, the other group is used.
+type CanaryLoadBalancer struct {
+	// isCanary identifies the canary servers.
+	isCanary func(*net.SRV) bool
+
+	// canary and stable select the servers inside each group.
+	canary *defaultLoadBalancer
+	stable *defaultLoadBalancer
+
+	// lastCanary is true when the last selection was a canary server.
+	lastCanary bool
+
+	// percentage is the percentage (0-100) of the selections that should be
+	// routed to the canary servers.
+	percentage float64
+
+	// stats stores the number of selections of each group.
+	stats CanaryStats
+
+	// lock make it safe to change the percentage and read the statistics while
+	// the servers are being selected.
+	lock sync.Mutex
+}
+
+// NewCanaryLoadBalancer builds a load balancer that routes the percentage
+// (0-100) of the selections to the servers identified by the isCanary function.
+func NewCanaryLoadBalancer(percentage float64, isCanary func(*net.SRV) bool) *CanaryLoadBalancer {
+	return &CanaryLoadBalancer{
+		isCanary:   isCanary,
+		canary:     new(defaultLoadBalancer),
+		stable:     new(defaultLoadBalancer),
+		percentage: percentage,
+	}
+}
+
+// CanaryTargetPattern returns a function that identifies the canary servers
+// by the target name, using the same pattern syntax of path.Match (e.g.
+// "canary-*.example.com."). The comparison is case insensitive.
+func CanaryTargetPattern(pattern string) func(*net.SRV) bool {
+	pattern = strings.ToLower(pattern)
+	return func(srv *net.SRV) bool {
+		matched, _ := path.Match(pattern, strings.ToLower(srv.Target))
+		return matched
+	}
+}
+
+// ChangeServers splits the servers between the canary and the stable groups.
+func (c *CanaryLoadBalancer) ChangeServers(servers []*net.SRV) {
+	var canary, stable []*net.SRV
+	for _, server := range servers {
+		if c.isCanary(server) {
+			canary = append(canary, server)
+		} else {
+			stable = append(stable, server)
+		}
+	}
+
+	c.canary.ChangeServers(canary)
+	c.stable.ChangeServers(stable)
+}
+
+// LoadBalance chooses the group of servers according to the percentage, and
+// selects the server inside the group using the RFC 2782 algorithm.
+func (c *CanaryLoadBalancer) LoadBalance() (target string, port uint16) {
+	return c.LoadBalanceWhere(nil)
+}
+
+// LoadBalanceWhere works like LoadBalance, but only the servers accepted by the
+// filter are considered. When no server of the chosen group is accepted, the
+// other group is used. A nil filter accepts all servers.
+func (c *CanaryLoadBalancer) LoadBalanceWhere(accept func(target string, port uint16) bool) (target string, port uint16) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	useCanary := randomSource.Float64()*100 < c.percentage
+	if len(c.canary.servers) == 0 {
+		useCanary = false
+	} else if len(c.stable.servers) == 0 {
+		useCanary = true
+	}
+
+	if useCanary {
+		target, port = c.canary.LoadBalanceWhere(accept)
+	} else {
+		target, port = c.stable.LoadBalanceWhere(accept)
+	}
+
+	if target == "" && port == 0 && accept != nil {
+		useCanary = !useCanary
+		if useCanary {
+			target, port = c.canary.LoadBalanceWhere(accept)
+		} else {
+			target, port = c.stable.LoadBalanceWhere(accept)
+		}
+	}
+
+	if target == "" && port == 0 {
+		return
+	}
+
+	c.lastCanary = useCanary
+	if useCanary {
+		c.stats.Canary++
+	} else {
+		c.stats.Stable++
+	}
+	return
+}
+
+// SetPercentage changes the percentage (0-100) of the selections routed to the
+// canary servers, allowing a gradual rollout without a refresh. It is go
+// routine safe.
+func (c *CanaryLoadBalancer) SetPercentage(percentage float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.percentage = percentage
+}
+
+// Stats returns how many times each group of servers was selected. It is go
+// routine safe.
+func (c *CanaryLoadBalancer) Stats() CanaryStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stats
+}
+
+// SetUsage defines the function that returns the number of times that a server
+// was chosen, replacing the load balancer own counters.
+func (c *CanaryLoadBalancer) SetUsage(usage func(target string, port uint16) int) {
+	c.canary.SetUsage(usage)
+	c.stable.SetUsage(usage)
+}
+
+// SetZeroWeightStrategy defines how the servers are selected when all of them
+// have weight zero.
+func (c *CanaryLoadBalancer) SetZeroWeightStrategy(strategy ZeroWeightStrategy) {
+	c.canary.SetZeroWeightStrategy(strategy)
+	c.stable.SetZeroWeightStrategy(strategy)
+}
+
+// SetCapacity defines the function that returns the capacity hint of a server,
+// combined with the SRV weight according to the blend (0-1).
+func (c *CanaryLoadBalancer) SetCapacity(capacity func(target string, port uint16) (int, bool), blend float64) {
+	c.canary.SetCapacity(capacity, blend)
+	c.stable.SetCapacity(capacity, blend)
+}
+
+// SetWeightFactor defines the function that returns the adaptive factor that
+// multiplies the weight of a server.
+func (c *CanaryLoadBalancer) SetWeightFactor(factor func(target string, port uint16) float64) {
+	c.canary.SetWeightFactor(factor)
+	c.stable.SetWeightFactor(factor)
+}
+
+// Explain describes why the last target was chosen, including the group of
+// servers used.
+func (c *CanaryLoadBalancer) Explain() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.lastCanary {
+		return fmt.Sprintf("canary group selected (%g%% of the requests): %s", c.percentage, c.canary.Explain())
+	}
+	return fmt.Sprintf("stable group selected (%g%% of the requests): %s", 100-c.percentage, c.stable.Explain())
+}
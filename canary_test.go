@@ -0,0 +1,79 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestCanaryLoadBalancer(t *testing.T) {
+	t.Parallel()
+
+	servers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+		{Target: "canary-1.example.com.", Port: 3333, Priority: 10, Weight: 10},
+	}
+
+	scenarios := []struct {
+		description    string
+		percentage     float64
+		servers        []*net.SRV
+		expectedCanary bool
+		expectedStable bool
+	}{
+		{
+			description:    "it should split the selections between the groups",
+			percentage:     50,
+			servers:        servers,
+			expectedCanary: true,
+			expectedStable: true,
+		},
+		{
+			description:    "it should never select canary servers",
+			percentage:     0,
+			servers:        servers,
+			expectedStable: true,
+		},
+		{
+			description:    "it should always select canary servers",
+			percentage:     100,
+			servers:        servers,
+			expectedCanary: true,
+		},
+		{
+			description:    "it should fallback to canary servers",
+			percentage:     0,
+			servers:        servers[2:],
+			expectedCanary: true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			loadBalancer := dnsdisco.NewCanaryLoadBalancer(scenario.percentage, dnsdisco.CanaryTargetPattern("CANARY-*.example.com."))
+			loadBalancer.ChangeServers(scenario.servers)
+
+			for i := 0; i < 100; i++ {
+				target, _ := loadBalancer.LoadBalance()
+				if target == "" {
+					t.Fatal("no server selected")
+				}
+			}
+
+			stats := loadBalancer.Stats()
+			if stats.Canary+stats.Stable != 100 {
+				t.Errorf("unexpected number of selections: %#v", stats)
+			}
+
+			if (stats.Canary > 0) != scenario.expectedCanary {
+				t.Errorf("unexpected canary selections: %#v", stats)
+			}
+
+			if (stats.Stable > 0) != scenario.expectedStable {
+				t.Errorf("unexpected stable selections: %#v", stats)
+			}
+		})
+	}
+}
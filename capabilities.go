@@ -0,0 +1,442 @@
+package dnsdisco
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// Refresher controls how and when the servers are refreshed.
+type Refresher interface {
+	// ForceRefresh works like Refresh, but ignores the answers cached by the
+	// retriever (e.g. negative answers).
+	ForceRefresh() error
+
+	// LastRefresh returns the information of the last refresh (timestamp,
+	// duration, number of records, resolver, error and whether the servers
+	// changed).
+	LastRefresh() RefreshInfo
+
+	// SetRefreshConcurrency defines what the Refresh calls do when there's
+	// already a refresh in progress: wait and share its result or return
+	// ErrRefreshInProgress.
+	SetRefreshConcurrency(mode RefreshConcurrency)
+
+	// SetReResolution triggers an immediate refresh when the fraction of
+	// healthy servers drops below the threshold, respecting a cooldown between
+	// the triggered refreshes.
+	SetReResolution(threshold float64, cooldown time.Duration)
+
+	// SetWarmStart makes the refreshes return without waiting for the health
+	// checks, that run in background with the given concurrency.
+	SetWarmStart(concurrency int)
+}
+
+// StatePersister keeps the state of the discovery across restarts.
+type StatePersister interface {
+	// SaveState returns the state of the discovery (e.g. load balancer usage
+	// counters), that can be restored with LoadState after a restart.
+	SaveState() ([]byte, error)
+
+	// LoadState restores the state returned by SaveState.
+	LoadState([]byte) error
+}
+
+// Selector offers alternative ways to choose the servers.
+type Selector interface {
+	// ChooseServer works like Choose, but returns all the information of the
+	// chosen server, or a RetryAfterError suggesting when to try again if
+	// there's no server available.
+	ChooseServer() (Server, error)
+
+	// ChooseWhere works like Choose, but only the healthy servers accepted by
+	// the filter can be selected. It is useful to restrict the selection at
+	// call time (e.g. only port 443) without changing the load balancer.
+	ChooseWhere(filter func(Server) bool) (target string, port uint16)
+
+	// ChooseWithin works like Choose, but health checks the candidates in the
+	// load balancer order until one passes or the timeout expires. ErrNoServer
+	// is returned when all candidates fail.
+	ChooseWithin(timeout time.Duration) (target string, port uint16, err error)
+
+	// Iterator returns an iterator over the healthy servers in the load
+	// balancer order, without repeats, where the failures can be reported.
+	Iterator() *Iter
+
+	// StrictRFC2782 returns an iterator over all servers in the order of the
+	// RFC 2782 client algorithm, reordered for each connection, where the next
+	// server is tried when the connection fails.
+	StrictRFC2782() *RFC2782Iterator
+}
+
+// Inspector exposes the state of the discovery, for debugging and monitoring.
+type Inspector interface {
+	// Servers returns a copy of all servers retrieved in the last refresh,
+	// including the health check result, the number of times that each one was
+	// chosen and the timestamps of those operations.
+	Servers() []Server
+
+	// Snapshot returns the current state of the discovery, with all servers
+	// retrieved in the last refresh, that can be encoded in JSON or YAML.
+	Snapshot() Snapshot
+
+	// Stats returns how many times each server was chosen in the last 1, 5 and
+	// 15 minutes.
+	Stats() []TargetStats
+
+	// Explain describes the last choice, listing the servers that were
+	// considered, their health and usage, and why the winner was picked.
+	Explain() Explanation
+
+	// Endpoints returns the healthy servers grouped by target host, for
+	// protocols that use several ports of the same server.
+	Endpoints() []Endpoint
+
+	// ActiveName returns the name of the servers retrieved in the last
+	// successful refresh, that may be the external name.
+	ActiveName() string
+
+	// ErrorCounts returns the number of errors of each class returned by the
+	// retriever and the health checker.
+	ErrorCounts() map[ErrorClass]uint64
+}
+
+// Publisher uploads the state of the discovery to remote stores.
+type Publisher interface {
+	// PublishSnapshots uploads the snapshot of the discovery with the
+	// publisher on every interval. To stop the publications the returned
+	// channel must be closed.
+	PublishSnapshots(publisher SnapshotPublisher, interval time.Duration) chan<- bool
+}
+
+// DecisionSampler records a sample of the load balancer decisions.
+type DecisionSampler interface {
+	// SetDecisionSampling enables the recording of 1 in each N load balancer
+	// decisions in a bounded buffer.
+	SetDecisionSampling(sampling DecisionSampling)
+
+	// DecisionSamples returns the recorded load balancer decisions.
+	DecisionSamples() []DecisionSample
+}
+
+// HealthManager controls the health checks of the servers.
+type HealthManager interface {
+	// CheckAll runs the configured health checker for every server retrieved
+	// in the last refresh, concurrently, without affecting the servers
+	// selection.
+	CheckAll(ctx context.Context) []HealthResult
+
+	// MarkUnhealthy flags the server as unhealthy until the next refresh, so
+	// the connection failures detected by the library user move the next
+	// choices to another server.
+	MarkUnhealthy(target string, port uint16)
+
+	// FlushHealth discards the health status of all servers, checking them
+	// again.
+	FlushHealth()
+
+	// SetServerHealthChecker changes the way the library health check each
+	// server, using a checker with access to all server information and with
+	// a richer health status. It has the same semantics of SetHealthChecker.
+	SetServerHealthChecker(ServerHealthChecker)
+
+	// SetProtocolHealthCheck defines if the health checker chosen for the
+	// service (e.g. an HTTP request for the http service) is used, instead of
+	// a plain connection.
+	SetProtocolHealthCheck(bool)
+
+	// SetHealthCheckPacing spreads the health checks of the known servers
+	// evenly across the interval of the asynchronous refreshes, instead of
+	// checking all of them on each refresh.
+	SetHealthCheckPacing(enabled bool)
+}
+
+// Drainer removes servers from the selection during maintenances.
+type Drainer interface {
+	// Drain flags the server as draining, so it isn't chosen anymore, until
+	// Undrain is called.
+	Drain(target string, port uint16)
+
+	// Undrain removes the draining flag of the server, checking it again.
+	Undrain(target string, port uint16)
+}
+
+// Hedger sends hedged requests to reduce the tail latency.
+type Hedger interface {
+	// Hedge calls fn with the best target, and if it doesn't succeed after the
+	// delay, also calls fn with the second best healthy target. The first
+	// success is returned and the context of the other call is cancelled.
+	Hedge(ctx context.Context, delay time.Duration, fn func(ctx context.Context, target string, port uint16) error) (target string, port uint16, err error)
+}
+
+// Dialer connects to the chosen servers.
+type Dialer interface {
+	// Dial chooses the best target and connects to it using the discovery
+	// proto.
+	Dial(ctx context.Context) (net.Conn, error)
+
+	// DialTLS chooses the best target and connects to it using TLS. The
+	// certificate is verified according to the base configuration and to the
+	// TLS policy of the target.
+	DialTLS(ctx context.Context, config *tls.Config) (net.Conn, error)
+
+	// ListenPacketTo chooses the best target and returns a datagram connection
+	// already connected to it, that moves to another healthy target when the
+	// writes start failing.
+	ListenPacketTo(ctx context.Context) (net.PacketConn, error)
+
+	// ResolveAddress returns the IP addresses of the target using the
+	// resolver defined with SetAddressResolver.
+	ResolveAddress(ctx context.Context, target string) ([]net.IP, error)
+
+	// Credentials returns the authentication material of the target, using
+	// the credentials provider.
+	Credentials(ctx context.Context, target string, port uint16) (Credentials, error)
+}
+
+// ConnectionConfigurer defines how the connections to the servers are
+// established.
+type ConnectionConfigurer interface {
+	// SetTLSPolicies changes the certificate pins and CA bundles used to
+	// verify each target when connecting with DialTLS.
+	SetTLSPolicies(TLSPolicies)
+
+	// SetCredentialsProvider defines the authentication material (TLS
+	// configuration, tokens) of each target, used by DialTLS and the
+	// RoundTripper.
+	SetCredentialsProvider(CredentialsProvider)
+
+	// SetUnixSockets defines how the servers are mapped to Unix domain
+	// sockets, for colocated services.
+	SetUnixSockets(mapping UnixSocketMapping)
+
+	// SetAddressResolver defines the resolver used by the dial helpers to
+	// convert the chosen targets to IP addresses.
+	SetAddressResolver(AddressResolver)
+
+	// SetNetworkPolicy fails the health checks of the targets resolved to IP
+	// addresses outside the allowed networks or inside the denied ones.
+	SetNetworkPolicy(policy NetworkPolicy)
+
+	// SetWarmUp defines how the new servers of a refresh are prepared in
+	// background before the first real request.
+	SetWarmUp(warmUp WarmUp, timeout time.Duration)
+}
+
+// Prober reports the readiness and liveness of the discovery.
+type Prober interface {
+	// SetProbeThresholds defines when the discovery is considered ready or
+	// alive by the Kubernetes probes.
+	SetProbeThresholds(ProbeThresholds)
+
+	// Healthy checks if the discovery refreshed recently and has enough
+	// healthy servers.
+	Healthy() bool
+
+	// Alive checks if the asynchronous refresh is still running.
+	Alive() bool
+}
+
+// EventSource publishes the events of the discovery lifecycle.
+type EventSource interface {
+	// Events subscribes to the events of the discovery lifecycle (refreshes,
+	// server changes, choices), returning a new channel for each consumer.
+	Events() <-chan Event
+
+	// CloseEvents unsubscribes and closes a channel returned by Events.
+	CloseEvents(events <-chan Event)
+}
+
+// RecordConfigurer defines how the retrieved SRV records are validated and
+// transformed.
+type RecordConfigurer interface {
+	// SetCNAMEChasing enables following the CNAME chain of the SRV targets on
+	// each refresh, up to the maximum depth, storing the canonical name of the
+	// servers.
+	SetCNAMEChasing(resolver CNAMEResolver, maxDepth int)
+
+	// SetLimits changes the limits of the servers accepted on each refresh,
+	// protecting the discovery against pathological answers.
+	SetLimits(Limits)
+
+	// SetDuplicatePolicy changes how the SRV records pointing to the same
+	// target are merged or dropped on each refresh.
+	SetDuplicatePolicy(DuplicatePolicy)
+
+	// SetTargetSuffixes rejects the SRV records with targets outside the
+	// domain suffixes, protecting against redirections from compromised zones.
+	SetTargetSuffixes(suffixes []string)
+
+	// SetManifest cross-checks the SRV records against a signed manifest
+	// fetched over HTTPS, reporting and optionally removing the mismatches.
+	SetManifest(config ManifestConfig) error
+
+	// SetProtoMismatchDetection reports a ProtoMismatchError when the service
+	// has no SRV records with the proto of the discovery, but has records with
+	// another proto.
+	SetProtoMismatchDetection(bool)
+
+	// SetExternalName enables the split-horizon failover: when the lookup of
+	// the internal name fails or returns no healthy servers, the external name
+	// is used.
+	SetExternalName(name string)
+
+	// AddServerFilter adds a transformation of the retrieved servers, applied
+	// after the normalization and before the health checks and the load
+	// balancer.
+	AddServerFilter(filter func([]Server) []Server)
+}
+
+// FailureConfigurer defines how the discovery behaves when the retriever, the
+// health checker or the load balancer fail.
+type FailureConfigurer interface {
+	// SetFallbackServers defines a static list of servers used only when the
+	// retrieval fails and there's no previous answer.
+	SetFallbackServers(servers []*net.SRV)
+
+	// SetShrinkProtection keeps the previous servers when a refresh answer
+	// shrinks by more than the percentage, as it may be partial. The
+	// quarantined refresh fails with a ShrinkError.
+	SetShrinkProtection(maxShrink float64)
+
+	// AllowShrink accepts the answer of the next refresh whatever is its size,
+	// for intentional scale-downs.
+	AllowShrink()
+
+	// SetErrorPolicy defines how the errors of the class returned by the
+	// retriever and the health checker are handled.
+	SetErrorPolicy(class ErrorClass, action ErrorAction)
+
+	// SetPanicPolicy defines if the panics of the retriever, the health
+	// checker and the load balancer are recovered and converted into errors.
+	SetPanicPolicy(PanicPolicy)
+}
+
+// BalancingConfigurer adjusts the servers selection without replacing the
+// load balancer.
+type BalancingConfigurer interface {
+	// SetPolicy enables the selection policy published in a control TXT
+	// record, that can prefer a subset of the servers (blue/green cutovers).
+	// When the public key is given the policy must be signed.
+	SetPolicy(retriever TXTRetriever, publicKey ed25519.PublicKey)
+
+	// SetSelectionLimit limits the selections per second of each target in
+	// Choose and ChooseWhere.
+	SetSelectionLimit(SelectionLimit)
+
+	// SetLocality replaces the priorities published in the DNS with
+	// priorities synthesized from the locality of the servers, relative to
+	// the local datacenter and region.
+	SetLocality(Locality)
+
+	// SetPriorityOverride replaces the priority of the servers, identified by
+	// target or by target and port, to steer the traffic without waiting for
+	// the DNS TTLs.
+	SetPriorityOverride(priorities map[string]uint16)
+
+	// SetWeightOverride replaces the weight of the servers, identified by
+	// target or by target and port, to shift the traffic without waiting for
+	// the DNS TTLs.
+	SetWeightOverride(weights map[string]uint16)
+
+	// SetZeroWeightStrategy changes how the servers are selected when all
+	// servers of a priority have weight zero.
+	SetZeroWeightStrategy(ZeroWeightStrategy)
+
+	// SetCapacityBlend combines the SRV weights with the capacity hints of the
+	// servers metadata, where the blend (0-1) defines how much the capacity
+	// counts.
+	SetCapacityBlend(blend float64)
+
+	// SetStatsStore changes where the usage counters and the health history of
+	// the servers are stored. Discoveries of many instances of an application
+	// sharing the same store coordinate their load balancing decisions.
+	SetStatsStore(StatsStore)
+}
+
+// AdaptiveWeighter adjusts the weights of the servers based on the results of
+// the requests.
+type AdaptiveWeighter interface {
+	// SetAdaptiveWeights adjusts the effective weight of each server based on
+	// the error rate and the latency reported with ReportResult.
+	SetAdaptiveWeights(AdaptiveWeights)
+
+	// ReportResult feeds the adaptive weights with the result of a request
+	// sent to the server.
+	ReportResult(target string, port uint16, latency time.Duration, err error)
+}
+
+// Scheduler controls the clock and the lifecycle of the background operations.
+type Scheduler interface {
+	// SetClock replaces the clock that schedules the asynchronous refreshes
+	// and the paced health checks.
+	SetClock(Clock)
+
+	// WithBaseContext defines the context that cancels the asynchronous
+	// refreshes, the health checks and the pools activity when done.
+	WithBaseContext(ctx context.Context)
+
+	// BaseContext returns the context defined by WithBaseContext.
+	BaseContext() context.Context
+}
+
+// resolveAddress returns the function that resolves the targets with the
+// address resolver of the discovery. When the discovery doesn't implement the
+// Dialer interface the targets are dialed as they are.
+func resolveAddress(discovery Discovery) func(ctx context.Context, target string) ([]net.IP, error) {
+	if dialer, ok := discovery.(Dialer); ok {
+		return dialer.ResolveAddress
+	}
+
+	return func(ctx context.Context, target string) ([]net.IP, error) {
+		return nil, nil
+	}
+}
+
+// chooseWhere chooses a server accepted by the filter. When the discovery
+// doesn't implement the Selector interface, the target chosen by Choose is
+// returned only if accepted by the filter.
+func chooseWhere(discovery Discovery, filter func(Server) bool) (target string, port uint16) {
+	if selector, ok := discovery.(Selector); ok {
+		return selector.ChooseWhere(filter)
+	}
+
+	target, port = discovery.Choose()
+	if (target == "" && port == 0) || !filter(Server{SRV: net.SRV{Target: target, Port: port}}) {
+		return "", 0
+	}
+	return target, port
+}
+
+// baseContext returns the base context of the discovery, or the background
+// context when the discovery doesn't implement the Scheduler interface.
+func baseContext(discovery Discovery) context.Context {
+	if scheduler, ok := discovery.(Scheduler); ok {
+		return scheduler.BaseContext()
+	}
+	return context.Background()
+}
+
+// check that the discovery implements all optional interfaces
+var (
+	_ Refresher            = (*discovery)(nil)
+	_ StatePersister       = (*discovery)(nil)
+	_ Selector             = (*discovery)(nil)
+	_ Inspector            = (*discovery)(nil)
+	_ Publisher            = (*discovery)(nil)
+	_ DecisionSampler      = (*discovery)(nil)
+	_ HealthManager        = (*discovery)(nil)
+	_ Drainer              = (*discovery)(nil)
+	_ Hedger               = (*discovery)(nil)
+	_ Dialer               = (*discovery)(nil)
+	_ ConnectionConfigurer = (*discovery)(nil)
+	_ Prober               = (*discovery)(nil)
+	_ EventSource          = (*discovery)(nil)
+	_ RecordConfigurer     = (*discovery)(nil)
+	_ FailureConfigurer    = (*discovery)(nil)
+	_ BalancingConfigurer  = (*discovery)(nil)
+	_ AdaptiveWeighter     = (*discovery)(nil)
+	_ Scheduler            = (*discovery)(nil)
+)
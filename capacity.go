@@ -0,0 +1,172 @@
+package dnsdisco
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// CapacityMetadata is the metadata key (Server.Metadata) of the capacity hint
+// of a server (e.g. "cap=200" in the TXT record of the target), used by the
+// default load balancer when a capacity blend is defined.
+const CapacityMetadata = "cap"
+
+// capacityScale is the precision of the weights blended with the capacities.
+const capacityScale = 10000
+
+// CapacityLoadBalancer is an optional interface that a LoadBalancer can
+// implement to receive the capacity hints of the servers, defined with the
+// SetCapacityBlend method. The default load balancer implements it.
+type CapacityLoadBalancer interface {
+	// SetCapacity defines the function that returns the capacity hint of a
+	// server, and how much it counts (0-1) compared with the SRV weight.
+	SetCapacity(capacity func(target string, port uint16) (int, bool), blend float64)
+}
+
+// SetCapacityBlend combines the SRV weights with the capacity hints published
+// in the metadata of the servers (CapacityMetadata), so the operators can
+// publish the real capacity without recalculating the DNS weights. The blend
+// (0-1) defines how much the capacity counts: with 0 only the SRV weights are
+// used, with 1 only the capacities, and in between the share of each server
+// is the weighted average of its weight share and its capacity share inside
+// the same priority. When one of the servers doesn't have a capacity hint only
+// the weights are used. The metadata can be retrieved with
+// NewTXTMetadataRetriever. It only works with load balancers that implement
+// the CapacityLoadBalancer interface. It is go routine safe.
+func (d *discovery) SetCapacityBlend(blend float64) {
+	d.loadBalancerLock.Lock()
+	defer d.loadBalancerLock.Unlock()
+
+	d.capacityBlend = math.Max(0, math.Min(1, blend))
+	d.shareCapacity(d.loadBalancer)
+}
+
+// shareCapacity makes the load balancer use the capacity hints when it
+// supports it. The caller must hold the load balancer write lock.
+func (d *discovery) shareCapacity(b LoadBalancer) {
+	loadBalancer, ok := b.(CapacityLoadBalancer)
+	if !ok {
+		return
+	}
+	loadBalancer.SetCapacity(d.capacity, d.capacityBlend)
+}
+
+// capacity returns the capacity hint of the server. The load balancer is
+// always called with the servers lock held.
+func (d *discovery) capacity(target string, port uint16) (int, bool) {
+	// the servers aren't copied, as the usage counters can change during the
+	// choices
+	for i := range d.servers {
+		if d.servers[i].Target != target || d.servers[i].Port != port {
+			continue
+		}
+
+		capacity, err := strconv.Atoi(d.servers[i].Metadata[CapacityMetadata])
+		if err != nil || capacity < 0 {
+			return 0, false
+		}
+		return capacity, true
+	}
+
+	return 0, false
+}
+
+// blendCapacity returns the weights of the servers combined with their
+// capacity hints.
+func blendCapacity(servers []defaultLoadBalancerServer, capacity func(target string, port uint16) (int, bool), blend float64) []int {
+	weights := make([]int, len(servers))
+	for i, server := range servers {
+		weights[i] = int(server.Weight)
+	}
+
+	if capacity == nil || blend <= 0 || len(servers) == 0 {
+		return weights
+	}
+
+	capacities := make([]int, len(servers))
+	var totalWeight, totalCapacity int
+
+	for i, server := range servers {
+		c, ok := capacity(server.Target, server.Port)
+		if !ok {
+			return weights
+		}
+		capacities[i] = c
+		totalCapacity += c
+		totalWeight += weights[i]
+	}
+
+	if totalCapacity == 0 {
+		return weights
+	}
+
+	for i := range servers {
+		// without weights the servers have the same share
+		weightShare := 1 / float64(len(servers))
+		if totalWeight > 0 {
+			weightShare = float64(weights[i]) / float64(totalWeight)
+		}
+		capacityShare := float64(capacities[i]) / float64(totalCapacity)
+
+		weights[i] = int(math.Round(((1-blend)*weightShare + blend*capacityShare) * capacityScale))
+	}
+
+	return weights
+}
+
+// NewTXTMetadataRetriever wraps the retriever, storing as metadata of each
+// server the key=value pairs of the TXT records of its target (e.g.
+// "cap=200 zone=a"). The servers without TXT records have no metadata. If the
+// retriever or the TXT retriever are nil the default ones are used.
+func NewTXTMetadataRetriever(retriever Retriever, txtRetriever TXTRetriever) MetadataRetriever {
+	if retriever == nil {
+		retriever = configuredRetriever()
+	}
+
+	if txtRetriever == nil {
+		txtRetriever = NewDefaultTXTRetriever()
+	}
+
+	return txtMetadataRetriever{Retriever: retriever, txtRetriever: txtRetriever}
+}
+
+// txtMetadataRetriever retrieves the metadata of the servers from the TXT
+// records of the targets.
+type txtMetadataRetriever struct {
+	Retriever
+
+	txtRetriever TXTRetriever
+}
+
+// RetrieveMetadata retrieves the servers and the TXT records of their targets.
+func (t txtMetadataRetriever) RetrieveMetadata(service, proto, name string) ([]*net.SRV, []map[string]string, error) {
+	srvs, err := t.Retrieve(service, proto, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := make([]map[string]string, len(srvs))
+	for i, srv := range srvs {
+		txts, err := t.txtRetriever.RetrieveTXT(srv.Target)
+		if err != nil {
+			continue
+		}
+
+		for _, txt := range txts {
+			for _, pair := range strings.Fields(txt) {
+				parts := strings.SplitN(pair, "=", 2)
+				if len(parts) != 2 {
+					continue
+				}
+
+				if metadata[i] == nil {
+					metadata[i] = make(map[string]string)
+				}
+				metadata[i][parts[0]] = parts[1]
+			}
+		}
+	}
+
+	return srvs, metadata, nil
+}
@@ -0,0 +1,143 @@
+package dnsdisco
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestBlendCapacity(t *testing.T) {
+	t.Parallel()
+
+	servers := []defaultLoadBalancerServer{
+		{SRV: net.SRV{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 30}},
+		{SRV: net.SRV{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10}},
+	}
+
+	capacities := func(values map[string]int) func(target string, port uint16) (int, bool) {
+		return func(target string, port uint16) (int, bool) {
+			capacity, ok := values[target]
+			return capacity, ok
+		}
+	}
+
+	scenarios := []struct {
+		description     string
+		capacity        func(target string, port uint16) (int, bool)
+		blend           float64
+		expectedWeights []int
+	}{
+		{
+			description:     "it should use the weights without capacities",
+			blend:           0.5,
+			expectedWeights: []int{30, 10},
+		},
+		{
+			description: "it should use the weights without blend",
+			capacity: capacities(map[string]int{
+				"server1.example.com.": 100,
+				"server2.example.com.": 300,
+			}),
+			expectedWeights: []int{30, 10},
+		},
+		{
+			description: "it should use only the capacities",
+			capacity: capacities(map[string]int{
+				"server1.example.com.": 100,
+				"server2.example.com.": 300,
+			}),
+			blend:           1,
+			expectedWeights: []int{2500, 7500},
+		},
+		{
+			description: "it should blend the weights and the capacities",
+			capacity: capacities(map[string]int{
+				"server1.example.com.": 100,
+				"server2.example.com.": 300,
+			}),
+			blend:           0.5,
+			expectedWeights: []int{5000, 5000},
+		},
+		{
+			description: "it should use the weights when a capacity is missing",
+			capacity: capacities(map[string]int{
+				"server1.example.com.": 100,
+			}),
+			blend:           1,
+			expectedWeights: []int{30, 10},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			weights := blendCapacity(servers, scenario.capacity, scenario.blend)
+			if !reflect.DeepEqual(weights, scenario.expectedWeights) {
+				t.Errorf("mismatch weights. Expecting: “%v”; found “%v”", scenario.expectedWeights, weights)
+			}
+		})
+	}
+}
+
+func TestSetCapacityBlend(t *testing.T) {
+	t.Parallel()
+
+	retriever := NewTXTMetadataRetriever(RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+			{Target: "server3.example.com.", Port: 3333, Priority: 10, Weight: 10},
+		}, nil
+	}), TXTRetrieverFunc(func(name string) ([]string, error) {
+		switch name {
+		case "server1.example.com.":
+			return []string{"cap=200 zone=a", "invalid"}, nil
+		case "server2.example.com.":
+			return []string{"cap=abc"}, nil
+		}
+		return nil, errors.New("no such host")
+	}))
+
+	d := buildDiscovery("jabber", "tcp", "registro.br")
+	d.SetRetriever(retriever)
+	d.SetHealthChecker(HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}))
+	d.SetCapacityBlend(2)
+
+	if err := d.Refresh(); err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	for _, server := range d.Servers() {
+		if server.Target == "server1.example.com." {
+			expected := map[string]string{"cap": "200", "zone": "a"}
+			if !reflect.DeepEqual(server.Metadata, expected) {
+				t.Errorf("mismatch metadata. Expecting: “%v”; found “%v”", expected, server.Metadata)
+			}
+		}
+	}
+
+	loadBalancer := d.loadBalancer.(*defaultLoadBalancer)
+	if loadBalancer.capacityBlend != 1 {
+		t.Errorf("mismatch blend. Expecting: “1”; found “%g”", loadBalancer.capacityBlend)
+	}
+
+	d.serversLock.RLock()
+	defer d.serversLock.RUnlock()
+
+	if capacity, ok := loadBalancer.capacity("server1.example.com.", 1111); !ok || capacity != 200 {
+		t.Errorf("mismatch capacity. Expecting: “200”; found “%d”", capacity)
+	}
+
+	if _, ok := loadBalancer.capacity("server2.example.com.", 2222); ok {
+		t.Error("invalid capacity shouldn't be used")
+	}
+
+	if _, ok := loadBalancer.capacity("server3.example.com.", 3333); ok {
+		t.Error("missing capacity shouldn't be used")
+	}
+}
@@ -0,0 +1,123 @@
+package dnsdisco
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrChaos is the error injected by the chaos decorators when no error is
+// defined.
+var ErrChaos = errors.New("dnsdisco: injected fault")
+
+// ChaosConfig defines the faults injected by the chaos decorators, used to
+// test the resilience of the applications that embed the library. All
+// probabilities are between 0 (never) and 1 (always).
+type ChaosConfig struct {
+	// DelayProbability is the probability of delaying each operation.
+	DelayProbability float64
+
+	// Delay is the time that the delayed operations wait before running.
+	Delay time.Duration
+
+	// ErrorProbability is the probability of failing each operation.
+	ErrorProbability float64
+
+	// Err is the injected error. If nil ErrChaos is used.
+	Err error
+
+	// FlapProbability is the probability of each operation switching the state
+	// of the resource (the service or the server) between up and down. While a
+	// resource is down all its operations fail.
+	FlapProbability float64
+
+	// Seed makes the injected faults reproducible. If zero the library random
+	// source is used.
+	Seed int64
+}
+
+// chaos injects the faults of the configuration.
+type chaos struct {
+	config ChaosConfig
+	random *rand.Rand
+
+	// down stores the resources that are down because of the flapping.
+	down     map[string]bool
+	downLock sync.Mutex
+}
+
+// newChaos builds the fault injector of the configuration.
+func newChaos(config ChaosConfig) *chaos {
+	if config.Err == nil {
+		config.Err = ErrChaos
+	}
+
+	random := randomSource
+	if config.Seed != 0 {
+		random = rand.New(&lockedRandSource{
+			Source: rand.NewSource(config.Seed),
+		})
+	}
+
+	return &chaos{
+		config: config,
+		random: random,
+		down:   make(map[string]bool),
+	}
+}
+
+// inject delays the operation of the resource and returns the injected error,
+// if any.
+func (c *chaos) inject(resource string) error {
+	if c.happens(c.config.DelayProbability) {
+		time.Sleep(c.config.Delay)
+	}
+
+	c.downLock.Lock()
+	if c.happens(c.config.FlapProbability) {
+		c.down[resource] = !c.down[resource]
+	}
+	down := c.down[resource]
+	c.downLock.Unlock()
+
+	if down || c.happens(c.config.ErrorProbability) {
+		return c.config.Err
+	}
+	return nil
+}
+
+// happens draws if an event of the probability happens.
+func (c *chaos) happens(probability float64) bool {
+	return probability > 0 && c.random.Float64() < probability
+}
+
+// NewChaosRetriever wraps the retriever, injecting delays, errors and flapping
+// (the service alternating between available and unavailable) in the
+// retrievals, according to the configuration. The optional interfaces of the
+// retriever (e.g. MetadataRetriever) aren't forwarded. It must only be used in
+// test environments.
+func NewChaosRetriever(retriever Retriever, config ChaosConfig) Retriever {
+	chaos := newChaos(config)
+	return RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		if err := chaos.inject(service + "." + proto + "." + name); err != nil {
+			return nil, err
+		}
+		return retriever.Retrieve(service, proto, name)
+	})
+}
+
+// NewChaosHealthChecker wraps the health checker, injecting delays, errors and
+// flapping (each server alternating between healthy and unhealthy) in the
+// health checks, according to the configuration. It must only be used in test
+// environments.
+func NewChaosHealthChecker(healthChecker HealthChecker, config ChaosConfig) HealthChecker {
+	chaos := newChaos(config)
+	return HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		if err := chaos.inject(JoinHostPort(target, port)); err != nil {
+			return false, err
+		}
+		return healthChecker.HealthCheck(target, port, proto)
+	})
+}
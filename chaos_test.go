@@ -0,0 +1,135 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestNewChaosRetriever(t *testing.T) {
+	t.Parallel()
+
+	injected := errors.New("injected")
+
+	scenarios := []struct {
+		description    string
+		config         dnsdisco.ChaosConfig
+		expectedErrors []error
+		expectedDelay  time.Duration
+	}{
+		{
+			description:    "it should not inject faults by default",
+			expectedErrors: []error{nil, nil, nil},
+		},
+		{
+			description: "it should inject errors",
+			config: dnsdisco.ChaosConfig{
+				ErrorProbability: 1,
+			},
+			expectedErrors: []error{dnsdisco.ErrChaos, dnsdisco.ErrChaos, dnsdisco.ErrChaos},
+		},
+		{
+			description: "it should inject custom errors",
+			config: dnsdisco.ChaosConfig{
+				ErrorProbability: 1,
+				Err:              injected,
+			},
+			expectedErrors: []error{injected},
+		},
+		{
+			description: "it should flap the service",
+			config: dnsdisco.ChaosConfig{
+				FlapProbability: 1,
+			},
+			expectedErrors: []error{dnsdisco.ErrChaos, nil, dnsdisco.ErrChaos, nil},
+		},
+		{
+			description: "it should delay the retrievals",
+			config: dnsdisco.ChaosConfig{
+				DelayProbability: 1,
+				Delay:            20 * time.Millisecond,
+			},
+			expectedErrors: []error{nil},
+			expectedDelay:  20 * time.Millisecond,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			retriever := dnsdisco.NewChaosRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+				}, nil
+			}), scenario.config)
+
+			for i, expectedErr := range scenario.expectedErrors {
+				begin := time.Now()
+				servers, err := retriever.Retrieve("jabber", "tcp", "registro.br")
+				if elapsed := time.Since(begin); elapsed < scenario.expectedDelay {
+					t.Errorf("retrieval %d wasn't delayed (%s)", i, elapsed)
+				}
+
+				if err != expectedErr {
+					t.Errorf("mismatch error of retrieval %d. Expecting: “%v”; found “%v”", i, expectedErr, err)
+				}
+
+				if err == nil && len(servers) != 1 {
+					t.Errorf("mismatch servers of retrieval %d. Expecting: “1”; found “%d”", i, len(servers))
+				}
+			}
+		})
+	}
+}
+
+func TestNewChaosHealthChecker(t *testing.T) {
+	t.Parallel()
+
+	healthChecker := dnsdisco.NewChaosHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}), dnsdisco.ChaosConfig{FlapProbability: 1})
+
+	// each server flaps independently
+	expected := []struct {
+		target string
+		ok     bool
+	}{
+		{target: "server1.example.com.", ok: false},
+		{target: "server2.example.com.", ok: false},
+		{target: "server1.example.com.", ok: true},
+		{target: "server1.example.com.", ok: false},
+		{target: "server2.example.com.", ok: true},
+	}
+
+	for i, check := range expected {
+		ok, err := healthChecker.HealthCheck(check.target, 1111, "tcp")
+		if ok != check.ok {
+			t.Errorf("mismatch health check %d of “%s”. Expecting: “%t”; found “%t” (%v)", i, check.target, check.ok, ok, err)
+		}
+	}
+
+	seeded := func() []bool {
+		healthChecker := dnsdisco.NewChaosHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+			return true, nil
+		}), dnsdisco.ChaosConfig{ErrorProbability: 0.5, Seed: 42})
+
+		var results []bool
+		for i := 0; i < 20; i++ {
+			ok, _ := healthChecker.HealthCheck("server1.example.com.", 1111, "tcp")
+			results = append(results, ok)
+		}
+		return results
+	}
+
+	first, second := seeded(), seeded()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("the seeded faults aren't reproducible. First: %v; second: %v", first, second)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package dnsdisco
+
+import (
+	"context"
+	"time"
+)
+
+// Clock schedules the background operations of the discovery (asynchronous
+// refreshes and paced health checks). It can be replaced with SetClock to
+// simulate long executions in tests without waiting (see the soaktest
+// package).
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a timer that sends the current time on its channel
+	// after the duration.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event created by a Clock.
+type Timer interface {
+	// C returns the channel that receives the time when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing, releasing its resources. It returns
+	// false if the timer already fired or was stopped.
+	Stop() bool
+}
+
+// realClock is the default clock, based on the time package.
+type realClock struct{}
+
+// Now returns the current time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer creates a timer of the time package.
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// realTimer adapts the timer of the time package to the Timer interface.
+type realTimer struct {
+	*time.Timer
+}
+
+// C returns the channel of the timer.
+func (r realTimer) C() <-chan time.Time {
+	return r.Timer.C
+}
+
+// SetClock replaces the clock that schedules the asynchronous refreshes and
+// the paced health checks. It must be called before RefreshAsync. A nil clock
+// restores the real one. It is go routine safe.
+func (d *discovery) SetClock(clock Clock) {
+	d.refreshStateLock.Lock()
+	defer d.refreshStateLock.Unlock()
+	d.clock = clock
+}
+
+// currentClock returns the clock defined by SetClock, or the real one.
+func (d *discovery) currentClock() Clock {
+	d.refreshStateLock.Lock()
+	defer d.refreshStateLock.Unlock()
+
+	if d.clock == nil {
+		return realClock{}
+	}
+	return d.clock
+}
+
+// wait sleeps for the duration, returning false if the finish channel was
+// closed or the context is done before. The timer is always stopped, so no
+// resource is kept after an early finish.
+func wait(ctx context.Context, clock Clock, duration time.Duration, finish <-chan bool) bool {
+	timer := clock.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-finish:
+		return false
+	case <-ctx.Done():
+		return false
+	case <-timer.C():
+		return true
+	}
+}
@@ -0,0 +1,85 @@
+package dnsdisco
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CNAMEResolver allows the library user to define how the CNAME records of the
+// SRV targets are resolved. Although RFC 2782 says that the target must not be
+// an alias, some providers publish CNAME targets.
+type CNAMEResolver interface {
+	// ResolveCNAME returns the target of the CNAME record of the name, or an
+	// empty string when the name isn't an alias. Only one step of the chain is
+	// resolved on each call.
+	ResolveCNAME(name string) (string, error)
+}
+
+// CNAMEResolverFunc is an easy-to-use implementation of the interface that is
+// responsible for resolving the CNAME records.
+type CNAMEResolverFunc func(name string) (string, error)
+
+// ResolveCNAME returns the target of the CNAME record of the name, or an empty
+// string when the name isn't an alias.
+func (c CNAMEResolverFunc) ResolveCNAME(name string) (string, error) {
+	return c(name)
+}
+
+// CNAMEError is reported when the CNAME chain of a SRV target can't be
+// followed, because it has a loop or is longer than the maximum depth.
+type CNAMEError struct {
+	// Target is the SRV target that starts the chain.
+	Target string
+
+	// Chain are the names followed until the problem was detected.
+	Chain []string
+
+	// Reason describes the problem.
+	Reason string
+}
+
+// Error returns the description of the problem in the chain.
+func (c CNAMEError) Error() string {
+	return fmt.Sprintf("dnsdisco: CNAME chain of %s %s (%s)", c.Target, c.Reason, strings.Join(c.Chain, " -> "))
+}
+
+// chaseCNAME follows the CNAME chain of the target until the canonical name,
+// detecting loops and limiting the number of steps to the maximum depth. IP
+// literals aren't aliases, so they are returned without any lookup.
+func chaseCNAME(resolver CNAMEResolver, target string, maxDepth int) (string, error) {
+	if _, ok := IPLiteral(target); ok {
+		return target, nil
+	}
+
+	chain := []string{target}
+	visited := map[string]bool{canonicalKey(target): true}
+
+	name := target
+	for {
+		alias, err := resolver.ResolveCNAME(name)
+		if err != nil {
+			return "", err
+		}
+
+		if alias == "" {
+			return name, nil
+		}
+
+		chain = append(chain, alias)
+		if visited[canonicalKey(alias)] {
+			return "", CNAMEError{Target: target, Chain: chain, Reason: "has a loop"}
+		}
+
+		if len(chain)-1 > maxDepth {
+			return "", CNAMEError{Target: target, Chain: chain, Reason: fmt.Sprintf("is longer than %d", maxDepth)}
+		}
+
+		visited[canonicalKey(alias)] = true
+		name = alias
+	}
+}
+
+// canonicalKey normalizes the name to compare it with other names.
+func canonicalKey(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
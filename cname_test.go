@@ -0,0 +1,100 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetCNAMEChasing(t *testing.T) {
+	t.Parallel()
+
+	aliases := map[string]string{
+		"alias1.example.com.": "alias2.example.com.",
+		"alias2.example.com.": "server.example.net.",
+		"loop1.example.com.":  "loop2.example.com.",
+		"loop2.example.com.":  "LOOP1.example.com.",
+		"long1.example.com.":  "long2.example.com.",
+		"long2.example.com.":  "long3.example.com.",
+		"long3.example.com.":  "long4.example.com.",
+		"long4.example.com.":  "server.example.net.",
+	}
+
+	scenarios := []struct {
+		description           string
+		target                string
+		expectedCanonicalName string
+		expectedHealthy       bool
+		expectedErrors        []error
+	}{
+		{
+			description:           "it should follow the chain",
+			target:                "alias1.example.com.",
+			expectedCanonicalName: "server.example.net.",
+			expectedHealthy:       true,
+		},
+		{
+			description:           "it should keep a target that isn't an alias",
+			target:                "server.example.net.",
+			expectedCanonicalName: "server.example.net.",
+			expectedHealthy:       true,
+		},
+		{
+			description: "it should detect a loop",
+			target:      "loop1.example.com.",
+			expectedErrors: []error{
+				dnsdisco.CNAMEError{
+					Target: "loop1.example.com.",
+					Chain:  []string{"loop1.example.com.", "loop2.example.com.", "LOOP1.example.com."},
+					Reason: "has a loop",
+				},
+			},
+		},
+		{
+			description: "it should limit the chain",
+			target:      "long1.example.com.",
+			expectedErrors: []error{
+				dnsdisco.CNAMEError{
+					Target: "long1.example.com.",
+					Chain:  []string{"long1.example.com.", "long2.example.com.", "long3.example.com.", "long4.example.com."},
+					Reason: "is longer than 2",
+				},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{{Target: scenario.target, Port: 1111}}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return true, nil
+			}))
+			discovery.(dnsdisco.RecordConfigurer).SetCNAMEChasing(dnsdisco.CNAMEResolverFunc(func(name string) (string, error) {
+				return aliases[name], nil
+			}), 2)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			server := discovery.(dnsdisco.Inspector).Servers()[0]
+
+			if server.CanonicalName != scenario.expectedCanonicalName {
+				t.Errorf("mismatch canonical names. Expecting: “%s”; found “%s”", scenario.expectedCanonicalName, server.CanonicalName)
+			}
+
+			if server.Healthy != scenario.expectedHealthy {
+				t.Errorf("mismatch health. Expecting: “%t”; found “%t”", scenario.expectedHealthy, server.Healthy)
+			}
+
+			if errs := discovery.Errors(); !reflect.DeepEqual(errs, scenario.expectedErrors) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedErrors, errs)
+			}
+		})
+	}
+}
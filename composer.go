@@ -0,0 +1,42 @@
+package dnsdisco
+
+import (
+	"net"
+	"strings"
+)
+
+// NameComposer allows the library user to define how the service, proto and
+// name are combined in the name queried by the retrievers, for infrastructures
+// that don't follow the _service._proto.name layout of RFC 2782 (e.g.
+// service.name without underscores, or extra labels for the region).
+type NameComposer interface {
+	// ComposeName returns the name of the SRV records of the service.
+	ComposeName(service, proto, name string) string
+}
+
+// NameComposerFunc is an easy-to-use implementation of the interface that is
+// responsible for composing the names of the SRV records.
+type NameComposerFunc func(service, proto, name string) string
+
+// ComposeName returns the name of the SRV records of the service.
+func (n NameComposerFunc) ComposeName(service, proto, name string) string {
+	return n(service, proto, name)
+}
+
+// NewDefaultNameComposer returns the name composer of RFC 2782, that builds
+// the names in the _service._proto.name format without the trailing dot.
+func NewDefaultNameComposer() NameComposer {
+	return NameComposerFunc(func(service, proto, name string) string {
+		return "_" + service + "._" + proto + "." + strings.TrimSuffix(name, ".")
+	})
+}
+
+// NewComposedRetriever returns a retriever that uses the local resolver, like
+// the default one, but querying the names built by the name composer.
+func NewComposedRetriever(composer NameComposer) Retriever {
+	return RetrieverFunc(func(service, proto, name string) (servers []*net.SRV, err error) {
+		// without service and proto the name is queried directly
+		_, servers, err = net.LookupSRV("", "", composer.ComposeName(service, proto, name))
+		return
+	})
+}
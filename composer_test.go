@@ -0,0 +1,37 @@
+package dnsdisco_test
+
+import (
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestDefaultNameComposer(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description  string
+		name         string
+		expectedName string
+	}{
+		{
+			description:  "it should compose the name in the RFC 2782 format",
+			name:         "registro.br",
+			expectedName: "_jabber._tcp.registro.br",
+		},
+		{
+			description:  "it should remove the trailing dot",
+			name:         "registro.br.",
+			expectedName: "_jabber._tcp.registro.br",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			name := dnsdisco.NewDefaultNameComposer().ComposeName("jabber", "tcp", scenario.name)
+			if name != scenario.expectedName {
+				t.Errorf("mismatch names. Expecting: “%s”; found “%s”", scenario.expectedName, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package dnsdisco
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+)
+
+// Connector is a database/sql driver.Connector that opens each new connection
+// to the target chosen by the discovery, so the database clients fail over
+// between the servers of the SRV records. It can be used with sql.OpenDB.
+type Connector struct {
+	// discovery chooses the targets.
+	discovery Discovery
+
+	// driver opens the connections.
+	driver driver.Driver
+
+	// dsn builds the data source name of the chosen target.
+	dsn func(address string) string
+}
+
+// NewConnector builds a driver.Connector that opens the connections with the
+// driver, using the data source name built by the dsn function for the target
+// chosen by the discovery. The function receives the address of the target
+// (see JoinHostPort), as each driver has its own DSN format. When a connection
+// fails with a network error or driver.ErrBadConn the target is marked as
+// unhealthy (see MarkUnhealthy), so the next connection moves to another
+// server.
+func NewConnector(discovery Discovery, d driver.Driver, dsn func(address string) string) *Connector {
+	return &Connector{
+		discovery: discovery,
+		driver:    d,
+		dsn:       dsn,
+	}
+}
+
+// Connect chooses the best target and opens a connection to it. If there's no
+// server available ErrNoServer is returned.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	target, port := c.discovery.Choose()
+	if target == "" && port == 0 {
+		return nil, ErrNoServer
+	}
+
+	conn, err := c.open(ctx, c.dsn(JoinHostPort(target, port)))
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+			if healthManager, ok := c.discovery.(HealthManager); ok {
+				healthManager.MarkUnhealthy(target, port)
+			}
+		}
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// Driver returns the driver used to open the connections.
+func (c *Connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// open connects using the driver connector when available, so the context is
+// respected.
+func (c *Connector) open(ctx context.Context, name string) (driver.Conn, error) {
+	driverContext, ok := c.driver.(driver.DriverContext)
+	if !ok {
+		return c.driver.Open(name)
+	}
+
+	connector, err := driverContext.OpenConnector(name)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
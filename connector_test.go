@@ -0,0 +1,157 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestConnector(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		openErr         error
+		expectedHealthy bool
+		expectedTargets []string
+	}{
+		{
+			description:     "it should fail over when the connection fails",
+			openErr:         &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			expectedHealthy: false,
+			expectedTargets: []string{"server2.example.com.", "server2.example.com."},
+		},
+		{
+			description:     "it should fail over when the connection is bad",
+			openErr:         driver.ErrBadConn,
+			expectedHealthy: false,
+			expectedTargets: []string{"server2.example.com.", "server2.example.com."},
+		},
+		{
+			description:     "it should keep the server when the error isn't a connection failure",
+			openErr:         errors.New("access denied"),
+			expectedHealthy: true,
+			expectedTargets: []string{"server2.example.com.", "server1.example.com."},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("mysql", "tcp", "example.com")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 3306, Priority: 10, Weight: 10},
+					{Target: "server2.example.com.", Port: 3306, Priority: 20, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			fake := &fakeDriver{failures: map[string]error{
+				"dsn://server1.example.com.:3306": scenario.openErr,
+			}}
+
+			connector := dnsdisco.NewConnector(discovery, fake, func(address string) string {
+				return "dsn://" + address
+			})
+
+			if _, err := connector.Connect(context.Background()); err != scenario.openErr {
+				t.Fatalf("mismatch errors. Expecting: “%v”; found “%v”", scenario.openErr, err)
+			}
+
+			if healthy := discovery.(dnsdisco.Inspector).Servers()[0].Healthy; healthy != scenario.expectedHealthy {
+				t.Errorf("mismatch health. Expecting: “%t”; found “%t”", scenario.expectedHealthy, healthy)
+			}
+
+			var targets []string
+			for range scenario.expectedTargets {
+				target, _ := discovery.Choose()
+				targets = append(targets, target)
+			}
+
+			if !reflect.DeepEqual(targets, scenario.expectedTargets) {
+				t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", scenario.expectedTargets, targets)
+			}
+		})
+	}
+}
+
+func TestConnectorOpenDB(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("postgresql", "tcp", "example.com")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 5432, Priority: 10, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}))
+
+	fake := new(fakeDriver)
+	db := sql.OpenDB(dnsdisco.NewConnector(discovery, fake, func(address string) string {
+		return "postgres://" + address + "/db"
+	}))
+	defer db.Close()
+
+	if err := db.Ping(); err != dnsdisco.ErrNoServer {
+		t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", dnsdisco.ErrNoServer, err)
+	}
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		t.Fatalf("unexpected error while connecting. Details: %s", err)
+	}
+
+	if expected := "postgres://server1.example.com.:5432/db"; fake.opened != expected {
+		t.Errorf("mismatch data source names. Expecting: “%s”; found “%s”", expected, fake.opened)
+	}
+}
+
+// fakeDriver opens connections that do nothing, failing for some data source
+// names.
+type fakeDriver struct {
+	failures map[string]error
+	opened   string
+}
+
+func (f *fakeDriver) Open(name string) (driver.Conn, error) {
+	if err := f.failures[name]; err != nil {
+		return nil, err
+	}
+	f.opened = name
+	return fakeConn{}, nil
+}
+
+// fakeConn is a connection that doesn't support any operation.
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
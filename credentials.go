@@ -0,0 +1,304 @@
+package dnsdisco
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Credentials is the authentication material of a target, for multi-tenant
+// backends with distinct certificates or secrets per host.
+type Credentials struct {
+	// TLSConfig is the TLS configuration used to connect to the target (e.g.
+	// with a client certificate or a private CA). When defined it replaces the
+	// base configuration of DialTLS, and the TLS policies are still applied.
+	TLSConfig *tls.Config
+
+	// Username and Password are sent with the HTTP basic authentication by the
+	// RoundTripper.
+	Username string
+	Password string
+
+	// Token is sent as an HTTP bearer token by the RoundTripper. It has
+	// precedence over the basic authentication.
+	Token string
+}
+
+// CredentialsProvider allows the library user to define the authentication
+// material of each target, loaded from a secret store, files or the
+// environment. The credentials are used by DialTLS, the RoundTripper,
+// NewAuthenticatedHTTPHealthChecker and dbhealth.NewRedisWithCredentials, the
+// other health checkers don't authenticate.
+type CredentialsProvider interface {
+	// Credentials returns the authentication material of the chosen server.
+	// When an error is returned the connection isn't established.
+	Credentials(ctx context.Context, server Server) (Credentials, error)
+}
+
+// CredentialsProviderFunc is an easy-to-use implementation of the interface
+// that is responsible for providing the credentials of the targets.
+type CredentialsProviderFunc func(ctx context.Context, server Server) (Credentials, error)
+
+// Credentials returns the authentication material of the chosen server.
+func (c CredentialsProviderFunc) Credentials(ctx context.Context, server Server) (Credentials, error) {
+	return c(ctx, server)
+}
+
+// redacted replaces the secrets in the descriptions of the credentials.
+const redacted = "[REDACTED]"
+
+// String describes the credentials without the secrets, so they can be logged.
+func (c Credentials) String() string {
+	password, token := "", ""
+	if c.Password != "" {
+		password = redacted
+	}
+	if c.Token != "" {
+		token = redacted
+	}
+	return fmt.Sprintf("{Username:%s Password:%s Token:%s TLS:%t}", c.Username, password, token, c.TLSConfig != nil)
+}
+
+// Redact replaces the password and the token in the text, so messages that
+// could contain them (e.g. the answer of a server refusing the credentials)
+// can be logged and published in the events.
+func (c Credentials) Redact(text string) string {
+	for _, secret := range []string{c.Password, c.Token} {
+		if secret != "" {
+			text = strings.Replace(text, secret, redacted, -1)
+		}
+	}
+	return text
+}
+
+// RedactError returns the error with the secrets replaced in its message (see
+// Redact). The original error is still available with errors.Unwrap.
+func (c Credentials) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if message := c.Redact(err.Error()); message != err.Error() {
+		return redactedError{message: message, err: err}
+	}
+	return err
+}
+
+// redactedError is an error with the secrets removed from its message.
+type redactedError struct {
+	message string
+	err     error
+}
+
+// Error returns the message without the secrets.
+func (r redactedError) Error() string {
+	return r.message
+}
+
+// Unwrap returns the original error.
+func (r redactedError) Unwrap() error {
+	return r.err
+}
+
+// authorization returns the value of the HTTP Authorization header: the bearer
+// token or, when there's no token, the basic authentication. It is empty when
+// there are no credentials.
+func (c Credentials) authorization() string {
+	if c.Token != "" {
+		return "Bearer " + c.Token
+	}
+
+	if c.Username != "" || c.Password != "" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password))
+	}
+	return ""
+}
+
+// NewStaticCredentialsProvider returns a credentials provider that uses the
+// same authentication material for all targets (e.g. the token of a health
+// check endpoint shared by all servers).
+func NewStaticCredentialsProvider(credentials Credentials) CredentialsProvider {
+	return CredentialsProviderFunc(func(ctx context.Context, server Server) (Credentials, error) {
+		return credentials, nil
+	})
+}
+
+// NewEnvCredentialsProvider returns a credentials provider that reads the
+// environment variables of each target, named with the prefix and the target
+// in upper case with the non-alphanumeric characters replaced by underscores
+// (e.g. "PREFIX_SERVER1_EXAMPLE_COM_TOKEN" for server1.example.com). The
+// suffixes _TOKEN, _USERNAME and _PASSWORD are supported.
+func NewEnvCredentialsProvider(prefix string) CredentialsProvider {
+	return CredentialsProviderFunc(func(ctx context.Context, server Server) (Credentials, error) {
+		name := prefix + "_" + envName(server.Target)
+		return Credentials{
+			Username: os.Getenv(name + "_USERNAME"),
+			Password: os.Getenv(name + "_PASSWORD"),
+			Token:    os.Getenv(name + "_TOKEN"),
+		}, nil
+	})
+}
+
+// NewFileCredentialsProvider returns a credentials provider that reads the
+// files of each target from a subdirectory named after it (e.g.
+// "dir/server1.example.com"): the client certificate "cert.pem" and key
+// "key.pem", the CA bundle "ca.pem" and the bearer token "token". Missing
+// files are ignored, and the files are checked on every connection, so rotated
+// secrets are used without restarting the application. The TLS configuration
+// is only built again when the certificate files change (modification time or
+// size), so the same configuration is returned meanwhile.
+func NewFileCredentialsProvider(dir string) CredentialsProvider {
+	var tlsConfigs sync.Map
+	return CredentialsProviderFunc(func(ctx context.Context, server Server) (Credentials, error) {
+		var credentials Credentials
+
+		// the target comes from the DNS, so it must not escape the directory
+		target := canonicalKey(server.Target)
+		if target == "" || target == ".." || strings.ContainsAny(target, `/\`) {
+			return credentials, fmt.Errorf("dnsdisco: invalid target %q for credentials files", server.Target)
+		}
+		targetDir := filepath.Join(dir, target)
+
+		token, err := readOptionalFile(filepath.Join(targetDir, "token"))
+		if err != nil {
+			return credentials, err
+		}
+		credentials.Token = strings.TrimSpace(string(token))
+
+		stamp, err := filesStamp(targetDir, "cert.pem", "key.pem", "ca.pem")
+		if err != nil {
+			return credentials, err
+		}
+
+		if cached, ok := tlsConfigs.Load(target); ok && cached.(fileTLSConfig).stamp == stamp {
+			credentials.TLSConfig = cached.(fileTLSConfig).config
+			return credentials, nil
+		}
+
+		certPEM, err := readOptionalFile(filepath.Join(targetDir, "cert.pem"))
+		if err != nil {
+			return credentials, err
+		}
+
+		keyPEM, err := readOptionalFile(filepath.Join(targetDir, "key.pem"))
+		if err != nil {
+			return credentials, err
+		}
+
+		caPEM, err := readOptionalFile(filepath.Join(targetDir, "ca.pem"))
+		if err != nil {
+			return credentials, err
+		}
+
+		if certPEM == nil && caPEM == nil {
+			tlsConfigs.Delete(target)
+			return credentials, nil
+		}
+
+		credentials.TLSConfig = new(tls.Config)
+		if certPEM != nil {
+			certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				return credentials, err
+			}
+			credentials.TLSConfig.Certificates = []tls.Certificate{certificate}
+		}
+
+		if caPEM != nil {
+			credentials.TLSConfig.RootCAs = x509.NewCertPool()
+			if !credentials.TLSConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+				return credentials, fmt.Errorf("dnsdisco: no certificate found in the CA bundle of %s", server.Target)
+			}
+		}
+
+		tlsConfigs.Store(target, fileTLSConfig{stamp: stamp, config: credentials.TLSConfig})
+		return credentials, nil
+	})
+}
+
+// fileTLSConfig is the TLS configuration built from the certificate files of
+// a target, identified by the state of the files.
+type fileTLSConfig struct {
+	stamp  string
+	config *tls.Config
+}
+
+// filesStamp describes the modification time and the size of the files in
+// the directory, to detect when they change. The missing files are also
+// described.
+func filesStamp(dir string, names ...string) (string, error) {
+	var stamp strings.Builder
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			stamp.WriteString("-;")
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&stamp, "%d:%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp.String(), nil
+}
+
+// SetCredentialsProvider defines the authentication material of each target,
+// used by DialTLS and the RoundTripper. When nil no credentials are used. It
+// is go routine safe.
+func (d *discovery) SetCredentialsProvider(provider CredentialsProvider) {
+	d.credentialsProviderLock.Lock()
+	defer d.credentialsProviderLock.Unlock()
+	d.credentialsProvider = provider
+}
+
+// Credentials returns the authentication material of the target, using the
+// credentials provider. When there's no provider empty credentials are
+// returned.
+func (d *discovery) Credentials(ctx context.Context, target string, port uint16) (Credentials, error) {
+	d.credentialsProviderLock.RLock()
+	provider := d.credentialsProvider
+	d.credentialsProviderLock.RUnlock()
+
+	if provider == nil {
+		return Credentials{}, nil
+	}
+
+	server := Server{SRV: net.SRV{Target: target, Port: port}}
+	for _, candidate := range d.Servers() {
+		if candidate.Target == target && candidate.Port == port {
+			server = candidate
+			break
+		}
+	}
+
+	return provider.Credentials(ctx, server)
+}
+
+// envName converts the target to the format of an environment variable name.
+func envName(target string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, canonicalKey(target))
+}
+
+// readOptionalFile reads the file, returning nil when it doesn't exist.
+func readOptionalFile(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
@@ -0,0 +1,234 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestCredentialsProvider(t *testing.T) {
+	t.Parallel()
+
+	authorization := make(chan string, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization <- r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	cert, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(cert)
+
+	discovery := dnsdisco.NewDiscovery("https", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "127.0.0.1", Port: serverPort(t, server.URL), Priority: 10, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	}))
+	discovery.(dnsdisco.ConnectionConfigurer).SetCredentialsProvider(dnsdisco.CredentialsProviderFunc(func(ctx context.Context, server dnsdisco.Server) (dnsdisco.Credentials, error) {
+		credentials := dnsdisco.Credentials{Token: "secret-" + server.Target}
+		credentials.TLSConfig = &tls.Config{RootCAs: rootCAs}
+		return credentials, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	t.Run("it should authenticate the HTTP requests", func(t *testing.T) {
+		client := http.Client{Transport: dnsdisco.NewRoundTripper(discovery, new(http.Transport))}
+		response, err := client.Get("https://api.registro.br/domains")
+		if err != nil {
+			t.Fatalf("unexpected error “%v”", err)
+		}
+		response.Body.Close()
+
+		if header := <-authorization; header != "Bearer secret-127.0.0.1" {
+			t.Errorf("mismatch authorization headers. Expecting: “Bearer secret-127.0.0.1”; found “%s”", header)
+		}
+	})
+
+	t.Run("it should use the TLS configuration of the target", func(t *testing.T) {
+		conn, err := discovery.(dnsdisco.Dialer).DialTLS(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("unexpected error “%v”", err)
+		}
+		conn.Close()
+	})
+}
+
+func TestEnvCredentialsProvider(t *testing.T) {
+	t.Parallel()
+
+	os.Setenv("DNSDISCO_TEST_SERVER1_EXAMPLE_COM_USERNAME", "user")
+	os.Setenv("DNSDISCO_TEST_SERVER1_EXAMPLE_COM_PASSWORD", "password")
+	defer os.Unsetenv("DNSDISCO_TEST_SERVER1_EXAMPLE_COM_USERNAME")
+	defer os.Unsetenv("DNSDISCO_TEST_SERVER1_EXAMPLE_COM_PASSWORD")
+
+	provider := dnsdisco.NewEnvCredentialsProvider("DNSDISCO_TEST")
+	credentials, err := provider.Credentials(context.Background(), dnsdisco.Server{
+		SRV: net.SRV{Target: "server1.example.com.", Port: 1111},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if credentials.Username != "user" || credentials.Password != "password" || credentials.Token != "" {
+		t.Errorf("unexpected credentials “%s”/“%s” (token “%s”)", credentials.Username, credentials.Password, credentials.Token)
+	}
+}
+
+func TestFileCredentialsProvider(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "dnsdisco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	targetDir := filepath.Join(dir, "server1.example.com")
+	if err := os.Mkdir(targetDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(targetDir, "token"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	if err := ioutil.WriteFile(filepath.Join(targetDir, "ca.pem"), caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		description   string
+		target        string
+		expectedToken string
+		expectedTLS   bool
+		expectedError bool
+	}{
+		{
+			description:   "it should read the files of the target",
+			target:        "SERVER1.example.com.",
+			expectedToken: "secret",
+			expectedTLS:   true,
+		},
+		{
+			description: "it should ignore the missing files",
+			target:      "server2.example.com.",
+		},
+		{
+			description:   "it should not escape the directory",
+			target:        "../server1.example.com",
+			expectedError: true,
+		},
+	}
+
+	provider := dnsdisco.NewFileCredentialsProvider(dir)
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			credentials, err := provider.Credentials(context.Background(), dnsdisco.Server{
+				SRV: net.SRV{Target: scenario.target, Port: 1111},
+			})
+
+			if (err != nil) != scenario.expectedError {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			if credentials.Token != scenario.expectedToken {
+				t.Errorf("mismatch tokens. Expecting: “%s”; found “%s”", scenario.expectedToken, credentials.Token)
+			}
+
+			if (credentials.TLSConfig != nil) != scenario.expectedTLS {
+				t.Errorf("mismatch TLS configurations. Expecting: “%t”; found “%t”", scenario.expectedTLS, credentials.TLSConfig != nil)
+			}
+		})
+	}
+
+	server1 := dnsdisco.Server{SRV: net.SRV{Target: "server1.example.com.", Port: 1111}}
+
+	first, err := provider.Credentials(context.Background(), server1)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	second, err := provider.Credentials(context.Background(), server1)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if first.TLSConfig != second.TLSConfig {
+		t.Error("TLS configuration built again without changes in the files")
+	}
+
+	// the rotated certificate files must be used
+	modified := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(targetDir, "ca.pem"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := provider.Credentials(context.Background(), server1)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if rotated.TLSConfig == first.TLSConfig {
+		t.Error("TLS configuration not built again after the files changed")
+	}
+}
+
+func TestCredentialsRedact(t *testing.T) {
+	t.Parallel()
+
+	credentials := dnsdisco.Credentials{
+		Username: "monitor",
+		Password: "p4ssw0rd",
+		Token:    "t0k3n",
+	}
+
+	expected := "{Username:monitor Password:[REDACTED] Token:[REDACTED] TLS:false}"
+	if text := fmt.Sprintf("%v", credentials); text != expected {
+		t.Errorf("mismatch description. Expecting: “%s”; found “%s”", expected, text)
+	}
+
+	original := errors.New("refused p4ssw0rd and t0k3n of monitor")
+	err := credentials.RedactError(original)
+
+	expected = "refused [REDACTED] and [REDACTED] of monitor"
+	if err.Error() != expected {
+		t.Errorf("mismatch error. Expecting: “%s”; found “%s”", expected, err)
+	}
+
+	if !errors.Is(err, original) {
+		t.Error("the original error should be available")
+	}
+
+	if err := credentials.RedactError(nil); err != nil {
+		t.Errorf("unexpected error redacting a nil error: %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+// Package dbhealth provides protocol-aware health checkers for databases
+// (MySQL, PostgreSQL and Redis) discovered via SRV records. A simple TCP
+// connection succeeds while the database is still starting up or recovering,
+// so these checkers complete the initial handshake of each protocol, without
+// authenticating, to detect if the server can really accept clients. For Redis
+// servers that require the authentication, NewRedisWithCredentials also
+// verifies that the credentials are accepted. The MySQL and PostgreSQL checkers
+// don't support credentials, as the handshake stops before the authentication.
+//
+// The checkers only use the standard library, so no database driver is needed.
+package dbhealth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+// defaultTimeout limits the connection and the handshake when no timeout is
+// defined.
+const defaultTimeout = 5 * time.Second
+
+// ErrUnexpectedResponse is returned when the server answers something that
+// isn't part of the expected protocol.
+var ErrUnexpectedResponse = errors.New("dbhealth: unexpected response")
+
+// ServerError is returned when the database refuses the client during the
+// handshake, e.g. because it is starting up, recovering or loading the data.
+type ServerError struct {
+	// Protocol is the database protocol ("mysql", "postgresql" or "redis").
+	Protocol string
+
+	// Code is the error code reported by the server, if any.
+	Code string
+
+	// Message is the error description reported by the server.
+	Message string
+}
+
+// Error returns the error reported by the server.
+func (s ServerError) Error() string {
+	if s.Code == "" {
+		return fmt.Sprintf("dbhealth: %s server error: %s", s.Protocol, s.Message)
+	}
+	return fmt.Sprintf("dbhealth: %s server error %s: %s", s.Protocol, s.Code, s.Message)
+}
+
+// NewMySQL returns a health checker that reads the initial handshake packet of
+// a MySQL (or MariaDB) server. The server is healthy when it sends the
+// protocol version 10 greeting, and unhealthy when it sends an error packet
+// (e.g. too many connections or host blocked). The timeout limits the whole
+// check (5 seconds when zero).
+func NewMySQL(timeout time.Duration) dnsdisco.HealthChecker {
+	return check(timeout, func(conn net.Conn) error {
+		var header [4]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return err
+		}
+
+		length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+		if length == 0 {
+			return ErrUnexpectedResponse
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return err
+		}
+
+		switch payload[0] {
+		case 0x0a:
+			return nil
+		case 0xff:
+			return mysqlError(payload)
+		}
+		return ErrUnexpectedResponse
+	})
+}
+
+// mysqlError parses the error packet of MySQL: the marker, the error code
+// (little endian), optionally the SQL state and the message.
+func mysqlError(payload []byte) error {
+	if len(payload) < 3 {
+		return ErrUnexpectedResponse
+	}
+
+	serverErr := ServerError{
+		Protocol: "mysql",
+		Code:     fmt.Sprintf("%d", binary.LittleEndian.Uint16(payload[1:3])),
+	}
+
+	message := payload[3:]
+	if len(message) >= 6 && message[0] == '#' {
+		message = message[6:]
+	}
+	serverErr.Message = string(message)
+	return serverErr
+}
+
+// PostgreSQL error codes (SQLSTATE) that report that the server can't accept
+// connections now.
+const (
+	// postgresCannotConnectNow is reported while the server is starting up,
+	// shutting down or recovering.
+	postgresCannotConnectNow = "57P03"
+
+	// postgresTooManyConnections is reported when the connection limit was
+	// reached.
+	postgresTooManyConnections = "53300"
+)
+
+// NewPostgreSQL returns a health checker that sends the startup message of the
+// PostgreSQL protocol 3.0 with the given user (and database with the same
+// name) and closes the connection at the first answer. The server is healthy
+// when it asks for the authentication or refuses the user, and unhealthy when
+// it is starting up, shutting down, recovering or without free connections.
+// The timeout limits the whole check (5 seconds when zero).
+func NewPostgreSQL(user string, timeout time.Duration) dnsdisco.HealthChecker {
+	return check(timeout, func(conn net.Conn) error {
+		var parameters bytes.Buffer
+		parameters.WriteString("user\x00" + user + "\x00")
+		parameters.WriteString("\x00")
+
+		message := make([]byte, 8, 8+parameters.Len())
+		binary.BigEndian.PutUint32(message[0:4], uint32(8+parameters.Len()))
+		binary.BigEndian.PutUint32(message[4:8], 3<<16) // protocol 3.0
+		message = append(message, parameters.Bytes()...)
+
+		if _, err := conn.Write(message); err != nil {
+			return err
+		}
+
+		var header [5]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return err
+		}
+
+		length := int(binary.BigEndian.Uint32(header[1:5])) - 4
+		if length < 0 || length > 64*1024 {
+			return ErrUnexpectedResponse
+		}
+
+		body := make([]byte, length)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return err
+		}
+
+		switch header[0] {
+		case 'R':
+			// authentication request, the server is ready for clients
+			return nil
+		case 'E':
+			serverErr := postgresError(body)
+			if serverErr.Code == postgresCannotConnectNow || serverErr.Code == postgresTooManyConnections {
+				return serverErr
+			}
+
+			// other errors (e.g. unknown user) are reported after the startup, so
+			// the server is working
+			return nil
+		}
+		return ErrUnexpectedResponse
+	})
+}
+
+// postgresError parses the fields of the PostgreSQL error response.
+func postgresError(body []byte) ServerError {
+	serverErr := ServerError{Protocol: "postgresql"}
+	for _, field := range bytes.Split(body, []byte{0}) {
+		if len(field) < 2 {
+			continue
+		}
+
+		switch field[0] {
+		case 'C':
+			serverErr.Code = string(field[1:])
+		case 'M':
+			serverErr.Message = string(field[1:])
+		}
+	}
+	return serverErr
+}
+
+// NewRedis returns a health checker that sends a PING command to a Redis
+// server. The server is healthy when it answers PONG or requires the
+// authentication (NOAUTH), and unhealthy when it is loading the dataset, busy
+// running a script or when the replica lost the connection with the master.
+// The timeout limits the whole check (5 seconds when zero).
+func NewRedis(timeout time.Duration) dnsdisco.HealthChecker {
+	return check(timeout, func(conn net.Conn) error {
+		err := redisPing(bufio.NewReader(conn), conn)
+		if serverErr, ok := err.(ServerError); ok && serverErr.Code == "NOAUTH" {
+			return nil
+		}
+		return err
+	})
+}
+
+// NewRedisWithCredentials works like NewRedis, but authenticates with the
+// credentials of each server before the PING command (AUTH with the password,
+// and the username when defined, for Redis 6 ACLs). The server is unhealthy
+// when it refuses the credentials or still requires the authentication. The
+// secrets are redacted from the returned errors, so they aren't exposed in the
+// logs and events.
+func NewRedisWithCredentials(timeout time.Duration, provider dnsdisco.CredentialsProvider) dnsdisco.ServerHealthChecker {
+	return dnsdisco.ServerHealthCheckerFunc(func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+		credentials, err := provider.Credentials(ctx, server)
+		if err != nil {
+			return dnsdisco.HealthStatusUnhealthy, err
+		}
+
+		healthChecker := check(timeout, func(conn net.Conn) error {
+			reader := bufio.NewReader(conn)
+
+			if credentials.Password != "" {
+				auth := []string{"AUTH", credentials.Password}
+				if credentials.Username != "" {
+					auth = []string{"AUTH", credentials.Username, credentials.Password}
+				}
+
+				if _, err := redisCommand(reader, conn, auth...); err != nil {
+					return err
+				}
+			}
+
+			return redisPing(reader, conn)
+		})
+
+		target, port, proto := server.Target, server.Port, "tcp"
+		if server.UnixSocket != "" {
+			target, port, proto = server.UnixSocket, 0, "unix"
+		}
+
+		if _, err := healthChecker.HealthCheck(target, port, proto); err != nil {
+			return dnsdisco.HealthStatusUnhealthy, credentials.RedactError(err)
+		}
+		return dnsdisco.HealthStatusHealthy, nil
+	})
+}
+
+// redisPing sends the PING command, expecting the PONG answer.
+func redisPing(reader *bufio.Reader, conn net.Conn) error {
+	reply, err := redisCommand(reader, conn, "PING")
+	if err != nil {
+		return err
+	}
+
+	if reply != "PONG" {
+		return ErrUnexpectedResponse
+	}
+	return nil
+}
+
+// redisCommand sends the command with the RESP protocol, returning the simple
+// string answer (e.g. OK or PONG). Error answers are returned as ServerError.
+func redisCommand(reader *bufio.Reader, conn net.Conn, args ...string) (string, error) {
+	var command bytes.Buffer
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := conn.Write(command.Bytes()); err != nil {
+		return "", err
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, "+") {
+		return line[1:], nil
+	}
+
+	if !strings.HasPrefix(line, "-") {
+		return "", ErrUnexpectedResponse
+	}
+
+	code, message := line[1:], ""
+	if i := strings.Index(code, " "); i >= 0 {
+		code, message = code[:i], code[i+1:]
+	}
+	return "", ServerError{Protocol: "redis", Code: code, Message: message}
+}
+
+// check connects to the server, using the proto of the discovery ("tcp" or
+// "unix" for sockets), and runs the handshake within the timeout.
+func check(timeout time.Duration, handshake func(conn net.Conn) error) dnsdisco.HealthChecker {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		address := dnsdisco.JoinHostPort(target, port)
+		if proto == "unix" {
+			address = target
+		} else if proto != "tcp" {
+			return false, net.UnknownNetworkError(proto)
+		}
+
+		conn, err := net.DialTimeout(proto, address, timeout)
+		if err != nil {
+			return false, err
+		}
+		defer conn.Close()
+
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return false, err
+		}
+
+		if err := handshake(conn); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+}
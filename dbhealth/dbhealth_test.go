@@ -0,0 +1,363 @@
+package dbhealth_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/dbhealth"
+)
+
+func TestMySQL(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description   string
+		packet        []byte
+		expectedOK    bool
+		expectedError error
+	}{
+		{
+			description: "it should accept the protocol 10 greeting",
+			packet:      mysqlPacket(append([]byte{0x0a}, "8.0.36\x00"...)),
+			expectedOK:  true,
+		},
+		{
+			description: "it should detect the error packet",
+			packet:      mysqlPacket(append([]byte{0xff, 0x10, 0x04}, "#08004Too many connections"...)),
+			expectedError: dbhealth.ServerError{
+				Protocol: "mysql",
+				Code:     "1040",
+				Message:  "Too many connections",
+			},
+		},
+		{
+			description:   "it should detect an unknown protocol",
+			packet:        mysqlPacket([]byte{0x09}),
+			expectedError: dbhealth.ErrUnexpectedResponse,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			port, stop := startServer(t, func(conn net.Conn) {
+				conn.Write(scenario.packet)
+			})
+			defer stop()
+
+			ok, err := dbhealth.NewMySQL(time.Second).HealthCheck("127.0.0.1", port, "tcp")
+			if ok != scenario.expectedOK || !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch results. Expecting: “%t” (%v); found “%t” (%v)", scenario.expectedOK, scenario.expectedError, ok, err)
+			}
+		})
+	}
+}
+
+func TestPostgreSQL(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description   string
+		message       []byte
+		expectedOK    bool
+		expectedError error
+	}{
+		{
+			description: "it should accept the authentication request",
+			message:     postgresMessage('R', []byte{0, 0, 0, 5, 1, 2, 3, 4}),
+			expectedOK:  true,
+		},
+		{
+			description: "it should accept an unknown user",
+			message:     postgresMessage('E', []byte("SFATAL\x00C28000\x00Mrole \"dnsdisco\" does not exist\x00\x00")),
+			expectedOK:  true,
+		},
+		{
+			description: "it should detect a server starting up",
+			message:     postgresMessage('E', []byte("SFATAL\x00C57P03\x00Mthe database system is starting up\x00\x00")),
+			expectedError: dbhealth.ServerError{
+				Protocol: "postgresql",
+				Code:     "57P03",
+				Message:  "the database system is starting up",
+			},
+		},
+		{
+			description:   "it should detect an unknown message",
+			message:       postgresMessage('X', nil),
+			expectedError: dbhealth.ErrUnexpectedResponse,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			startup := make(chan []byte, 1)
+			port, stop := startServer(t, func(conn net.Conn) {
+				var length [4]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+
+				message := make([]byte, binary.BigEndian.Uint32(length[:])-4)
+				if _, err := io.ReadFull(conn, message); err != nil {
+					return
+				}
+				startup <- message
+
+				conn.Write(scenario.message)
+			})
+			defer stop()
+
+			ok, err := dbhealth.NewPostgreSQL("dnsdisco", time.Second).HealthCheck("127.0.0.1", port, "tcp")
+			if ok != scenario.expectedOK || !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch results. Expecting: “%t” (%v); found “%t” (%v)", scenario.expectedOK, scenario.expectedError, ok, err)
+			}
+
+			expectedStartup := append([]byte{0, 3, 0, 0}, "user\x00dnsdisco\x00\x00"...)
+			if message := <-startup; !reflect.DeepEqual(message, expectedStartup) {
+				t.Errorf("mismatch startup messages. Expecting: “%q”; found “%q”", expectedStartup, message)
+			}
+		})
+	}
+}
+
+func TestRedis(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description   string
+		reply         string
+		expectedOK    bool
+		expectedError error
+	}{
+		{
+			description: "it should accept the PONG",
+			reply:       "+PONG\r\n",
+			expectedOK:  true,
+		},
+		{
+			description: "it should accept a server that requires authentication",
+			reply:       "-NOAUTH Authentication required.\r\n",
+			expectedOK:  true,
+		},
+		{
+			description: "it should detect a server loading the dataset",
+			reply:       "-LOADING Redis is loading the dataset in memory\r\n",
+			expectedError: dbhealth.ServerError{
+				Protocol: "redis",
+				Code:     "LOADING",
+				Message:  "Redis is loading the dataset in memory",
+			},
+		},
+		{
+			description:   "it should detect an unknown reply",
+			reply:         ":1\r\n",
+			expectedError: dbhealth.ErrUnexpectedResponse,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			port, stop := startServer(t, func(conn net.Conn) {
+				reader := bufio.NewReader(conn)
+				for i := 0; i < 3; i++ {
+					if _, err := reader.ReadString('\n'); err != nil {
+						return
+					}
+				}
+				conn.Write([]byte(scenario.reply))
+			})
+			defer stop()
+
+			ok, err := dbhealth.NewRedis(time.Second).HealthCheck("127.0.0.1", port, "tcp")
+			if ok != scenario.expectedOK || !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch results. Expecting: “%t” (%v); found “%t” (%v)", scenario.expectedOK, scenario.expectedError, ok, err)
+			}
+		})
+	}
+}
+
+func TestRedisWithCredentials(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		credentials     dnsdisco.Credentials
+		expectedCommand string
+		reply           string
+		expectedStatus  dnsdisco.HealthStatus
+		expectedError   string
+	}{
+		{
+			description:     "it should authenticate with the password",
+			credentials:     dnsdisco.Credentials{Password: "s3cr3t"},
+			expectedCommand: "*2\r\n$4\r\nAUTH\r\n$6\r\ns3cr3t\r\n*1\r\n$4\r\nPING\r\n",
+			reply:           "+OK\r\n+PONG\r\n",
+			expectedStatus:  dnsdisco.HealthStatusHealthy,
+		},
+		{
+			description:     "it should authenticate with the username and password",
+			credentials:     dnsdisco.Credentials{Username: "monitor", Password: "s3cr3t"},
+			expectedCommand: "*3\r\n$4\r\nAUTH\r\n$7\r\nmonitor\r\n$6\r\ns3cr3t\r\n*1\r\n$4\r\nPING\r\n",
+			reply:           "+OK\r\n+PONG\r\n",
+			expectedStatus:  dnsdisco.HealthStatusHealthy,
+		},
+		{
+			description:     "it should redact the refused credentials",
+			credentials:     dnsdisco.Credentials{Password: "s3cr3t"},
+			expectedCommand: "*2\r\n$4\r\nAUTH\r\n$6\r\ns3cr3t\r\n",
+			reply:           "-WRONGPASS invalid password s3cr3t\r\n",
+			expectedStatus:  dnsdisco.HealthStatusUnhealthy,
+			expectedError:   "dbhealth: redis server error WRONGPASS: invalid password [REDACTED]",
+		},
+		{
+			description:     "it should detect missing credentials",
+			expectedCommand: "*1\r\n$4\r\nPING\r\n",
+			reply:           "-NOAUTH Authentication required.\r\n",
+			expectedStatus:  dnsdisco.HealthStatusUnhealthy,
+			expectedError:   "dbhealth: redis server error NOAUTH: Authentication required.",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			commands := make(chan string, 1)
+			port, stop := startServer(t, func(conn net.Conn) {
+				// each command is answered before the client sends the next one
+				var received strings.Builder
+				defer func() { commands <- received.String() }()
+
+				reader := bufio.NewReader(conn)
+				for _, reply := range strings.SplitAfter(scenario.reply, "\r\n") {
+					if reply == "" {
+						return
+					}
+
+					header, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					received.WriteString(header)
+
+					args, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+					for i := 0; i < 2*args; i++ {
+						line, err := reader.ReadString('\n')
+						if err != nil {
+							return
+						}
+						received.WriteString(line)
+					}
+
+					conn.Write([]byte(reply))
+				}
+			})
+			defer stop()
+
+			server := dnsdisco.Server{SRV: net.SRV{Target: "127.0.0.1", Port: port}}
+			healthChecker := dbhealth.NewRedisWithCredentials(time.Second, dnsdisco.NewStaticCredentialsProvider(scenario.credentials))
+
+			status, err := healthChecker.HealthCheck(context.Background(), server)
+
+			var errMessage string
+			if err != nil {
+				errMessage = err.Error()
+			}
+
+			if status != scenario.expectedStatus || errMessage != scenario.expectedError {
+				t.Errorf("mismatch results. Expecting: “%s” (%s); found “%s” (%s)", scenario.expectedStatus, scenario.expectedError, status, errMessage)
+			}
+
+			if command := <-commands; command != scenario.expectedCommand {
+				t.Errorf("mismatch commands. Expecting: “%q”; found “%q”", scenario.expectedCommand, command)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	// the server accepts the connection but never sends the greeting, like a
+	// database that is still starting up
+	port, stop := startServer(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+	})
+	defer stop()
+
+	ok, err := dbhealth.NewMySQL(100*time.Millisecond).HealthCheck("127.0.0.1", port, "tcp")
+
+	var netErr net.Error
+	if ok || !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("expected a timeout; found “%t” (%v)", ok, err)
+	}
+}
+
+func TestUnknownProto(t *testing.T) {
+	t.Parallel()
+
+	ok, err := dbhealth.NewRedis(time.Second).HealthCheck("127.0.0.1", 6379, "udp")
+	if expected := net.UnknownNetworkError("udp"); ok || err != expected {
+		t.Errorf("mismatch results. Expecting: “false” (%v); found “%t” (%v)", expected, ok, err)
+	}
+}
+
+// check that the checkers can be adapted to the discovery
+var _ dnsdisco.ServerHealthChecker = dnsdisco.AdaptHealthChecker(dbhealth.NewRedis(0), "tcp")
+
+// mysqlPacket builds a MySQL packet with the sequence zero.
+func mysqlPacket(payload []byte) []byte {
+	length := len(payload)
+	return append([]byte{byte(length), byte(length >> 8), byte(length >> 16), 0}, payload...)
+}
+
+// postgresMessage builds a PostgreSQL backend message.
+func postgresMessage(kind byte, body []byte) []byte {
+	message := []byte{kind, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(message[1:], uint32(len(body)+4))
+	return append(message, body...)
+}
+
+// startServer runs a local TCP server that handles each connection with the
+// given function, returning the port and a function to stop it.
+func startServer(t *testing.T, handle func(conn net.Conn)) (uint16, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+
+	return uint16(listener.Addr().(*net.TCPAddr).Port), func() { listener.Close() }
+}
@@ -0,0 +1,36 @@
+package dnsdisco
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// DebugHandler returns an http.Handler that writes the snapshot of the
+// discovery in JSON (see Snapshot), including the health history of each
+// server, so operators can see flapping patterns instead of only the last
+// health status. Only the GET method is accepted, and a discovery that doesn't
+// implement the Inspector interface answers with 501 (Not Implemented).
+func DebugHandler(discovery Discovery) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		inspector, ok := discovery.(Inspector)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+			return
+		}
+
+		data, err := json.Marshal(inspector.Snapshot())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
@@ -0,0 +1,70 @@
+package dnsdisco_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestDebugHandler(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	scenarios := []struct {
+		description    string
+		method         string
+		expectedStatus int
+	}{
+		{
+			description:    "it should write the snapshot",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "it should refuse other methods",
+			method:         http.MethodPost,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			dnsdisco.DebugHandler(discovery).ServeHTTP(w, httptest.NewRequest(scenario.method, "/debug/dnsdisco", nil))
+
+			if w.Code != scenario.expectedStatus {
+				t.Fatalf("mismatch status. Expecting: “%d”; found “%d”", scenario.expectedStatus, w.Code)
+			}
+
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var snapshot dnsdisco.Snapshot
+			if err := json.Unmarshal(w.Body.Bytes(), &snapshot); err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			if len(snapshot.Servers) != 1 || len(snapshot.Servers[0].HealthHistory) != 1 {
+				t.Errorf("unexpected snapshot “%#v”", snapshot)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package dnsdisco
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DuplicateMerge defines how the SRV records with the same target and port
+// are merged.
+type DuplicateMerge int
+
+// List of possible strategies to merge the duplicated records.
+const (
+	// DuplicateKeepAll keeps all duplicated records, as retrieved. This is the
+	// default strategy.
+	DuplicateKeepAll DuplicateMerge = iota
+
+	// DuplicateKeepFirst keeps only the record with the best priority,
+	// dropping the other ones.
+	DuplicateKeepFirst
+
+	// DuplicateSumWeights keeps only the record with the best priority, with
+	// the sum of the weights of the duplicated records of the same priority
+	// (limited to the maximum weight of 65535).
+	DuplicateSumWeights
+)
+
+// DuplicatePolicy protects the load balancers from zones that accidentally
+// multiply the SRV records of the same target. The zero value keeps all
+// records.
+type DuplicatePolicy struct {
+	// MaxPerTarget is the maximum number of records accepted for the same
+	// target (with different ports), keeping the ones with the best priority.
+	// Zero means no limit.
+	MaxPerTarget int
+
+	// Merge defines how the records with the same target and port are merged.
+	Merge DuplicateMerge
+}
+
+// DuplicateError is reported in the Errors method for each SRV record dropped
+// or merged by the duplicate policy.
+type DuplicateError struct {
+	// Target is the target of the record.
+	Target string
+
+	// Port is the port of the record.
+	Port uint16
+
+	// Reason describes why the record was dropped or merged.
+	Reason string
+}
+
+// Error returns the description of the duplicated record.
+func (d DuplicateError) Error() string {
+	return fmt.Sprintf("dnsdisco: duplicated record %s:%d %s", d.Target, d.Port, d.Reason)
+}
+
+// apply merges and drops the duplicated records. The servers must be already
+// normalized, so the ones with the best priority are kept. The accepted
+// records are copies, so the answers cached by the retrievers aren't changed.
+func (p DuplicatePolicy) apply(srvs []*net.SRV) (accepted []*net.SRV, warnings []error) {
+	if p.MaxPerTarget <= 0 && p.Merge == DuplicateKeepAll {
+		return srvs, nil
+	}
+
+	merged := make(map[string]*net.SRV)
+	perTarget := make(map[string]int)
+
+	for _, srv := range srvs {
+		target := strings.ToLower(strings.TrimSuffix(srv.Target, "."))
+		key := target + ":" + strconv.FormatUint(uint64(srv.Port), 10)
+
+		if existing, ok := merged[key]; ok && p.Merge != DuplicateKeepAll {
+			if p.Merge == DuplicateSumWeights && existing.Priority == srv.Priority {
+				weight := int(existing.Weight) + int(srv.Weight)
+				if weight > 65535 {
+					weight = 65535
+				}
+				existing.Weight = uint16(weight)
+				warnings = append(warnings, DuplicateError{Target: srv.Target, Port: srv.Port, Reason: "merged"})
+			} else {
+				warnings = append(warnings, DuplicateError{Target: srv.Target, Port: srv.Port, Reason: "dropped"})
+			}
+			continue
+		}
+
+		if p.MaxPerTarget > 0 && perTarget[target] == p.MaxPerTarget {
+			reason := fmt.Sprintf("dropped (more than %d records for the target)", p.MaxPerTarget)
+			warnings = append(warnings, DuplicateError{Target: srv.Target, Port: srv.Port, Reason: reason})
+			continue
+		}
+		perTarget[target]++
+
+		accepted = append(accepted, &net.SRV{
+			Target:   srv.Target,
+			Port:     srv.Port,
+			Priority: srv.Priority,
+			Weight:   srv.Weight,
+		})
+		merged[key] = accepted[len(accepted)-1]
+	}
+
+	return accepted, warnings
+}
+
+// SetDuplicatePolicy changes how the SRV records pointing to the same target
+// are accepted on each refresh. The dropped and merged records are reported as
+// DuplicateError in the Errors method. By default all records are kept. It is
+// go routine safe.
+func (d *discovery) SetDuplicatePolicy(policy DuplicatePolicy) {
+	d.limitsLock.Lock()
+	defer d.limitsLock.Unlock()
+	d.duplicatePolicy = policy
+}
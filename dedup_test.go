@@ -0,0 +1,119 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetDuplicatePolicy(t *testing.T) {
+	t.Parallel()
+
+	servers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		{Target: "SERVER1.example.com", Port: 1111, Priority: 10, Weight: 10},
+		{Target: "server1.example.com.", Port: 1111, Priority: 20, Weight: 10},
+		{Target: "server1.example.com.", Port: 2222, Priority: 15, Weight: 10},
+		{Target: "server2.example.com.", Port: 3333, Priority: 10, Weight: 10},
+	}
+
+	scenarios := []struct {
+		description     string
+		policy          dnsdisco.DuplicatePolicy
+		expectedServers map[string]uint16
+		expectedErrors  int
+	}{
+		{
+			description: "it should keep all records by default",
+			expectedServers: map[string]uint16{
+				"server1.example.com.:1111": 10,
+				"SERVER1.example.com:1111":  10,
+				"server1.example.com.:2222": 10,
+				"server2.example.com.:3333": 10,
+			},
+		},
+		{
+			description: "it should keep the first duplicated record",
+			policy:      dnsdisco.DuplicatePolicy{Merge: dnsdisco.DuplicateKeepFirst},
+			expectedServers: map[string]uint16{
+				"server1.example.com.:1111": 10,
+				"server1.example.com.:2222": 10,
+				"server2.example.com.:3333": 10,
+			},
+			expectedErrors: 2,
+		},
+		{
+			description: "it should sum the weights of the duplicated records",
+			policy:      dnsdisco.DuplicatePolicy{Merge: dnsdisco.DuplicateSumWeights},
+			expectedServers: map[string]uint16{
+				"server1.example.com.:1111": 20,
+				"server1.example.com.:2222": 10,
+				"server2.example.com.:3333": 10,
+			},
+			expectedErrors: 2,
+		},
+		{
+			description: "it should limit the records per target",
+			policy:      dnsdisco.DuplicatePolicy{MaxPerTarget: 1, Merge: dnsdisco.DuplicateKeepFirst},
+			expectedServers: map[string]uint16{
+				"server1.example.com.:1111": 10,
+				"server2.example.com.:3333": 10,
+			},
+			expectedErrors: 3,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				// copy the records, as the sort changes the order of the slice
+				return append([]*net.SRV(nil), servers...), nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+			discovery.(dnsdisco.RecordConfigurer).SetDuplicatePolicy(scenario.policy)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			found := make(map[string]uint16)
+			for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+				// the records with a worse priority are only kept by default
+				if server.Priority == 20 {
+					continue
+				}
+
+				// the duplicated records of the same priority are shuffled, so any
+				// spelling of the target can be kept
+				target := server.Target
+				if scenario.policy.Merge != dnsdisco.DuplicateKeepAll {
+					target = strings.ToLower(strings.TrimSuffix(target, ".")) + "."
+				}
+
+				found[target+":"+strconv.FormatUint(uint64(server.Port), 10)] = server.Weight
+			}
+
+			if !reflect.DeepEqual(found, scenario.expectedServers) {
+				t.Errorf("mismatch servers. Expecting: “%v”; found “%v”", scenario.expectedServers, found)
+			}
+
+			if errs := discovery.Errors(); len(errs) != scenario.expectedErrors {
+				t.Errorf("mismatch number of errors. Expecting: “%d”; found “%d” (%v)", scenario.expectedErrors, len(errs), errs)
+			}
+
+			if servers[0].Weight != 10 {
+				t.Errorf("the retrieved records were changed")
+			}
+		})
+	}
+}
@@ -1,12 +1,104 @@
 package dnsdisco
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
+	"sync"
 )
 
+var (
+	// defaultRetriever replaces the default retriever when defined by
+	// SetDefaultRetriever.
+	defaultRetriever Retriever
+
+	// defaultHealthChecker replaces the default health checker when defined by
+	// SetDefaultHealthChecker.
+	defaultHealthChecker HealthChecker
+
+	// defaultBalancerFactory replaces the default load balancer when defined by
+	// SetDefaultBalancerFactory.
+	defaultBalancerFactory func() LoadBalancer
+
+	// defaultsLock make it safe to change the defaults while the library is
+	// executing the operations.
+	defaultsLock sync.RWMutex
+)
+
+// SetDefaultRetriever replaces the retriever used by the discoveries built
+// after the call (NewDiscovery and the Discover functions), e.g. to use a
+// custom resolver in the whole application or a fixed server in the test
+// environment (see the dnsdiscodev build tag). A nil retriever restores the
+// local resolver. It is go routine safe.
+func SetDefaultRetriever(retriever Retriever) {
+	defaultsLock.Lock()
+	defer defaultsLock.Unlock()
+	defaultRetriever = retriever
+}
+
+// SetDefaultHealthChecker replaces the simple connection health checker used
+// by the discoveries built after the call, when the service doesn't have a
+// registered health check strategy (see RegisterServiceDefaults). A nil
+// health checker restores the simple connection. It is go routine safe.
+func SetDefaultHealthChecker(healthChecker HealthChecker) {
+	defaultsLock.Lock()
+	defer defaultsLock.Unlock()
+	defaultHealthChecker = healthChecker
+}
+
+// SetDefaultBalancerFactory replaces the RFC 2782 load balancer used by the
+// discoveries built after the call. The factory is called for each discovery,
+// as the load balancers store the servers. A nil factory restores the RFC 2782
+// load balancer. It is go routine safe.
+func SetDefaultBalancerFactory(factory func() LoadBalancer) {
+	defaultsLock.Lock()
+	defer defaultsLock.Unlock()
+	defaultBalancerFactory = factory
+}
+
+// configuredRetriever returns the retriever defined by SetDefaultRetriever, or
+// the default one.
+func configuredRetriever() Retriever {
+	defaultsLock.RLock()
+	defer defaultsLock.RUnlock()
+
+	if defaultRetriever != nil {
+		return defaultRetriever
+	}
+	return NewDefaultRetriever()
+}
+
+// configuredHealthChecker returns the health checker defined by
+// SetDefaultHealthChecker, or the default one.
+func configuredHealthChecker() HealthChecker {
+	defaultsLock.RLock()
+	defer defaultsLock.RUnlock()
+
+	if defaultHealthChecker != nil {
+		return defaultHealthChecker
+	}
+	return NewDefaultHealthChecker()
+}
+
+// configuredLoadBalancer builds the load balancer defined by
+// SetDefaultBalancerFactory, or the default one.
+func configuredLoadBalancer() LoadBalancer {
+	defaultsLock.RLock()
+	factory := defaultBalancerFactory
+	defaultsLock.RUnlock()
+
+	if factory != nil {
+		if loadBalancer := factory(); loadBalancer != nil {
+			return loadBalancer
+		}
+	}
+	return NewDefaultLoadBalancer()
+}
+
 // NewDefaultRetriever returns an instance of the default retriever algorithm,
-// that uses the local resolver to retrieve the SRV records.
+// that uses the local resolver to retrieve the SRV records. On Unix systems
+// the Go runtime resolver already detects changes of /etc/resolv.conf; when
+// using the dnsclient package, see its Reload and WatchConfig methods.
 func NewDefaultRetriever() Retriever {
 	return RetrieverFunc(func(service, proto, name string) (servers []*net.SRV, err error) {
 		_, servers, err = net.LookupSRV(service, proto, name)
@@ -17,11 +109,14 @@ func NewDefaultRetriever() Retriever {
 // NewDefaultHealthChecker returns an instance of the default health checker
 // algorithm. The default health checker tries to do a simple connection to the
 // server. If the connection is successful the health check pass, otherwise it
-// fails with an error. Possible proto values are tcp or udp.
+// fails with an error. Possible proto values are tcp, udp or unix, where the
+// target is the path of the socket.
 func NewDefaultHealthChecker() HealthChecker {
 	return HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
-		address := fmt.Sprintf("%s:%d", target, port)
-		if proto != "tcp" && proto != "udp" {
+		address := JoinHostPort(target, port)
+		if proto == "unix" {
+			address = target
+		} else if proto != "tcp" && proto != "udp" {
 			return false, net.UnknownNetworkError(proto)
 		}
 
@@ -45,6 +140,34 @@ func NewDefaultLoadBalancer() LoadBalancer {
 // client doesn't replace using the SetLoadBalancer method.
 type defaultLoadBalancer struct {
 	servers []defaultLoadBalancerServer
+
+	// usage returns the number of times that a server was chosen, when the
+	// counters are shared with other instances of the application.
+	usage func(target string, port uint16) int
+
+	// zeroWeight defines how the servers are selected when all of them have
+	// weight zero.
+	zeroWeight ZeroWeightStrategy
+
+	// capacity returns the capacity hint of a server, combined with the SRV
+	// weight according to the capacityBlend.
+	capacity func(target string, port uint16) (int, bool)
+
+	// capacityBlend defines how much the capacity hints count (0-1) compared
+	// with the SRV weights.
+	capacityBlend float64
+
+	// weightFactor returns the adaptive factor that multiplies the weight of a
+	// server.
+	weightFactor func(target string, port uint16) float64
+
+	// restored stores the usage counters loaded from a saved state, that are
+	// applied when the servers appear.
+	restored map[string]int
+
+	// lastDecision stores the data used to choose the last target, so it can be
+	// explained later.
+	lastDecision defaultLoadBalancerDecision
 }
 
 // ChangeServers will be called anytime that a new set of servers is retrieved.
@@ -56,6 +179,46 @@ func (d *defaultLoadBalancer) ChangeServers(servers []*net.SRV) {
 			SRV: *server,
 		})
 	}
+	d.applyRestored()
+}
+
+// SaveState returns the usage counters of the servers, so the balancing is
+// kept after a restart.
+func (d *defaultLoadBalancer) SaveState() ([]byte, error) {
+	used := make(map[string]int)
+	for _, server := range d.servers {
+		used[defaultLoadBalancerKey(server.Target, server.Port)] = server.selected
+	}
+	return json.Marshal(used)
+}
+
+// LoadState restores the usage counters saved by SaveState. The counters of
+// the servers that aren't available yet are applied when they appear.
+func (d *defaultLoadBalancer) LoadState(data []byte) error {
+	var used map[string]int
+	if err := json.Unmarshal(data, &used); err != nil {
+		return err
+	}
+
+	d.restored = used
+	d.applyRestored()
+	return nil
+}
+
+// applyRestored sets the restored usage counters in the available servers.
+func (d *defaultLoadBalancer) applyRestored() {
+	for i := range d.servers {
+		key := defaultLoadBalancerKey(d.servers[i].Target, d.servers[i].Port)
+		if used, ok := d.restored[key]; ok {
+			d.servers[i].selected = used
+			delete(d.restored, key)
+		}
+	}
+}
+
+// defaultLoadBalancerKey identifies the server in the saved state.
+func defaultLoadBalancerKey(target string, port uint16) string {
+	return Server{SRV: net.SRV{Target: target, Port: port}}.address()
 }
 
 // LoadBalance follows the algorithm described in the RFC 2782, based on the
@@ -76,14 +239,30 @@ func (d *defaultLoadBalancer) ChangeServers(servers []*net.SRV) {
 //
 // The algorithm assumes that the servers slice is already sorted by priority
 // and randomized by weight within a priority.
-func (d defaultLoadBalancer) LoadBalance() (target string, port uint16) {
+func (d *defaultLoadBalancer) LoadBalance() (target string, port uint16) {
+	return d.LoadBalanceWhere(nil)
+}
+
+// LoadBalanceWhere works like LoadBalance, but only the servers accepted by the
+// filter are considered. A nil filter accepts all servers.
+func (d *defaultLoadBalancer) LoadBalanceWhere(accept func(target string, port uint16) bool) (target string, port uint16) {
+	if d.usage != nil {
+		for i := range d.servers {
+			d.servers[i].selected = d.usage(d.servers[i].Target, d.servers[i].Port)
+		}
+	}
+
 	var selectedServers []defaultLoadBalancerServer
 	var totalWeight int
 
 	priority := -1
-	minimumUse := d.getServersMinimumUse()
+	minimumUse := d.getServersMinimumUse(accept)
 
 	for i, server := range d.servers {
+		if accept != nil && !accept(server.Target, server.Port) {
+			continue
+		}
+
 		// detect priority change
 		if priority != -1 && priority != int(server.Priority) {
 			break
@@ -91,34 +270,141 @@ func (d defaultLoadBalancer) LoadBalance() (target string, port uint16) {
 
 		if server.selected == minimumUse {
 			priority = int(server.Priority)
-			totalWeight += int(server.Weight)
-
-			server.weightSum = totalWeight
 			server.originalIndex = i
 			selectedServers = append(selectedServers, server)
 		}
 	}
 
+	weights := blendCapacity(selectedServers, d.capacity, d.capacityBlend)
+	applyWeightFactor(selectedServers, weights, d.weightFactor)
+	for i := range selectedServers {
+		totalWeight += weights[i]
+		selectedServers[i].weightSum = totalWeight
+	}
+
 	// choose a uniform random number between 0 and the sum computed (inclusive)
 	randomNumber := randomSource.Intn(totalWeight + 1)
 
+	d.lastDecision = defaultLoadBalancerDecision{
+		candidates:   len(selectedServers),
+		priority:     priority,
+		minimumUse:   minimumUse,
+		totalWeight:  totalWeight,
+		randomNumber: randomNumber,
+		zeroWeight:   d.zeroWeight,
+	}
+
+	// when all weights are zero the running sum doesn't distinguish the
+	// servers, so the strategy decides
+	if totalWeight == 0 && len(selectedServers) > 0 {
+		server := selectedServers[0]
+		if d.zeroWeight == ZeroWeightEqual {
+			server = selectedServers[randomSource.Intn(len(selectedServers))]
+		}
+		return d.choose(server)
+	}
+
 	for _, server := range selectedServers {
 		// select the RR whose running sum value is the first in the selected
 		// order which is greater than or equal to the random number selected
 		if server.weightSum >= randomNumber {
-			d.servers[server.originalIndex].selected++
-			return server.Target, server.Port
+			return d.choose(server)
 		}
 	}
 
 	return "", 0
 }
 
-// getServersMinimumUse returns the minimum number of times that a server was
-// selected. If no server is available -1 is returned.
-func (d defaultLoadBalancer) getServersMinimumUse() int {
+// choose marks the server as selected and stores the decision.
+func (d *defaultLoadBalancer) choose(server defaultLoadBalancerServer) (target string, port uint16) {
+	d.servers[server.originalIndex].selected++
+	d.lastDecision.target = server.Target
+	d.lastDecision.port = server.Port
+	d.lastDecision.weightSum = server.weightSum
+	return server.Target, server.Port
+}
+
+// SetZeroWeightStrategy defines how the servers are selected when all of them
+// have weight zero.
+func (d *defaultLoadBalancer) SetZeroWeightStrategy(strategy ZeroWeightStrategy) {
+	d.zeroWeight = strategy
+}
+
+// SetCapacity defines the function that returns the capacity hint of a server,
+// combined with the SRV weight according to the blend (0-1).
+func (d *defaultLoadBalancer) SetCapacity(capacity func(target string, port uint16) (int, bool), blend float64) {
+	d.capacity = capacity
+	d.capacityBlend = blend
+}
+
+// SetWeightFactor defines the function that returns the adaptive factor that
+// multiplies the weight of a server.
+func (d *defaultLoadBalancer) SetWeightFactor(factor func(target string, port uint16) float64) {
+	d.weightFactor = factor
+}
+
+// SetUsage defines the function that returns the number of times that a server
+// was chosen, replacing the load balancer own counters. It is used to
+// coordinate the choices of many instances of an application.
+func (d *defaultLoadBalancer) SetUsage(usage func(target string, port uint16) int) {
+	d.usage = usage
+}
+
+// Migrate keeps the usage counters of the servers that were selected by a
+// previous default load balancer, so replacing it at runtime doesn't restart
+// the balancing between the servers.
+func (d *defaultLoadBalancer) Migrate(previous interface{}) {
+	previousLoadBalancer, ok := previous.(*defaultLoadBalancer)
+	if !ok {
+		return
+	}
+
+	for i := range d.servers {
+		for _, server := range previousLoadBalancer.servers {
+			if d.servers[i].Target == server.Target && d.servers[i].Port == server.Port {
+				d.servers[i].selected = server.selected
+				break
+			}
+		}
+	}
+}
+
+// Explain describes why the last target was chosen, detailing the steps of the
+// RFC 2782 algorithm.
+func (d *defaultLoadBalancer) Explain() string {
+	decision := d.lastDecision
+	if decision.candidates == 0 {
+		return "no server available"
+	}
+
+	if decision.totalWeight == 0 {
+		strategy := "all of them had the same chance"
+		if decision.zeroWeight == ZeroWeightOrdered {
+			strategy = "the first one in order was used"
+		}
+
+		return fmt.Sprintf("%s was chosen between %d server(s) of priority %d that were used %d time(s) "+
+			"(lowest priority with the least used servers); all weights were zero, so %s",
+			defaultLoadBalancerKey(decision.target, decision.port), decision.candidates, decision.priority, decision.minimumUse, strategy)
+	}
+
+	return fmt.Sprintf("%s was chosen between %d server(s) of priority %d that were used %d time(s) "+
+		"(lowest priority with the least used servers); the random number %d between 0 and %d "+
+		"matched the running weight sum %d (RFC 2782)",
+		defaultLoadBalancerKey(decision.target, decision.port), decision.candidates, decision.priority, decision.minimumUse,
+		decision.randomNumber, decision.totalWeight, decision.weightSum)
+}
+
+// getServersMinimumUse returns the minimum number of times that a server
+// accepted by the filter (that can be nil) was selected. If no server is
+// available -1 is returned.
+func (d *defaultLoadBalancer) getServersMinimumUse(accept func(target string, port uint16) bool) int {
 	minimumUsed := -1
 	for _, server := range d.servers {
+		if accept != nil && !accept(server.Target, server.Port) {
+			continue
+		}
+
 		if server.selected < minimumUsed || minimumUsed == -1 {
 			minimumUsed = server.selected
 		}
@@ -126,6 +412,36 @@ func (d defaultLoadBalancer) getServersMinimumUse() int {
 	return minimumUsed
 }
 
+// defaultLoadBalancerDecision stores the data used by the default load
+// balancer to choose a target.
+type defaultLoadBalancerDecision struct {
+	// target and port identifies the chosen server.
+	target string
+	port   uint16
+
+	// candidates is the number of servers considered in the selection.
+	candidates int
+
+	// priority is the priority of the considered servers.
+	priority int
+
+	// minimumUse is the number of times that the considered servers were
+	// already used.
+	minimumUse int
+
+	// totalWeight is the sum of the weights of the considered servers.
+	totalWeight int
+
+	// randomNumber is the number drawn between 0 and the total weight.
+	randomNumber int
+
+	// weightSum is the running sum of the weights of the chosen server.
+	weightSum int
+
+	// zeroWeight is the strategy used when all weights are zero.
+	zeroWeight ZeroWeightStrategy
+}
+
 // defaultLoadBalancerServer stores a server type plus some additional data
 // useful for selecting the server according the RFC 2782 algorithm.
 type defaultLoadBalancerServer struct {
@@ -276,6 +276,62 @@ func TestDefaultLoadBalancer(t *testing.T) {
 	}
 }
 
+func TestZeroWeightStrategy(t *testing.T) {
+	t.Parallel()
+
+	retriever := dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server3.example.com.", Port: 3333, Priority: 10, Weight: 0},
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 0},
+			{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 0},
+		}, nil
+	})
+
+	healthChecker := dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	})
+
+	t.Run("it should keep the retrieved order", func(t *testing.T) {
+		discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+		discovery.SetRetriever(retriever)
+		discovery.SetHealthChecker(healthChecker)
+		discovery.(dnsdisco.BalancingConfigurer).SetZeroWeightStrategy(dnsdisco.ZeroWeightOrdered)
+
+		if err := discovery.Refresh(); err != nil {
+			t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+		}
+
+		expectedTargets := []string{"server3.example.com.", "server1.example.com.", "server2.example.com."}
+		for _, expectedTarget := range expectedTargets {
+			if target, _ := discovery.Choose(); target != expectedTarget {
+				t.Errorf("mismatch targets. Expecting: “%s”; found “%s”", expectedTarget, target)
+			}
+		}
+	})
+
+	t.Run("it should give the same chance to all servers", func(t *testing.T) {
+		chosen := make(map[string]int)
+		for i := 0; i < 300; i++ {
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(retriever)
+			discovery.SetHealthChecker(healthChecker)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			target, _ := discovery.Choose()
+			chosen[target]++
+		}
+
+		for _, target := range []string{"server1.example.com.", "server2.example.com.", "server3.example.com."} {
+			if chosen[target] == 0 {
+				t.Errorf("server “%s” was never chosen: %v", target, chosen)
+			}
+		}
+	})
+}
+
 func TestDefaultHealthChecker(t *testing.T) {
 	t.Parallel()
 
@@ -533,3 +589,128 @@ func (l loadBalacerMock) ChangeServers(servers []*net.SRV) {
 func (l loadBalacerMock) LoadBalance() (target string, port uint16) {
 	return l.MockLoadBalance()
 }
+
+func TestDefaultHealthCheckerIPv6(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 not available: %s", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	port := uint16(ln.Addr().(*net.TCPAddr).Port)
+
+	scenarios := []struct {
+		description string
+		target      string
+		proto       string
+		expectedOK  bool
+	}{
+		{
+			description: "it should check an IPv6 target",
+			target:      "::1",
+			proto:       "tcp",
+			expectedOK:  true,
+		},
+		{
+			description: "it should check an IPv6 target with the trailing dot",
+			target:      "::1.",
+			proto:       "tcp",
+			expectedOK:  true,
+		},
+		{
+			description: "it should check an IPv6 target over UDP",
+			target:      "::1",
+			proto:       "udp",
+			expectedOK:  true,
+		},
+	}
+
+	healthChecker := dnsdisco.NewDefaultHealthChecker()
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			ok, err := healthChecker.HealthCheck(scenario.target, port, scenario.proto)
+			if ok != scenario.expectedOK {
+				t.Errorf("mismatch health check results. Expecting: “%t”; found “%t” (%v)", scenario.expectedOK, ok, err)
+			}
+		})
+	}
+}
+
+// TestSetDefaults isn't parallel, as it changes the defaults of all
+// discoveries built in the meantime.
+func TestSetDefaults(t *testing.T) {
+	defer func() {
+		dnsdisco.SetDefaultRetriever(nil)
+		dnsdisco.SetDefaultHealthChecker(nil)
+		dnsdisco.SetDefaultBalancerFactory(nil)
+	}()
+
+	dnsdisco.SetDefaultRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+		}, nil
+	}))
+	dnsdisco.SetDefaultHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}))
+
+	var built int
+	dnsdisco.SetDefaultBalancerFactory(func() dnsdisco.LoadBalancer {
+		built++
+		return &loadBalancerLastServer{}
+	})
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if target, port := discovery.Choose(); target != "server2.example.com." || port != 2222 {
+		t.Errorf("mismatch target. Expecting: “server2.example.com.:2222”; found “%s:%d”", target, port)
+	}
+
+	if built != 1 {
+		t.Errorf("mismatch load balancers built. Expecting: “1”; found “%d”", built)
+	}
+
+	target, port, err := dnsdisco.Discover("jabber", "tcp", "registro.br")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if target != "server2.example.com." || port != 2222 {
+		t.Errorf("mismatch target. Expecting: “server2.example.com.:2222”; found “%s:%d”", target, port)
+	}
+}
+
+// loadBalancerLastServer always chooses the last server.
+type loadBalancerLastServer struct {
+	servers []*net.SRV
+}
+
+func (l *loadBalancerLastServer) ChangeServers(servers []*net.SRV) {
+	l.servers = servers
+}
+
+func (l *loadBalancerLastServer) LoadBalance() (target string, port uint16) {
+	if len(l.servers) == 0 {
+		return "", 0
+	}
+
+	server := l.servers[len(l.servers)-1]
+	return server.Target, server.Port
+}
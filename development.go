@@ -1,3 +1,4 @@
+//go:build dnsdiscodev
 // +build dnsdiscodev
 
 package dnsdisco
@@ -28,7 +29,7 @@ var (
 //   * "localhost" for your server address in the test environment
 //   * "443" for your server port in the test environment
 func init() {
-	DefaultRetriever = RetrieverFunc(func(service, proto, name string) (servers []*net.SRV, err error) {
+	SetDefaultRetriever(RetrieverFunc(func(service, proto, name string) (servers []*net.SRV, err error) {
 		port, err := strconv.ParseUint(DevPort, 10, 16)
 		if err != nil {
 			return nil, err
@@ -40,5 +41,5 @@ func init() {
 				Port:   uint16(port),
 			},
 		}, nil
-	})
+	}))
 }
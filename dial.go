@@ -0,0 +1,62 @@
+package dnsdisco
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// Dial chooses the best target and connects to it using the discovery proto,
+// or to its Unix domain socket when mapped (see SetUnixSockets). The target is
+// converted to IP addresses with the address resolver, when defined (see
+// SetAddressResolver). If there's no server available ErrNoServer is returned.
+func (d *discovery) Dial(ctx context.Context) (net.Conn, error) {
+	target, port := d.Choose()
+	if target == "" && port == 0 {
+		return nil, ErrNoServer
+	}
+
+	network, address := d.dialAddress(target, port)
+	return d.dialContext(ctx, network, address)
+}
+
+// DialTLS chooses the best target and connects to it using TLS. The
+// certificate is verified according to the base configuration (that can be
+// nil) and to the TLS policy of the target, defined with SetTLSPolicies. When
+// the credentials provider returns a TLS configuration for the target, it
+// replaces the base configuration. If there's no server available ErrNoServer
+// is returned.
+func (d *discovery) DialTLS(ctx context.Context, config *tls.Config) (net.Conn, error) {
+	target, port := d.Choose()
+	if target == "" && port == 0 {
+		return nil, ErrNoServer
+	}
+
+	credentials, err := d.Credentials(ctx, target, port)
+	if err != nil {
+		return nil, err
+	}
+
+	if credentials.TLSConfig != nil {
+		config = credentials.TLSConfig
+	}
+
+	d.tlsPoliciesLock.RLock()
+	config = d.tlsPolicies.Config(config, target)
+	d.tlsPoliciesLock.RUnlock()
+
+	network, address := d.dialAddress(target, port)
+
+	conn, err := d.dialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
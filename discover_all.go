@@ -0,0 +1,83 @@
+package dnsdisco
+
+import "sync"
+
+// ServiceSpec identifies a service and protocol combination queried by
+// DiscoverAll.
+type ServiceSpec struct {
+	// Service is the name of the application (e.g. "sips").
+	Service string
+
+	// Proto is the protocol used by the application. Could be "udp" or "tcp".
+	Proto string
+}
+
+// ServiceServer is a healthy server found by DiscoverAll, identifying the
+// service specification that announced it.
+type ServiceServer struct {
+	ServiceSpec
+	Server
+}
+
+// DiscoverAll queries many service and proto combinations of the same name in
+// parallel, returning all healthy servers merged in the preference order of
+// the specifications. Inside the same specification the servers follow the
+// RFC 2782 order. This is the procedure used by protocols like SIP (RFC 3263)
+// and XMPP, where the client tries _sips._tcp, then _sip._tcp and then
+// _sip._udp.
+//
+// An error is returned only when all specifications fail, otherwise the
+// servers of the specifications that succeeded are returned.
+func DiscoverAll(name string, services []ServiceSpec) ([]ServiceServer, error) {
+	return discoverAll(name, services, buildDiscovery)
+}
+
+// discoverAll queries the service specifications using the discoveries built
+// by the given function, allowing the retriever to be replaced in tests.
+func discoverAll(name string, services []ServiceSpec, newDiscovery func(service, proto, name string) *discovery) ([]ServiceServer, error) {
+	results := make([][]Server, len(services))
+	errs := make([]error, len(services))
+
+	var wg sync.WaitGroup
+	for i, spec := range services {
+		wg.Add(1)
+		go func(i int, spec ServiceSpec) {
+			defer wg.Done()
+
+			discovery := newDiscovery(spec.Service, spec.Proto, name)
+			if errs[i] = discovery.Refresh(); errs[i] == nil {
+				results[i] = discovery.Servers()
+			}
+		}(i, spec)
+	}
+	wg.Wait()
+
+	var servers []ServiceServer
+	var firstErr error
+	failures := 0
+
+	for i, spec := range services {
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			failures++
+			continue
+		}
+
+		for _, server := range results[i] {
+			if server.Healthy {
+				servers = append(servers, ServiceServer{
+					ServiceSpec: spec,
+					Server:      server,
+				})
+			}
+		}
+	}
+
+	if len(services) > 0 && failures == len(services) {
+		return nil, firstErr
+	}
+
+	return servers, nil
+}
@@ -0,0 +1,96 @@
+package dnsdisco
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverAll(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		records         map[string][]*net.SRV
+		expectedServers []string
+		expectedError   error
+	}{
+		{
+			description: "it should merge the servers in the preference order",
+			records: map[string][]*net.SRV{
+				"_sip._udp": {
+					{Target: "udp.example.com.", Port: 5060, Priority: 10},
+				},
+				"_sips._tcp": {
+					{Target: "tls2.example.com.", Port: 5061, Priority: 20},
+					{Target: "tls1.example.com.", Port: 5061, Priority: 10},
+				},
+				"_sip._tcp": {
+					{Target: "tcp.example.com.", Port: 5060, Priority: 10},
+					{Target: "sick.example.com.", Port: 5060, Priority: 20},
+				},
+			},
+			expectedServers: []string{
+				"sips/tcp/tls1.example.com.:5061",
+				"sips/tcp/tls2.example.com.:5061",
+				"sip/tcp/tcp.example.com.:5060",
+				"sip/udp/udp.example.com.:5060",
+			},
+		},
+		{
+			description: "it should ignore the specifications that fail",
+			records: map[string][]*net.SRV{
+				"_sip._udp": {
+					{Target: "udp.example.com.", Port: 5060, Priority: 10},
+				},
+			},
+			expectedServers: []string{
+				"sip/udp/udp.example.com.:5060",
+			},
+		},
+		{
+			description:   "it should fail when all specifications fail",
+			expectedError: net.UnknownNetworkError("test"),
+		},
+	}
+
+	services := []ServiceSpec{
+		{Service: "sips", Proto: "tcp"},
+		{Service: "sip", Proto: "tcp"},
+		{Service: "sip", Proto: "udp"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			newDiscovery := func(service, proto, name string) *discovery {
+				discovery := buildDiscovery(service, proto, name)
+				discovery.SetRetriever(RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+					records, ok := scenario.records["_"+service+"._"+proto]
+					if !ok {
+						return nil, net.UnknownNetworkError("test")
+					}
+					return records, nil
+				}))
+				discovery.SetHealthChecker(HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+					return target != "sick.example.com.", nil
+				}))
+				return discovery
+			}
+
+			servers, err := discoverAll("example.com", services, newDiscovery)
+
+			var found []string
+			for _, server := range servers {
+				found = append(found, server.Service+"/"+server.Proto+"/"+server.address())
+			}
+
+			if !reflect.DeepEqual(found, scenario.expectedServers) {
+				t.Errorf("mismatch servers. Expecting: “%v”; found “%v”", scenario.expectedServers, found)
+			}
+
+			if !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+		})
+	}
+}
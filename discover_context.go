@@ -0,0 +1,116 @@
+package dnsdisco
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// DiscoverWithTimeout works like Discover, but the whole operation (DNS
+// request, health checks and selection) must finish inside the timeout. If the
+// timeout expires while checking the servers, the best server that already
+// passed on the health check is returned.
+func DiscoverWithTimeout(service, proto, name string, timeout time.Duration) (target string, port uint16, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return DiscoverContext(ctx, service, proto, name)
+}
+
+// DiscoverContext works like Discover, but the whole operation (DNS request,
+// health checks and selection) must finish before the context is done. If the
+// context is done while checking the servers, the best server that already
+// passed on the health check is returned, otherwise the context error is
+// returned. As in Discover, the default port of the service is used when the
+// domain doesn't publish the SRV records.
+func DiscoverContext(ctx context.Context, service, proto, name string) (target string, port uint16, err error) {
+	target, port, err = discoverContext(ctx, service, proto, name, configuredRetriever(), serviceHealthChecker(service, proto))
+	if err != nil {
+		if port, ok := defaultPort(service, err); ok {
+			return name, port, nil
+		}
+	}
+	return
+}
+
+// healthCheckResult stores the result of a health check executed in parallel.
+type healthCheckResult struct {
+	index int
+	usage HealthUsage
+}
+
+// discoverContext finds the best server within the context budget, using the
+// given retriever and health checker. The health checks are executed in
+// parallel, and the ones that don't finish in time are ignored.
+func discoverContext(ctx context.Context, service, proto, name string, retriever Retriever, healthChecker ServerHealthChecker) (target string, port uint16, err error) {
+	type retrieveResult struct {
+		srvs []*net.SRV
+		err  error
+	}
+
+	// the channels are buffered so the go routines don't block after the
+	// context is done
+	retrieved := make(chan retrieveResult, 1)
+	go func() {
+		srvs, err := retriever.Retrieve(service, proto, name)
+		retrieved <- retrieveResult{srvs: srvs, err: err}
+	}()
+
+	var srvs []*net.SRV
+	select {
+	case result := <-retrieved:
+		if result.err != nil {
+			return "", 0, result.err
+		}
+		srvs = result.srvs
+	case <-ctx.Done():
+		return "", 0, ctx.Err()
+	}
+
+	normalize(srvs)
+
+	checked := make(chan healthCheckResult, len(srvs))
+	for i, srv := range srvs {
+		go func(i int, srv *net.SRV) {
+			status, err := healthChecker.HealthCheck(ctx, Server{SRV: *srv})
+			if err != nil {
+				status = HealthStatusUnhealthy
+			}
+			checked <- healthCheckResult{index: i, usage: status.Usage()}
+		}(i, srv)
+	}
+
+	usages := make([]HealthUsage, len(srvs))
+	timeout := false
+
+	for pending := len(srvs); pending > 0 && !timeout; pending-- {
+		select {
+		case result := <-checked:
+			usages[result.index] = result.usage
+		case <-ctx.Done():
+			timeout = true
+		}
+	}
+
+	var servers, fallbackServers []*net.SRV
+	for i, srv := range srvs {
+		switch usages[i] {
+		case HealthUsageAlways:
+			servers = append(servers, srv)
+		case HealthUsageFallback:
+			fallbackServers = append(fallbackServers, srv)
+		}
+	}
+
+	if len(servers) == 0 {
+		servers = fallbackServers
+	}
+
+	if len(servers) == 0 && timeout {
+		return "", 0, ctx.Err()
+	}
+
+	loadBalancer := configuredLoadBalancer()
+	loadBalancer.ChangeServers(servers)
+	target, port = loadBalancer.LoadBalance()
+	return target, port, nil
+}
@@ -0,0 +1,106 @@
+package dnsdisco
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiscoverContext(t *testing.T) {
+	t.Parallel()
+
+	servers := []*net.SRV{
+		{
+			Target:   "server1.example.com.",
+			Port:     1111,
+			Priority: 10,
+			Weight:   10,
+		},
+		{
+			Target:   "server2.example.com.",
+			Port:     2222,
+			Priority: 20,
+			Weight:   10,
+		},
+	}
+
+	scenarios := []struct {
+		description    string
+		retriever      RetrieverFunc
+		healthChecker  HealthCheckerFunc
+		expectedTarget string
+		expectedPort   uint16
+		expectedError  error
+	}{
+		{
+			description: "it should select the best server",
+			retriever: RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return servers, nil
+			}),
+			healthChecker: HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return true, nil
+			}),
+			expectedTarget: "server1.example.com.",
+			expectedPort:   1111,
+		},
+		{
+			description: "it should select the best server checked within the budget",
+			retriever: RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return servers, nil
+			}),
+			healthChecker: HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				if target == "server1.example.com." {
+					time.Sleep(time.Second)
+				}
+				return true, nil
+			}),
+			expectedTarget: "server2.example.com.",
+			expectedPort:   2222,
+		},
+		{
+			description: "it should fail when no server is checked within the budget",
+			retriever: RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return servers, nil
+			}),
+			healthChecker: HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				time.Sleep(time.Second)
+				return true, nil
+			}),
+			expectedError: context.DeadlineExceeded,
+		},
+		{
+			description: "it should fail when the DNS request doesn't finish within the budget",
+			retriever: RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				time.Sleep(time.Second)
+				return servers, nil
+			}),
+			healthChecker: HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return true, nil
+			}),
+			expectedError: context.DeadlineExceeded,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			target, port, err := discoverContext(ctx, "jabber", "tcp", "registro.br", scenario.retriever, AdaptHealthChecker(scenario.healthChecker, "tcp"))
+
+			if target != scenario.expectedTarget {
+				t.Errorf("mismatch targets. Expecting: “%s”; found “%s”", scenario.expectedTarget, target)
+			}
+
+			if port != scenario.expectedPort {
+				t.Errorf("mismatch ports. Expecting: “%d”; found “%d”", scenario.expectedPort, port)
+			}
+
+			if !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+		})
+	}
+}
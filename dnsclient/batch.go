@@ -0,0 +1,53 @@
+package dnsclient
+
+import (
+	"sync"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+// RetrieveBatch retrieves the servers of all services in one logical
+// operation, sending the queries concurrently instead of one after the other.
+// Services that result in the same query name are retrieved only once. When
+// the retriever uses a custom transport (see SetTransport) all queries are
+// handed to it at the same time, so a transport with a single connection can
+// pipeline them. It implements the dnsdisco.BatchRetriever interface.
+func (r *Retriever) RetrieveBatch(queries []dnsdisco.BatchQuery) map[dnsdisco.BatchQuery]dnsdisco.BatchResult {
+	r.lock.RLock()
+	composer, recordType := r.nameComposer, r.recordType
+	r.lock.RUnlock()
+
+	// group the services by the query name
+	groups := make(map[string][]dnsdisco.BatchQuery)
+	var qnames []string
+	for _, query := range queries {
+		qname := queryName(composer, recordType, query.Service, query.Proto, query.Name)
+		if _, ok := groups[qname]; !ok {
+			qnames = append(qnames, qname)
+		}
+		groups[qname] = append(groups[qname], query)
+	}
+
+	results := make(map[dnsdisco.BatchQuery]dnsdisco.BatchResult, len(queries))
+	var resultsLock sync.Mutex
+
+	var wg sync.WaitGroup
+	for _, qname := range qnames {
+		wg.Add(1)
+		go func(group []dnsdisco.BatchQuery) {
+			defer wg.Done()
+
+			var result dnsdisco.BatchResult
+			result.Servers, result.Metadata, result.Err = r.RetrieveMetadata(group[0].Service, group[0].Proto, group[0].Name)
+
+			resultsLock.Lock()
+			defer resultsLock.Unlock()
+			for _, query := range group {
+				results[query] = result
+			}
+		}(groups[qname])
+	}
+	wg.Wait()
+
+	return results
+}
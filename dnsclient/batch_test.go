@@ -0,0 +1,82 @@
+package dnsclient_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/dnsclient"
+)
+
+func TestRetrieveBatch(t *testing.T) {
+	t.Parallel()
+
+	// the transport only answers when all the distinct queries were sent, so
+	// the test hangs if they are sent in sequence
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+
+	var questionsLock sync.Mutex
+	questions := make(map[string]int)
+
+	retriever := dnsclient.NewTransportRetriever(dnsclient.DNSTransportFunc(func(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+		questionsLock.Lock()
+		questions[query.Question[0].Name]++
+		questionsLock.Unlock()
+
+		arrived.Done()
+		arrived.Wait()
+
+		response := new(dns.Msg)
+		response.SetReply(query)
+
+		if query.Question[0].Name != "_jabber._tcp.registro.example.com." {
+			response.Rcode = dns.RcodeNameError
+			return response, nil
+		}
+
+		response.Answer = []dns.RR{
+			&dns.SRV{
+				Hdr:      dns.RR_Header{Name: query.Question[0].Name, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 60},
+				Priority: 10,
+				Weight:   20,
+				Port:     5269,
+				Target:   "server1.example.com.",
+			},
+		}
+		return response, nil
+	}))
+
+	jabber := dnsdisco.BatchQuery{ServiceSpec: dnsdisco.ServiceSpec{Service: "jabber", Proto: "tcp"}, Name: "registro.example.com."}
+	jabberAlias := dnsdisco.BatchQuery{ServiceSpec: dnsdisco.ServiceSpec{Service: "jabber", Proto: "tcp"}, Name: "registro.example.com"}
+	ldap := dnsdisco.BatchQuery{ServiceSpec: dnsdisco.ServiceSpec{Service: "ldap", Proto: "tcp"}, Name: "example.com."}
+
+	results := dnsdisco.RetrieveBatch(retriever, []dnsdisco.BatchQuery{jabber, jabberAlias, ldap})
+
+	expectedServers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 5269, Priority: 10, Weight: 20},
+	}
+
+	for _, spec := range []dnsdisco.BatchQuery{jabber, jabberAlias} {
+		if result := results[spec]; result.Err != nil || !reflect.DeepEqual(result.Servers, expectedServers) {
+			t.Errorf("mismatch servers of “%v”. Expecting: “%v”; found “%v” (%v)", spec, expectedServers, result.Servers, result.Err)
+		}
+	}
+
+	if err, ok := results[ldap].Err.(*net.DNSError); !ok || !err.IsNotFound {
+		t.Errorf("unexpected error “%v”", results[ldap].Err)
+	}
+
+	expectedQuestions := map[string]int{
+		"_jabber._tcp.registro.example.com.": 1,
+		"_ldap._tcp.example.com.":            1,
+	}
+
+	if !reflect.DeepEqual(questions, expectedQuestions) {
+		t.Errorf("mismatch questions. Expecting: “%v”; found “%v”", expectedQuestions, questions)
+	}
+}
@@ -0,0 +1,974 @@
+// Package dnsclient retrieves the SRV records using its own DNS client,
+// instead of the Go runtime resolver. It gives full control over the
+// nameservers, search domains and timeouts, which is necessary in containers
+// and other environments with unusual DNS setups.
+package dnsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+// ErrNoNameserver is returned when the configuration doesn't have any
+// nameserver to query.
+var ErrNoNameserver = errors.New("dnsclient: no nameserver configured")
+
+// ErrNoConfigFile is returned when reloading a retriever that wasn't built
+// from a resolv.conf file.
+var ErrNoConfigFile = errors.New("dnsclient: retriever without configuration file")
+
+// ErrUnsupportedRecordType is returned when the retriever is configured with a
+// record type that can't be used to discover servers.
+var ErrUnsupportedRecordType = errors.New("dnsclient: unsupported record type")
+
+// maxAliasDepth is the maximum number of SVCB/HTTPS aliases (AliasMode) that
+// are followed before giving up.
+const maxAliasDepth = 8
+
+// TruncatedError is a warning stored in the Errors list when a UDP response
+// was truncated (TC bit) and the query was repeated over TCP to retrieve all
+// records.
+type TruncatedError struct {
+	// Name is the queried name.
+	Name string
+
+	// Nameserver is the address of the nameserver that truncated the response.
+	Nameserver string
+}
+
+// Error returns the warning description.
+func (t TruncatedError) Error() string {
+	return fmt.Sprintf("dnsclient: truncated response for %s from %s, retried over TCP", t.Name, t.Nameserver)
+}
+
+// ConfigChange describes a change of the nameservers detected when the
+// resolv.conf was reloaded, e.g. after a DHCP lease renewal.
+type ConfigChange struct {
+	// Path is the location of the resolv.conf.
+	Path string
+
+	// Previous are the nameservers used before the reload.
+	Previous []string
+
+	// Current are the nameservers used from now on.
+	Current []string
+}
+
+// Exchange describes a DNS message exchange with a nameserver, including the
+// raw messages, for packet-level debugging or to feed tools like dnstap.
+type Exchange struct {
+	// Query is the message sent. It must not be modified.
+	Query *dns.Msg
+
+	// Response is the message received, or nil when the exchange failed. It
+	// must not be modified.
+	Response *dns.Msg
+
+	// Nameserver is the address of the queried nameserver.
+	Nameserver string
+
+	// Network is the transport protocol used: udp or tcp.
+	Network string
+
+	// RTT is the round-trip time of the exchange.
+	RTT time.Duration
+
+	// Err is the error of the exchange, if any.
+	Err error
+}
+
+// QueryOptions are the low-level options of the DNS messages sent by the
+// retriever, for unusual private DNS deployments (e.g. a non-IN class or
+// nameservers that must not recurse). Start from DefaultQueryOptions and
+// change only the necessary fields.
+type QueryOptions struct {
+	// Class is the class of the question. When zero IN is used.
+	Class uint16
+
+	// RecursionDesired sets the RD bit, asking the nameserver to resolve the
+	// query recursively.
+	RecursionDesired bool
+
+	// CheckingDisabled sets the CD bit, disabling the DNSSEC validation of
+	// the nameserver.
+	CheckingDisabled bool
+
+	// AuthenticatedData sets the AD bit, asking the nameserver to inform if
+	// the answer was validated with DNSSEC (RFC 6840).
+	AuthenticatedData bool
+
+	// UDPSize is the UDP payload size advertised in the EDNS0 OPT record. When
+	// zero EDNS0 is only used when required by other options, with the
+	// default size.
+	UDPSize uint16
+
+	// DNSSECOK sets the DO bit of EDNS0, asking for the DNSSEC records.
+	DNSSECOK bool
+}
+
+// DefaultQueryOptions returns the options used when none are defined: class
+// IN with recursion desired.
+func DefaultQueryOptions() QueryOptions {
+	return QueryOptions{
+		Class:            dns.ClassINET,
+		RecursionDesired: true,
+	}
+}
+
+// Retriever sends the SRV queries directly to the nameservers of a resolv.conf
+// configuration. It implements the dnsdisco.Retriever interface.
+type Retriever struct {
+	// config stores the nameservers, search domains, ndots, timeout and
+	// attempts used to build and send the queries.
+	config *dns.ClientConfig
+
+	// path is the location of the resolv.conf, when the retriever was built
+	// from a file, so it can be reloaded.
+	path string
+
+	// configModified is the modification time of the resolv.conf when it was
+	// last loaded.
+	configModified time.Time
+
+	// configChangeHandler is notified when the nameservers change.
+	configChangeHandler func(ConfigChange)
+
+	// transport sends the messages instead of the nameservers of the
+	// configuration. When it is nil the nameservers are used.
+	transport DNSTransport
+
+	// exchangeHook is notified of each message exchanged with the
+	// nameservers.
+	exchangeHook func(Exchange)
+
+	// client sends the DNS messages over UDP.
+	client *dns.Client
+
+	// tcpClient repeats the queries over TCP when the UDP response is
+	// truncated.
+	tcpClient *dns.Client
+
+	// clientSubnet is sent in the EDNS0 Client Subnet option (RFC 7871) of
+	// the queries, so geo-aware authoritative servers can answer with the
+	// servers closer to the client.
+	clientSubnet *net.IPNet
+
+	// recordType is the type of the records queried: SRV (default), SVCB or
+	// HTTPS.
+	recordType uint16
+
+	// queryOptions are the low-level options of the DNS messages.
+	queryOptions QueryOptions
+
+	// nameComposer builds the name of the SRV records. When it is nil the
+	// _service._proto.name layout is used.
+	nameComposer dnsdisco.NameComposer
+
+	// retryPolicy replaces the attempts and timeout of the resolv.conf when
+	// defined.
+	retryPolicy *dnsdisco.RetryPolicy
+
+	// scopes stores the ECS scope prefix length returned by the last response
+	// of each service.
+	scopes map[string]uint8
+
+	// negativeCache stores the services that don't exist (NXDOMAIN or without
+	// SRV records), until the negative TTL expires (RFC 2308).
+	negativeCache map[string]negativeAnswer
+
+	// lock make it possible to change the options and read the scopes while
+	// the retriever is executing the queries.
+	lock sync.RWMutex
+
+	// errors stores the warnings generated while retrieving the records.
+	errors []error
+
+	// errorsLock guarantees that the errors list will be go routine safe.
+	errorsLock sync.Mutex
+}
+
+// NewRetriever builds a retriever from a parsed resolv.conf. The nameservers
+// are queried in the configured order, the name of the SRV record is expanded
+// with the search domains according to ndots, and each query waits at most the
+// configured timeout. Each nameserver is tried the configured number of
+// attempts before giving up.
+func NewRetriever(config *dns.ClientConfig) *Retriever {
+	r := &Retriever{
+		recordType:    dns.TypeSRV,
+		queryOptions:  DefaultQueryOptions(),
+		scopes:        make(map[string]uint8),
+		negativeCache: make(map[string]negativeAnswer),
+	}
+	r.setConfig(config)
+	return r
+}
+
+// NewRetrieverFromFile builds a retriever reading the resolv.conf from the
+// given path (e.g. /etc/resolv.conf). The file can be reloaded later with
+// Reload or WatchConfig.
+func NewRetrieverFromFile(path string) (*Retriever, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := dns.ClientConfigFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewRetriever(config)
+	r.path = path
+	r.configModified = info.ModTime()
+	return r, nil
+}
+
+// setConfig replaces the configuration and the clients built from it. The
+// caller must hold the write lock, or be the only one with access to the
+// retriever.
+func (r *Retriever) setConfig(config *dns.ClientConfig) {
+	timeout := time.Duration(config.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	r.config = config
+	r.client = &dns.Client{
+		Timeout: timeout,
+	}
+	r.tcpClient = &dns.Client{
+		Net:     "tcp",
+		Timeout: timeout,
+	}
+}
+
+// Reload reads the resolv.conf again when it was modified, replacing the
+// nameservers, search domains and options without restarting the process. It
+// is useful in long-running processes of hosts managed by DHCP, where the
+// nameservers change over time. When the nameservers change the handler
+// defined with SetConfigChangeHandler is notified. If the retriever wasn't
+// built with NewRetrieverFromFile ErrNoConfigFile is returned.
+func (r *Retriever) Reload() error {
+	r.lock.RLock()
+	path, modified := r.path, r.configModified
+	r.lock.RUnlock()
+
+	if path == "" {
+		return ErrNoConfigFile
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.ModTime().Equal(modified) {
+		return nil
+	}
+
+	config, err := dns.ClientConfigFromFile(path)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	previous := r.config.Servers
+	r.setConfig(config)
+	r.configModified = info.ModTime()
+	handler := r.configChangeHandler
+	r.lock.Unlock()
+
+	if handler != nil && !reflect.DeepEqual(previous, config.Servers) {
+		handler(ConfigChange{
+			Path:     path,
+			Previous: previous,
+			Current:  config.Servers,
+		})
+	}
+	return nil
+}
+
+// WatchConfig reloads the resolv.conf periodically in a go routine, as Reload
+// does. The errors are stored in the Errors list. To stop watching, close the
+// returned channel.
+func (r *Retriever) WatchConfig(interval time.Duration) chan<- bool {
+	finish := make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-finish:
+				return
+			case <-ticker.C:
+			}
+
+			if err := r.Reload(); err != nil {
+				r.errorsLock.Lock()
+				r.errors = append(r.errors, err)
+				r.errorsLock.Unlock()
+			}
+		}
+	}()
+
+	return finish
+}
+
+// SetConfigChangeHandler defines the function notified when a reload of the
+// resolv.conf changes the nameservers. It is go routine safe.
+func (r *Retriever) SetConfigChangeHandler(handler func(ConfigChange)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.configChangeHandler = handler
+}
+
+// clients returns the configuration and the clients in use, that can be
+// replaced by a reload.
+func (r *Retriever) clients() (config *dns.ClientConfig, client, tcpClient *dns.Client) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.config, r.client, r.tcpClient
+}
+
+// Retrieve sends the SRV query for each name built with the search domains,
+// until one of them has records. Names that don't exist (NXDOMAIN) or without
+// SRV records continue the search, but if the nameservers fail (timeout or
+// SERVFAIL) the search stops. The returned error is a *net.DNSError, like the
+// one returned by the Go runtime resolver.
+//
+// When the service doesn't exist, the negative answer is cached for the SOA
+// minimum TTL (RFC 2308), and the nameservers aren't queried again until it
+// expires or the cache is invalidated (e.g. Discovery.ForceRefresh).
+func (r *Retriever) Retrieve(service, proto, name string) ([]*net.SRV, error) {
+	servers, _, err := r.RetrieveMetadata(service, proto, name)
+	return servers, err
+}
+
+// RetrieveMetadata works like Retrieve, also returning the parameters of the
+// SVCB/HTTPS records (e.g. "alpn", "ech", "ipv4hint") of each server, indexed
+// by the key name. SRV records don't have metadata. It implements the
+// dnsdisco.MetadataRetriever interface, so the parameters are available in
+// dnsdisco.Server.Metadata.
+func (r *Retriever) RetrieveMetadata(service, proto, name string) ([]*net.SRV, []map[string]string, error) {
+	r.lock.RLock()
+	config := r.config
+	recordType := r.recordType
+	transport := r.transport
+	settings := querySettings{
+		clientSubnet: r.clientSubnet,
+		retryPolicy:  r.retryPolicy,
+		options:      r.queryOptions,
+	}
+	qname := queryName(r.nameComposer, recordType, service, proto, name)
+	negative, cached := r.negativeCache[qname]
+	r.lock.RUnlock()
+
+	if len(config.Servers) == 0 && transport == nil {
+		return nil, nil, ErrNoNameserver
+	}
+
+	if cached && time.Now().Before(negative.expires) {
+		return nil, nil, negative.err
+	}
+
+	ctx := context.Background()
+	if settings.retryPolicy != nil && settings.retryPolicy.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.retryPolicy.Budget)
+		defer cancel()
+	}
+
+	var lastErr *net.DNSError
+
+	// the negative answer can only be cached when all names have a negative TTL
+	negativeTTL, cacheable := time.Duration(-1), true
+
+	for _, candidate := range config.NameList(qname) {
+		response, err := r.query(ctx, candidate, recordType, settings)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if response.Rcode == dns.RcodeNameError {
+			lastErr = &net.DNSError{Err: "no such host", Name: candidate, IsNotFound: true}
+			negativeTTL, cacheable = minNegativeTTL(negativeTTL, cacheable, response)
+			continue
+		}
+
+		servers, metadata, err := r.servers(ctx, response, recordType, settings)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// a name without records (NODATA) continues the search, as the Go
+		// runtime resolver does
+		if len(servers) > 0 {
+			if settings.clientSubnet != nil {
+				r.storeScope(qname, response)
+			}
+			return servers, metadata, nil
+		}
+		lastErr = &net.DNSError{Err: "no such host", Name: candidate, IsNotFound: true}
+		negativeTTL, cacheable = minNegativeTTL(negativeTTL, cacheable, response)
+	}
+
+	if cacheable && negativeTTL > 0 {
+		r.lock.Lock()
+		r.negativeCache[qname] = negativeAnswer{err: lastErr, expires: time.Now().Add(negativeTTL)}
+		r.lock.Unlock()
+	}
+
+	return nil, nil, lastErr
+}
+
+// querySettings are the options used to send the queries of a retrieval.
+type querySettings struct {
+	clientSubnet *net.IPNet
+	retryPolicy  *dnsdisco.RetryPolicy
+	options      QueryOptions
+}
+
+// query sends the question to the nameservers.
+func (r *Retriever) query(ctx context.Context, name string, recordType uint16, settings querySettings) (*dns.Msg, error) {
+	request := newRequest(name, recordType, settings.options, settings.clientSubnet)
+
+	response, err := r.exchange(ctx, request, settings.retryPolicy)
+	if err != nil {
+		err.Name = name
+		return nil, err
+	}
+	return response, nil
+}
+
+// servers converts the records of the response to servers. SVCB and HTTPS
+// records in AliasMode are followed, querying the alias target.
+func (r *Retriever) servers(ctx context.Context, response *dns.Msg, recordType uint16, settings querySettings) ([]*net.SRV, []map[string]string, error) {
+	if recordType == dns.TypeSRV {
+		servers := srvServers(response)
+		return servers, make([]map[string]string, len(servers)), nil
+	}
+
+	for depth := 0; ; depth++ {
+		servers, metadata, alias := svcbServers(response, recordType)
+		if len(servers) > 0 || alias == "" {
+			return servers, metadata, nil
+		}
+
+		if depth == maxAliasDepth {
+			return nil, nil, &net.DNSError{Err: "too many aliases", Name: alias}
+		}
+
+		var err error
+		if response, err = r.query(ctx, alias, recordType, settings); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// ParseResponse converts the records of a DNS response in wire format to
+// servers, the same way the retriever does: SRV records, or SVCB and HTTPS
+// records in ServiceMode with their parameters as metadata. Aliases aren't
+// followed. It is useful to analyze captured responses (e.g. from the exchange
+// hook) and as an entry point for fuzzing.
+func ParseResponse(data []byte, recordType uint16) ([]*net.SRV, []map[string]string, error) {
+	var response dns.Msg
+	if err := response.Unpack(data); err != nil {
+		return nil, nil, err
+	}
+
+	switch recordType {
+	case dns.TypeSRV:
+		servers := srvServers(&response)
+		return servers, make([]map[string]string, len(servers)), nil
+	case dns.TypeSVCB, dns.TypeHTTPS:
+		servers, metadata, _ := svcbServers(&response, recordType)
+		return servers, metadata, nil
+	}
+	return nil, nil, ErrUnsupportedRecordType
+}
+
+// srvServers converts the SRV records of the response to servers.
+func srvServers(response *dns.Msg) []*net.SRV {
+	var servers []*net.SRV
+	for _, rr := range response.Answer {
+		if srv, ok := rr.(*dns.SRV); ok {
+			servers = append(servers, &net.SRV{
+				Target:   srv.Target,
+				Port:     srv.Port,
+				Priority: srv.Priority,
+				Weight:   srv.Weight,
+			})
+		}
+	}
+	return servers
+}
+
+// svcbServers converts the SVCB or HTTPS records in ServiceMode of the response
+// to servers (RFC 9460). The SvcPriority is used as the server priority, the
+// weight is always zero and the port comes from the "port" parameter, or 443
+// for HTTPS records without it. All parameters are returned as metadata. When
+// there're only records in AliasMode the alias target is returned instead.
+func svcbServers(response *dns.Msg, recordType uint16) (servers []*net.SRV, metadata []map[string]string, alias string) {
+	for _, rr := range response.Answer {
+		var svcb *dns.SVCB
+		switch record := rr.(type) {
+		case *dns.SVCB:
+			svcb = record
+		case *dns.HTTPS:
+			svcb = &record.SVCB
+		default:
+			continue
+		}
+
+		// the target "." refers to the owner name of the record
+		target := svcb.Target
+		if target == "." {
+			target = svcb.Hdr.Name
+		}
+
+		if svcb.Priority == 0 {
+			if target != svcb.Hdr.Name {
+				alias = target
+			}
+			continue
+		}
+
+		server := &net.SRV{
+			Target:   target,
+			Priority: svcb.Priority,
+		}
+		if recordType == dns.TypeHTTPS {
+			server.Port = 443
+		}
+
+		parameters := make(map[string]string)
+		for _, value := range svcb.Value {
+			switch keyValue := value.(type) {
+			case *dns.SVCBPort:
+				server.Port = keyValue.Port
+			case *dns.SVCBAlpn:
+				// the values are joined without the presentation format escaping
+				parameters[keyValue.Key().String()] = strings.Join(keyValue.Alpn, ",")
+				continue
+			}
+			parameters[value.Key().String()] = value.String()
+		}
+
+		servers = append(servers, server)
+		metadata = append(metadata, parameters)
+	}
+
+	return servers, metadata, alias
+}
+
+// queryName returns the name queried for the service. SRV records use the
+// _service._proto.name format (RFC 2782), unless a name composer is defined,
+// SVCB records use the _service.name format, where the service is the scheme
+// (RFC 9460, section 2.3), and HTTPS records use the name directly.
+func queryName(composer dnsdisco.NameComposer, recordType uint16, service, proto, name string) string {
+	name = strings.TrimSuffix(name, ".")
+
+	switch recordType {
+	case dns.TypeSVCB:
+		return "_" + service + "." + name
+	case dns.TypeHTTPS:
+		return name
+	}
+
+	if composer != nil {
+		return strings.TrimSuffix(composer.ComposeName(service, proto, name), ".")
+	}
+	return "_" + service + "._" + proto + "." + name
+}
+
+// SetNameComposer defines how the name of the SRV records is built, for
+// infrastructures that don't follow the _service._proto.name layout. The
+// composed name is still expanded with the search domains. A nil composer
+// restores the RFC 2782 layout. It is go routine safe.
+func (r *Retriever) SetNameComposer(composer dnsdisco.NameComposer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.nameComposer = composer
+}
+
+// SetRecordType defines the type of the records used to discover the servers:
+// dns.TypeSRV (default), dns.TypeSVCB or dns.TypeHTTPS. SVCB and HTTPS records
+// (RFC 9460) are replacing SRV for HTTP service discovery, and carry the
+// connection parameters (e.g. ALPN and ECH) as metadata. Any other type
+// returns ErrUnsupportedRecordType. It is go routine safe.
+func (r *Retriever) SetRecordType(recordType uint16) error {
+	switch recordType {
+	case dns.TypeSRV, dns.TypeSVCB, dns.TypeHTTPS:
+	default:
+		return ErrUnsupportedRecordType
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.recordType = recordType
+	return nil
+}
+
+// ResolveCNAME returns the target of the CNAME record of the name, or an empty
+// string when the name isn't an alias. It implements the
+// dnsdisco.CNAMEResolver interface, so the same nameservers are used to chase
+// the CNAME chain of the SRV targets.
+func (r *Retriever) ResolveCNAME(name string) (string, error) {
+	r.lock.RLock()
+	config := r.config
+	retryPolicy := r.retryPolicy
+	options := r.queryOptions
+	transport := r.transport
+	r.lock.RUnlock()
+
+	if len(config.Servers) == 0 && transport == nil {
+		return "", ErrNoNameserver
+	}
+
+	ctx := context.Background()
+	if retryPolicy != nil && retryPolicy.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, retryPolicy.Budget)
+		defer cancel()
+	}
+
+	request := newRequest(dns.Fqdn(name), dns.TypeCNAME, options, nil)
+
+	response, err := r.exchange(ctx, request, retryPolicy)
+	if err != nil {
+		err.Name = request.Question[0].Name
+		return "", err
+	}
+
+	for _, rr := range response.Answer {
+		if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, request.Question[0].Name) {
+			return cname.Target, nil
+		}
+	}
+
+	return "", nil
+}
+
+// Invalidate removes the cached negative answer of the service, so the next
+// retrieve queries the nameservers again. It implements the
+// dnsdisco.CachingRetriever interface, used by Discovery.ForceRefresh.
+func (r *Retriever) Invalidate(service, proto, name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.negativeCache, queryName(r.nameComposer, r.recordType, service, proto, name))
+}
+
+// negativeAnswer stores a cached answer of a service that doesn't exist.
+type negativeAnswer struct {
+	err     *net.DNSError
+	expires time.Time
+}
+
+// minNegativeTTL returns the smallest negative TTL between the current one and
+// the one of the response. As defined in RFC 2308 section 5, the negative TTL
+// is the minimum between the SOA TTL and the SOA minimum field. If the
+// response doesn't have a SOA record the answer can't be cached.
+func minNegativeTTL(current time.Duration, cacheable bool, response *dns.Msg) (time.Duration, bool) {
+	for _, rr := range response.Ns {
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+
+		ttl := soa.Hdr.Ttl
+		if soa.Minttl < ttl {
+			ttl = soa.Minttl
+		}
+
+		negativeTTL := time.Duration(ttl) * time.Second
+		if current < 0 || negativeTTL < current {
+			current = negativeTTL
+		}
+		return current, cacheable
+	}
+
+	return current, false
+}
+
+// SetRetryPolicy defines the number of retries, the timeout of each attempt
+// and the total time budget of the queries, replacing the attempts and
+// timeout of the resolv.conf. Timeouts are retried in the same nameserver,
+// server failures (SERVFAIL or REFUSED) move to the next nameserver, and a
+// name that doesn't exist (NXDOMAIN) is never retried. It is go routine safe.
+func (r *Retriever) SetRetryPolicy(policy dnsdisco.RetryPolicy) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.retryPolicy = &policy
+}
+
+// SetClientSubnet defines the network sent in the EDNS0 Client Subnet option
+// (RFC 7871) of the queries, so geo-aware authoritative servers answer with the
+// servers appropriate to the client region. Only the network prefix is sent.
+// A nil subnet disables the option. It is go routine safe.
+func (r *Retriever) SetClientSubnet(subnet *net.IPNet) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.clientSubnet = subnet
+}
+
+// ClientSubnetScope returns the ECS scope prefix length of the last response
+// of the service, when the EDNS0 Client Subnet option is enabled. The scope
+// defines for which networks the answer is valid, and can be used to decide if
+// the servers retrieved can be cached and shared between clients. If the
+// nameserver didn't return the option, ok is false.
+func (r *Retriever) ClientSubnetScope(service, proto, name string) (scope uint8, ok bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	scope, ok = r.scopes[queryName(r.nameComposer, r.recordType, service, proto, name)]
+	return
+}
+
+// storeScope stores the ECS scope of the response.
+func (r *Retriever) storeScope(qname string, response *dns.Msg) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.scopes, qname)
+
+	opt := response.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	for _, option := range opt.Option {
+		if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+			r.scopes[qname] = subnet.SourceScope
+			return
+		}
+	}
+}
+
+// newRequest builds the query message with the options.
+func newRequest(name string, recordType uint16, options QueryOptions, clientSubnet *net.IPNet) *dns.Msg {
+	request := new(dns.Msg)
+	request.SetQuestion(name, recordType)
+	if options.Class != 0 {
+		request.Question[0].Qclass = options.Class
+	}
+
+	request.RecursionDesired = options.RecursionDesired
+	request.CheckingDisabled = options.CheckingDisabled
+	request.AuthenticatedData = options.AuthenticatedData
+
+	if options.UDPSize > 0 || options.DNSSECOK || clientSubnet != nil {
+		udpSize := options.UDPSize
+		if udpSize == 0 {
+			udpSize = dns.DefaultMsgSize
+		}
+		request.SetEdns0(udpSize, options.DNSSECOK)
+	}
+
+	if clientSubnet != nil {
+		setClientSubnet(request, clientSubnet)
+	}
+	return request
+}
+
+// SetQueryOptions defines the low-level options of the DNS messages, like the
+// query class and the header bits. It is go routine safe.
+func (r *Retriever) SetQueryOptions(options QueryOptions) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.queryOptions = options
+}
+
+// setClientSubnet adds the EDNS0 Client Subnet option to the request, that
+// must already have the EDNS0 OPT record.
+func setClientSubnet(request *dns.Msg, subnet *net.IPNet) {
+	ones, _ := subnet.Mask.Size()
+
+	option := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		SourceNetmask: uint8(ones),
+	}
+
+	if ip := subnet.IP.To4(); ip != nil {
+		option.Family = 1
+		option.Address = ip.Mask(subnet.Mask)
+	} else {
+		option.Family = 2
+		option.Address = subnet.IP.Mask(subnet.Mask)
+	}
+
+	opt := request.IsEdns0()
+	opt.Option = append(opt.Option, option)
+}
+
+// Errors returns the warnings generated while retrieving the records, like
+// truncated responses (TruncatedError). Once this method is called the
+// internal errors buffer is cleared.
+func (r *Retriever) Errors() []error {
+	r.errorsLock.Lock()
+	defer r.errorsLock.Unlock()
+
+	errs := r.errors
+	r.errors = nil
+	return errs
+}
+
+// exchange sends the request to the nameservers in the configured order,
+// trying each one the configured number of attempts. The first response that
+// isn't a server failure is returned. When the UDP response is truncated the
+// query is repeated over TCP, as a truncated SRV RRset would silently lose
+// servers.
+func (r *Retriever) exchange(ctx context.Context, request *dns.Msg, policy *dnsdisco.RetryPolicy) (*dns.Msg, *net.DNSError) {
+	config, client, tcpClient := r.clients()
+
+	r.lock.RLock()
+	transport := r.transport
+	r.lock.RUnlock()
+
+	attempts := config.Attempts
+	tryTimeout := client.Timeout
+	if policy != nil {
+		attempts = policy.Retries + 1
+		if policy.TryTimeout > 0 {
+			tryTimeout = policy.TryTimeout
+		}
+	}
+
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	port := config.Port
+	if port == "" {
+		port = "53"
+	}
+
+	var addresses []string
+	for _, server := range config.Servers {
+		addresses = append(addresses, net.JoinHostPort(server, port))
+	}
+
+	if transport != nil {
+		addresses = []string{TransportNameserver}
+	}
+
+	var lastErr *net.DNSError
+	for _, address := range addresses {
+		for i := 0; i < attempts; i++ {
+			if ctx.Err() != nil {
+				if lastErr == nil {
+					lastErr = &net.DNSError{Err: ctx.Err().Error(), Server: address, IsTimeout: true}
+				}
+				return nil, lastErr
+			}
+
+			var response *dns.Msg
+			var err error
+
+			if transport != nil {
+				response, err = r.exchangeTransport(ctx, transport, request, tryTimeout)
+			} else {
+				response, err = r.exchangeTry(ctx, client, tcpClient, request, address, tryTimeout)
+			}
+
+			if err != nil {
+				// timeouts and network errors are retried in the same nameserver
+				lastErr = &net.DNSError{Err: err.Error(), Server: address, IsTimeout: isTimeout(err), IsTemporary: true}
+				continue
+			}
+
+			if response.Rcode == dns.RcodeServerFailure || response.Rcode == dns.RcodeRefused {
+				// the nameserver can't answer, so the next one is tried
+				lastErr = &net.DNSError{Err: "server misbehaving", Server: address, IsTemporary: true}
+				break
+			}
+
+			return response, nil
+		}
+	}
+
+	return nil, lastErr
+}
+
+// exchangeTry sends the request to the nameserver, repeating it over TCP when
+// the UDP response is truncated.
+func (r *Retriever) exchangeTry(ctx context.Context, client, tcpClient *dns.Client, request *dns.Msg, address string, timeout time.Duration) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	response, err := r.captureClient(ctx, client, request, address)
+	if err == nil && response.Truncated {
+		r.errorsLock.Lock()
+		r.errors = append(r.errors, TruncatedError{Name: request.Question[0].Name, Nameserver: address})
+		r.errorsLock.Unlock()
+
+		response, err = r.captureClient(ctx, tcpClient, request, address)
+	}
+	return response, err
+}
+
+// captureClient sends the request with the client, notifying the exchange
+// hook.
+func (r *Retriever) captureClient(ctx context.Context, client *dns.Client, request *dns.Msg, address string) (*dns.Msg, error) {
+	network := client.Net
+	if network == "" {
+		network = "udp"
+	}
+
+	return r.capture(request, address, network, func() (*dns.Msg, error) {
+		response, _, err := client.ExchangeContext(ctx, request, address)
+		return response, err
+	})
+}
+
+// capture sends the request, notifying the exchange hook.
+func (r *Retriever) capture(request *dns.Msg, address, network string, send func() (*dns.Msg, error)) (*dns.Msg, error) {
+	r.lock.RLock()
+	hook := r.exchangeHook
+	r.lock.RUnlock()
+
+	begin := time.Now()
+	response, err := send()
+
+	if hook != nil {
+		hook(Exchange{
+			Query:      request,
+			Response:   response,
+			Nameserver: address,
+			Network:    network,
+			RTT:        time.Since(begin),
+			Err:        err,
+		})
+	}
+
+	return response, err
+}
+
+// SetExchangeHook defines a function notified of each message exchanged with
+// the nameservers, including retries and the TCP fallback of truncated
+// responses. It exposes the raw query and response (message ID, rcode and
+// records), the nameserver used and the round-trip time. The hook is called
+// synchronously, so it must be fast. A nil hook disables the notifications. It
+// is go routine safe.
+func (r *Retriever) SetExchangeHook(hook func(Exchange)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.exchangeHook = hook
+}
+
+// isTimeout checks if the error was caused by a timeout.
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
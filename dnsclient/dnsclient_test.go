@@ -0,0 +1,913 @@
+package dnsclient_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/dnsclient"
+)
+
+func TestRetrieve(t *testing.T) {
+	t.Parallel()
+
+	port, stop := startServer(t, recordsHandler(map[string][]dns.RR{
+		"_jabber._tcp.registro.example.com.": {
+			&dns.SRV{
+				Hdr:      dns.RR_Header{Name: "_jabber._tcp.registro.example.com.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 60},
+				Priority: 10,
+				Weight:   20,
+				Port:     5269,
+				Target:   "server1.example.com.",
+			},
+		},
+	}))
+	defer stop()
+
+	scenarios := []struct {
+		description     string
+		config          *dns.ClientConfig
+		name            string
+		expectedServers []*net.SRV
+		expectNotFound  bool
+		expectedError   error
+	}{
+		{
+			description: "it should use the search domains",
+			config: &dns.ClientConfig{
+				Servers: []string{"127.0.0.1"},
+				Search:  []string{"example.com."},
+				Port:    port,
+				Ndots:   1,
+				Timeout: 1,
+			},
+			name: "registro",
+			expectedServers: []*net.SRV{
+				{Target: "server1.example.com.", Port: 5269, Priority: 10, Weight: 20},
+			},
+		},
+		{
+			description: "it should try the next nameserver",
+			config: &dns.ClientConfig{
+				Servers: []string{"127.0.0.2", "127.0.0.1"},
+				Port:    port,
+				Ndots:   1,
+				Timeout: 1,
+			},
+			name: "registro.example.com.",
+			expectedServers: []*net.SRV{
+				{Target: "server1.example.com.", Port: 5269, Priority: 10, Weight: 20},
+			},
+		},
+		{
+			description: "it should not find the name",
+			config: &dns.ClientConfig{
+				Servers: []string{"127.0.0.1"},
+				Search:  []string{"example.net."},
+				Port:    port,
+				Ndots:   1,
+				Timeout: 1,
+			},
+			name:           "registro",
+			expectNotFound: true,
+		},
+		{
+			description:   "it should fail without nameservers",
+			config:        &dns.ClientConfig{},
+			name:          "registro.example.com.",
+			expectedError: dnsclient.ErrNoNameserver,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			retriever := dnsclient.NewRetriever(scenario.config)
+			servers, err := retriever.Retrieve("jabber", "tcp", scenario.name)
+
+			if !reflect.DeepEqual(servers, scenario.expectedServers) {
+				t.Errorf("mismatch servers. Expecting: “%#v”; found “%#v”", scenario.expectedServers, servers)
+			}
+
+			if scenario.expectNotFound {
+				if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+					t.Errorf("unexpected error “%v”", err)
+				}
+			} else if !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestNameComposer(t *testing.T) {
+	t.Parallel()
+
+	port, stop := startServer(t, recordsHandler(map[string][]dns.RR{
+		"jabber.eu-west.registro.example.com.": {
+			&dns.SRV{
+				Hdr:      dns.RR_Header{Name: "jabber.eu-west.registro.example.com.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 60},
+				Priority: 10,
+				Weight:   20,
+				Port:     5269,
+				Target:   "server1.example.com.",
+			},
+		},
+	}))
+	defer stop()
+
+	retriever := dnsclient.NewRetriever(&dns.ClientConfig{
+		Servers: []string{"127.0.0.1"},
+		Search:  []string{"example.com."},
+		Port:    port,
+		Ndots:   1,
+		Timeout: 1,
+	})
+	retriever.SetNameComposer(dnsdisco.NameComposerFunc(func(service, proto, name string) string {
+		return service + ".eu-west." + name
+	}))
+
+	servers, err := retriever.Retrieve("jabber", "tcp", "registro")
+	if err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	expectedServers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 5269, Priority: 10, Weight: 20},
+	}
+
+	if !reflect.DeepEqual(servers, expectedServers) {
+		t.Errorf("mismatch servers. Expecting: “%#v”; found “%#v”", expectedServers, servers)
+	}
+}
+
+func TestNewRetrieverFromFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "dnsclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "resolv.conf")
+	if err := ioutil.WriteFile(path, []byte("nameserver 127.0.0.1\nsearch example.com\noptions ndots:2 timeout:1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dnsclient.NewRetrieverFromFile(path); err != nil {
+		t.Errorf("unexpected error “%v”", err)
+	}
+
+	if _, err := dnsclient.NewRetrieverFromFile(filepath.Join(dir, "missing.conf")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "dnsclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "resolv.conf")
+	if err := ioutil.WriteFile(path, []byte("nameserver 127.0.0.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	retriever, err := dnsclient.NewRetrieverFromFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	var changes []dnsclient.ConfigChange
+	retriever.SetConfigChangeHandler(func(change dnsclient.ConfigChange) {
+		changes = append(changes, change)
+	})
+
+	// nothing changed
+	if err := retriever.Reload(); err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("nameserver 127.0.0.2\nnameserver 127.0.0.3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// guarantee that the modification is detected in file systems with a low
+	// timestamp resolution
+	modified := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := retriever.Reload(); err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	expected := []dnsclient.ConfigChange{
+		{
+			Path:     path,
+			Previous: []string{"127.0.0.1"},
+			Current:  []string{"127.0.0.2", "127.0.0.3"},
+		},
+	}
+
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("mismatch changes. Expecting: “%#v”; found “%#v”", expected, changes)
+	}
+
+	if err := dnsclient.NewRetriever(&dns.ClientConfig{}).Reload(); err != dnsclient.ErrNoConfigFile {
+		t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", dnsclient.ErrNoConfigFile, err)
+	}
+}
+
+func TestClientSubnet(t *testing.T) {
+	t.Parallel()
+
+	// the channel makes the received option visible to the test go routine
+	received := make(chan dns.EDNS0_SUBNET, 1)
+
+	port, stop := startServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		response := new(dns.Msg)
+		response.SetReply(r)
+		response.Answer = []dns.RR{
+			&dns.SRV{
+				Hdr:    dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 60},
+				Port:   5269,
+				Target: "server1.example.com.",
+			},
+		}
+
+		if opt := r.IsEdns0(); opt != nil {
+			for _, option := range opt.Option {
+				if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+					received <- *subnet
+					subnet.SourceScope = 16
+					response.Extra = append(response.Extra, opt)
+				}
+			}
+		}
+		w.WriteMsg(response)
+	}))
+	defer stop()
+
+	retriever := dnsclient.NewRetriever(&dns.ClientConfig{
+		Servers: []string{"127.0.0.1"},
+		Port:    port,
+		Ndots:   1,
+		Timeout: 1,
+	})
+
+	_, subnet, _ := net.ParseCIDR("192.0.2.0/24")
+	retriever.SetClientSubnet(subnet)
+
+	if _, err := retriever.Retrieve("jabber", "tcp", "registro.example.com."); err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if subnet := <-received; subnet.SourceNetmask != 24 || !subnet.Address.Equal(net.ParseIP("192.0.2.0")) {
+		t.Errorf("unexpected client subnet “%s/%d” sent", subnet.Address, subnet.SourceNetmask)
+	}
+
+	if scope, ok := retriever.ClientSubnetScope("jabber", "tcp", "registro.example.com"); !ok || scope != 16 {
+		t.Errorf("unexpected scope “%d” (found: %t)", scope, ok)
+	}
+}
+
+func TestQueryOptions(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		options         *dnsclient.QueryOptions
+		expectedClass   uint16
+		expectedRD      bool
+		expectedCD      bool
+		expectedAD      bool
+		expectedEDNS0   bool
+		expectedUDPSize uint16
+		expectedDO      bool
+	}{
+		{
+			description:   "it should use the default options",
+			expectedClass: dns.ClassINET,
+			expectedRD:    true,
+		},
+		{
+			description: "it should send a CHAOS query without recursion",
+			options: &dnsclient.QueryOptions{
+				Class: dns.ClassCHAOS,
+			},
+			expectedClass: dns.ClassCHAOS,
+		},
+		{
+			description: "it should use IN when the class is zero",
+			options: &dnsclient.QueryOptions{
+				RecursionDesired: true,
+			},
+			expectedClass: dns.ClassINET,
+			expectedRD:    true,
+		},
+		{
+			description: "it should set the header bits and EDNS0",
+			options: &dnsclient.QueryOptions{
+				Class:             dns.ClassHESIOD,
+				CheckingDisabled:  true,
+				AuthenticatedData: true,
+				UDPSize:           1232,
+				DNSSECOK:          true,
+			},
+			expectedClass:   dns.ClassHESIOD,
+			expectedCD:      true,
+			expectedAD:      true,
+			expectedEDNS0:   true,
+			expectedUDPSize: 1232,
+			expectedDO:      true,
+		},
+		{
+			description: "it should use the default UDP size with the DO bit",
+			options: &dnsclient.QueryOptions{
+				DNSSECOK: true,
+			},
+			expectedClass:   dns.ClassINET,
+			expectedEDNS0:   true,
+			expectedUDPSize: dns.DefaultMsgSize,
+			expectedDO:      true,
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			port, stop := startServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+				response := new(dns.Msg)
+				response.SetReply(r)
+				response.Answer = []dns.RR{
+					&dns.SRV{
+						Hdr:    dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeSRV, Class: r.Question[0].Qclass, Ttl: 60},
+						Port:   5269,
+						Target: "server1.example.com.",
+					},
+				}
+				w.WriteMsg(response)
+			}))
+			defer stop()
+
+			retriever := dnsclient.NewRetriever(&dns.ClientConfig{
+				Servers: []string{"127.0.0.1"},
+				Port:    port,
+				Ndots:   1,
+				Timeout: 1,
+			})
+
+			if item.options != nil {
+				retriever.SetQueryOptions(*item.options)
+			}
+
+			var queries []*dns.Msg
+			retriever.SetExchangeHook(func(exchange dnsclient.Exchange) {
+				queries = append(queries, exchange.Query)
+			})
+
+			if _, err := retriever.Retrieve("jabber", "tcp", "registro.example.com."); err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			if len(queries) != 1 {
+				t.Fatalf("unexpected number of queries: %d", len(queries))
+			}
+			query := queries[0]
+
+			if class := query.Question[0].Qclass; class != item.expectedClass {
+				t.Errorf("mismatch classes. Expecting: “%s”; found “%s”", dns.ClassToString[item.expectedClass], dns.ClassToString[class])
+			}
+
+			if query.RecursionDesired != item.expectedRD {
+				t.Errorf("mismatch RD bits. Expecting: “%t”; found “%t”", item.expectedRD, query.RecursionDesired)
+			}
+
+			if query.CheckingDisabled != item.expectedCD {
+				t.Errorf("mismatch CD bits. Expecting: “%t”; found “%t”", item.expectedCD, query.CheckingDisabled)
+			}
+
+			if query.AuthenticatedData != item.expectedAD {
+				t.Errorf("mismatch AD bits. Expecting: “%t”; found “%t”", item.expectedAD, query.AuthenticatedData)
+			}
+
+			opt := query.IsEdns0()
+			if (opt != nil) != item.expectedEDNS0 {
+				t.Fatalf("mismatch EDNS0. Expecting: “%t”; found “%t”", item.expectedEDNS0, opt != nil)
+			}
+
+			if opt == nil {
+				return
+			}
+
+			if opt.UDPSize() != item.expectedUDPSize {
+				t.Errorf("mismatch UDP sizes. Expecting: “%d”; found “%d”", item.expectedUDPSize, opt.UDPSize())
+			}
+
+			if opt.Do() != item.expectedDO {
+				t.Errorf("mismatch DO bits. Expecting: “%t”; found “%t”", item.expectedDO, opt.Do())
+			}
+		})
+	}
+}
+
+func TestRetrieveTruncated(t *testing.T) {
+	t.Parallel()
+
+	var answer []dns.RR
+	var expectedServers []*net.SRV
+
+	for i := 0; i < 20; i++ {
+		target := fmt.Sprintf("server%d.example.com.", i)
+		answer = append(answer, &dns.SRV{
+			Hdr:    dns.RR_Header{Name: "_jabber._tcp.registro.example.com.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 60},
+			Port:   5269,
+			Target: target,
+		})
+		expectedServers = append(expectedServers, &net.SRV{Target: target, Port: 5269})
+	}
+
+	port, stop := startServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		response := new(dns.Msg)
+		response.SetReply(r)
+		response.Answer = answer
+
+		if w.RemoteAddr().Network() == "udp" {
+			response.Answer = answer[:1]
+			response.Truncated = true
+		}
+		w.WriteMsg(response)
+	}))
+	defer stop()
+
+	retriever := dnsclient.NewRetriever(&dns.ClientConfig{
+		Servers: []string{"127.0.0.1"},
+		Port:    port,
+		Ndots:   1,
+		Timeout: 1,
+	})
+
+	servers, err := retriever.Retrieve("jabber", "tcp", "registro.example.com.")
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if !reflect.DeepEqual(servers, expectedServers) {
+		t.Errorf("mismatch servers. Expecting: “%#v”; found “%#v”", expectedServers, servers)
+	}
+
+	expectedErrors := []error{
+		dnsclient.TruncatedError{Name: "_jabber._tcp.registro.example.com.", Nameserver: "127.0.0.1:" + port},
+	}
+
+	if errs := retriever.Errors(); !reflect.DeepEqual(errs, expectedErrors) {
+		t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", expectedErrors, errs)
+	}
+}
+
+func TestExchangeHook(t *testing.T) {
+	t.Parallel()
+
+	port, stop := startServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		response := new(dns.Msg)
+		response.SetReply(r)
+		response.Answer = []dns.RR{
+			&dns.SRV{
+				Hdr:    dns.RR_Header{Name: "_jabber._tcp.registro.example.com.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 60},
+				Port:   5269,
+				Target: "server1.example.com.",
+			},
+		}
+		response.Truncated = w.RemoteAddr().Network() == "udp"
+		w.WriteMsg(response)
+	}))
+	defer stop()
+
+	retriever := dnsclient.NewRetriever(&dns.ClientConfig{
+		Servers: []string{"127.0.0.1"},
+		Port:    port,
+		Ndots:   1,
+		Timeout: 1,
+	})
+
+	var exchanges []dnsclient.Exchange
+	retriever.SetExchangeHook(func(exchange dnsclient.Exchange) {
+		exchanges = append(exchanges, exchange)
+	})
+
+	if _, err := retriever.Retrieve("jabber", "tcp", "registro.example.com."); err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	expectedNetworks := []string{"udp", "tcp"}
+	if len(exchanges) != len(expectedNetworks) {
+		t.Fatalf("unexpected number of exchanges: %d", len(exchanges))
+	}
+
+	for i, exchange := range exchanges {
+		if exchange.Network != expectedNetworks[i] {
+			t.Errorf("mismatch networks. Expecting: “%s”; found “%s”", expectedNetworks[i], exchange.Network)
+		}
+
+		if exchange.Nameserver != "127.0.0.1:"+port {
+			t.Errorf("mismatch nameservers. Expecting: “%s”; found “%s”", "127.0.0.1:"+port, exchange.Nameserver)
+		}
+
+		if exchange.Err != nil || exchange.Response == nil {
+			t.Fatalf("unexpected error “%v”", exchange.Err)
+		}
+
+		if exchange.Response.Id != exchange.Query.Id {
+			t.Errorf("mismatch message IDs. Expecting: “%d”; found “%d”", exchange.Query.Id, exchange.Response.Id)
+		}
+
+		if exchange.Response.Rcode != dns.RcodeSuccess {
+			t.Errorf("mismatch rcodes. Expecting: “%s”; found “%s”", dns.RcodeToString[dns.RcodeSuccess], dns.RcodeToString[exchange.Response.Rcode])
+		}
+
+		if exchange.RTT <= 0 {
+			t.Errorf("unexpected RTT “%s”", exchange.RTT)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		policy          dnsdisco.RetryPolicy
+		dropped         int32
+		rcode           int
+		expectedQueries int32
+		expectServers   bool
+		expectTimeout   bool
+		expectNotFound  bool
+	}{
+		{
+			description:     "it should retry after a timeout",
+			policy:          dnsdisco.RetryPolicy{Retries: 2, TryTimeout: 50 * time.Millisecond},
+			dropped:         1,
+			expectedQueries: 2,
+			expectServers:   true,
+		},
+		{
+			description:     "it should not retry the same nameserver after a server failure",
+			policy:          dnsdisco.RetryPolicy{Retries: 2, TryTimeout: 50 * time.Millisecond},
+			rcode:           dns.RcodeServerFailure,
+			expectedQueries: 1,
+		},
+		{
+			description:     "it should not retry when the name doesn't exist",
+			policy:          dnsdisco.RetryPolicy{Retries: 2, TryTimeout: 50 * time.Millisecond},
+			rcode:           dns.RcodeNameError,
+			expectedQueries: 1,
+			expectNotFound:  true,
+		},
+		{
+			description:     "it should stop when the budget is exhausted",
+			policy:          dnsdisco.RetryPolicy{Retries: 10, TryTimeout: 50 * time.Millisecond, Budget: 120 * time.Millisecond},
+			dropped:         10,
+			expectedQueries: 3,
+			expectTimeout:   true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			var queries int32
+
+			port, stop := startServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+				if atomic.AddInt32(&queries, 1) <= scenario.dropped {
+					return
+				}
+
+				response := new(dns.Msg)
+				response.SetRcode(r, scenario.rcode)
+				if scenario.rcode == dns.RcodeSuccess {
+					response.Answer = []dns.RR{
+						&dns.SRV{
+							Hdr:    dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 60},
+							Port:   5269,
+							Target: "server1.example.com.",
+						},
+					}
+				}
+				w.WriteMsg(response)
+			}))
+			defer stop()
+
+			retriever := dnsclient.NewRetriever(&dns.ClientConfig{
+				Servers: []string{"127.0.0.1"},
+				Port:    port,
+				Ndots:   1,
+				Timeout: 1,
+			})
+			retriever.SetRetryPolicy(scenario.policy)
+
+			servers, err := retriever.Retrieve("jabber", "tcp", "registro.example.com.")
+
+			if (len(servers) > 0) != scenario.expectServers {
+				t.Errorf("unexpected servers “%v” (error “%v”)", servers, err)
+			}
+
+			if queries := atomic.LoadInt32(&queries); queries != scenario.expectedQueries {
+				t.Errorf("mismatch queries. Expecting: “%d”; found “%d”", scenario.expectedQueries, queries)
+			}
+
+			if !scenario.expectServers {
+				dnsErr, ok := err.(*net.DNSError)
+				if !ok || dnsErr.IsNotFound != scenario.expectNotFound || dnsErr.IsTimeout != scenario.expectTimeout {
+					t.Errorf("unexpected error “%#v”", err)
+				}
+			}
+		})
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	t.Parallel()
+
+	var queries int32
+
+	port, stop := startServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&queries, 1)
+
+		response := new(dns.Msg)
+		response.SetRcode(r, dns.RcodeNameError)
+		response.Ns = []dns.RR{
+			&dns.SOA{
+				Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+				Ns:     "ns1.example.com.",
+				Mbox:   "hostmaster.example.com.",
+				Serial: 2016101501,
+				Minttl: 300,
+			},
+		}
+		w.WriteMsg(response)
+	}))
+	defer stop()
+
+	retriever := dnsclient.NewRetriever(&dns.ClientConfig{
+		Servers: []string{"127.0.0.1"},
+		Port:    port,
+		Ndots:   1,
+		Timeout: 1,
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := retriever.Retrieve("jabber", "tcp", "registro.example.com.")
+		if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+			t.Fatalf("unexpected error “%v”", err)
+		}
+	}
+
+	if queries := atomic.LoadInt32(&queries); queries != 1 {
+		t.Errorf("negative answer wasn't cached, %d queries sent", queries)
+	}
+
+	retriever.Invalidate("jabber", "tcp", "registro.example.com")
+	retriever.Retrieve("jabber", "tcp", "registro.example.com.")
+
+	if queries := atomic.LoadInt32(&queries); queries != 2 {
+		t.Errorf("negative answer wasn't invalidated, %d queries sent", queries)
+	}
+}
+
+func TestResolveCNAME(t *testing.T) {
+	t.Parallel()
+
+	port, stop := startServer(t, recordsHandler(map[string][]dns.RR{
+		"alias.example.com.": {
+			&dns.CNAME{
+				Hdr:    dns.RR_Header{Name: "alias.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60},
+				Target: "server.example.net.",
+			},
+		},
+		"server.example.net.": nil,
+	}))
+	defer stop()
+
+	retriever := dnsclient.NewRetriever(&dns.ClientConfig{
+		Servers: []string{"127.0.0.1"},
+		Port:    port,
+		Ndots:   1,
+		Timeout: 1,
+	})
+
+	scenarios := []struct {
+		description    string
+		name           string
+		expectedTarget string
+	}{
+		{
+			description:    "it should resolve the alias",
+			name:           "alias.example.com",
+			expectedTarget: "server.example.net.",
+		},
+		{
+			description: "it should detect a name that isn't an alias",
+			name:        "server.example.net.",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			target, err := retriever.ResolveCNAME(scenario.name)
+			if err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			if target != scenario.expectedTarget {
+				t.Errorf("mismatch targets. Expecting: “%s”; found “%s”", scenario.expectedTarget, target)
+			}
+		})
+	}
+}
+
+func TestRetrieveSVCB(t *testing.T) {
+	t.Parallel()
+
+	port, stop := startServer(t, recordsHandler(map[string][]dns.RR{
+		"www.example.com.": {
+			&dns.HTTPS{SVCB: dns.SVCB{
+				Hdr:      dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeHTTPS, Class: dns.ClassINET, Ttl: 60},
+				Priority: 1,
+				Target:   ".",
+				Value: []dns.SVCBKeyValue{
+					&dns.SVCBAlpn{Alpn: []string{"h2", "h3"}},
+				},
+			}},
+			&dns.HTTPS{SVCB: dns.SVCB{
+				Hdr:      dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeHTTPS, Class: dns.ClassINET, Ttl: 60},
+				Priority: 2,
+				Target:   "backup.example.com.",
+				Value: []dns.SVCBKeyValue{
+					&dns.SVCBPort{Port: 8443},
+				},
+			}},
+		},
+		"alias.example.com.": {
+			&dns.HTTPS{SVCB: dns.SVCB{
+				Hdr:    dns.RR_Header{Name: "alias.example.com.", Rrtype: dns.TypeHTTPS, Class: dns.ClassINET, Ttl: 60},
+				Target: "www.example.com.",
+			}},
+		},
+		"_api.example.com.": {
+			&dns.SVCB{
+				Hdr:      dns.RR_Header{Name: "_api.example.com.", Rrtype: dns.TypeSVCB, Class: dns.ClassINET, Ttl: 60},
+				Priority: 1,
+				Target:   "api.example.com.",
+				Value: []dns.SVCBKeyValue{
+					&dns.SVCBPort{Port: 8080},
+				},
+			},
+		},
+	}))
+	defer stop()
+
+	scenarios := []struct {
+		description      string
+		recordType       uint16
+		name             string
+		expectedServers  []*net.SRV
+		expectedMetadata []map[string]string
+	}{
+		{
+			description: "it should retrieve the HTTPS records",
+			recordType:  dns.TypeHTTPS,
+			name:        "www.example.com.",
+			expectedServers: []*net.SRV{
+				{Target: "www.example.com.", Port: 443, Priority: 1},
+				{Target: "backup.example.com.", Port: 8443, Priority: 2},
+			},
+			expectedMetadata: []map[string]string{
+				{"alpn": "h2,h3"},
+				{"port": "8443"},
+			},
+		},
+		{
+			description: "it should follow the alias",
+			recordType:  dns.TypeHTTPS,
+			name:        "alias.example.com.",
+			expectedServers: []*net.SRV{
+				{Target: "www.example.com.", Port: 443, Priority: 1},
+				{Target: "backup.example.com.", Port: 8443, Priority: 2},
+			},
+			expectedMetadata: []map[string]string{
+				{"alpn": "h2,h3"},
+				{"port": "8443"},
+			},
+		},
+		{
+			description: "it should retrieve the SVCB records",
+			recordType:  dns.TypeSVCB,
+			name:        "example.com.",
+			expectedServers: []*net.SRV{
+				{Target: "api.example.com.", Port: 8080, Priority: 1},
+			},
+			expectedMetadata: []map[string]string{
+				{"port": "8080"},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			retriever := dnsclient.NewRetriever(&dns.ClientConfig{
+				Servers: []string{"127.0.0.1"},
+				Port:    port,
+				Ndots:   1,
+				Timeout: 1,
+			})
+
+			if err := retriever.SetRecordType(scenario.recordType); err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			servers, metadata, err := retriever.RetrieveMetadata("api", "tcp", scenario.name)
+			if err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			if !reflect.DeepEqual(servers, scenario.expectedServers) {
+				t.Errorf("mismatch servers. Expecting: “%#v”; found “%#v”", scenario.expectedServers, servers)
+			}
+
+			if !reflect.DeepEqual(metadata, scenario.expectedMetadata) {
+				t.Errorf("mismatch metadata. Expecting: “%#v”; found “%#v”", scenario.expectedMetadata, metadata)
+			}
+		})
+	}
+
+	retriever := dnsclient.NewRetriever(&dns.ClientConfig{})
+	if err := retriever.SetRecordType(dns.TypeA); err != dnsclient.ErrUnsupportedRecordType {
+		t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", dnsclient.ErrUnsupportedRecordType, err)
+	}
+}
+
+// recordsHandler answers the queries with the given records, or with NXDOMAIN
+// when the name is unknown.
+func recordsHandler(records map[string][]dns.RR) dns.Handler {
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		response := new(dns.Msg)
+		response.SetReply(r)
+
+		if answer, ok := records[r.Question[0].Name]; ok {
+			response.Answer = answer
+		} else {
+			response.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(response)
+	})
+}
+
+// startServer runs a local DNS server, over UDP and TCP, using the given
+// handler. It returns the port where it is listening and a function to stop
+// it.
+func startServer(t *testing.T, handler dns.Handler) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers := []*dns.Server{
+		{PacketConn: conn, Handler: handler},
+		{Listener: listener, Handler: handler},
+	}
+
+	for _, server := range servers {
+		started := make(chan bool)
+		server.NotifyStartedFunc = func() { close(started) }
+		go server.ActivateAndServe()
+		<-started
+	}
+
+	_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	return port, func() {
+		for _, server := range servers {
+			server.Shutdown()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package dnsclient_test
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/rafaeljusto/dnsdisco/dnsclient"
+)
+
+func FuzzParseResponse(f *testing.F) {
+	for _, rr := range []dns.RR{
+		&dns.SRV{
+			Hdr:      dns.RR_Header{Name: "_jabber._tcp.example.com.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 60},
+			Priority: 10,
+			Weight:   20,
+			Port:     5269,
+			Target:   "server1.example.com.",
+		},
+		&dns.HTTPS{SVCB: dns.SVCB{
+			Hdr:      dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeHTTPS, Class: dns.ClassINET, Ttl: 60},
+			Priority: 1,
+			Target:   ".",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBAlpn{Alpn: []string{"h2", "h3"}},
+				&dns.SVCBPort{Port: 8443},
+			},
+		}},
+	} {
+		var response dns.Msg
+		response.SetQuestion(rr.Header().Name, rr.Header().Rrtype)
+		response.Response = true
+		response.Answer = []dns.RR{rr}
+
+		data, err := response.Pack()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, recordType := range []uint16{dns.TypeSRV, dns.TypeSVCB, dns.TypeHTTPS} {
+			servers, metadata, err := dnsclient.ParseResponse(data, recordType)
+			if err != nil {
+				return
+			}
+
+			if len(servers) != len(metadata) {
+				t.Fatalf("mismatch number of servers (%d) and metadata (%d)", len(servers), len(metadata))
+			}
+
+			for _, server := range servers {
+				if recordType != dns.TypeSRV && server.Priority == 0 {
+					t.Fatalf("server in AliasMode returned: %#v", server)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package dnsclient
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ErrNoSystemNameserver is returned when the nameservers of the operating
+// system couldn't be detected.
+var ErrNoSystemNameserver = errors.New("dnsclient: no system nameserver found")
+
+// NewSystemRetriever builds a retriever with the nameservers and search domains
+// configured in the operating system, so there's no need to hardcode a
+// nameserver address. On Windows they are read from the registry, on macOS
+// from the SystemConfiguration framework (the same information reported by
+// scutil) and in the other systems from /etc/resolv.conf, that can be reloaded
+// with Reload or WatchConfig.
+func NewSystemRetriever() (*Retriever, error) {
+	return newSystemRetriever()
+}
+
+// newClientConfig builds a configuration with the same defaults used when
+// parsing a resolv.conf.
+func newClientConfig(servers, search []string) (*dns.ClientConfig, error) {
+	if len(servers) == 0 {
+		return nil, ErrNoSystemNameserver
+	}
+
+	return &dns.ClientConfig{
+		Servers:  servers,
+		Search:   search,
+		Port:     "53",
+		Ndots:    1,
+		Timeout:  5,
+		Attempts: 2,
+	}, nil
+}
+
+// appendUnique adds the values that aren't in the list yet, keeping the order.
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, item := range list {
+			if strings.EqualFold(item, value) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
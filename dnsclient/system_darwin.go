@@ -0,0 +1,83 @@
+//go:build darwin
+// +build darwin
+
+package dnsclient
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// newSystemRetriever reads the nameservers from the SystemConfiguration
+// framework. The /etc/resolv.conf in macOS is only informative, and doesn't
+// reflect the resolvers of VPNs and other network services.
+func newSystemRetriever() (*Retriever, error) {
+	output, err := exec.Command("scutil", "--dns").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := parseSCUtil(output)
+	if err != nil {
+		return nil, err
+	}
+	return NewRetriever(config), nil
+}
+
+// parseSCUtil extracts the nameservers and search domains of the "scutil
+// --dns" output. Only the resolvers for all domains are used, the ones
+// restricted to a domain (e.g. "local" for mDNS) and the scoped queries
+// section are ignored.
+func parseSCUtil(output []byte) (*dns.ClientConfig, error) {
+	var servers, search []string
+	var resolverServers, resolverSearch []string
+	restricted := false
+
+	// flush stores the information of the resolver that was read
+	flush := func() {
+		if !restricted {
+			servers = appendUnique(servers, resolverServers...)
+			search = appendUnique(search, resolverSearch...)
+		}
+		resolverServers, resolverSearch, restricted = nil, nil, false
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "DNS configuration (") {
+			break
+		}
+
+		if strings.HasPrefix(line, "resolver #") {
+			flush()
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch {
+		case strings.HasPrefix(key, "nameserver["):
+			resolverServers = append(resolverServers, value)
+		case strings.HasPrefix(key, "search domain["):
+			resolverSearch = append(resolverSearch, dns.Fqdn(value))
+		case key == "domain":
+			restricted = true
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return newClientConfig(servers, search)
+}
@@ -0,0 +1,58 @@
+//go:build darwin
+// +build darwin
+
+package dnsclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSCUtil(t *testing.T) {
+	t.Parallel()
+
+	output := []byte(`
+DNS configuration
+
+resolver #1
+  search domain[0] : example.com
+  nameserver[0] : 192.168.1.1
+  nameserver[1] : fe80::1%en0
+  if_index : 6 (en0)
+  flags    : Request A records, Request AAAA records
+  reach    : 0x00020002 (Reachable,Directly Reachable Address)
+
+resolver #2
+  domain   : local
+  options  : mdns
+  timeout  : 5
+  flags    : Request A records, Request AAAA records
+  reach    : 0x00000000 (Not Reachable)
+  order    : 300000
+
+DNS configuration (for scoped queries)
+
+resolver #1
+  search domain[0] : scoped.example.com
+  nameserver[0] : 10.0.0.1
+`)
+
+	config, err := parseSCUtil(output)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	expectedServers := []string{"192.168.1.1", "fe80::1%en0"}
+	if !reflect.DeepEqual(config.Servers, expectedServers) {
+		t.Errorf("mismatch servers. Expecting: “%v”; found “%v”", expectedServers, config.Servers)
+	}
+
+	expectedSearch := []string{"example.com."}
+	if !reflect.DeepEqual(config.Search, expectedSearch) {
+		t.Errorf("mismatch search domains. Expecting: “%v”; found “%v”", expectedSearch, config.Search)
+	}
+
+	if _, err := parseSCUtil([]byte("DNS configuration\n\nNo DNS configuration available\n")); err != ErrNoSystemNameserver {
+		t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", ErrNoSystemNameserver, err)
+	}
+}
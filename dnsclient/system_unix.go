@@ -0,0 +1,13 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package dnsclient
+
+// resolvConfPath is the location of the resolver configuration in Unix
+// systems.
+const resolvConfPath = "/etc/resolv.conf"
+
+// newSystemRetriever reads the nameservers from the resolv.conf.
+func newSystemRetriever() (*Retriever, error) {
+	return NewRetrieverFromFile(resolvConfPath)
+}
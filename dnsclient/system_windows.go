@@ -0,0 +1,96 @@
+//go:build windows
+// +build windows
+
+package dnsclient
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+	"golang.org/x/sys/windows/registry"
+)
+
+// tcpipParameters are the registry keys with the TCP/IP configuration, for
+// IPv4 and IPv6.
+var tcpipParameters = []string{
+	`SYSTEM\CurrentControlSet\Services\Tcpip\Parameters`,
+	`SYSTEM\CurrentControlSet\Services\Tcpip6\Parameters`,
+}
+
+// newSystemRetriever reads the nameservers and search domains from the
+// registry. The static nameservers of an interface have precedence over the
+// ones received by DHCP.
+func newSystemRetriever() (*Retriever, error) {
+	var servers, search []string
+
+	for _, path := range tcpipParameters {
+		parameters, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.READ)
+		if err != nil {
+			continue
+		}
+
+		for _, name := range []string{"SearchList", "Domain", "DhcpDomain"} {
+			search = appendUnique(search, fqdnList(splitRegistryList(readRegistryString(parameters, name)))...)
+		}
+		servers = appendUnique(servers, splitRegistryList(readRegistryString(parameters, "NameServer"))...)
+
+		interfaces, err := registry.OpenKey(parameters, "Interfaces", registry.READ)
+		parameters.Close()
+		if err != nil {
+			continue
+		}
+
+		names, err := interfaces.ReadSubKeyNames(-1)
+		if err != nil {
+			interfaces.Close()
+			continue
+		}
+
+		for _, name := range names {
+			iface, err := registry.OpenKey(interfaces, name, registry.READ)
+			if err != nil {
+				continue
+			}
+
+			nameservers := splitRegistryList(readRegistryString(iface, "NameServer"))
+			if len(nameservers) == 0 {
+				nameservers = splitRegistryList(readRegistryString(iface, "DhcpNameServer"))
+			}
+			servers = appendUnique(servers, nameservers...)
+			iface.Close()
+		}
+		interfaces.Close()
+	}
+
+	config, err := newClientConfig(servers, search)
+	if err != nil {
+		return nil, err
+	}
+	return NewRetriever(config), nil
+}
+
+// readRegistryString returns the string value, or an empty string when it
+// doesn't exist.
+func readRegistryString(key registry.Key, name string) string {
+	value, _, err := key.GetStringValue(name)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// splitRegistryList splits the lists of the registry, that can be separated by
+// commas or spaces.
+func splitRegistryList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// fqdnList converts the domains to fully qualified names.
+func fqdnList(domains []string) []string {
+	for i := range domains {
+		domains[i] = dns.Fqdn(domains[i])
+	}
+	return domains
+}
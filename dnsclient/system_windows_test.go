@@ -0,0 +1,50 @@
+//go:build windows
+// +build windows
+
+package dnsclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitRegistryList(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description string
+		value       string
+		expected    []string
+	}{
+		{
+			description: "it should split a list separated by commas",
+			value:       "8.8.8.8,8.8.4.4",
+			expected:    []string{"8.8.8.8", "8.8.4.4"},
+		},
+		{
+			description: "it should split a list separated by spaces",
+			value:       "192.168.1.1 192.168.1.2",
+			expected:    []string{"192.168.1.1", "192.168.1.2"},
+		},
+		{
+			description: "it should ignore an empty value",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			if values := splitRegistryList(scenario.value); !reflect.DeepEqual(values, scenario.expected) {
+				t.Errorf("mismatch values. Expecting: “%v”; found “%v”", scenario.expected, values)
+			}
+		})
+	}
+}
+
+func TestNewSystemRetriever(t *testing.T) {
+	t.Parallel()
+
+	// the machines running the tests always have a nameserver configured
+	if _, err := NewSystemRetriever(); err != nil {
+		t.Errorf("unexpected error “%v”", err)
+	}
+}
@@ -0,0 +1,78 @@
+package dnsclient
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TransportNameserver identifies the custom transport as the nameserver in the
+// exchanges and errors, and TransportNetwork as the network.
+const (
+	TransportNameserver = "transport"
+	TransportNetwork    = "transport"
+)
+
+// errNilResponse is returned when the transport doesn't return a response nor
+// an error.
+var errNilResponse = errors.New("dnsclient: transport returned no response")
+
+// DNSTransport allows the library user to define how the DNS messages are
+// sent, so tests can inject canned responses and DNS can be tunneled over
+// other protocols (e.g. gRPC or WebSocket) while the retriever still builds
+// the queries and parses the SRV, SVCB and HTTPS records.
+type DNSTransport interface {
+	// Exchange sends the query and returns the response. The context is done
+	// when the attempt times out.
+	Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error)
+}
+
+// DNSTransportFunc is an easy-to-use implementation of the interface that is
+// responsible for sending the DNS messages.
+type DNSTransportFunc func(ctx context.Context, query *dns.Msg) (*dns.Msg, error)
+
+// Exchange sends the query and returns the response.
+func (d DNSTransportFunc) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	return d(ctx, query)
+}
+
+// NewTransportRetriever builds a retriever that sends the messages using the
+// transport, with a timeout of 5 seconds and 2 attempts for each query. The
+// name of the records is used as is (ndots 1, without search domains).
+func NewTransportRetriever(transport DNSTransport) *Retriever {
+	r := NewRetriever(&dns.ClientConfig{
+		Ndots:    1,
+		Timeout:  5,
+		Attempts: 2,
+	})
+	r.SetTransport(transport)
+	return r
+}
+
+// SetTransport defines how the DNS messages are sent, replacing the
+// nameservers of the configuration. The attempts, timeouts, retry policy and
+// exchange hook still apply, but truncated responses aren't retried over TCP,
+// as the transport decides the network. A nil transport restores the
+// nameservers. It is go routine safe.
+func (r *Retriever) SetTransport(transport DNSTransport) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.transport = transport
+}
+
+// exchangeTransport sends the request using the transport, notifying the
+// exchange hook.
+func (r *Retriever) exchangeTransport(ctx context.Context, transport DNSTransport, request *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return r.capture(request, TransportNameserver, TransportNetwork, func() (*dns.Msg, error) {
+		response, err := transport.Exchange(ctx, request)
+		if err == nil && response == nil {
+			err = errNilResponse
+		}
+		return response, err
+	})
+}
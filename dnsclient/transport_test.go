@@ -0,0 +1,122 @@
+package dnsclient_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/rafaeljusto/dnsdisco/dnsclient"
+)
+
+func TestDNSTransport(t *testing.T) {
+	t.Parallel()
+
+	answer := func(query *dns.Msg) *dns.Msg {
+		response := new(dns.Msg)
+		response.SetReply(query)
+		response.Answer = []dns.RR{
+			&dns.SRV{
+				Hdr:      dns.RR_Header{Name: query.Question[0].Name, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 60},
+				Priority: 10,
+				Weight:   20,
+				Port:     5269,
+				Target:   "server1.example.com.",
+			},
+		}
+		return response
+	}
+
+	scenarios := []struct {
+		description       string
+		responses         []func(query *dns.Msg) (*dns.Msg, error)
+		expectedServers   []*net.SRV
+		expectedExchanges int
+		expectedError     bool
+	}{
+		{
+			description: "it should parse the canned response",
+			responses: []func(query *dns.Msg) (*dns.Msg, error){
+				func(query *dns.Msg) (*dns.Msg, error) {
+					return answer(query), nil
+				},
+			},
+			expectedServers: []*net.SRV{
+				{Target: "server1.example.com.", Port: 5269, Priority: 10, Weight: 20},
+			},
+			expectedExchanges: 1,
+		},
+		{
+			description: "it should retry when the transport fails",
+			responses: []func(query *dns.Msg) (*dns.Msg, error){
+				func(query *dns.Msg) (*dns.Msg, error) {
+					return nil, errors.New("tunnel closed")
+				},
+				func(query *dns.Msg) (*dns.Msg, error) {
+					return answer(query), nil
+				},
+			},
+			expectedServers: []*net.SRV{
+				{Target: "server1.example.com.", Port: 5269, Priority: 10, Weight: 20},
+			},
+			expectedExchanges: 2,
+		},
+		{
+			description: "it should fail without a response",
+			responses: []func(query *dns.Msg) (*dns.Msg, error){
+				func(query *dns.Msg) (*dns.Msg, error) {
+					return nil, nil
+				},
+				func(query *dns.Msg) (*dns.Msg, error) {
+					return nil, nil
+				},
+			},
+			expectedExchanges: 2,
+			expectedError:     true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			var queries int
+			retriever := dnsclient.NewTransportRetriever(dnsclient.DNSTransportFunc(func(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+				response := scenario.responses[queries]
+				queries++
+				return response(query)
+			}))
+
+			var exchanges []dnsclient.Exchange
+			retriever.SetExchangeHook(func(exchange dnsclient.Exchange) {
+				exchanges = append(exchanges, exchange)
+			})
+
+			servers, err := retriever.Retrieve("jabber", "tcp", "registro.example.com.")
+			if (err != nil) != scenario.expectedError {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			if !reflect.DeepEqual(servers, scenario.expectedServers) {
+				t.Errorf("mismatch servers. Expecting: “%v”; found “%v”", scenario.expectedServers, servers)
+			}
+
+			if len(exchanges) != scenario.expectedExchanges {
+				t.Fatalf("mismatch number of exchanges. Expecting: “%d”; found “%d”", scenario.expectedExchanges, len(exchanges))
+			}
+
+			for _, exchange := range exchanges {
+				if exchange.Nameserver != dnsclient.TransportNameserver || exchange.Network != dnsclient.TransportNetwork {
+					t.Errorf("unexpected exchange with “%s” over “%s”", exchange.Nameserver, exchange.Network)
+				}
+
+				if exchange.Query.Question[0].Name != "_jabber._tcp.registro.example.com." {
+					t.Errorf("unexpected question “%s”", exchange.Query.Question[0].Name)
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,19 @@
 package dnsdisco
 
 import (
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"net"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
 
+// ErrNoServer is returned when there's no healthy server available to be used.
+var ErrNoServer = errors.New("dnsdisco: no server available")
+
 // Discover is the fastest way to find a target using all the default
 // parameters. It will send a SRV query in _service._proto.name format and
 // return the target (address and port) selected by the RFC 2782 algorithm and
@@ -14,9 +21,16 @@ import (
 //
 // proto must be "udp" or "tcp", otherwise an UnknownNetworkError error will be
 // returned. The library will use the local resolver to send the DNS package.
+//
+// When the domain doesn't publish the SRV records and the service has a
+// default port (see RegisterServiceDefaults), the name itself is returned with
+// the default port.
 func Discover(service, proto, name string) (target string, port uint16, err error) {
 	discovery := NewDiscovery(service, proto, name)
 	if err = discovery.Refresh(); err != nil {
+		if port, ok := defaultPort(service, err); ok {
+			return name, port, nil
+		}
 		return
 	}
 
@@ -26,7 +40,13 @@ func Discover(service, proto, name string) (target string, port uint16, err erro
 
 // Discovery contains all the methods to discover the services and select the
 // best one at the moment. The use of interface allows the users to mock this
-// library easily for unit tests.
+// library easily for unit tests, so it only has the essential operations. The
+// discoveries built by NewDiscovery and Manager also implement optional
+// interfaces (e.g. Inspector), accessed with a type assertion:
+//
+//	if inspector, ok := discovery.(dnsdisco.Inspector); ok {
+//		servers := inspector.Servers()
+//	}
 type Discovery interface {
 	// Refresh retrieves the servers using the DNS SRV solution. It is possible to
 	// change the default behaviour (local resolver with default timeouts) using
@@ -49,13 +69,20 @@ type Discovery interface {
 	// method is called the internal errors buffer is cleared.
 	Errors() []error
 
-	// SetRetriever changes how the library retrieves the DNS SRV records.
+	// SetRetriever changes how the library retrieves the DNS SRV records. It
+	// can be called while the discovery is running, and a refresh already in
+	// progress finishes with the previous retriever.
 	SetRetriever(Retriever)
 
-	// SetHealthChecker changes the way the library health check each server.
+	// SetHealthChecker changes the way the library health check each server. It
+	// can be called while the discovery is running, and a refresh already in
+	// progress finishes with the previous health checker.
 	SetHealthChecker(HealthChecker)
 
-	// SetLoadBalancer changes how the library selects the best server.
+	// SetLoadBalancer changes how the library selects the best server. It can
+	// be called while the discovery is running, and the new load balancer
+	// receives the healthy servers of the last refresh before being used, so
+	// there's no need to refresh again.
 	SetLoadBalancer(LoadBalancer)
 }
 
@@ -82,7 +109,11 @@ type discovery struct {
 	// healthChecker is responsible for verifying if the target is still on, if
 	// not the library can move to the next target. By default the health check
 	// only tries a simple connection to the target.
-	healthChecker HealthChecker
+	healthChecker ServerHealthChecker
+
+	// automaticHealthChecker is true while the health checker is the one
+	// chosen for the service, and not one defined by the library user.
+	automaticHealthChecker bool
 
 	// healthCheckerLock make it possible to change the health check algorithm
 	// while the library is executing the operations.
@@ -96,10 +127,371 @@ type discovery struct {
 	// while the library is executing the operations.
 	loadBalancerLock sync.RWMutex
 
+	// zeroWeight defines how the servers are sorted and selected when all
+	// servers of a priority have weight zero. It is protected by the
+	// loadBalancerLock.
+	zeroWeight ZeroWeightStrategy
+
+	// capacityBlend defines how much the capacity hints of the servers count
+	// compared with the SRV weights. It is protected by the loadBalancerLock.
+	capacityBlend float64
+
+	// adaptive defines how the weights are adjusted by the reported results.
+	adaptive AdaptiveWeights
+
+	// adaptiveResults stores the moving averages of the reported results of
+	// each server.
+	adaptiveResults map[string]*adaptiveResults
+
+	// adaptiveLock make it possible to report the results while the library
+	// is executing the operations.
+	adaptiveLock sync.RWMutex
+
+	// servers stores all the servers retrieved in the last refresh, already
+	// normalized, with their health check and usage information.
+	servers []Server
+
+	// externalName is used when the lookup of the name fails or returns no
+	// healthy servers. When it is empty there's no split-horizon failover.
+	externalName string
+
+	// externalNameLock make it possible to change the external name while the
+	// library is executing the operations.
+	externalNameLock sync.RWMutex
+
+	// activeName is the name of the current servers. It is protected by the
+	// serversLock.
+	activeName string
+
+	// preferredLabel is the label preferred by the selection policy of the
+	// current servers. It is protected by the serversLock.
+	preferredLabel string
+
+	// priorityOverride replaces the priority of the servers, identified by
+	// target or by target and port.
+	priorityOverride map[string]uint16
+
+	// weightOverride replaces the weight of the servers, identified like in
+	// the priorityOverride.
+	weightOverride map[string]uint16
+
+	// selectionLimit limits the selections per second of each target.
+	selectionLimit SelectionLimit
+
+	// selectionBuckets stores the available selections of each target.
+	selectionBuckets map[string]*tokenBucket
+
+	// selectionLimitLock make it possible to change the selection limit
+	// while the library is executing the operations.
+	selectionLimitLock sync.Mutex
+
+	// locality synthesizes the priorities of the servers from their
+	// location.
+	locality Locality
+
+	// priorityOverrideLock make it possible to change the priority and weight
+	// overrides while the library is executing the operations.
+	priorityOverrideLock sync.RWMutex
+
+	// drained stores the servers drained by the operators, identified by
+	// target and port.
+	drained map[string]bool
+
+	// drainedLock make it possible to drain the servers while the library is
+	// executing the operations.
+	drainedLock sync.RWMutex
+
+	// serverFilters transform the retrieved servers before the health checks,
+	// in the order they were added.
+	serverFilters []func([]Server) []Server
+
+	// serverFiltersLock make it possible to add filters while the library is
+	// executing the operations.
+	serverFiltersLock sync.RWMutex
+
+	// staticServers are used when the retrieval fails and there's no
+	// previous answer.
+	staticServers []*net.SRV
+
+	// staticServersLock make it possible to change the fallback servers while
+	// the library is executing the operations.
+	staticServersLock sync.RWMutex
+
+	// targetSuffixes are the domains accepted in the SRV targets. When it is
+	// empty all targets are accepted.
+	targetSuffixes []string
+
+	// targetSuffixesLock make it possible to change the accepted domains while
+	// the library is executing the operations.
+	targetSuffixesLock sync.RWMutex
+
+	// manifest defines where the signed manifest of the service is published.
+	// When its URL is empty there's no verification.
+	manifest ManifestConfig
+
+	// manifestLock make it possible to change the manifest while the library
+	// is executing the operations.
+	manifestLock sync.RWMutex
+
+	// protoMismatch enables the detection of SRV records with another proto
+	// when the retrieval doesn't find any record.
+	protoMismatch bool
+
+	// protoMismatchLock make it possible to change the proto mismatch
+	// detection while the library is executing the operations.
+	protoMismatchLock sync.RWMutex
+
+	// panicPolicy defines what happens when a component of the library user
+	// panics.
+	panicPolicy PanicPolicy
+
+	// panicPolicyLock make it possible to change the panic policy while the
+	// library is executing the operations.
+	panicPolicyLock sync.RWMutex
+
+	// policyRetriever retrieves the selection policy. When it is nil there's no
+	// policy.
+	policyRetriever TXTRetriever
+
+	// policyPublicKey verifies the signature of the policy. When it is nil the
+	// policy doesn't need to be signed.
+	policyPublicKey ed25519.PublicKey
+
+	// policyLock make it possible to change the policy while the library is
+	// executing the operations.
+	policyLock sync.RWMutex
+
+	// maxShrink is the maximum percentage that the number of servers can
+	// shrink in a refresh. When it is zero there's no protection.
+	maxShrink float64
+
+	// allowShrink accepts any answer in the next refresh.
+	allowShrink bool
+
+	// shrinkLock make it possible to change the shrink protection while the
+	// library is executing the operations.
+	shrinkLock sync.Mutex
+
+	// reResolutionThreshold is the fraction of healthy servers that triggers
+	// an immediate refresh. When it is zero there's no re-resolution.
+	reResolutionThreshold float64
+
+	// reResolutionCooldown is the minimum time between triggered refreshes.
+	reResolutionCooldown time.Duration
+
+	// lastReResolution is the moment of the last triggered refresh.
+	lastReResolution time.Time
+
+	// reResolutionPending is set when a refresh was triggered, it starts when
+	// the refresh in progress finishes.
+	reResolutionPending bool
+
+	// reResolutionLock make it possible to change the re-resolution options
+	// while the library is executing the operations.
+	reResolutionLock sync.Mutex
+
+	// unixSockets maps the servers to Unix domain sockets. When it is nil only
+	// the server metadata is used.
+	unixSockets UnixSocketMapping
+
+	// unixSocketsLock make it possible to change the mapping while the library
+	// is executing the operations.
+	unixSocketsLock sync.RWMutex
+
+	// warmUp prepares the new servers of a refresh. When it is nil there's no
+	// warm-up.
+	warmUp WarmUp
+
+	// warmUpTimeout limits the duration of each warm-up.
+	warmUpTimeout time.Duration
+
+	// warmUpLock make it possible to change the warm-up while the library is
+	// executing the operations.
+	warmUpLock sync.RWMutex
+
+	// cnameResolver follows the CNAME chain of the SRV targets. When it is nil
+	// the chain isn't followed.
+	cnameResolver CNAMEResolver
+
+	// cnameMaxDepth is the maximum number of aliases followed.
+	cnameMaxDepth int
+
+	// addressResolver converts the chosen targets to IP addresses in the
+	// dial helpers.
+	addressResolver AddressResolver
+
+	// addressResolverLock make it possible to change the address resolver
+	// while the library is executing the operations.
+	addressResolverLock sync.RWMutex
+
+	// networkPolicy defines the networks where the targets can be.
+	networkPolicy NetworkPolicy
+
+	// networkPolicyLock make it possible to change the network policy while
+	// the library is executing the operations.
+	networkPolicyLock sync.RWMutex
+
+	// cnameLock make it possible to change the CNAME chasing while the library
+	// is executing the operations.
+	cnameLock sync.RWMutex
+
+	// limits protects the discovery against pathological answers.
+	limits Limits
+
+	// duplicatePolicy merges and drops the records pointing to the same
+	// target.
+	duplicatePolicy DuplicatePolicy
+
+	// limitsLock make it possible to change the limits and the duplicate
+	// policy while the library is executing the operations.
+	limitsLock sync.RWMutex
+
+	// tlsPolicies stores the certificate verification rules of each target used
+	// by DialTLS.
+	tlsPolicies TLSPolicies
+
+	// tlsPoliciesLock make it possible to change the TLS policies while the
+	// library is executing the operations.
+	tlsPoliciesLock sync.RWMutex
+
+	// credentialsProvider returns the authentication material of each target.
+	// When it is nil no credentials are used.
+	credentialsProvider CredentialsProvider
+
+	// credentialsProviderLock make it possible to change the credentials
+	// provider while the library is executing the operations.
+	credentialsProviderLock sync.RWMutex
+
+	// statsStore stores the usage counters and the health history of the
+	// servers. By default they are kept in memory.
+	statsStore StatsStore
+
+	// sharedStats is true when the statsStore was defined by the library user,
+	// so the load balancer decisions are based on its usage counters.
+	sharedStats bool
+
+	// statsStoreLock make it possible to change the stats store while the
+	// library is executing the operations.
+	statsStoreLock sync.RWMutex
+
+	// lastChoice stores the last target chosen.
+	lastChoice choice
+
+	// decisionSampling defines which load balancer decisions are recorded.
+	decisionSampling DecisionSampling
+
+	// decisions counts the choices since the sampling was enabled.
+	decisions uint64
+
+	// decisionSamples are the recorded load balancer decisions.
+	decisionSamples []DecisionSample
+
+	// decisionSamplingLock make it possible to change the decision sampling
+	// while the library is executing the operations.
+	decisionSamplingLock sync.Mutex
+
+	// selections counts the choices of each server in sliding windows.
+	selections map[string]*selectionRing
+
 	// serversLock make it safe to change the servers in the load balancer
 	// algorithm.
 	serversLock sync.RWMutex
 
+	// choiceLock serializes the choices, that only need the servers read
+	// lock. It protects the load balancer decisions, the last choice, the
+	// selections and the usage counters of the servers (Used and LastUsed),
+	// that are also protected by the servers write lock, as no choice is made
+	// while it is held.
+	choiceLock sync.Mutex
+
+	// healthCheckPacing spreads the health checks of the known servers across
+	// the interval of the asynchronous refreshes.
+	healthCheckPacing bool
+
+	// healthCheckPacingLock make it possible to change the health check pacing
+	// while the library is executing the operations.
+	healthCheckPacingLock sync.RWMutex
+
+	// warmStart is the number of concurrent background health checks after
+	// each refresh, or zero when the refreshes wait for the health checks.
+	warmStart int
+
+	// warmStartLock make it possible to change the warm start while the
+	// library is executing the operations.
+	warmStartLock sync.RWMutex
+
+	// refreshInterval is the interval of the asynchronous refreshes, or zero
+	// when they weren't started.
+	refreshInterval time.Duration
+
+	// refreshGeneration identifies the last asynchronous refresh loop started,
+	// so a previous loop doesn't clear the interval of the current one when
+	// it stops.
+	refreshGeneration uint64
+
+	// lastRefresh is the moment of the last refresh.
+	lastRefresh time.Time
+
+	// lastSuccessfulRefresh is the moment of the last refresh without errors.
+	lastSuccessfulRefresh time.Time
+
+	// probeThresholds defines when the discovery is ready or alive.
+	probeThresholds ProbeThresholds
+
+	// refreshFailures is the number of consecutive failed refreshes.
+	refreshFailures int
+
+	// lastRefreshInfo describes the last refresh.
+	lastRefreshInfo RefreshInfo
+
+	// healthChecks stores the result of the previous checks of each server,
+	// exposed to the health checkers (see HealthCheckInfo).
+	healthChecks map[string]*healthCheckState
+
+	// healthChecksLock make it possible to check the servers from different
+	// go routines.
+	healthChecksLock sync.Mutex
+
+	// errorPolicy stores the action of each error class.
+	errorPolicy map[ErrorClass]ErrorAction
+
+	// errorCounts stores the number of errors of each class.
+	errorCounts map[ErrorClass]uint64
+
+	// errorPolicyLock make it possible to change the error policy while the
+	// library is executing the operations.
+	errorPolicyLock sync.RWMutex
+
+	// clock schedules the asynchronous refreshes and the paced health checks.
+	// It is protected by the refreshStateLock.
+	clock Clock
+
+	// baseCtx controls the lifecycle of the background operations. It is
+	// protected by the refreshStateLock.
+	baseCtx context.Context
+
+	// refreshStateLock make it safe to update the refresh state from different
+	// go routines.
+	refreshStateLock sync.Mutex
+
+	// refreshCall is the refresh in progress, if any.
+	refreshCall *refreshCall
+
+	// refreshConcurrency defines what Refresh does while another refresh is
+	// in progress.
+	refreshConcurrency RefreshConcurrency
+
+	// refreshCallLock make it safe to start refreshes from different go
+	// routines.
+	refreshCallLock sync.Mutex
+
+	// events stores the channels of the event subscribers.
+	events []chan Event
+
+	// eventsLock make it possible to subscribe while the library is emitting
+	// the events.
+	eventsLock sync.RWMutex
+
 	// errors stores all the error generated by asynchronous methods
 	errors []error
 
@@ -109,89 +501,472 @@ type discovery struct {
 
 // NewDiscovery builds the default implementation of the Discovery interface. To
 // retrieve the servers it will use the net.LookupSRV (local resolver), for
-// health check will only perform a simple connection, and the chosen target
-// will be selected using the RFC 2782 considering only online servers.
+// health check will only perform a simple connection (unless the service has
+// a registered health check strategy, like the built-in http, xmpp-client,
+// xmpp-server and sip services, see RegisterServiceDefaults), and the
+// chosen target will be selected using the RFC 2782 considering only online
+// servers.
 //
 // The returned type can be used globally as it is go routine safe. It is
 // recommended to keep a global Discovery for each service to minimize the
 // number of DNS requests.
 func NewDiscovery(service, proto, name string) Discovery {
+	return buildDiscovery(service, proto, name)
+}
+
+// buildDiscovery builds the default implementation, returning the concrete
+// type so the optional interfaces can be used internally without type
+// assertions.
+func buildDiscovery(service, proto, name string) *discovery {
 	return &discovery{
 		service:       service,
 		name:          name,
 		proto:         proto,
-		retriever:     NewDefaultRetriever(),
-		healthChecker: NewDefaultHealthChecker(),
-		loadBalancer:  NewDefaultLoadBalancer(),
+		retriever:     configuredRetriever(),
+		healthChecker: serviceHealthChecker(service, proto),
+		loadBalancer:  configuredLoadBalancer(),
+		statsStore:    NewMemoryStatsStore(defaultHealthHistorySize),
+
+		automaticHealthChecker: true,
 	}
 }
 
 // Refresh retrieves the servers using the DNS SRV solution. It is possible to
 // change the default behaviour (local resolver with default timeouts) using
 // the SetRetriever method from the Discovery interface. When the new servers
-// are retrieved, a health check is done on each server and the list of servers
-// is sort by priority and weight.
+// are retrieved, the list of servers is normalized (sort by priority and
+// weight) and a health check is done on each server. If there's already a
+// refresh in progress, it waits for it and returns the same result, or returns
+// ErrRefreshInProgress, according to SetRefreshConcurrency.
 func (d *discovery) Refresh() error {
+	return d.singleFlightRefresh(d.refreshConcurrencyMode())
+}
+
+// refreshServers retrieves and checks the servers, replacing the current ones.
+// It must only be called by singleFlightRefresh, so concurrent refreshes don't
+// race to overwrite the servers.
+func (d *discovery) refreshServers() error {
+	d.emit(Event{Type: EventRefreshStarted})
+
+	begin := time.Now()
+	previous := d.Servers()
+
 	d.retrieverLock.RLock()
-	srvs, err := d.retriever.Retrieve(d.service, d.proto, d.name)
+	retriever := d.retriever
 	d.retrieverLock.RUnlock()
 
+	d.externalNameLock.RLock()
+	externalName := d.externalName
+	d.externalNameLock.RUnlock()
+
+	var err error
+	if externalName == "" {
+		err = d.refresh(d.name, true)
+	} else {
+		err = d.refreshSplitHorizon(externalName)
+	}
+
+	d.recordRefresh(d.newRefreshInfo(begin, retriever, previous, err))
+
 	if err != nil {
+		d.emit(Event{Type: EventRefreshFailed, Err: err})
 		return err
 	}
 
-	d.serversLock.Lock()
-	defer d.serversLock.Unlock()
+	d.emit(Event{Type: EventRefreshSucceeded})
+	return nil
+}
+
+// refresh retrieves and checks the servers of the name. When the name is not
+// the last option and no server is healthy, the current servers are kept and
+// errNoHealthyServers is returned.
+func (d *discovery) refresh(name string, last bool) error {
+	// the components are copied, so they can be replaced while the refresh is
+	// running without waiting for slow DNS requests or health checks
+	d.retrieverLock.RLock()
+	retriever := d.retriever
+	d.retrieverLock.RUnlock()
+
+	d.healthCheckerLock.RLock()
+	healthChecker := d.healthChecker
+	d.healthCheckerLock.RUnlock()
+
+	srvs, metadata, action, err := d.retrieveServers(retriever, name)
+	if err != nil || len(srvs) == 0 {
+		err = d.detectProtoMismatch(retriever, name, err)
+	}
+
+	if err != nil {
+		if action == ErrorActionIgnore {
+			return nil
+		}
+
+		staticServers, ok := d.useStaticServers(last)
+		if !ok {
+			if action == ErrorActionEject {
+				d.ejectServers()
+			}
+			return err
+		}
+
+		d.errorsLock.Lock()
+		d.errors = append(d.errors, FallbackError{Err: err})
+		d.errorsLock.Unlock()
+		srvs, metadata = staticServers, nil
+	}
 
-	var servers []*net.SRV
+	srvs, rejected := d.verifyTargetSuffixes(srvs)
+	if len(rejected) > 0 {
+		d.errorsLock.Lock()
+		d.errors = append(d.errors, rejected...)
+		d.errorsLock.Unlock()
+	}
+
+	srvs, mismatches, err := d.verifyManifest(srvs)
+	if err != nil {
+		return err
+	}
+
+	if len(mismatches) > 0 {
+		d.errorsLock.Lock()
+		d.errors = append(d.errors, mismatches...)
+		d.errorsLock.Unlock()
+	}
+
+	d.priorityOverrideLock.RLock()
+	priorityOverride, weightOverride, locality := d.priorityOverride, d.weightOverride, d.locality
+	d.priorityOverrideLock.RUnlock()
+
+	if locality.enabled() {
+		srvs = locality.apply(srvs, metadata)
+	}
+
+	if len(priorityOverride) > 0 {
+		srvs = overridePriorities(srvs, metadata, priorityOverride)
+	}
+
+	if len(weightOverride) > 0 {
+		srvs = overrideWeights(srvs, metadata, weightOverride)
+	}
+
+	d.loadBalancerLock.RLock()
+	zeroWeight := d.zeroWeight
+	d.loadBalancerLock.RUnlock()
+
+	byPriorityWeight(srvs).sort(zeroWeight)
+
+	d.limitsLock.RLock()
+	limits, duplicatePolicy := d.limits, d.duplicatePolicy
+	d.limitsLock.RUnlock()
+
+	d.cnameLock.RLock()
+	cnameResolver, cnameMaxDepth := d.cnameResolver, d.cnameMaxDepth
+	d.cnameLock.RUnlock()
+
+	d.warmUpLock.RLock()
+	warmUp, warmUpTimeout := d.warmUp, d.warmUpTimeout
+	d.warmUpLock.RUnlock()
+
+	d.unixSocketsLock.RLock()
+	unixSockets := d.unixSockets
+	d.unixSocketsLock.RUnlock()
+
+	srvs, warnings := duplicatePolicy.apply(srvs)
+
+	srvs, limitWarnings, err := limits.apply(srvs)
+	if err != nil {
+		return err
+	}
+	warnings = append(warnings, limitWarnings...)
+
+	d.policyLock.RLock()
+	policyRetriever, policyPublicKey := d.policyRetriever, d.policyPublicKey
+	d.policyLock.RUnlock()
+
+	var preferredLabel string
+	if policyRetriever != nil {
+		policyName := PolicyPrefix + "." + name
+		if preferredLabel, err = retrievePolicy(policyRetriever, policyPublicKey, policyName); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	if len(warnings) > 0 {
+		d.errorsLock.Lock()
+		d.errors = append(d.errors, warnings...)
+		d.errorsLock.Unlock()
+	}
+
+	now := time.Now()
+
+	retrieved := make([]Server, 0, len(srvs))
 	for _, srv := range srvs {
-		d.healthCheckerLock.RLock()
-		ok, err := d.healthChecker.HealthCheck(srv.Target, srv.Port, d.proto)
-		d.healthCheckerLock.RUnlock()
+		server := Server{
+			SRV:       *srv,
+			Metadata:  metadata[srv],
+			Retrieved: now,
+		}
+		server.UnixSocket = unixSocket(unixSockets, server)
+		retrieved = append(retrieved, server)
+	}
 
-		if err != nil {
+	d.serverFiltersLock.RLock()
+	serverFilters := d.serverFilters
+	d.serverFiltersLock.RUnlock()
+
+	for _, filter := range serverFilters {
+		retrieved = filter(retrieved)
+	}
+
+	// the servers are only locked to replace them, so the choices aren't
+	// blocked by the health checks
+	previousServers := make(map[string]Server)
+	for _, server := range d.Servers() {
+		previousServers[server.address()] = server
+	}
+
+	if err := d.quarantine(len(previousServers), len(retrieved)); err != nil {
+		return err
+	}
+
+	d.statsStoreLock.RLock()
+	statsStore := d.statsStore
+	d.statsStoreLock.RUnlock()
+
+	paced := d.pacedHealthChecks()
+	warmStart := d.warmStartConcurrency()
+
+	// inherited stores the servers that keep the health status of the current
+	// servers
+	inherited := make([]bool, len(retrieved))
+	current := make([]Server, 0, len(retrieved))
+
+	for i, server := range retrieved {
+		previousServer, found := previousServers[server.address()]
+
+		key := d.statsKey(server.Target, server.Port)
+		if server.Used, err = statsStore.Used(key); err != nil {
 			d.errorsLock.Lock()
 			d.errors = append(d.errors, err)
 			d.errorsLock.Unlock()
 		}
 
-		if err == nil && ok {
-			servers = append(servers, srv)
+		// with paced health checks the known servers keep their status, as
+		// they are checked between the refreshes, and with the warm start the
+		// new servers are considered healthy until they are checked in
+		// background
+		if (paced || warmStart > 0) && found {
+			inherited[i] = true
+			server.CanonicalName = previousServer.CanonicalName
+			server.HealthStatus = previousServer.HealthStatus
+			server.Healthy = previousServer.Healthy
+			server.HealthChecked = previousServer.HealthChecked
+			server.HealthHistory = previousServer.HealthHistory
+		} else if warmStart > 0 {
+			server.HealthStatus = HealthStatusHealthy
+			server.Healthy = true
+		} else {
+			var err error
+
+			if cnameResolver != nil {
+				server.CanonicalName, err = chaseCNAME(cnameResolver, server.Target, cnameMaxDepth)
+			}
+
+			// a broken CNAME chain can't be used, so the health check is skipped
+			status := previousServer.HealthStatus
+			begin := time.Now()
+			if err == nil {
+				// the last status is kept when the error is ignored
+				server.HealthStatus, server.HealthChecked = previousServer.HealthStatus, previousServer.HealthChecked
+				status, err = d.checkHealth(d.BaseContext(), healthChecker, server)
+			}
+
+			record := HealthRecord{Latency: time.Since(begin)}
+			if err != nil {
+				d.errorsLock.Lock()
+				d.errors = append(d.errors, err)
+				d.errorsLock.Unlock()
+				status = HealthStatusUnhealthy
+				record.Error = err.Error()
+			}
+
+			server.HealthStatus = status
+			server.Healthy = status.Usable()
+			server.HealthChecked = time.Now()
+
+			record.Status, record.Checked = status, server.HealthChecked
+			if err := statsStore.AddHealth(key, record); err != nil {
+				d.errorsLock.Lock()
+				d.errors = append(d.errors, err)
+				d.errorsLock.Unlock()
+			}
+
+			if server.HealthHistory, err = statsStore.Health(key); err != nil {
+				d.errorsLock.Lock()
+				d.errors = append(d.errors, err)
+				d.errorsLock.Unlock()
+			}
 		}
+
+		current = append(current, server)
 	}
 
-	// the default retriever already do the sort for us (lookupSRV), but if it's
-	// replaced for other algorithm the library needs to ensure that it is
-	// ordered, because the default load balancer algorithm depends on that
-	byPriorityWeight(servers).sort()
+	d.serversLock.Lock()
+	defer d.serversLock.Unlock()
 
-	d.loadBalancerLock.RLock()
-	d.loadBalancer.ChangeServers(servers)
-	d.loadBalancerLock.RUnlock()
+	// the current servers may have changed during the health checks (e.g.
+	// chosen, drained or checked by the paced health checks), so the latest
+	// information is kept
+	liveServers := make(map[string]Server, len(d.servers))
+	for _, server := range d.servers {
+		liveServers[server.address()] = server
+	}
+
+	var servers, fallbackServers []*net.SRV
+	var newServers []Server
+
+	for i := range current {
+		server := &current[i]
+
+		liveServer, found := liveServers[server.address()]
+		if found {
+			if liveServer.Used > server.Used {
+				server.Used = liveServer.Used
+			}
+			server.LastUsed = liveServer.LastUsed
+			server.WarmedUp = liveServer.WarmedUp
+
+			if inherited[i] {
+				server.CanonicalName = liveServer.CanonicalName
+				server.HealthStatus = liveServer.HealthStatus
+				server.Healthy = liveServer.Healthy
+				server.HealthChecked = liveServer.HealthChecked
+				server.HealthHistory = liveServer.HealthHistory
+			}
+		}
+
+		// the servers drained by the operators keep draining whatever is the
+		// health check result
+		if d.isDrained(server.Target, server.Port) {
+			server.HealthStatus = HealthStatusDraining
+			server.Healthy = false
+		}
+
+		if server.Healthy {
+			srv := server.SRV
+			if server.HealthStatus.Usage() == HealthUsageFallback {
+				fallbackServers = append(fallbackServers, &srv)
+			} else {
+				servers = append(servers, &srv)
+			}
+
+			if !found {
+				newServers = append(newServers, *server)
+			}
+		}
+	}
+
+	// the degraded servers are only used when there's no healthy one
+	if len(servers) == 0 {
+		servers = fallbackServers
+	}
+
+	if !last && len(servers) == 0 {
+		return errNoHealthyServers
+	}
+
+	previous := d.servers
+	d.servers = current
+	d.activeName = name
+	d.preferredLabel = preferredLabel
+	d.emitServerChanges(previous)
+	d.pruneHealthChecks(current)
+
+	if warmUp != nil {
+		d.warmUpServers(warmUp, warmUpTimeout, newServers)
+	}
+
+	d.changeServers()
+	d.checkReResolution(len(servers), len(d.servers))
+
+	if warmStart > 0 {
+		go d.checkServers(append([]Server(nil), d.servers...), warmStart)
+	}
 	return nil
 }
 
+// ForceRefresh works like Refresh, but if the retriever implements the
+// CachingRetriever interface its cached answers of the service are invalidated
+// first. It is useful to check a service that was fixed before the negative
+// TTL expires.
+func (d *discovery) ForceRefresh() error {
+	d.retrieverLock.RLock()
+	retriever := d.retriever
+	d.retrieverLock.RUnlock()
+
+	if cachingRetriever, ok := retriever.(CachingRetriever); ok {
+		cachingRetriever.Invalidate(d.service, d.proto, d.name)
+
+		d.externalNameLock.RLock()
+		if d.externalName != "" {
+			cachingRetriever.Invalidate(d.service, d.proto, d.externalName)
+		}
+		d.externalNameLock.RUnlock()
+	}
+
+	return d.Refresh()
+}
+
 // RefreshAsync works exactly as Refresh, but is non-blocking and will repeat
 // the action on every interval. To stop the refresh the returned channel must
-// be closed.
+// be closed, or the base context cancelled (see WithBaseContext).
 //
 // The interval should be at least the TTL of the SRV records, or you will
 // retrieve cached information.
 func (d *discovery) RefreshAsync(interval time.Duration) chan<- bool {
 	finish := make(chan bool)
 
+	d.refreshStateLock.Lock()
+	d.refreshInterval = interval
+	d.refreshGeneration++
+	generation := d.refreshGeneration
+	d.refreshStateLock.Unlock()
+
+	stop := func() {
+		d.refreshStateLock.Lock()
+		if d.refreshGeneration == generation {
+			d.refreshInterval = 0
+		}
+		d.refreshStateLock.Unlock()
+	}
+
+	ctx := d.BaseContext()
+
 	go func() {
 		for {
-			if err := d.Refresh(); err != nil {
+			if ctx.Err() != nil {
+				stop()
+				return
+			}
+
+			if err := d.singleFlightRefresh(RefreshConcurrencyWait); err != nil {
 				d.errorsLock.Lock()
 				d.errors = append(d.errors, err)
 				d.errorsLock.Unlock()
 			}
 
-			select {
-			case <-finish:
+			// the paced health checks also wait for the next refresh
+			if d.pacedHealthChecks() {
+				if !d.paceHealthChecks(ctx, interval, finish) {
+					stop()
+					return
+				}
+				continue
+			}
+
+			if !wait(ctx, d.currentClock(), interval, finish) {
+				stop()
 				return
-			case <-time.Tick(interval):
 			}
 		}
 	}()
@@ -208,13 +983,61 @@ func (d *discovery) Choose() (target string, port uint16) {
 	d.serversLock.RLock()
 	defer d.serversLock.RUnlock()
 
-	d.loadBalancerLock.RLock()
-	target, port = d.loadBalancer.LoadBalance()
-	d.loadBalancerLock.RUnlock()
+	d.choiceLock.Lock()
+	defer d.choiceLock.Unlock()
+
+	if d.limitedSelections() {
+		target, port = d.loadBalanceWhere(d.admissible)
+	} else {
+		d.loadBalancerLock.RLock()
+		target, port = d.loadBalance(nil)
+		d.loadBalancerLock.RUnlock()
+	}
 
+	d.admit(target, port)
+	d.markChosen(target, port)
 	return
 }
 
+// markChosen stores the chosen target and updates its usage counters. The
+// caller must hold the servers read lock and the choice lock.
+func (d *discovery) markChosen(target string, port uint16) {
+	d.lastChoice = choice{
+		target: target,
+		port:   port,
+		chosen: time.Now(),
+	}
+	d.sampleDecision()
+
+	if target == "" && port == 0 {
+		return
+	}
+
+	d.recordSelection(target, port, d.lastChoice.chosen)
+
+	d.statsStoreLock.RLock()
+	used, err := d.statsStore.IncrementUsed(d.statsKey(target, port))
+	d.statsStoreLock.RUnlock()
+
+	if err != nil {
+		d.errorsLock.Lock()
+		d.errors = append(d.errors, err)
+		d.errorsLock.Unlock()
+	}
+
+	for i := range d.servers {
+		if d.servers[i].Target == target && d.servers[i].Port == port {
+			if err != nil {
+				used = d.servers[i].Used + 1
+			}
+			d.servers[i].Used = used
+			d.servers[i].LastUsed = time.Now()
+			d.emit(Event{Type: EventChosen, Server: d.servers[i]})
+			break
+		}
+	}
+}
+
 // Errors return all errors found during asynchronous executions. Once this
 // method is called the internal errors buffer is cleared.
 func (d *discovery) Errors() []error {
@@ -226,28 +1049,193 @@ func (d *discovery) Errors() []error {
 	return errs
 }
 
+// Servers returns a copy of all servers retrieved in the last refresh,
+// including the health check result, the number of times that each one was
+// chosen and the timestamps of those operations. They are sorted by priority
+// and randomized by weight inside the same priority, as described in RFC 2782.
+func (d *discovery) Servers() []Server {
+	d.serversLock.RLock()
+	defer d.serversLock.RUnlock()
+
+	d.choiceLock.Lock()
+	defer d.choiceLock.Unlock()
+
+	servers := make([]Server, len(d.servers))
+	copy(servers, d.servers)
+	return servers
+}
+
 // SetRetriever changes how the library retrieves the DNS SRV records. It is go
-// routine safe.
+// routine safe, and can be called while Refresh or RefreshAsync are running: a
+// refresh already in progress finishes with the previous retriever, and the
+// next ones use the new retriever. If the new retriever implements the
+// Migrator interface it receives the previous one.
 func (d *discovery) SetRetriever(r Retriever) {
 	d.retrieverLock.Lock()
 	defer d.retrieverLock.Unlock()
+
+	migrate(r, d.retriever)
 	d.retriever = r
 }
 
 // SetHealthChecker changes the way the library health check each server. It is
-// go routine safe.
+// go routine safe, and has the same semantics of SetServerHealthChecker.
 func (d *discovery) SetHealthChecker(h HealthChecker) {
+	d.SetServerHealthChecker(AdaptHealthChecker(h, d.proto))
+}
+
+// SetServerHealthChecker changes the way the library health check each server,
+// using a checker with access to all server information and with a richer
+// health status. It is go routine safe, and can be called while Refresh or
+// RefreshAsync are running: a refresh already in progress finishes with the
+// previous health checker, and the next ones use the new health checker. If
+// the new health checker implements the Migrator interface it receives the
+// previous one.
+func (d *discovery) SetServerHealthChecker(h ServerHealthChecker) {
 	d.healthCheckerLock.Lock()
 	defer d.healthCheckerLock.Unlock()
+
+	migrate(h, d.healthChecker)
 	d.healthChecker = h
+	d.automaticHealthChecker = false
 }
 
 // SetLoadBalancer changes how the library selects the best server. It is go
-// routine safe.
+// routine safe, and can be called while Choose, Refresh or RefreshAsync are
+// running. The swap waits for the operations that are using the servers to
+// finish, then the new load balancer receives the healthy servers of the last
+// refresh (ChangeServers), so Choose keeps working without a new refresh. If
+// the new load balancer implements the Migrator interface it receives the
+// previous one, and can take over its state (e.g. usage counters).
 func (d *discovery) SetLoadBalancer(b LoadBalancer) {
+	d.statsStoreLock.RLock()
+	sharedStats := d.sharedStats
+	d.statsStoreLock.RUnlock()
+
+	d.serversLock.Lock()
+	defer d.serversLock.Unlock()
+
+	servers := d.balancedServers()
+
 	d.loadBalancerLock.Lock()
 	defer d.loadBalancerLock.Unlock()
+
+	if loadBalancer, ok := b.(ZeroWeightLoadBalancer); ok {
+		loadBalancer.SetZeroWeightStrategy(d.zeroWeight)
+	}
+	d.shareCapacity(b)
+	d.shareWeightFactor(b)
+
+	b.ChangeServers(servers)
+	migrate(b, d.loadBalancer)
 	d.loadBalancer = b
+	d.emit(Event{Type: EventBalancerSwapped})
+
+	if sharedStats {
+		d.shareUsage()
+	}
+}
+
+// SetTLSPolicies changes the certificate pins and CA bundles used to verify
+// each target when connecting with DialTLS. It is go routine safe.
+func (d *discovery) SetTLSPolicies(policies TLSPolicies) {
+	d.tlsPoliciesLock.Lock()
+	defer d.tlsPoliciesLock.Unlock()
+	d.tlsPolicies = policies
+}
+
+// SetWarmUp defines how the new servers of a refresh are prepared in
+// background, so the first real request doesn't pay the connection latency.
+// Only the healthy servers that weren't retrieved in the previous refresh are
+// prepared, and each warm-up is limited by the timeout. The moment of the
+// warm-up is stored in the Server type, and the failures are reported in the
+// Errors method. A nil warm-up disables it, that is the default behaviour. It
+// is go routine safe.
+func (d *discovery) SetWarmUp(warmUp WarmUp, timeout time.Duration) {
+	d.warmUpLock.Lock()
+	defer d.warmUpLock.Unlock()
+	d.warmUp = warmUp
+	d.warmUpTimeout = timeout
+}
+
+// SetCNAMEChasing enables following the CNAME chain of the SRV targets on each
+// refresh, up to the maximum depth, storing the canonical name in the Server
+// type. When the chain has a loop or is too long the server is considered
+// unhealthy, and a CNAMEError is reported in the Errors method. A nil resolver
+// disables the chasing, that is the default behaviour. It is go routine safe.
+func (d *discovery) SetCNAMEChasing(resolver CNAMEResolver, maxDepth int) {
+	d.cnameLock.Lock()
+	defer d.cnameLock.Unlock()
+	d.cnameResolver = resolver
+	d.cnameMaxDepth = maxDepth
+}
+
+// SetLimits changes the limits of the servers accepted on each refresh. When an
+// answer exceeds the limits it is rejected by Refresh, keeping the previous
+// servers, or truncated if the limits allow it. By default there's no limit.
+// It is go routine safe.
+func (d *discovery) SetLimits(limits Limits) {
+	d.limitsLock.Lock()
+	defer d.limitsLock.Unlock()
+	d.limits = limits
+}
+
+// SetZeroWeightStrategy changes how the servers are selected when all servers
+// of a priority have weight zero. By default they have the same chance
+// (ZeroWeightEqual), as required by RFC 2782. The strategy is used to sort the
+// servers in the next refresh, and is also sent to the load balancer when it
+// implements the ZeroWeightLoadBalancer interface. It is go routine safe.
+func (d *discovery) SetZeroWeightStrategy(strategy ZeroWeightStrategy) {
+	d.loadBalancerLock.Lock()
+	defer d.loadBalancerLock.Unlock()
+
+	d.zeroWeight = strategy
+	if loadBalancer, ok := d.loadBalancer.(ZeroWeightLoadBalancer); ok {
+		loadBalancer.SetZeroWeightStrategy(strategy)
+	}
+}
+
+// SetStatsStore changes where the usage counters and the health history of the
+// servers are stored. If the load balancer implements the UsageLoadBalancer
+// interface, its decisions will be based on the usage counters of the store,
+// so discoveries of many instances of an application sharing the same store
+// coordinate their choices. It is go routine safe.
+func (d *discovery) SetStatsStore(s StatsStore) {
+	d.statsStoreLock.Lock()
+	d.statsStore = s
+	d.sharedStats = true
+	d.statsStoreLock.Unlock()
+
+	d.loadBalancerLock.Lock()
+	defer d.loadBalancerLock.Unlock()
+	d.shareUsage()
+}
+
+// shareUsage makes the load balancer use the usage counters of the stats store
+// when it supports it. The caller must hold the load balancer write lock.
+func (d *discovery) shareUsage() {
+	loadBalancer, ok := d.loadBalancer.(UsageLoadBalancer)
+	if !ok {
+		return
+	}
+
+	loadBalancer.SetUsage(func(target string, port uint16) int {
+		d.statsStoreLock.RLock()
+		used, err := d.statsStore.Used(d.statsKey(target, port))
+		d.statsStoreLock.RUnlock()
+
+		if err != nil {
+			d.errorsLock.Lock()
+			d.errors = append(d.errors, err)
+			d.errorsLock.Unlock()
+		}
+		return used
+	})
+}
+
+// statsKey returns the key that identifies the server in the stats store.
+func (d *discovery) statsKey(target string, port uint16) string {
+	return ServerStatsKey(d.service, d.proto, d.name, target, port)
 }
 
 // Retriever allows the library user to define a custom DNS retrieve algorithm.
@@ -257,6 +1245,45 @@ type Retriever interface {
 	Retrieve(service, proto, name string) ([]*net.SRV, error)
 }
 
+// CachingRetriever is an optional interface that a Retriever that caches the
+// answers (e.g. negative caching of NXDOMAIN) can implement, so the cache can
+// be ignored by ForceRefresh.
+type CachingRetriever interface {
+	Retriever
+
+	// Invalidate removes the cached answers of the service.
+	Invalidate(service, proto, name string)
+}
+
+// MetadataRetriever is an optional interface that a Retriever can implement to
+// attach extra information to the retrieved servers, like the parameters of
+// the SVCB/HTTPS records (RFC 9460). When implemented it is used by Refresh
+// instead of Retrieve, and the information is available in Server.Metadata.
+type MetadataRetriever interface {
+	Retriever
+
+	// RetrieveMetadata works like Retrieve, also returning the metadata of each
+	// server in the same order of the servers.
+	RetrieveMetadata(service, proto, name string) ([]*net.SRV, []map[string]string, error)
+}
+
+// retrieveMetadata retrieves the servers with their metadata, indexed by
+// server, so the metadata isn't lost when the servers are sorted or truncated.
+func retrieveMetadata(retriever MetadataRetriever, service, proto, name string) ([]*net.SRV, map[*net.SRV]map[string]string, error) {
+	srvs, metadata, err := retriever.RetrieveMetadata(service, proto, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	indexed := make(map[*net.SRV]map[string]string)
+	for i, srv := range srvs {
+		if i < len(metadata) {
+			indexed[srv] = metadata[i]
+		}
+	}
+	return srvs, indexed, nil
+}
+
 // RetrieverFunc is an easy-to-use implementation of the interface that is
 // responsible for sending the DNS SRV requests.
 type RetrieverFunc func(service, proto, name string) ([]*net.SRV, error)
@@ -285,6 +1312,22 @@ func (h HealthCheckerFunc) HealthCheck(target string, port uint16, proto string)
 	return h(target, port, proto)
 }
 
+// Migrator is an optional interface that a retriever, health checker or load
+// balancer can implement to take over the state of the component that it
+// replaces, when it is changed while the discovery is running.
+type Migrator interface {
+	// Migrate receives the component that is being replaced. It is called
+	// before the new component is used by the discovery.
+	Migrate(previous interface{})
+}
+
+// migrate calls the migration hook of the component, if it exists.
+func migrate(component, previous interface{}) {
+	if migrator, ok := component.(Migrator); ok && previous != nil {
+		migrator.Migrate(previous)
+	}
+}
+
 // LoadBalancer allows the library user to define a custom balance algorithm.
 type LoadBalancer interface {
 	// ChangeServers will be called anytime that a new set of servers is
@@ -295,6 +1338,81 @@ type LoadBalancer interface {
 	LoadBalance() (target string, port uint16)
 }
 
+// Server is a target retrieved from the SRV records with the information of
+// how it is being used by the discovery.
+type Server struct {
+	net.SRV
+
+	// Healthy is true when the server passed on the last health check and can
+	// be chosen.
+	Healthy bool
+
+	// HealthStatus is the detailed result of the last health check.
+	HealthStatus HealthStatus
+
+	// Metadata stores extra information of the server provided by a
+	// MetadataRetriever, like the SVCB/HTTPS parameters (e.g. "alpn" and
+	// "ech"). It must not be modified.
+	Metadata map[string]string
+
+	// UnixSocket is the path of the Unix domain socket where the server
+	// listens, when it is mapped to one (see SetUnixSockets).
+	UnixSocket string
+
+	// CanonicalName is the name at the end of the CNAME chain of the target.
+	// It is only filled when the CNAME chasing is enabled.
+	CanonicalName string
+
+	// Used is the number of times that the server was chosen. The counter is
+	// kept in the stats store, so it survives refreshes and can be shared
+	// between many instances of the application.
+	Used int
+
+	// Retrieved is the moment of the last refresh that retrieved the server.
+	Retrieved time.Time
+
+	// HealthChecked is the moment of the last health check.
+	HealthChecked time.Time
+
+	// HealthHistory stores the results of the last health checks, from the
+	// oldest to the newest, as kept by the stats store. It shows flapping
+	// patterns that the last health status hides.
+	HealthHistory []HealthRecord
+
+	// LastUsed is the moment that the server was chosen for the last time. It is
+	// zero if the server was never chosen.
+	LastUsed time.Time
+
+	// WarmedUp is the moment that the server was prepared by the warm-up. It is
+	// zero if there's no warm-up or it failed.
+	WarmedUp time.Time
+}
+
+// choice stores the information of a target chosen by the load balancer.
+type choice struct {
+	target string
+	port   uint16
+	chosen time.Time
+}
+
+// address returns the target and port of the server, identifying it between
+// refreshes.
+func (s Server) address() string {
+	return net.JoinHostPort(s.Target, strconv.FormatUint(uint64(s.Port), 10))
+}
+
+// normalize sorts the SRV records by priority and randomizes the order by
+// weight inside the same priority, as described in RFC 2782. The default
+// retriever already do the sort for us (lookupSRV), but if it's replaced for
+// other algorithm the library needs to ensure that it is ordered, because the
+// load balancer algorithms depends on that. The order is defined only once per
+// refresh, so simple load balancers (e.g. round robin) still respect the
+// priorities. Priorities where all servers have weight zero are shuffled with
+// equal chance.
+func normalize(servers []*net.SRV) {
+	byPriorityWeight(servers).sort(ZeroWeightEqual)
+}
+
 // byPriorityWeight was retrieved from file "net/dnsclient.go" of the standard
 // library. It is responsible for ordering the servers by priority and weight.
 type byPriorityWeight []*net.SRV
@@ -314,12 +1432,20 @@ func (servers byPriorityWeight) Swap(i, j int) {
 }
 
 // shuffleByWeight shuffles SRV records by weight using the algorithm
-// described in RFC 2782.
-func (servers byPriorityWeight) shuffleByWeight() {
+// described in RFC 2782. When all weights are zero the order is defined by the
+// strategy: shuffled with equal chance or kept as retrieved.
+func (servers byPriorityWeight) shuffleByWeight(strategy ZeroWeightStrategy) {
 	sum := 0
 	for _, addr := range servers {
 		sum += int(addr.Weight)
 	}
+	if sum == 0 && strategy == ZeroWeightEqual {
+		for i := len(servers) - 1; i > 0; i-- {
+			j := randomSource.Intn(i + 1)
+			servers[i], servers[j] = servers[j], servers[i]
+		}
+		return
+	}
 	for sum > 0 && len(servers) > 1 {
 		s := 0
 		n := randomSource.Intn(sum)
@@ -337,15 +1463,16 @@ func (servers byPriorityWeight) shuffleByWeight() {
 	}
 }
 
-// sort reorders SRV records as specified in RFC 2782.
-func (servers byPriorityWeight) sort() {
-	sort.Sort(servers)
+// sort reorders SRV records as specified in RFC 2782. The sort is stable, so
+// the servers with the same priority and weight keep the retrieved order.
+func (servers byPriorityWeight) sort(strategy ZeroWeightStrategy) {
+	sort.Stable(servers)
 	i := 0
 	for j := 1; j < len(servers); j++ {
 		if servers[i].Priority != servers[j].Priority {
-			servers[i:j].shuffleByWeight()
+			servers[i:j].shuffleByWeight(strategy)
 			i = j
 		}
 	}
-	servers[i:].shuffleByWeight()
+	servers[i:].shuffleByWeight(strategy)
 }
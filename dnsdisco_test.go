@@ -207,6 +207,227 @@ func TestRefreshAsync(t *testing.T) {
 	}
 }
 
+func TestServers(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{
+				Target:   "server1.example.com.",
+				Port:     1111,
+				Priority: 20,
+				Weight:   10,
+			},
+			{
+				Target:   "server2.example.com.",
+				Port:     2222,
+				Priority: 10,
+				Weight:   10,
+			},
+			{
+				Target:   "server3.example.com.",
+				Port:     3333,
+				Priority: 5,
+				Weight:   10,
+			},
+			{
+				Target:   "server4.example.com.",
+				Port:     4444,
+				Priority: 15,
+				Weight:   10,
+			},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return target != "server4.example.com.", nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	discovery.Choose()
+	discovery.Choose()
+
+	var targets []string
+	var healthy []bool
+	var used []int
+
+	for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+		targets = append(targets, server.Target)
+		healthy = append(healthy, server.Healthy)
+		used = append(used, server.Used)
+
+		if server.Retrieved.IsZero() || server.HealthChecked.IsZero() {
+			t.Errorf("missing timestamps for server “%s”", server.Target)
+		}
+
+		if server.Used > 0 && server.LastUsed.IsZero() {
+			t.Errorf("missing last used timestamp for server “%s”", server.Target)
+		}
+	}
+
+	expectedTargets := []string{"server3.example.com.", "server2.example.com.", "server4.example.com.", "server1.example.com."}
+	if !reflect.DeepEqual(targets, expectedTargets) {
+		t.Errorf("mismatch servers. Expecting: “%v”; found “%v”", expectedTargets, targets)
+	}
+
+	expectedHealthy := []bool{true, true, false, true}
+	if !reflect.DeepEqual(healthy, expectedHealthy) {
+		t.Errorf("mismatch health states. Expecting: “%v”; found “%v”", expectedHealthy, healthy)
+	}
+
+	expectedUsed := []int{1, 1, 0, 0}
+	if !reflect.DeepEqual(used, expectedUsed) {
+		t.Errorf("mismatch usage counters. Expecting: “%v”; found “%v”", expectedUsed, used)
+	}
+}
+
+func TestForceRefresh(t *testing.T) {
+	t.Parallel()
+
+	retriever := &cachingRetrieverMock{}
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(retriever)
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	if retriever.invalidated != "" {
+		t.Errorf("unexpected invalidation of “%s” on refresh", retriever.invalidated)
+	}
+
+	if err := discovery.(dnsdisco.Refresher).ForceRefresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	if retriever.invalidated != "_jabber._tcp.registro.br" {
+		t.Errorf("mismatch invalidation. Expecting: “_jabber._tcp.registro.br”; found “%s”", retriever.invalidated)
+	}
+}
+
+type cachingRetrieverMock struct {
+	invalidated string
+}
+
+func (c *cachingRetrieverMock) Retrieve(service, proto, name string) ([]*net.SRV, error) {
+	return nil, nil
+}
+
+func (c *cachingRetrieverMock) Invalidate(service, proto, name string) {
+	c.invalidated = "_" + service + "._" + proto + "." + name
+}
+
+func TestMetadataRetriever(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("https", "tcp", "registro.br")
+	discovery.SetRetriever(metadataRetrieverMock{})
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	expected := map[string]map[string]string{
+		"server1.example.com.": {"alpn": "h2"},
+		"server2.example.com.": {"alpn": "h3"},
+	}
+
+	for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+		if !reflect.DeepEqual(server.Metadata, expected[server.Target]) {
+			t.Errorf("mismatch metadata of %s. Expecting: “%v”; found “%v”", server.Target, expected[server.Target], server.Metadata)
+		}
+	}
+}
+
+type metadataRetrieverMock struct{}
+
+func (m metadataRetrieverMock) Retrieve(service, proto, name string) ([]*net.SRV, error) {
+	return nil, nil
+}
+
+func (m metadataRetrieverMock) RetrieveMetadata(service, proto, name string) ([]*net.SRV, []map[string]string, error) {
+	// the servers are out of order, so the metadata must follow them when
+	// sorted
+	return []*net.SRV{
+		{Target: "server2.example.com.", Port: 443, Priority: 20},
+		{Target: "server1.example.com.", Port: 443, Priority: 10},
+	}, []map[string]string{
+		{"alpn": "h3"},
+		{"alpn": "h2"},
+	}, nil
+}
+
+func TestHotSwap(t *testing.T) {
+	t.Parallel()
+
+	retriever := dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+		}, nil
+	})
+
+	healthChecker := dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	})
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(retriever)
+	discovery.SetHealthChecker(healthChecker)
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	finish := discovery.RefreshAsync(time.Millisecond)
+	defer close(finish)
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			discovery.SetRetriever(retriever)
+			discovery.SetHealthChecker(healthChecker)
+			discovery.SetLoadBalancer(dnsdisco.NewDefaultLoadBalancer())
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if target, _ := discovery.Choose(); target == "" {
+			t.Fatal("no server chosen while swapping the components")
+		}
+	}
+	<-done
+
+	// the new load balancer must be ready to use without a refresh
+	loadBalancer := &migratorMock{LoadBalancer: dnsdisco.NewDefaultLoadBalancer()}
+	discovery.SetLoadBalancer(loadBalancer)
+
+	if target, port := discovery.Choose(); target != "server1.example.com." || port != 1111 {
+		t.Errorf("unexpected server “%s:%d” chosen after swapping the load balancer", target, port)
+	}
+
+	if loadBalancer.previous == nil {
+		t.Error("state wasn't migrated to the new load balancer")
+	}
+}
+
+type migratorMock struct {
+	dnsdisco.LoadBalancer
+	previous interface{}
+}
+
+func (m *migratorMock) Migrate(previous interface{}) {
+	m.previous = previous
+}
+
 // ExampleDiscover is the fastest way to select a server using all default
 // algorithms.
 func ExampleDiscover() {
@@ -274,6 +495,12 @@ func ExampleRetrieverFunc() {
 		request.RecursionDesired = true
 
 		response, _, err := client.Exchange(&request, "8.8.8.8:53")
+		if err == nil && response.Truncated {
+			// large RRsets don't fit in a UDP response, so retry over TCP to avoid
+			// losing servers
+			client.Net = "tcp"
+			response, _, err = client.Exchange(&request, "8.8.8.8:53")
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,84 @@
+package dnsdisco
+
+import (
+	"net"
+	"strconv"
+)
+
+// Drain flags the server as draining (HealthStatusDraining), so it isn't
+// chosen anymore, while the operators take it out of service. Unlike
+// MarkUnhealthy the flag is kept on the next refreshes and health checks,
+// until Undrain is called. The server doesn't need to be retrieved yet. It is
+// go routine safe.
+func (d *discovery) Drain(target string, port uint16) {
+	d.drainedLock.Lock()
+	if d.drained == nil {
+		d.drained = make(map[string]bool)
+	}
+	d.drained[drainKey(target, port)] = true
+	d.drainedLock.Unlock()
+
+	d.serversLock.Lock()
+	defer d.serversLock.Unlock()
+
+	found := false
+	for i, server := range d.servers {
+		if drainKey(server.Target, server.Port) != drainKey(target, port) || server.HealthStatus == HealthStatusDraining {
+			continue
+		}
+
+		d.servers[i].HealthStatus = HealthStatusDraining
+		d.servers[i].Healthy = false
+		found = true
+
+		d.emit(Event{
+			Type:                 EventHealthChanged,
+			Server:               d.servers[i],
+			PreviousHealthStatus: server.HealthStatus,
+		})
+	}
+
+	if !found {
+		return
+	}
+
+	d.changeServers()
+}
+
+// Undrain removes the draining flag defined by Drain, checking the server again
+// so it can be chosen as soon as it is healthy. It is go routine safe.
+func (d *discovery) Undrain(target string, port uint16) {
+	d.drainedLock.Lock()
+	delete(d.drained, drainKey(target, port))
+	d.drainedLock.Unlock()
+
+	for _, server := range d.Servers() {
+		if drainKey(server.Target, server.Port) == drainKey(target, port) {
+			d.checkServer(server)
+		}
+	}
+}
+
+// FlushHealth discards the health status of all servers, including the ones
+// flagged by MarkUnhealthy, checking them again concurrently. It returns when
+// all servers were checked. It is go routine safe.
+func (d *discovery) FlushHealth() {
+	servers := d.Servers()
+	if len(servers) == 0 {
+		return
+	}
+
+	d.checkServers(servers, len(servers))
+}
+
+// isDrained returns true when the server was drained by the operators.
+func (d *discovery) isDrained(target string, port uint16) bool {
+	d.drainedLock.RLock()
+	defer d.drainedLock.RUnlock()
+	return d.drained[drainKey(target, port)]
+}
+
+// drainKey identifies the server, no matter how the target was written.
+func drainKey(target string, port uint16) string {
+	return net.JoinHostPort(canonicalKey(target), strconv.FormatUint(uint64(port), 10))
+}
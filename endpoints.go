@@ -0,0 +1,57 @@
+package dnsdisco
+
+// Endpoint groups the healthy servers of the same target host, for protocols
+// where the client must use several ports of the same server (e.g. media and
+// signaling).
+type Endpoint struct {
+	// Target is the host of the servers.
+	Target string
+
+	// Ports are the ports of the healthy servers of the target, in the RFC
+	// 2782 order.
+	Ports []uint16
+
+	// Servers are the healthy servers of the target, in the same order of the
+	// ports.
+	Servers []Server
+}
+
+// DiscoverEndpoints retrieves and checks the servers of the service, returning
+// all the healthy targets with their ports (see Endpoints). Different from
+// Discover, the default port of the service isn't used when the domain
+// doesn't publish the SRV records, as there's no port to group.
+func DiscoverEndpoints(service, proto, name string) ([]Endpoint, error) {
+	discovery := buildDiscovery(service, proto, name)
+	if err := discovery.Refresh(); err != nil {
+		return nil, err
+	}
+	return discovery.Endpoints(), nil
+}
+
+// Endpoints returns the healthy servers grouped by target host. The targets
+// are sorted by their best server, following the RFC 2782 order, and the
+// target names are compared without case and trailing dot. It is go routine
+// safe.
+func (d *discovery) Endpoints() []Endpoint {
+	var endpoints []Endpoint
+	index := make(map[string]int)
+
+	for _, server := range d.Servers() {
+		if !server.Healthy {
+			continue
+		}
+
+		key := canonicalKey(server.Target)
+		i, ok := index[key]
+		if !ok {
+			i = len(endpoints)
+			index[key] = i
+			endpoints = append(endpoints, Endpoint{Target: server.Target})
+		}
+
+		endpoints[i].Ports = append(endpoints[i].Ports, server.Port)
+		endpoints[i].Servers = append(endpoints[i].Servers, server)
+	}
+
+	return endpoints
+}
@@ -0,0 +1,57 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestEndpoints(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("sip", "udp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "media1.example.com.", Port: 5060, Priority: 10, Weight: 10},
+			{Target: "MEDIA1.example.com", Port: 10000, Priority: 20, Weight: 10},
+			{Target: "media2.example.com.", Port: 5060, Priority: 15, Weight: 10},
+			{Target: "media2.example.com.", Port: 10000, Priority: 30, Weight: 10},
+			{Target: "media3.example.com.", Port: 5060, Priority: 40, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return target != "media3.example.com." && (target != "media2.example.com." || port != 10000), nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	endpoints := discovery.(dnsdisco.Inspector).Endpoints()
+
+	var targets []string
+	ports := make(map[string][]uint16)
+	for _, endpoint := range endpoints {
+		targets = append(targets, endpoint.Target)
+		ports[endpoint.Target] = endpoint.Ports
+
+		if len(endpoint.Servers) != len(endpoint.Ports) {
+			t.Errorf("mismatch servers of “%s”. Expecting: “%d”; found “%d”", endpoint.Target, len(endpoint.Ports), len(endpoint.Servers))
+		}
+	}
+
+	expectedTargets := []string{"media1.example.com.", "media2.example.com."}
+	if !reflect.DeepEqual(targets, expectedTargets) {
+		t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", expectedTargets, targets)
+	}
+
+	expectedPorts := map[string][]uint16{
+		"media1.example.com.": {5060, 10000},
+		"media2.example.com.": {5060},
+	}
+	if !reflect.DeepEqual(ports, expectedPorts) {
+		t.Errorf("mismatch ports. Expecting: “%v”; found “%v”", expectedPorts, ports)
+	}
+}
@@ -0,0 +1,176 @@
+package dnsdisco
+
+import (
+	"math"
+	"net"
+	"sync"
+)
+
+// EpochLoadBalancer selects the servers with the RFC 2782 algorithm without
+// replacement inside an epoch: each server receives a number of selections
+// proportional to its weight, and a server is only selected again in the next
+// epoch, after all servers received their selections. The servers of the best
+// priority are exhausted before the next priority. It gives a deterministic
+// coverage for batch and crawler workloads that must touch all servers in
+// weighted proportion. A new epoch also starts when the set of servers
+// changes.
+type EpochLoadBalancer struct {
+	// scale is the number of selections of the server with the highest weight
+	// in each epoch.
+	scale int
+
+	// servers are the available servers, sorted by priority.
+	servers []*net.SRV
+
+	// remaining stores the selections of each server (target and port) left
+	// in the current epoch.
+	remaining map[string]int
+
+	// epoch is the number of the current epoch.
+	epoch uint64
+
+	// lock make it safe to read the epoch while the servers are being
+	// selected.
+	lock sync.Mutex
+}
+
+// NewEpochLoadBalancer builds a load balancer that selects the servers
+// without replacement inside each epoch. The scale is the number of
+// selections of the server with the highest weight in an epoch, and the other
+// servers receive selections proportional to their weights, at least one. If
+// the scale is less than 1, each server is selected once per epoch, in the
+// weighted random order.
+func NewEpochLoadBalancer(scale int) *EpochLoadBalancer {
+	if scale < 1 {
+		scale = 1
+	}
+	return &EpochLoadBalancer{scale: scale}
+}
+
+// ChangeServers will be called anytime that a new set of servers is retrieved.
+// The current epoch is kept while the set of servers is the same.
+func (e *EpochLoadBalancer) ChangeServers(servers []*net.SRV) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// the order inside the same priority changes on each refresh, so only the
+	// set of servers is compared
+	keys := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		keys[epochKey(server)] = true
+	}
+
+	same := len(keys) == len(e.remaining)
+	for key := range keys {
+		if _, ok := e.remaining[key]; !ok {
+			same = false
+			break
+		}
+	}
+
+	e.servers = servers
+	if !same {
+		e.startEpoch()
+	}
+}
+
+// LoadBalance selects a server of the best priority that still has selections
+// in the current epoch, with probability proportional to its weight. If there's
+// no server an empty target and a zero port are returned.
+func (e *EpochLoadBalancer) LoadBalance() (target string, port uint16) {
+	return e.LoadBalanceWhere(nil)
+}
+
+// LoadBalanceWhere works like LoadBalance, but only the servers accepted by the
+// filter are considered. The servers that aren't accepted keep their
+// selections in the current epoch, and a new epoch only starts when no server
+// has selections left. A nil filter accepts all servers.
+func (e *EpochLoadBalancer) LoadBalanceWhere(accept func(target string, port uint16) bool) (target string, port uint16) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if len(e.servers) == 0 {
+		return "", 0
+	}
+
+	candidates := e.candidates(accept)
+	if len(candidates) == 0 && len(e.candidates(nil)) == 0 {
+		e.startEpoch()
+		candidates = e.candidates(accept)
+	}
+
+	// the weight zero servers still have a small chance to be selected, as
+	// they also have selections in the epoch
+	var totalWeight int
+	for _, i := range candidates {
+		totalWeight += int(e.servers[i].Weight) + 1
+	}
+
+	randomNumber := randomSource.Intn(totalWeight)
+	for _, i := range candidates {
+		randomNumber -= int(e.servers[i].Weight) + 1
+		if randomNumber < 0 {
+			e.remaining[epochKey(e.servers[i])]--
+			return e.servers[i].Target, e.servers[i].Port
+		}
+	}
+
+	return "", 0
+}
+
+// Epoch returns the number of the current epoch, starting at 1 after the first
+// servers are received.
+func (e *EpochLoadBalancer) Epoch() uint64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.epoch
+}
+
+// startEpoch distributes the selections of the new epoch between the servers.
+// The caller must hold the lock.
+func (e *EpochLoadBalancer) startEpoch() {
+	e.epoch++
+	e.remaining = make(map[string]int, len(e.servers))
+
+	var maxWeight uint16
+	for _, server := range e.servers {
+		if server.Weight > maxWeight {
+			maxWeight = server.Weight
+		}
+	}
+
+	for _, server := range e.servers {
+		selections := 1
+		if maxWeight > 0 {
+			selections = int(math.Round(float64(server.Weight) * float64(e.scale) / float64(maxWeight)))
+		}
+		e.remaining[epochKey(server)] = int(math.Max(1, float64(selections)))
+	}
+}
+
+// candidates returns the indexes of the servers of the best priority that
+// still have selections in the epoch and are accepted by the filter (that can
+// be nil). The caller must hold the lock.
+func (e *EpochLoadBalancer) candidates(accept func(target string, port uint16) bool) []int {
+	var candidates []int
+	priority := -1
+
+	for i, server := range e.servers {
+		if e.remaining[epochKey(server)] <= 0 || (accept != nil && !accept(server.Target, server.Port)) {
+			continue
+		}
+
+		if priority != -1 && priority != int(server.Priority) {
+			break
+		}
+
+		priority = int(server.Priority)
+		candidates = append(candidates, i)
+	}
+	return candidates
+}
+
+// epochKey identifies the server in the epoch.
+func epochKey(server *net.SRV) string {
+	return Server{SRV: *server}.address()
+}
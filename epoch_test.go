@@ -0,0 +1,143 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestEpochLoadBalancer(t *testing.T) {
+	t.Parallel()
+
+	servers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 20},
+		{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+		{Target: "server3.example.com.", Port: 3333, Priority: 10, Weight: 0},
+		{Target: "server4.example.com.", Port: 4444, Priority: 20, Weight: 10},
+	}
+
+	scenarios := []struct {
+		description    string
+		scale          int
+		selections     int
+		expectedCounts map[string]int
+		expectedLast   string
+		expectedEpoch  uint64
+	}{
+		{
+			description: "it should select each server once per epoch",
+			selections:  4,
+			expectedCounts: map[string]int{
+				"server1.example.com.": 1,
+				"server2.example.com.": 1,
+				"server3.example.com.": 1,
+				"server4.example.com.": 1,
+			},
+			expectedLast:  "server4.example.com.",
+			expectedEpoch: 1,
+		},
+		{
+			description: "it should select the servers in weighted proportion",
+			scale:       4,
+			selections:  8,
+			expectedCounts: map[string]int{
+				"server1.example.com.": 4,
+				"server2.example.com.": 2,
+				"server3.example.com.": 1,
+				"server4.example.com.": 1,
+			},
+			expectedLast:  "server4.example.com.",
+			expectedEpoch: 1,
+		},
+		{
+			description: "it should start a new epoch",
+			selections:  8,
+			expectedCounts: map[string]int{
+				"server1.example.com.": 2,
+				"server2.example.com.": 2,
+				"server3.example.com.": 2,
+				"server4.example.com.": 2,
+			},
+			expectedLast:  "server4.example.com.",
+			expectedEpoch: 2,
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			loadBalancer := dnsdisco.NewEpochLoadBalancer(item.scale)
+			loadBalancer.ChangeServers(servers)
+
+			counts := make(map[string]int)
+			var last string
+
+			for i := 0; i < item.selections; i++ {
+				target, _ := loadBalancer.LoadBalance()
+				counts[target]++
+				last = target
+			}
+
+			if !reflect.DeepEqual(counts, item.expectedCounts) {
+				t.Errorf("mismatch selections. Expecting: “%v”; found “%v”", item.expectedCounts, counts)
+			}
+
+			if last != item.expectedLast {
+				t.Errorf("mismatch last target. Expecting: “%s”; found “%s”", item.expectedLast, last)
+			}
+
+			if epoch := loadBalancer.Epoch(); epoch != item.expectedEpoch {
+				t.Errorf("mismatch epoch. Expecting: “%d”; found “%d”", item.expectedEpoch, epoch)
+			}
+		})
+	}
+}
+
+func TestEpochLoadBalancerChangeServers(t *testing.T) {
+	t.Parallel()
+
+	servers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 20},
+		{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+		{Target: "server3.example.com.", Port: 3333, Priority: 10, Weight: 10},
+	}
+
+	loadBalancer := dnsdisco.NewEpochLoadBalancer(1)
+	loadBalancer.ChangeServers(servers)
+
+	counts := make(map[string]int)
+	target, _ := loadBalancer.LoadBalance()
+	counts[target]++
+
+	// the refreshes shuffle the servers of the same priority
+	loadBalancer.ChangeServers([]*net.SRV{servers[2], servers[0], servers[1]})
+
+	for i := 0; i < 2; i++ {
+		target, _ := loadBalancer.LoadBalance()
+		counts[target]++
+	}
+
+	expectedCounts := map[string]int{
+		"server1.example.com.": 1,
+		"server2.example.com.": 1,
+		"server3.example.com.": 1,
+	}
+	if !reflect.DeepEqual(counts, expectedCounts) {
+		t.Errorf("mismatch selections. Expecting: “%v”; found “%v”", expectedCounts, counts)
+	}
+
+	if epoch := loadBalancer.Epoch(); epoch != 1 {
+		t.Errorf("mismatch epoch after reordering. Expecting: “1”; found “%d”", epoch)
+	}
+
+	loadBalancer.ChangeServers(servers[:2])
+
+	if epoch := loadBalancer.Epoch(); epoch != 2 {
+		t.Errorf("mismatch epoch after removing a server. Expecting: “2”; found “%d”", epoch)
+	}
+}
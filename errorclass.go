@@ -0,0 +1,240 @@
+package dnsdisco
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ErrorClass is the category of an error returned by the retrievers and the
+// health checkers (see ClassifyError).
+type ErrorClass int
+
+// List of error classes.
+const (
+	// ErrorClassUnknown is used for the errors that don't fit in the other
+	// classes.
+	ErrorClassUnknown ErrorClass = iota
+
+	// ErrorClassTimeout is used when the operation took too long.
+	ErrorClassTimeout
+
+	// ErrorClassRefused is used when the server refused the connection.
+	ErrorClassRefused
+
+	// ErrorClassNXDomain is used when the queried name doesn't exist.
+	ErrorClassNXDomain
+
+	// ErrorClassTLS is used for handshake and certificate failures.
+	ErrorClassTLS
+
+	// ErrorClassProtocol is used when the server answered with an unexpected
+	// protocol.
+	ErrorClassProtocol
+)
+
+// String returns the name of the error class.
+func (e ErrorClass) String() string {
+	switch e {
+	case ErrorClassTimeout:
+		return "timeout"
+	case ErrorClassRefused:
+		return "refused"
+	case ErrorClassNXDomain:
+		return "nxdomain"
+	case ErrorClassTLS:
+		return "tls"
+	case ErrorClassProtocol:
+		return "protocol"
+	}
+	return "unknown"
+}
+
+// ClassifyError returns the class of the error, inspecting the wrapped
+// errors. A nil error is ErrorClassUnknown.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassUnknown
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return ErrorClassNXDomain
+		}
+		if dnsErr.IsTimeout {
+			return ErrorClassTimeout
+		}
+	}
+
+	var recordHeaderErr tls.RecordHeaderError
+	var certificateErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var protoMismatchErr ProtoMismatchError
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, syscall.ETIMEDOUT):
+		return ErrorClassTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClassRefused
+	case errors.As(err, &recordHeaderErr),
+		errors.As(err, &certificateErr),
+		errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &certificateInvalidErr),
+		errors.As(err, &hostnameErr):
+		return ErrorClassTLS
+	case errors.Is(err, ErrUnexpectedProtocol), errors.As(err, &protoMismatchErr):
+		return ErrorClassProtocol
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+
+	return ErrorClassUnknown
+}
+
+// ErrorAction defines how the discovery handles the errors of a class (see
+// SetErrorPolicy).
+type ErrorAction int
+
+// List of error actions.
+const (
+	// ErrorActionDefault keeps the usual handling: the failed refresh keeps
+	// the previous servers and the failed health check makes the server
+	// unhealthy.
+	ErrorActionDefault ErrorAction = iota
+
+	// ErrorActionRetry repeats the operation once before handling the error as
+	// usual.
+	ErrorActionRetry
+
+	// ErrorActionEject removes the servers right away: the failed refresh
+	// drops all the current servers and the failed health check makes the
+	// server unhealthy.
+	ErrorActionEject
+
+	// ErrorActionIgnore discards the error: the failed refresh keeps the
+	// previous servers without reporting the error and the failed health
+	// check keeps the last status of the server (healthy if it was never
+	// checked).
+	ErrorActionIgnore
+)
+
+// SetErrorPolicy defines how the errors of the class returned by the
+// retriever and the health checker are handled, as a refused connection
+// usually deserves a different treatment than a slow answer. By default all
+// classes use ErrorActionDefault. It is go routine safe.
+func (d *discovery) SetErrorPolicy(class ErrorClass, action ErrorAction) {
+	d.errorPolicyLock.Lock()
+	defer d.errorPolicyLock.Unlock()
+
+	if d.errorPolicy == nil {
+		d.errorPolicy = make(map[ErrorClass]ErrorAction)
+	}
+	d.errorPolicy[class] = action
+}
+
+// ErrorCounts returns the number of errors of each class returned by the
+// retriever and the health checker, including the ignored ones. It is go
+// routine safe.
+func (d *discovery) ErrorCounts() map[ErrorClass]uint64 {
+	d.errorPolicyLock.RLock()
+	defer d.errorPolicyLock.RUnlock()
+
+	counts := make(map[ErrorClass]uint64, len(d.errorCounts))
+	for class, count := range d.errorCounts {
+		counts[class] = count
+	}
+	return counts
+}
+
+// errorAction classifies the error, counting it, and returns the action
+// defined for its class.
+func (d *discovery) errorAction(err error) ErrorAction {
+	class := ClassifyError(err)
+
+	d.errorPolicyLock.Lock()
+	defer d.errorPolicyLock.Unlock()
+
+	if d.errorCounts == nil {
+		d.errorCounts = make(map[ErrorClass]uint64)
+	}
+	d.errorCounts[class]++
+
+	return d.errorPolicy[class]
+}
+
+// checkHealth checks the server with the health checker, handling the error
+// according to the policy of its class. Targets outside the network policy
+// are unhealthy without running the health checker. The information about the
+// previous checks is stored in the context (see HealthCheckInfoFromContext).
+func (d *discovery) checkHealth(ctx context.Context, healthChecker ServerHealthChecker, server Server) (status HealthStatus, err error) {
+	if err = d.checkNetworkPolicy(ctx, server.Target); err != nil {
+		d.recordHealthCheck(server, HealthStatusUnhealthy, err)
+		return HealthStatusUnhealthy, err
+	}
+
+	status, err = d.healthCheck(d.healthCheckContext(ctx, server, false), healthChecker, server)
+	if err == nil {
+		d.recordHealthCheck(server, status, nil)
+		return status, nil
+	}
+
+	defer func() {
+		d.recordHealthCheck(server, status, err)
+	}()
+
+	switch d.errorAction(err) {
+	case ErrorActionRetry:
+		if status, err = d.healthCheck(d.healthCheckContext(ctx, server, true), healthChecker, server); err != nil {
+			d.errorAction(err)
+		}
+
+	case ErrorActionIgnore:
+		if server.HealthChecked.IsZero() {
+			return HealthStatusHealthy, nil
+		}
+		return server.HealthStatus, nil
+	}
+
+	return status, err
+}
+
+// retrieveServers retrieves the servers of the name with the retriever,
+// retrying according to the policy of the error class. The action of the
+// error class is returned, so the caller can handle the failure.
+func (d *discovery) retrieveServers(retriever Retriever, name string) ([]*net.SRV, map[*net.SRV]map[string]string, ErrorAction, error) {
+	srvs, metadata, err := d.retrieve(retriever, name)
+	if err == nil {
+		return srvs, metadata, ErrorActionDefault, nil
+	}
+
+	action := d.errorAction(err)
+	if action == ErrorActionRetry {
+		if srvs, metadata, err = d.retrieve(retriever, name); err != nil {
+			d.errorAction(err)
+		}
+	}
+
+	return srvs, metadata, action, err
+}
+
+// ejectServers removes all the current servers, so the load balancer doesn't
+// choose them anymore.
+func (d *discovery) ejectServers() {
+	d.serversLock.Lock()
+	defer d.serversLock.Unlock()
+
+	previous := d.servers
+	d.servers = nil
+	d.emitServerChanges(previous)
+
+	d.changeServers()
+}
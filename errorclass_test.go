@@ -0,0 +1,214 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestClassifyError(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description   string
+		err           error
+		expectedClass dnsdisco.ErrorClass
+	}{
+		{
+			description:   "it should classify a nil error as unknown",
+			expectedClass: dnsdisco.ErrorClassUnknown,
+		},
+		{
+			description:   "it should classify a generic error as unknown",
+			err:           errors.New("generic error"),
+			expectedClass: dnsdisco.ErrorClassUnknown,
+		},
+		{
+			description:   "it should classify a DNS timeout",
+			err:           &net.DNSError{Err: "i/o timeout", IsTimeout: true},
+			expectedClass: dnsdisco.ErrorClassTimeout,
+		},
+		{
+			description:   "it should classify a context deadline",
+			err:           fmt.Errorf("checking server: %w", context.DeadlineExceeded),
+			expectedClass: dnsdisco.ErrorClassTimeout,
+		},
+		{
+			description:   "it should classify a refused connection",
+			err:           &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+			expectedClass: dnsdisco.ErrorClassRefused,
+		},
+		{
+			description:   "it should classify a name that doesn't exist",
+			err:           &net.DNSError{Err: "no such host", IsNotFound: true},
+			expectedClass: dnsdisco.ErrorClassNXDomain,
+		},
+		{
+			description:   "it should classify a certificate error",
+			err:           fmt.Errorf("handshake: %w", x509.UnknownAuthorityError{}),
+			expectedClass: dnsdisco.ErrorClassTLS,
+		},
+		{
+			description:   "it should classify an unexpected protocol",
+			err:           fmt.Errorf("checking server: %w", dnsdisco.ErrUnexpectedProtocol),
+			expectedClass: dnsdisco.ErrorClassProtocol,
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			if class := dnsdisco.ClassifyError(item.err); class != item.expectedClass {
+				t.Errorf("mismatch class. Expecting: “%s”; found “%s”", item.expectedClass, class)
+			}
+		})
+	}
+}
+
+func TestSetErrorPolicy(t *testing.T) {
+	t.Parallel()
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	timeout := &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+
+	servers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+	}
+
+	scenarios := []struct {
+		description     string
+		class           dnsdisco.ErrorClass
+		action          dnsdisco.ErrorAction
+		retrieverErrors []error
+		healthErrors    []error
+		expectedError   bool
+		expectedServers int
+		expectedHealthy bool
+		expectedCounts  map[dnsdisco.ErrorClass]uint64
+	}{
+		{
+			description:     "it should mark the server unhealthy by default",
+			class:           dnsdisco.ErrorClassRefused,
+			action:          dnsdisco.ErrorActionDefault,
+			healthErrors:    []error{refused},
+			expectedServers: 1,
+			expectedCounts:  map[dnsdisco.ErrorClass]uint64{dnsdisco.ErrorClassRefused: 1},
+		},
+		{
+			description:     "it should retry the health check",
+			class:           dnsdisco.ErrorClassRefused,
+			action:          dnsdisco.ErrorActionRetry,
+			healthErrors:    []error{refused},
+			expectedServers: 1,
+			expectedHealthy: true,
+			expectedCounts:  map[dnsdisco.ErrorClass]uint64{dnsdisco.ErrorClassRefused: 1},
+		},
+		{
+			description:     "it should ignore the health check error",
+			class:           dnsdisco.ErrorClassRefused,
+			action:          dnsdisco.ErrorActionIgnore,
+			healthErrors:    []error{refused, refused},
+			expectedServers: 1,
+			expectedHealthy: true,
+			expectedCounts:  map[dnsdisco.ErrorClass]uint64{dnsdisco.ErrorClassRefused: 1},
+		},
+		{
+			description:     "it should keep the servers when the retriever fails",
+			class:           dnsdisco.ErrorClassTimeout,
+			action:          dnsdisco.ErrorActionDefault,
+			retrieverErrors: []error{nil, timeout},
+			expectedError:   true,
+			expectedServers: 1,
+			expectedHealthy: true,
+			expectedCounts:  map[dnsdisco.ErrorClass]uint64{dnsdisco.ErrorClassTimeout: 1},
+		},
+		{
+			description:     "it should ignore the retriever error",
+			class:           dnsdisco.ErrorClassTimeout,
+			action:          dnsdisco.ErrorActionIgnore,
+			retrieverErrors: []error{nil, timeout},
+			expectedServers: 1,
+			expectedHealthy: true,
+			expectedCounts:  map[dnsdisco.ErrorClass]uint64{dnsdisco.ErrorClassTimeout: 1},
+		},
+		{
+			description:     "it should eject the servers when the retriever fails",
+			class:           dnsdisco.ErrorClassTimeout,
+			action:          dnsdisco.ErrorActionEject,
+			retrieverErrors: []error{nil, timeout},
+			expectedError:   true,
+			expectedCounts:  map[dnsdisco.ErrorClass]uint64{dnsdisco.ErrorClassTimeout: 1},
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			retrieverErrors, healthErrors := item.retrieverErrors, item.healthErrors
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.(dnsdisco.FailureConfigurer).SetErrorPolicy(item.class, item.action)
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				var err error
+				if len(retrieverErrors) > 0 {
+					err, retrieverErrors = retrieverErrors[0], retrieverErrors[1:]
+				}
+				if err != nil {
+					return nil, err
+				}
+				return servers, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				var err error
+				if len(healthErrors) > 0 {
+					err, healthErrors = healthErrors[0], healthErrors[1:]
+				}
+				return err == nil, err
+			}))
+
+			var err error
+			for i := 0; i < 2; i++ {
+				err = discovery.Refresh()
+				if len(item.retrieverErrors) == 0 {
+					break
+				}
+			}
+
+			if item.expectedError && err == nil {
+				t.Error("expected an error and got nil")
+			} else if !item.expectedError && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			discoveredServers := discovery.(dnsdisco.Inspector).Servers()
+			if len(discoveredServers) != item.expectedServers {
+				t.Fatalf("mismatch number of servers. Expecting: “%d”; found “%d”", item.expectedServers, len(discoveredServers))
+			}
+
+			for _, server := range discoveredServers {
+				if server.Healthy != item.expectedHealthy {
+					t.Errorf("mismatch health of “%s”. Expecting: “%t”; found “%t”", server.Target, item.expectedHealthy, server.Healthy)
+				}
+			}
+
+			counts := discovery.(dnsdisco.Inspector).ErrorCounts()
+			for class, expectedCount := range item.expectedCounts {
+				if counts[class] != expectedCount {
+					t.Errorf("mismatch number of “%s” errors. Expecting: “%d”; found “%d”", class, expectedCount, counts[class])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Package etcd retrieves the servers of a service from etcd instead of DNS SRV
+// records. It is useful for environments migrating between etcd-based and
+// DNS-based discovery, as the same Discovery can be used in both cases.
+//
+// To avoid depending on a specific etcd client version, the library only
+// needs an implementation of the Client interface, that can be easily written
+// on top of the official clients.
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+// Client is the subset of the etcd operations needed by the retriever.
+type Client interface {
+	// Values returns the values of all keys that starts with the given prefix.
+	Values(prefix string) ([][]byte, error)
+
+	// Watch notifies on the returned channel every time that a key with the
+	// given prefix is created, changed or removed. The watch must be stopped
+	// when the finish channel is closed.
+	Watch(prefix string, finish <-chan bool) <-chan bool
+}
+
+// Entry is the JSON document stored in each etcd key that represents a server.
+type Entry struct {
+	// Target is the address of the server.
+	Target string `json:"target"`
+
+	// Port is where the server is listening for requests.
+	Port uint16 `json:"port"`
+
+	// Priority works like the SRV record priority, the servers with lower values
+	// are used first.
+	Priority uint16 `json:"priority"`
+
+	// Weight works like the SRV record weight, servers with bigger values inside
+	// the same priority are used more often.
+	Weight uint16 `json:"weight"`
+}
+
+// Retriever reads the servers from the keys stored under
+// <prefix>/_service._proto.name/, where each key contains an Entry in JSON
+// format. It implements the dnsdisco.Retriever interface.
+type Retriever struct {
+	// client is the connection to the etcd cluster.
+	client Client
+
+	// prefix is the root directory where the services are stored.
+	prefix string
+
+	// nameComposer builds the directory name of the services. When it is nil
+	// the _service._proto.name layout is used.
+	nameComposer dnsdisco.NameComposer
+
+	// nameComposerLock make it possible to change the name composer while the
+	// retriever is executing the operations.
+	nameComposerLock sync.RWMutex
+
+	// errors stores all the error generated by asynchronous methods.
+	errors []error
+
+	// errorsLock guarantees that the errors list will be go routine safe.
+	errorsLock sync.Mutex
+}
+
+// NewRetriever builds a retriever that looks for the services under the given
+// prefix using the etcd client.
+func NewRetriever(client Client, prefix string) *Retriever {
+	return &Retriever{
+		client: client,
+		prefix: strings.TrimRight(prefix, "/"),
+	}
+}
+
+// Retrieve reads all entries of the service and converts them to SRV records.
+// If any entry is invalid an error is returned, so the discovery keeps the
+// last known set of servers.
+func (r *Retriever) Retrieve(service, proto, name string) ([]*net.SRV, error) {
+	values, err := r.client.Values(r.key(service, proto, name))
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []*net.SRV
+	for _, value := range values {
+		var entry Entry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return nil, err
+		}
+
+		servers = append(servers, &net.SRV{
+			Target:   entry.Target,
+			Port:     entry.Port,
+			Priority: entry.Priority,
+			Weight:   entry.Weight,
+		})
+	}
+
+	return servers, nil
+}
+
+// Watch refreshes the discovery every time that an entry of the service
+// changes in etcd, so there's no need to wait for the next RefreshAsync
+// interval. The discovery must be using this retriever. To stop watching the
+// returned channel must be closed.
+func (r *Retriever) Watch(discovery dnsdisco.Discovery, service, proto, name string) chan<- bool {
+	finish := make(chan bool)
+	changes := r.client.Watch(r.key(service, proto, name), finish)
+
+	go func() {
+		for {
+			select {
+			case <-finish:
+				return
+			case _, ok := <-changes:
+				if !ok {
+					return
+				}
+
+				if err := discovery.Refresh(); err != nil {
+					r.errorsLock.Lock()
+					r.errors = append(r.errors, err)
+					r.errorsLock.Unlock()
+				}
+			}
+		}
+	}()
+
+	return finish
+}
+
+// Errors return all errors found while refreshing the discovery on changes.
+// Once this method is called the internal errors buffer is cleared.
+func (r *Retriever) Errors() []error {
+	r.errorsLock.Lock()
+	defer r.errorsLock.Unlock()
+
+	errs := r.errors
+	r.errors = nil
+	return errs
+}
+
+// SetNameComposer defines how the directory name of the services is built,
+// for registries that don't follow the _service._proto.name layout. A nil
+// composer restores the default layout. It is go routine safe.
+func (r *Retriever) SetNameComposer(composer dnsdisco.NameComposer) {
+	r.nameComposerLock.Lock()
+	defer r.nameComposerLock.Unlock()
+	r.nameComposer = composer
+}
+
+// key returns the etcd directory of the service in the format
+// <prefix>/_service._proto.name/, or <prefix>/<composed name>/ when a name
+// composer is defined.
+func (r *Retriever) key(service, proto, name string) string {
+	r.nameComposerLock.RLock()
+	composer := r.nameComposer
+	r.nameComposerLock.RUnlock()
+
+	if composer != nil {
+		return fmt.Sprintf("%s/%s/", r.prefix, strings.TrimRight(composer.ComposeName(service, proto, name), "."))
+	}
+	return fmt.Sprintf("%s/_%s._%s.%s/", r.prefix, service, proto, strings.TrimRight(name, "."))
+}
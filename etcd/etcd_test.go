@@ -0,0 +1,154 @@
+package etcd_test
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/etcd"
+)
+
+func TestRetrieve(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		prefix          string
+		composer        dnsdisco.NameComposer
+		values          map[string][][]byte
+		expectedServers []*net.SRV
+		expectError     bool
+	}{
+		{
+			description: "it should convert the entries to SRV records",
+			prefix:      "/services/",
+			values: map[string][][]byte{
+				"/services/_jabber._tcp.registro.br/": {
+					[]byte(`{"target":"server1.example.com.","port":1111,"priority":10,"weight":20}`),
+					[]byte(`{"target":"server2.example.com.","port":2222,"priority":20,"weight":10}`),
+				},
+			},
+			expectedServers: []*net.SRV{
+				{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 20},
+				{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+			},
+		},
+		{
+			description: "it should use the name composer",
+			prefix:      "/services",
+			composer: dnsdisco.NameComposerFunc(func(service, proto, name string) string {
+				return service + ".eu-west." + name
+			}),
+			values: map[string][][]byte{
+				"/services/jabber.eu-west.registro.br/": {
+					[]byte(`{"target":"server1.example.com.","port":1111,"priority":10,"weight":20}`),
+				},
+			},
+			expectedServers: []*net.SRV{
+				{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 20},
+			},
+		},
+		{
+			description: "it should fail with an invalid entry",
+			prefix:      "/services",
+			values: map[string][][]byte{
+				"/services/_jabber._tcp.registro.br/": {
+					[]byte(`{"target":"server1.example.com."`),
+				},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			retriever := etcd.NewRetriever(&clientMock{values: scenario.values}, scenario.prefix)
+			retriever.SetNameComposer(scenario.composer)
+			servers, err := retriever.Retrieve("jabber", "tcp", "registro.br.")
+
+			if !reflect.DeepEqual(servers, scenario.expectedServers) {
+				t.Errorf("mismatch servers. Expecting: “%#v”; found “%#v”", scenario.expectedServers, servers)
+			}
+
+			if (err != nil) != scenario.expectError {
+				t.Errorf("unexpected error “%v”", err)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	client := &clientMock{
+		values: map[string][][]byte{
+			"/services/_jabber._tcp.registro.br/": {
+				[]byte(`{"target":"server1.example.com.","port":1111,"priority":10,"weight":20}`),
+			},
+		},
+		changes: make(chan bool),
+	}
+
+	retriever := etcd.NewRetriever(client, "/services")
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(retriever)
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving servers. Details: %s", err)
+	}
+
+	finish := retriever.Watch(discovery, "jabber", "tcp", "registro.br")
+	defer close(finish)
+
+	client.setValues(map[string][][]byte{
+		"/services/_jabber._tcp.registro.br/": {
+			[]byte(`{"target":"server2.example.com.","port":2222,"priority":10,"weight":20}`),
+		},
+	})
+	client.changes <- true
+
+	// wait the asynchronous refresh
+	time.Sleep(50 * time.Millisecond)
+
+	if target, port := discovery.Choose(); target != "server2.example.com." || port != 2222 {
+		t.Errorf("mismatch server. Expecting: “server2.example.com.:2222”; found “%s:%d”", target, port)
+	}
+
+	if errs := retriever.Errors(); len(errs) > 0 {
+		t.Errorf("unexpected errors “%v”", errs)
+	}
+}
+
+// clientMock stores the etcd values in memory.
+type clientMock struct {
+	values  map[string][][]byte
+	changes chan bool
+	lock    sync.Mutex
+}
+
+// Values returns the values of all keys that starts with the given prefix.
+func (c *clientMock) Values(prefix string) ([][]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.values[prefix], nil
+}
+
+// Watch notifies on the returned channel every time that a key with the given
+// prefix changes.
+func (c *clientMock) Watch(prefix string, finish <-chan bool) <-chan bool {
+	return c.changes
+}
+
+// setValues replaces the stored values.
+func (c *clientMock) setValues(values map[string][][]byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values = values
+}
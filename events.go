@@ -0,0 +1,240 @@
+package dnsdisco
+
+import "time"
+
+// EventType identifies what happened in the discovery lifecycle.
+type EventType int
+
+// List of possible events of the discovery lifecycle.
+const (
+	// EventRefreshStarted is emitted when a refresh starts.
+	EventRefreshStarted EventType = iota
+
+	// EventRefreshSucceeded is emitted when a refresh finishes without errors.
+	EventRefreshSucceeded
+
+	// EventRefreshFailed is emitted when a refresh fails. The event stores the
+	// error.
+	EventRefreshFailed
+
+	// EventServerAdded is emitted when a refresh retrieves a new server.
+	EventServerAdded
+
+	// EventServerRemoved is emitted when a server isn't retrieved anymore.
+	EventServerRemoved
+
+	// EventHealthChanged is emitted when the health status of a server changes
+	// between refreshes. The event stores the previous status.
+	EventHealthChanged
+
+	// EventChosen is emitted when a server is chosen.
+	EventChosen
+
+	// EventBalancerSwapped is emitted when the load balancer is replaced.
+	EventBalancerSwapped
+
+	// EventTargetRejected is emitted when a SRV record is rejected because its
+	// target doesn't end in the expected domain suffixes. The event stores the
+	// record and the error.
+	EventTargetRejected
+
+	// EventManifestMismatch is emitted when a SRV record doesn't match the
+	// signed manifest of the service. The event stores the record and the
+	// error.
+	EventManifestMismatch
+
+	// EventPanicRecovered is emitted when a panic of the retriever, the health
+	// checker or the load balancer is recovered (see SetPanicPolicy). The
+	// event stores the PanicError.
+	EventPanicRecovered
+
+	// EventServerPortChanged is emitted when a refresh keeps a target but
+	// changes its port. The event stores the server with the new port and
+	// the previous port. It is emitted before the EventServerRemoved event of
+	// the previous port, so the connections can be drained (see
+	// PoolConfig.PortChangeDrain).
+	EventServerPortChanged
+)
+
+// String returns the human readable name of the event type.
+func (e EventType) String() string {
+	switch e {
+	case EventRefreshStarted:
+		return "refresh-started"
+	case EventRefreshSucceeded:
+		return "refresh-succeeded"
+	case EventRefreshFailed:
+		return "refresh-failed"
+	case EventServerAdded:
+		return "server-added"
+	case EventServerRemoved:
+		return "server-removed"
+	case EventHealthChanged:
+		return "health-changed"
+	case EventChosen:
+		return "chosen"
+	case EventBalancerSwapped:
+		return "balancer-swapped"
+	case EventTargetRejected:
+		return "target-rejected"
+	case EventManifestMismatch:
+		return "manifest-mismatch"
+	case EventPanicRecovered:
+		return "panic-recovered"
+	case EventServerPortChanged:
+		return "server-port-changed"
+	}
+
+	return "unknown"
+}
+
+// Event describes something that happened in the discovery lifecycle. It is
+// the single source for metrics, logging and debug handlers.
+type Event struct {
+	// Type identifies what happened.
+	Type EventType
+
+	// Time is the moment of the event.
+	Time time.Time
+
+	// Server is the server of the event, for the server, health and choice
+	// events.
+	Server Server
+
+	// PreviousHealthStatus is the health status of the server before the
+	// EventHealthChanged event.
+	PreviousHealthStatus HealthStatus
+
+	// PreviousPort is the port of the server before the
+	// EventServerPortChanged event.
+	PreviousPort uint16
+
+	// Err is the error of the EventRefreshFailed, EventTargetRejected,
+	// EventManifestMismatch and EventPanicRecovered events.
+	Err error
+}
+
+// eventsBufferSize is the number of events that each subscriber can hold
+// before new events are dropped.
+const eventsBufferSize = 128
+
+// Events subscribes to the events of the discovery lifecycle, returning a new
+// channel for each call, so metrics, logging and debug handlers can consume
+// the events independently. The discovery never blocks on a slow consumer:
+// when the channel buffer is full the new events are dropped. Call CloseEvents
+// to unsubscribe. It is go routine safe.
+func (d *discovery) Events() <-chan Event {
+	events := make(chan Event, eventsBufferSize)
+
+	d.eventsLock.Lock()
+	defer d.eventsLock.Unlock()
+	d.events = append(d.events, events)
+	return events
+}
+
+// CloseEvents unsubscribes and closes a channel returned by Events. It is go
+// routine safe.
+func (d *discovery) CloseEvents(events <-chan Event) {
+	d.eventsLock.Lock()
+	defer d.eventsLock.Unlock()
+
+	for i, subscriber := range d.events {
+		if subscriber == events {
+			d.events = append(d.events[:i], d.events[i+1:]...)
+			close(subscriber)
+			return
+		}
+	}
+}
+
+// emit sends the event to all subscribers, without blocking.
+func (d *discovery) emit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	d.eventsLock.RLock()
+	defer d.eventsLock.RUnlock()
+
+	for _, subscriber := range d.events {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// emitServerChanges compares the new servers with the previous ones, emitting
+// the added, removed and health changed events. The caller must hold the
+// servers lock.
+func (d *discovery) emitServerChanges(previous []Server) {
+	previousServers := make(map[string]Server, len(previous))
+	for _, server := range previous {
+		previousServers[server.address()] = server
+	}
+
+	current := make(map[string]bool, len(d.servers))
+	for _, server := range d.servers {
+		current[server.address()] = true
+
+		previousServer, found := previousServers[server.address()]
+		if !found {
+			d.emit(Event{Type: EventServerAdded, Server: server})
+		} else if previousServer.HealthStatus != server.HealthStatus {
+			d.emit(Event{
+				Type:                 EventHealthChanged,
+				Server:               server,
+				PreviousHealthStatus: previousServer.HealthStatus,
+			})
+		}
+	}
+
+	for _, change := range portChanges(previous, d.servers, current) {
+		d.emit(change)
+	}
+
+	for _, server := range previous {
+		if !current[server.address()] {
+			d.emit(Event{Type: EventServerRemoved, Server: server})
+		}
+	}
+}
+
+// portChanges detects the targets that were kept with a different port,
+// returning the EventServerPortChanged events. Only the targets with exactly
+// one removed and one added port are considered, as otherwise the migration
+// can't be paired.
+func portChanges(previous, servers []Server, current map[string]bool) []Event {
+	previousAddresses := make(map[string]bool, len(previous))
+	removed := make(map[string][]Server)
+	for _, server := range previous {
+		previousAddresses[server.address()] = true
+		if !current[server.address()] {
+			key := canonicalKey(server.Target)
+			removed[key] = append(removed[key], server)
+		}
+	}
+
+	added := make(map[string][]Server)
+	for _, server := range servers {
+		if !previousAddresses[server.address()] {
+			key := canonicalKey(server.Target)
+			added[key] = append(added[key], server)
+		}
+	}
+
+	var events []Event
+	for _, server := range servers {
+		key := canonicalKey(server.Target)
+		if len(removed[key]) != 1 || len(added[key]) != 1 || added[key][0].address() != server.address() {
+			continue
+		}
+
+		events = append(events, Event{
+			Type:         EventServerPortChanged,
+			Server:       server,
+			PreviousPort: removed[key][0].Port,
+		})
+	}
+	return events
+}
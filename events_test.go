@@ -0,0 +1,186 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+
+	srvs := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+	}
+	var retrieveErr error
+	healthy := map[string]bool{
+		"server1.example.com.": true,
+		"server2.example.com.": true,
+		"server3.example.com.": true,
+	}
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return srvs, retrieveErr
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return healthy[target], nil
+	}))
+
+	events := discovery.(dnsdisco.EventSource).Events()
+	defer discovery.(dnsdisco.EventSource).CloseEvents(events)
+
+	scenarios := []struct {
+		description     string
+		action          func()
+		expectedEvents  []dnsdisco.EventType
+		expectedTargets []string
+	}{
+		{
+			description: "it should add the servers",
+			action: func() {
+				discovery.Refresh()
+			},
+			expectedEvents: []dnsdisco.EventType{
+				dnsdisco.EventRefreshStarted,
+				dnsdisco.EventServerAdded,
+				dnsdisco.EventServerAdded,
+				dnsdisco.EventRefreshSucceeded,
+			},
+			expectedTargets: []string{"", "server1.example.com.", "server2.example.com.", ""},
+		},
+		{
+			description: "it should report the chosen server",
+			action: func() {
+				discovery.Choose()
+			},
+			expectedEvents: []dnsdisco.EventType{
+				dnsdisco.EventChosen,
+			},
+			expectedTargets: []string{"server1.example.com."},
+		},
+		{
+			description: "it should detect the health changes and the removed servers",
+			action: func() {
+				srvs = []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+					{Target: "server3.example.com.", Port: 3333, Priority: 20, Weight: 10},
+				}
+				healthy["server1.example.com."] = false
+				discovery.Refresh()
+			},
+			expectedEvents: []dnsdisco.EventType{
+				dnsdisco.EventRefreshStarted,
+				dnsdisco.EventHealthChanged,
+				dnsdisco.EventServerAdded,
+				dnsdisco.EventServerRemoved,
+				dnsdisco.EventRefreshSucceeded,
+			},
+			expectedTargets: []string{"", "server1.example.com.", "server3.example.com.", "server2.example.com.", ""},
+		},
+		{
+			description: "it should detect the port changes",
+			action: func() {
+				srvs = []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+					{Target: "server3.example.com.", Port: 4444, Priority: 20, Weight: 10},
+				}
+				discovery.Refresh()
+			},
+			expectedEvents: []dnsdisco.EventType{
+				dnsdisco.EventRefreshStarted,
+				dnsdisco.EventServerAdded,
+				dnsdisco.EventServerPortChanged,
+				dnsdisco.EventServerRemoved,
+				dnsdisco.EventRefreshSucceeded,
+			},
+			expectedTargets: []string{"", "server3.example.com.", "server3.example.com.", "server3.example.com.", ""},
+		},
+		{
+			description: "it should report the refresh failure",
+			action: func() {
+				retrieveErr = errors.New("timeout")
+				discovery.Refresh()
+			},
+			expectedEvents: []dnsdisco.EventType{
+				dnsdisco.EventRefreshStarted,
+				dnsdisco.EventRefreshFailed,
+			},
+			expectedTargets: []string{"", ""},
+		},
+		{
+			description: "it should report the load balancer swap",
+			action: func() {
+				discovery.SetLoadBalancer(dnsdisco.NewDefaultLoadBalancer())
+			},
+			expectedEvents: []dnsdisco.EventType{
+				dnsdisco.EventBalancerSwapped,
+			},
+			expectedTargets: []string{""},
+		},
+	}
+
+	// the scenarios depend on each other, so they aren't executed in parallel
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			scenario.action()
+
+			var types []dnsdisco.EventType
+			var targets []string
+
+			for len(events) > 0 {
+				event := <-events
+				types = append(types, event.Type)
+				targets = append(targets, event.Server.Target)
+
+				if event.Type == dnsdisco.EventHealthChanged &&
+					(event.PreviousHealthStatus != dnsdisco.HealthStatusHealthy || event.Server.HealthStatus != dnsdisco.HealthStatusUnhealthy) {
+					t.Errorf("unexpected health change from “%s” to “%s”", event.PreviousHealthStatus, event.Server.HealthStatus)
+				}
+
+				if event.Type == dnsdisco.EventServerPortChanged && (event.PreviousPort != 3333 || event.Server.Port != 4444) {
+					t.Errorf("unexpected port change from “%d” to “%d”", event.PreviousPort, event.Server.Port)
+				}
+
+				if event.Type == dnsdisco.EventRefreshFailed && event.Err == nil {
+					t.Error("missing error in the refresh failure")
+				}
+
+				if event.Time.IsZero() {
+					t.Errorf("missing time in the event “%s”", event.Type)
+				}
+			}
+
+			if !reflect.DeepEqual(types, scenario.expectedEvents) {
+				t.Errorf("mismatch events. Expecting: “%v”; found “%v”", scenario.expectedEvents, types)
+			}
+
+			if !reflect.DeepEqual(targets, scenario.expectedTargets) {
+				t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", scenario.expectedTargets, targets)
+			}
+		})
+	}
+}
+
+func TestCloseEvents(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return nil, nil
+	}))
+
+	events := discovery.(dnsdisco.EventSource).Events()
+	discovery.(dnsdisco.EventSource).CloseEvents(events)
+
+	// the discovery must not block or panic without subscribers
+	discovery.Refresh()
+
+	if _, ok := <-events; ok {
+		t.Error("expected a closed channel after unsubscribing")
+	}
+}
@@ -0,0 +1,118 @@
+package dnsdisco
+
+import "time"
+
+// Explainer is an optional interface that a LoadBalancer can implement to
+// describe why the last target was chosen. The default load balancer
+// implements it.
+type Explainer interface {
+	// Explain describes why the last target was chosen.
+	Explain() string
+}
+
+// Explanation describes the last choice of the discovery, so it is possible to
+// understand why a target is being selected. It can be serialized to JSON.
+type Explanation struct {
+	// Target is the last chosen target. It is empty if no server was available.
+	Target string `json:"target"`
+
+	// Port is the port of the last chosen target.
+	Port uint16 `json:"port"`
+
+	// Chosen is the moment of the last choice. It is zero if Choose was never
+	// called.
+	Chosen time.Time `json:"chosen"`
+
+	// Reason is the description of the load balancer decision.
+	Reason string `json:"reason"`
+
+	// Servers are all servers retrieved in the last refresh, with the
+	// information used to consider them in the choice.
+	Servers []ExplainedServer `json:"servers"`
+}
+
+// ExplainedServer describes how a server was considered in the last choice.
+type ExplainedServer struct {
+	// Target is the address of the server.
+	Target string `json:"target"`
+
+	// Port is the port of the server.
+	Port uint16 `json:"port"`
+
+	// Priority is the SRV record priority.
+	Priority uint16 `json:"priority"`
+
+	// Weight is the SRV record weight.
+	Weight uint16 `json:"weight"`
+
+	// Health is the result of the last health check.
+	Health string `json:"health"`
+
+	// Used is the number of times that the server was chosen.
+	Used int `json:"used"`
+
+	// Considered is true when the server was sent to the load balancer.
+	Considered bool `json:"considered"`
+
+	// Reason describes why the server was or wasn't considered.
+	Reason string `json:"reason"`
+}
+
+// Explain describes the last choice, listing the servers that were considered,
+// their health and usage, and why the winner was picked. When the load balancer
+// doesn't implement the Explainer interface, only the servers information is
+// available.
+func (d *discovery) Explain() Explanation {
+	d.serversLock.RLock()
+	defer d.serversLock.RUnlock()
+
+	d.choiceLock.Lock()
+	defer d.choiceLock.Unlock()
+
+	return d.explain()
+}
+
+// explain describes the last choice. The caller must hold the servers read
+// lock and the choice lock.
+func (d *discovery) explain() Explanation {
+	explanation := Explanation{
+		Target: d.lastChoice.target,
+		Port:   d.lastChoice.port,
+		Chosen: d.lastChoice.chosen,
+		Reason: "chosen by a load balancer that doesn't explain its decisions",
+	}
+
+	// the load balancer decisions are protected by the choice lock, so it's
+	// safe to ask for the explanation of the last decision here
+	d.loadBalancerLock.RLock()
+	if explainer, ok := d.loadBalancer.(Explainer); ok {
+		explanation.Reason = explainer.Explain()
+	}
+	d.loadBalancerLock.RUnlock()
+
+	for _, server := range d.servers {
+		explained := ExplainedServer{
+			Target:     server.Target,
+			Port:       server.Port,
+			Priority:   server.Priority,
+			Weight:     server.Weight,
+			Health:     server.HealthStatus.String(),
+			Used:       server.Used,
+			Considered: server.Healthy,
+		}
+
+		if server.Healthy {
+			explained.Reason = "passed on the health check"
+		} else {
+			explained.Reason = "ignored because the server is " + server.HealthStatus.String()
+		}
+
+		if server.Target == explanation.Target && server.Port == explanation.Port {
+			explained.Reason = "chosen by the load balancer"
+		}
+
+		explanation.Servers = append(explanation.Servers, explained)
+	}
+
+	return explanation
+}
@@ -0,0 +1,70 @@
+package dnsdisco_test
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{
+				Target:   "server1.example.com.",
+				Port:     1111,
+				Priority: 10,
+				Weight:   20,
+			},
+			{
+				Target:   "server2.example.com.",
+				Port:     2222,
+				Priority: 20,
+				Weight:   10,
+			},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return target == "server2.example.com.", nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	if explanation := discovery.(dnsdisco.Inspector).Explain(); !explanation.Chosen.IsZero() {
+		t.Errorf("unexpected choice before calling Choose: %#v", explanation)
+	}
+
+	discovery.Choose()
+	explanation := discovery.(dnsdisco.Inspector).Explain()
+
+	if explanation.Target != "server2.example.com." || explanation.Port != 2222 {
+		t.Errorf("mismatch chosen server. Expecting: “server2.example.com.:2222”; found “%s:%d”", explanation.Target, explanation.Port)
+	}
+
+	if !strings.Contains(explanation.Reason, "priority 20") {
+		t.Errorf("unexpected reason “%s”", explanation.Reason)
+	}
+
+	if len(explanation.Servers) != 2 {
+		t.Fatalf("mismatch number of servers. Expecting: “2”; found “%d”", len(explanation.Servers))
+	}
+
+	if server := explanation.Servers[0]; server.Considered || server.Health != "unhealthy" {
+		t.Errorf("unexpected explanation for the unhealthy server: %#v", server)
+	}
+
+	if server := explanation.Servers[1]; !server.Considered || server.Used != 1 {
+		t.Errorf("unexpected explanation for the chosen server: %#v", server)
+	}
+
+	if _, err := json.Marshal(explanation); err != nil {
+		t.Errorf("unexpected error serializing the explanation. Details: %s", err)
+	}
+}
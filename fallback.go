@@ -0,0 +1,72 @@
+package dnsdisco
+
+import (
+	"fmt"
+	"net"
+)
+
+// FallbackError is a warning stored in the Errors list when the retrieval
+// failed before any answer was received, and the static fallback servers were
+// used instead.
+type FallbackError struct {
+	// Err is the retrieval error.
+	Err error
+}
+
+// Error returns the warning description.
+func (f FallbackError) Error() string {
+	return fmt.Sprintf("dnsdisco: retrieval failed, using the fallback servers: %s", f.Err)
+}
+
+// Unwrap returns the retrieval error.
+func (f FallbackError) Unwrap() error {
+	return f.Err
+}
+
+// SetFallbackServers defines a static list of servers used as last resort,
+// only when the retrieval fails and there's no previous answer, so a freshly
+// started process in a degraded network can still reach the seed hosts. The
+// fallback servers are health checked and balanced like the retrieved ones, and
+// the retrieval error is stored as a FallbackError in the Errors list. A nil
+// list disables the fallback. It is go routine safe.
+func (d *discovery) SetFallbackServers(servers []*net.SRV) {
+	var copied []*net.SRV
+	for _, server := range servers {
+		server := *server
+		copied = append(copied, &server)
+	}
+
+	d.staticServersLock.Lock()
+	defer d.staticServersLock.Unlock()
+	d.staticServers = copied
+}
+
+// useStaticServers returns a copy of the fallback servers when the retrieval
+// of the last name option failed and there's no previous answer.
+func (d *discovery) useStaticServers(last bool) ([]*net.SRV, bool) {
+	if !last {
+		return nil, false
+	}
+
+	d.serversLock.RLock()
+	answered := len(d.servers) > 0
+	d.serversLock.RUnlock()
+
+	if answered {
+		return nil, false
+	}
+
+	d.staticServersLock.RLock()
+	defer d.staticServersLock.RUnlock()
+
+	if len(d.staticServers) == 0 {
+		return nil, false
+	}
+
+	servers := make([]*net.SRV, len(d.staticServers))
+	for i, server := range d.staticServers {
+		server := *server
+		servers[i] = &server
+	}
+	return servers, true
+}
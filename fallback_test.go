@@ -0,0 +1,94 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetFallbackServers(t *testing.T) {
+	t.Parallel()
+
+	retrievalErr := errors.New("network unreachable")
+	fallbackServers := []*net.SRV{
+		{Target: "seed1.example.com.", Port: 5222, Priority: 10, Weight: 10},
+	}
+
+	scenarios := []struct {
+		description     string
+		answers         [][]*net.SRV
+		expectedTargets []string
+		expectedError   error
+		expectedErrors  []error
+	}{
+		{
+			description:     "it should use the fallback servers without a previous answer",
+			answers:         [][]*net.SRV{nil},
+			expectedTargets: []string{"seed1.example.com."},
+			expectedErrors:  []error{dnsdisco.FallbackError{Err: retrievalErr}},
+		},
+		{
+			description: "it should keep the previous answer",
+			answers: [][]*net.SRV{
+				{{Target: "server1.example.com.", Port: 5222, Priority: 10, Weight: 10}},
+				nil,
+			},
+			expectedTargets: []string{"server1.example.com."},
+			expectedError:   retrievalErr,
+		},
+		{
+			description: "it should not use the fallback servers when the retrieval works",
+			answers: [][]*net.SRV{
+				{{Target: "server1.example.com.", Port: 5222, Priority: 10, Weight: 10}},
+			},
+			expectedTargets: []string{"server1.example.com."},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			answers := scenario.answers
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "example.com")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				answer := answers[0]
+				answers = answers[1:]
+				if answer == nil {
+					return nil, retrievalErr
+				}
+				return answer, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+			discovery.(dnsdisco.FailureConfigurer).SetFallbackServers(fallbackServers)
+
+			var err error
+			for range scenario.answers {
+				err = discovery.Refresh()
+			}
+
+			if err != scenario.expectedError {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+
+			var targets []string
+			for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+				targets = append(targets, server.Target)
+			}
+
+			if !reflect.DeepEqual(targets, scenario.expectedTargets) {
+				t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", scenario.expectedTargets, targets)
+			}
+
+			if errs := discovery.Errors(); !reflect.DeepEqual(errs, scenario.expectedErrors) {
+				t.Errorf("mismatch warnings. Expecting: “%v”; found “%v”", scenario.expectedErrors, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package dnsdisco
+
+import "net"
+
+// ChooseWhere works like Choose, but only the healthy servers accepted by the
+// filter can be selected. It is useful to restrict the selection at call time
+// (e.g. only port 443, or only the new version of a service during a canary)
+// without reconfiguring the load balancer. The filtered servers are selected
+// using the RFC 2782 algorithm considering their usage counters, as the
+// configured load balancer only knows the complete set of servers. If no
+// server matches an empty target and a zero port are returned.
+func (d *discovery) ChooseWhere(filter func(Server) bool) (target string, port uint16) {
+	d.serversLock.RLock()
+	defer d.serversLock.RUnlock()
+
+	d.choiceLock.Lock()
+	defer d.choiceLock.Unlock()
+
+	if d.limitedSelections() {
+		filter = admissibleFilter(filter, d.admissible)
+	}
+
+	target, port = d.chooseFiltered(filter)
+	d.admit(target, port)
+	d.markChosen(target, port)
+	return
+}
+
+// chooseFiltered selects one of the healthy servers accepted by the filter,
+// using the RFC 2782 algorithm considering their usage counters. The caller
+// must hold the servers read lock and the choice lock.
+func (d *discovery) chooseFiltered(filter func(Server) bool) (target string, port uint16) {
+	used := make(map[string]int)
+	for _, server := range d.servers {
+		used[server.address()] = server.Used
+	}
+	servers := chooseable(d.servers, filter)
+
+	d.loadBalancerLock.RLock()
+	zeroWeight, capacityBlend := d.zeroWeight, d.capacityBlend
+	d.loadBalancerLock.RUnlock()
+
+	loadBalancer := &defaultLoadBalancer{
+		zeroWeight:    zeroWeight,
+		capacity:      d.capacity,
+		capacityBlend: capacityBlend,
+		weightFactor:  d.weightFactor,
+	}
+	loadBalancer.ChangeServers(servers)
+	loadBalancer.SetUsage(func(target string, port uint16) int {
+		return used[Server{SRV: net.SRV{Target: target, Port: port}}.address()]
+	})
+
+	return loadBalancer.LoadBalance()
+}
+
+// admissibleFilter combines the filter (that can be nil) with the check of the
+// available selections.
+func admissibleFilter(filter func(Server) bool, admissible func(Server) bool) func(Server) bool {
+	return func(server Server) bool {
+		return (filter == nil || filter(server)) && admissible(server)
+	}
+}
+
+// AddServerFilter adds a transformation of the servers retrieved in each
+// refresh, applied after the normalization (sort by priority and weight) and
+// before the health checks, so the load balancer only sees the transformed
+// servers. The filters can reorder, remove or rewrite the servers (e.g. map
+// the ports to the TLS ones), or inject synthetic servers, and are applied in
+// the order they were added. It is go routine safe.
+func (d *discovery) AddServerFilter(filter func([]Server) []Server) {
+	d.serverFiltersLock.Lock()
+	defer d.serverFiltersLock.Unlock()
+
+	// the slice is copied, so a refresh in progress keeps the previous filters
+	filters := make([]func([]Server) []Server, len(d.serverFilters), len(d.serverFilters)+1)
+	copy(filters, d.serverFilters)
+	d.serverFilters = append(filters, filter)
+}
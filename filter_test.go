@@ -0,0 +1,143 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestChooseWhere(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		filter          func(dnsdisco.Server) bool
+		choices         int
+		expectedTargets []string
+	}{
+		{
+			description: "it should choose only the accepted servers",
+			filter: func(server dnsdisco.Server) bool {
+				return server.Port == 443
+			},
+			choices:         2,
+			expectedTargets: []string{"server2.example.com.", "server3.example.com."},
+		},
+		{
+			description: "it should ignore unhealthy servers",
+			filter: func(server dnsdisco.Server) bool {
+				return server.Target == "server4.example.com."
+			},
+			choices:         1,
+			expectedTargets: []string{""},
+		},
+		{
+			description: "it should not select any target",
+			filter: func(server dnsdisco.Server) bool {
+				return false
+			},
+			choices:         1,
+			expectedTargets: []string{""},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 80, Priority: 10, Weight: 10},
+					{Target: "server2.example.com.", Port: 443, Priority: 20, Weight: 10},
+					{Target: "server3.example.com.", Port: 443, Priority: 20, Weight: 10},
+					{Target: "server4.example.com.", Port: 443, Priority: 5, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return target != "server4.example.com.", nil
+			}))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			// servers of the same priority are randomized by weight, but the least
+			// used server is always preferred
+			var targets []string
+			for i := 0; i < scenario.choices; i++ {
+				target, _ := discovery.(dnsdisco.Selector).ChooseWhere(scenario.filter)
+				targets = append(targets, target)
+			}
+			sort.Strings(targets)
+
+			if !reflect.DeepEqual(targets, scenario.expectedTargets) {
+				t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", scenario.expectedTargets, targets)
+			}
+
+			if target, _ := discovery.Choose(); target != "server1.example.com." {
+				t.Errorf("the filter shouldn't affect the load balancer, found “%s”", target)
+			}
+		})
+	}
+}
+
+func TestAddServerFilter(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("http", "tcp", "example.com")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 80, Priority: 10, Weight: 10},
+			{Target: "server2.example.com.", Port: 80, Priority: 20, Weight: 10},
+		}, nil
+	}))
+
+	checked := make(chan string, 3)
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		checked <- dnsdisco.JoinHostPort(target, port)
+		return true, nil
+	}))
+
+	// map the ports to the TLS ones
+	discovery.(dnsdisco.RecordConfigurer).AddServerFilter(func(servers []dnsdisco.Server) []dnsdisco.Server {
+		for i := range servers {
+			if servers[i].Port == 80 {
+				servers[i].Port = 443
+			}
+		}
+		return servers
+	})
+
+	// inject a synthetic server and remove the second one
+	discovery.(dnsdisco.RecordConfigurer).AddServerFilter(func(servers []dnsdisco.Server) []dnsdisco.Server {
+		return append(servers[:1], dnsdisco.Server{
+			SRV: net.SRV{Target: "sidecar.example.com.", Port: 8443, Priority: 30, Weight: 10},
+		})
+	})
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+	close(checked)
+
+	var addresses []string
+	for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+		addresses = append(addresses, dnsdisco.JoinHostPort(server.Target, server.Port))
+	}
+
+	expectedAddresses := []string{"server1.example.com.:443", "sidecar.example.com.:8443"}
+	if !reflect.DeepEqual(addresses, expectedAddresses) {
+		t.Errorf("mismatch servers. Expecting: “%v”; found “%v”", expectedAddresses, addresses)
+	}
+
+	var checkedAddresses []string
+	for address := range checked {
+		checkedAddresses = append(checkedAddresses, address)
+	}
+
+	if !reflect.DeepEqual(checkedAddresses, expectedAddresses) {
+		t.Errorf("mismatch checked servers. Expecting: “%v”; found “%v”", expectedAddresses, checkedAddresses)
+	}
+}
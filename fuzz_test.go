@@ -0,0 +1,89 @@
+package dnsdisco
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// fuzzServers decodes the fuzzer data into SRV records, using 5 bytes for each
+// record: priority, weight, port (2 bytes) and the target index.
+func fuzzServers(data []byte) []*net.SRV {
+	var servers []*net.SRV
+	for ; len(data) >= 5; data = data[5:] {
+		servers = append(servers, &net.SRV{
+			Priority: uint16(data[0]),
+			Weight:   uint16(data[1]),
+			Port:     binary.BigEndian.Uint16(data[2:4]),
+			Target:   fmt.Sprintf("server%d.example.com.", data[4]),
+		})
+	}
+	return servers
+}
+
+func FuzzNormalize(f *testing.F) {
+	f.Add(false, []byte{10, 20, 0, 80, 1, 10, 0, 0, 80, 2, 20, 10, 1, 187, 3})
+	f.Add(true, []byte{10, 0, 0, 80, 1, 10, 0, 0, 80, 2})
+
+	f.Fuzz(func(t *testing.T, ordered bool, data []byte) {
+		servers := fuzzServers(data)
+
+		strategy := ZeroWeightEqual
+		if ordered {
+			strategy = ZeroWeightOrdered
+		}
+
+		count := make(map[net.SRV]int)
+		for _, server := range servers {
+			count[*server]++
+		}
+
+		byPriorityWeight(servers).sort(strategy)
+
+		for i, server := range servers {
+			if i > 0 && servers[i-1].Priority > server.Priority {
+				t.Fatalf("servers not sorted by priority: %d before %d", servers[i-1].Priority, server.Priority)
+			}
+			count[*server]--
+		}
+
+		for server, n := range count {
+			if n != 0 {
+				t.Fatalf("server %#v lost or duplicated in the normalization", server)
+			}
+		}
+	})
+}
+
+func FuzzDefaultLoadBalancer(f *testing.F) {
+	f.Add(uint8(3), []byte{10, 20, 0, 80, 1, 10, 0, 0, 80, 2, 20, 10, 1, 187, 3})
+	f.Add(uint8(1), []byte{})
+
+	f.Fuzz(func(t *testing.T, iterations uint8, data []byte) {
+		servers := fuzzServers(data)
+		byPriorityWeight(servers).sort(ZeroWeightEqual)
+
+		available := make(map[string]bool)
+		for _, server := range servers {
+			available[Server{SRV: *server}.address()] = true
+		}
+
+		loadBalancer := NewDefaultLoadBalancer()
+		loadBalancer.ChangeServers(servers)
+
+		for i := 0; i < int(iterations); i++ {
+			target, port := loadBalancer.LoadBalance()
+			if target == "" && port == 0 {
+				if len(servers) > 0 {
+					t.Fatal("no server selected")
+				}
+				continue
+			}
+
+			if !available[Server{SRV: net.SRV{Target: target, Port: port}}.address()] {
+				t.Fatalf("unknown server selected: %s:%d", target, port)
+			}
+		}
+	})
+}
@@ -0,0 +1,318 @@
+// Package gameserver provides helpers to discover game servers published with
+// SRV records (e.g. _minecraft._tcp), with health checkers that use the status
+// ping of the game protocol instead of a simple connection. The ping results,
+// like the number of players, are exposed as metadata of the servers, so
+// launchers and proxies can use them when choosing a server.
+package gameserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+// defaultTimeout limits the connection and the ping when no timeout is
+// defined.
+const defaultTimeout = 5 * time.Second
+
+// maxPacketSize limits the size of the status response, as it is only a JSON
+// document.
+const maxPacketSize = 1 << 20
+
+// List of metadata keys (dnsdisco.Server.Metadata) filled with the ping
+// results by the retriever.
+const (
+	// PlayersOnlineMetadata is the number of players connected to the server.
+	PlayersOnlineMetadata = "players_online"
+
+	// PlayersMaxMetadata is the maximum number of players of the server.
+	PlayersMaxMetadata = "players_max"
+
+	// VersionMetadata is the game version of the server.
+	VersionMetadata = "version"
+)
+
+// ErrUnexpectedResponse is returned when the server answers something that
+// isn't part of the expected protocol.
+var ErrUnexpectedResponse = errors.New("gameserver: unexpected response")
+
+// Status is the result of a status ping.
+type Status struct {
+	// Version is the game version of the server (e.g. "1.20.4").
+	Version string
+
+	// Protocol is the protocol number of the game version.
+	Protocol int
+
+	// PlayersOnline is the number of players connected to the server.
+	PlayersOnline int
+
+	// PlayersMax is the maximum number of players of the server.
+	PlayersMax int
+
+	// Description is the message of the day of the server.
+	Description string
+}
+
+// Full returns true when the server doesn't accept more players.
+func (s Status) Full() bool {
+	return s.PlayersMax > 0 && s.PlayersOnline >= s.PlayersMax
+}
+
+// PingMinecraft sends the server list ping of the Minecraft protocol (Java
+// Edition 1.7 or newer) to the target, returning the server status. The
+// operation must finish before the context is done.
+func PingMinecraft(ctx context.Context, target string, port uint16) (Status, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", dnsdisco.JoinHostPort(target, port))
+	if err != nil {
+		return Status{}, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	address := strings.TrimSuffix(target, ".")
+	if ip, ok := dnsdisco.IPLiteral(target); ok {
+		address = ip.String()
+	}
+
+	// the handshake uses the protocol version -1, as the client is pinging to
+	// find out the server version, and the next state 1 (status)
+	var handshake bytes.Buffer
+	writeVarInt(&handshake, 0x00)
+	writeVarInt(&handshake, -1)
+	writeString(&handshake, address)
+	binary.Write(&handshake, binary.BigEndian, port)
+	writeVarInt(&handshake, 1)
+
+	var request bytes.Buffer
+	writeVarInt(&request, int32(handshake.Len()))
+	request.Write(handshake.Bytes())
+
+	// status request, without fields
+	writeVarInt(&request, 1)
+	writeVarInt(&request, 0x00)
+
+	if _, err := conn.Write(request.Bytes()); err != nil {
+		return Status{}, err
+	}
+
+	reader := bufio.NewReader(conn)
+	length, err := readVarInt(reader)
+	if err != nil {
+		return Status{}, err
+	}
+
+	if length <= 0 || length > maxPacketSize {
+		return Status{}, ErrUnexpectedResponse
+	}
+
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(reader, packet); err != nil {
+		return Status{}, err
+	}
+
+	packetReader := bytes.NewReader(packet)
+	if id, err := readVarInt(packetReader); err != nil || id != 0x00 {
+		return Status{}, ErrUnexpectedResponse
+	}
+
+	jsonLength, err := readVarInt(packetReader)
+	if err != nil || jsonLength < 0 || int(jsonLength) > packetReader.Len() {
+		return Status{}, ErrUnexpectedResponse
+	}
+
+	content := make([]byte, jsonLength)
+	packetReader.Read(content)
+	return parseStatus(content)
+}
+
+// minecraftStatus is the JSON document of the status response.
+type minecraftStatus struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+
+	Description json.RawMessage `json:"description"`
+}
+
+// parseStatus decodes the JSON document of the status response. The
+// description can be a simple string or a chat component.
+func parseStatus(content []byte) (Status, error) {
+	var decoded minecraftStatus
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return Status{}, ErrUnexpectedResponse
+	}
+
+	status := Status{
+		Version:       decoded.Version.Name,
+		Protocol:      decoded.Version.Protocol,
+		PlayersOnline: decoded.Players.Online,
+		PlayersMax:    decoded.Players.Max,
+	}
+
+	if err := json.Unmarshal(decoded.Description, &status.Description); err != nil {
+		var component struct {
+			Text string `json:"text"`
+		}
+		json.Unmarshal(decoded.Description, &component)
+		status.Description = component.Text
+	}
+
+	return status, nil
+}
+
+// NewMinecraftHealthChecker returns a health checker that sends the status
+// ping to each server. A server that doesn't answer is unhealthy, and a full
+// server is degraded, so it is only chosen when there's no other option. Each
+// ping is limited by the timeout (5 seconds when zero).
+func NewMinecraftHealthChecker(timeout time.Duration) dnsdisco.ServerHealthChecker {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return dnsdisco.ServerHealthCheckerFunc(func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		status, err := PingMinecraft(ctx, server.Target, server.Port)
+		if err != nil {
+			return dnsdisco.HealthStatusUnhealthy, err
+		}
+
+		if status.Full() {
+			return dnsdisco.HealthStatusDegraded, nil
+		}
+		return dnsdisco.HealthStatusHealthy, nil
+	})
+}
+
+// minecraftRetriever pings the retrieved servers to fill their metadata.
+type minecraftRetriever struct {
+	dnsdisco.Retriever
+
+	// timeout limits each ping.
+	timeout time.Duration
+}
+
+// NewMinecraftRetriever wraps the retriever, sending the status ping to the
+// retrieved servers in parallel and storing the results in their metadata
+// (PlayersOnlineMetadata, PlayersMaxMetadata and VersionMetadata). The servers
+// that don't answer the ping in the timeout (5 seconds when zero) have no
+// metadata. If the retriever is nil the default one is used.
+func NewMinecraftRetriever(retriever dnsdisco.Retriever, timeout time.Duration) dnsdisco.MetadataRetriever {
+	if retriever == nil {
+		retriever = dnsdisco.NewDefaultRetriever()
+	}
+
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return minecraftRetriever{Retriever: retriever, timeout: timeout}
+}
+
+// RetrieveMetadata retrieves the servers and pings them.
+func (m minecraftRetriever) RetrieveMetadata(service, proto, name string) ([]*net.SRV, []map[string]string, error) {
+	srvs, err := m.Retrieve(service, proto, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := make([]map[string]string, len(srvs))
+
+	var wg sync.WaitGroup
+	for i, srv := range srvs {
+		wg.Add(1)
+		go func(i int, srv *net.SRV) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+			defer cancel()
+
+			status, err := PingMinecraft(ctx, srv.Target, srv.Port)
+			if err != nil {
+				return
+			}
+
+			metadata[i] = map[string]string{
+				PlayersOnlineMetadata: strconv.Itoa(status.PlayersOnline),
+				PlayersMaxMetadata:    strconv.Itoa(status.PlayersMax),
+				VersionMetadata:       status.Version,
+			}
+		}(i, srv)
+	}
+	wg.Wait()
+
+	return srvs, metadata, nil
+}
+
+// NewMinecraftDiscovery builds a discovery of the Minecraft servers of the
+// domain (_minecraft._tcp), checking the servers with the status ping and
+// storing the number of players in their metadata. Each ping is limited by the
+// timeout (5 seconds when zero).
+func NewMinecraftDiscovery(name string, timeout time.Duration) dnsdisco.Discovery {
+	discovery := dnsdisco.NewDiscovery("minecraft", "tcp", name)
+	discovery.SetRetriever(NewMinecraftRetriever(nil, timeout))
+	discovery.(dnsdisco.HealthManager).SetServerHealthChecker(NewMinecraftHealthChecker(timeout))
+	return discovery
+}
+
+// writeVarInt writes the number using the variable length encoding of the
+// protocol.
+func writeVarInt(buffer *bytes.Buffer, value int32) {
+	number := uint32(value)
+	for {
+		if number&^0x7f == 0 {
+			buffer.WriteByte(byte(number))
+			return
+		}
+		buffer.WriteByte(byte(number&0x7f | 0x80))
+		number >>= 7
+	}
+}
+
+// writeString writes the string prefixed by its length.
+func writeString(buffer *bytes.Buffer, value string) {
+	writeVarInt(buffer, int32(len(value)))
+	buffer.WriteString(value)
+}
+
+// readVarInt reads a number using the variable length encoding of the
+// protocol.
+func readVarInt(reader io.ByteReader) (int32, error) {
+	var number uint32
+	for i := 0; i < 5; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		number |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(number), nil
+		}
+	}
+
+	return 0, ErrUnexpectedResponse
+}
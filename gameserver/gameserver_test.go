@@ -0,0 +1,207 @@
+package gameserver_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/gameserver"
+)
+
+func TestPingMinecraft(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description    string
+		response       []byte
+		expectedStatus gameserver.Status
+		expectedError  error
+	}{
+		{
+			description: "it should decode the status with a text description",
+			response: statusPacket(`{"version":{"name":"1.20.4","protocol":765},` +
+				`"players":{"max":20,"online":3},"description":"A Minecraft Server"}`),
+			expectedStatus: gameserver.Status{
+				Version:       "1.20.4",
+				Protocol:      765,
+				PlayersOnline: 3,
+				PlayersMax:    20,
+				Description:   "A Minecraft Server",
+			},
+		},
+		{
+			description: "it should decode the status with a chat component description",
+			response: statusPacket(`{"version":{"name":"1.20.4","protocol":765},` +
+				`"players":{"max":20,"online":20},"description":{"text":"Full server"}}`),
+			expectedStatus: gameserver.Status{
+				Version:       "1.20.4",
+				Protocol:      765,
+				PlayersOnline: 20,
+				PlayersMax:    20,
+				Description:   "Full server",
+			},
+		},
+		{
+			description:   "it should detect an invalid packet",
+			response:      []byte{0x02, 0x01, 0x00},
+			expectedError: gameserver.ErrUnexpectedResponse,
+		},
+		{
+			description:   "it should detect an invalid document",
+			response:      statusPacket(`not json`),
+			expectedError: gameserver.ErrUnexpectedResponse,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			port, stop := startServer(t, scenario.response)
+			defer stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			status, err := gameserver.PingMinecraft(ctx, "127.0.0.1", port)
+			if !reflect.DeepEqual(status, scenario.expectedStatus) {
+				t.Errorf("mismatch status. Expecting: “%#v”; found “%#v”", scenario.expectedStatus, status)
+			}
+
+			if err != scenario.expectedError {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestMinecraftDiscovery(t *testing.T) {
+	t.Parallel()
+
+	fullPort, stopFull := startServer(t, statusPacket(`{"version":{"name":"1.20.4","protocol":765},`+
+		`"players":{"max":10,"online":10},"description":"full"}`))
+	defer stopFull()
+
+	emptyPort, stopEmpty := startServer(t, statusPacket(`{"version":{"name":"1.20.4","protocol":765},`+
+		`"players":{"max":10,"online":0},"description":"empty"}`))
+	defer stopEmpty()
+
+	retriever := dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "127.0.0.1", Port: fullPort, Priority: 10, Weight: 10},
+			{Target: "127.0.0.1", Port: emptyPort, Priority: 20, Weight: 10},
+		}, nil
+	})
+
+	discovery := gameserver.NewMinecraftDiscovery("example.com", time.Second)
+	discovery.SetRetriever(gameserver.NewMinecraftRetriever(retriever, time.Second))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	expectedHealth := []dnsdisco.HealthStatus{dnsdisco.HealthStatusDegraded, dnsdisco.HealthStatusHealthy}
+	expectedMetadata := []map[string]string{
+		{gameserver.PlayersOnlineMetadata: "10", gameserver.PlayersMaxMetadata: "10", gameserver.VersionMetadata: "1.20.4"},
+		{gameserver.PlayersOnlineMetadata: "0", gameserver.PlayersMaxMetadata: "10", gameserver.VersionMetadata: "1.20.4"},
+	}
+
+	for i, server := range discovery.(dnsdisco.Inspector).Servers() {
+		if server.HealthStatus != expectedHealth[i] {
+			t.Errorf("mismatch health of server %d. Expecting: “%s”; found “%s”", i, expectedHealth[i], server.HealthStatus)
+		}
+
+		if !reflect.DeepEqual(server.Metadata, expectedMetadata[i]) {
+			t.Errorf("mismatch metadata of server %d. Expecting: “%v”; found “%v”", i, expectedMetadata[i], server.Metadata)
+		}
+	}
+
+	if _, port := discovery.Choose(); port != emptyPort {
+		t.Errorf("mismatch ports. Expecting: “%d”; found “%d”", emptyPort, port)
+	}
+}
+
+// statusPacket builds the status response packet with the JSON document.
+func statusPacket(document string) []byte {
+	var packet bytes.Buffer
+	packet.WriteByte(0x00)
+	writeVarInt(&packet, len(document))
+	packet.WriteString(document)
+
+	var response bytes.Buffer
+	writeVarInt(&response, packet.Len())
+	response.Write(packet.Bytes())
+	return response.Bytes()
+}
+
+// writeVarInt writes a positive number using the variable length encoding.
+func writeVarInt(buffer *bytes.Buffer, value int) {
+	for value >= 0x80 {
+		buffer.WriteByte(byte(value&0x7f | 0x80))
+		value >>= 7
+	}
+	buffer.WriteByte(byte(value))
+}
+
+// readPacket reads a packet sent by the client.
+func readPacket(reader *bufio.Reader) ([]byte, error) {
+	var length, shift uint
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length |= uint(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+
+	packet := make([]byte, length)
+	_, err := io.ReadFull(reader, packet)
+	return packet, err
+}
+
+// startServer runs a local server that answers the handshake and the status
+// request with the response, returning the port and a function to stop it.
+func startServer(t *testing.T, response []byte) (uint16, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				handshake, err := readPacket(reader)
+				if err != nil || len(handshake) == 0 || handshake[len(handshake)-1] != 0x01 {
+					return
+				}
+
+				if request, err := readPacket(reader); err != nil || !bytes.Equal(request, []byte{0x00}) {
+					return
+				}
+
+				conn.Write(response)
+			}()
+		}
+	}()
+
+	return uint16(listener.Addr().(*net.TCPAddr).Port), func() { listener.Close() }
+}
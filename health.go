@@ -0,0 +1,337 @@
+package dnsdisco
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// HealthStatus is the state of a server reported by a ServerHealthChecker.
+type HealthStatus int
+
+// List of possible health states of a server.
+const (
+	// HealthStatusUnhealthy means that the server can't receive requests.
+	HealthStatusUnhealthy HealthStatus = iota
+
+	// HealthStatusHealthy means that the server is working properly.
+	HealthStatusHealthy
+
+	// HealthStatusDegraded means that the server is working, but with
+	// problems (e.g. slow responses). It is only chosen when there's no
+	// healthy server.
+	HealthStatusDegraded
+
+	// HealthStatusDraining means that the server is finishing the current
+	// requests before going down, so it shouldn't be chosen for new ones.
+	HealthStatusDraining
+)
+
+// HealthUsage defines when the servers with a health status can be chosen.
+type HealthUsage int
+
+// List of possible usages of the servers.
+const (
+	// HealthUsageNever means that the servers are never chosen.
+	HealthUsageNever HealthUsage = iota
+
+	// HealthUsageAlways means that the servers can always be chosen.
+	HealthUsageAlways
+
+	// HealthUsageFallback means that the servers are only chosen when there's
+	// no server that can always be chosen.
+	HealthUsageFallback
+)
+
+// customHealthStatus is a health status registered by the library user.
+type customHealthStatus struct {
+	name  string
+	usage HealthUsage
+}
+
+var (
+	// customHealthStatuses stores the registered health states, indexed by
+	// their distance from HealthStatusDraining.
+	customHealthStatuses []customHealthStatus
+
+	// customHealthStatusesLock make it safe to register health states while
+	// the library is executing the operations.
+	customHealthStatusesLock sync.RWMutex
+)
+
+// RegisterHealthStatus creates a new health state, for health checkers that
+// need more details than the built-in states (e.g. "overloaded" or
+// "maintenance"). The usage defines when the servers with the new state can be
+// chosen. The name is used in the human readable representation and must be
+// unique. It is go routine safe, but the states are usually registered in
+// the package initialization.
+func RegisterHealthStatus(name string, usage HealthUsage) (HealthStatus, error) {
+	customHealthStatusesLock.Lock()
+	defer customHealthStatusesLock.Unlock()
+
+	for _, status := range builtinHealthStatuses {
+		if status.String() == name {
+			return HealthStatusUnhealthy, fmt.Errorf("dnsdisco: health status %q already registered", name)
+		}
+	}
+
+	for _, status := range customHealthStatuses {
+		if status.name == name {
+			return HealthStatusUnhealthy, fmt.Errorf("dnsdisco: health status %q already registered", name)
+		}
+	}
+
+	customHealthStatuses = append(customHealthStatuses, customHealthStatus{name: name, usage: usage})
+	return HealthStatusDraining + HealthStatus(len(customHealthStatuses)), nil
+}
+
+// builtinHealthStatuses are the health states defined by the library.
+var builtinHealthStatuses = []HealthStatus{
+	HealthStatusUnhealthy,
+	HealthStatusHealthy,
+	HealthStatusDegraded,
+	HealthStatusDraining,
+}
+
+// healthStatuses returns the built-in and the registered health states.
+func healthStatuses() []HealthStatus {
+	customHealthStatusesLock.RLock()
+	defer customHealthStatusesLock.RUnlock()
+
+	statuses := append([]HealthStatus(nil), builtinHealthStatuses...)
+	for i := range customHealthStatuses {
+		statuses = append(statuses, HealthStatusDraining+HealthStatus(i+1))
+	}
+	return statuses
+}
+
+// custom returns the registered health state, if any.
+func (h HealthStatus) custom() (customHealthStatus, bool) {
+	customHealthStatusesLock.RLock()
+	defer customHealthStatusesLock.RUnlock()
+
+	i := int(h - HealthStatusDraining - 1)
+	if i < 0 || i >= len(customHealthStatuses) {
+		return customHealthStatus{}, false
+	}
+	return customHealthStatuses[i], true
+}
+
+// String returns the human readable name of the health status.
+func (h HealthStatus) String() string {
+	switch h {
+	case HealthStatusUnhealthy:
+		return "unhealthy"
+	case HealthStatusHealthy:
+		return "healthy"
+	case HealthStatusDegraded:
+		return "degraded"
+	case HealthStatusDraining:
+		return "draining"
+	}
+
+	if custom, ok := h.custom(); ok {
+		return custom.name
+	}
+	return "unknown"
+}
+
+// Usage returns when a server with this health status can be chosen. Unknown
+// states are never chosen.
+func (h HealthStatus) Usage() HealthUsage {
+	switch h {
+	case HealthStatusHealthy:
+		return HealthUsageAlways
+	case HealthStatusDegraded:
+		return HealthUsageFallback
+	case HealthStatusUnhealthy, HealthStatusDraining:
+		return HealthUsageNever
+	}
+
+	if custom, ok := h.custom(); ok {
+		return custom.usage
+	}
+	return HealthUsageNever
+}
+
+// Usable returns true when a server with this health status can be chosen,
+// even if only as a fallback.
+func (h HealthStatus) Usable() bool {
+	return h.Usage() != HealthUsageNever
+}
+
+// chooseable returns the usable servers accepted by the filter, where the ones
+// with the fallback usage are only returned when there's no other. A nil
+// filter accepts all servers.
+func chooseable(servers []Server, filter func(Server) bool) []*net.SRV {
+	var preferred, fallback []*net.SRV
+	for _, server := range servers {
+		if !server.Healthy || (filter != nil && !filter(server)) {
+			continue
+		}
+
+		srv := server.SRV
+		if server.HealthStatus.Usage() == HealthUsageFallback {
+			fallback = append(fallback, &srv)
+		} else {
+			preferred = append(preferred, &srv)
+		}
+	}
+
+	if len(preferred) == 0 {
+		return fallback
+	}
+	return preferred
+}
+
+// ServerHealthChecker allows the library user to define a custom health check
+// algorithm with access to all the server information (priority, weight,
+// usage) and with cancellation support. It also allows a richer health status
+// than the HealthChecker interface.
+type ServerHealthChecker interface {
+	// HealthCheck will analyze the server to check if it is still capable of
+	// receiving requests. When an error is returned the server is considered
+	// unhealthy. The context stores the information about the previous checks
+	// of the server (see HealthCheckInfoFromContext).
+	HealthCheck(ctx context.Context, server Server) (HealthStatus, error)
+}
+
+// ServerHealthCheckerFunc is an easy-to-use implementation of the interface
+// that is responsible for checking if a server is still alive.
+type ServerHealthCheckerFunc func(ctx context.Context, server Server) (HealthStatus, error)
+
+// HealthCheck will analyze the server to check if it is still capable of
+// receiving requests.
+func (h ServerHealthCheckerFunc) HealthCheck(ctx context.Context, server Server) (HealthStatus, error) {
+	return h(ctx, server)
+}
+
+// AdaptHealthChecker converts a HealthChecker to the ServerHealthChecker
+// interface, using the given proto in the checks. A successful check is
+// reported as healthy and a failed one as unhealthy. Servers mapped to a Unix
+// domain socket are checked with the socket path as target, a zero port and
+// the "unix" proto.
+func AdaptHealthChecker(healthChecker HealthChecker, proto string) ServerHealthChecker {
+	return ServerHealthCheckerFunc(func(ctx context.Context, server Server) (HealthStatus, error) {
+		var ok bool
+		var err error
+
+		if server.UnixSocket != "" {
+			ok, err = healthChecker.HealthCheck(server.UnixSocket, 0, "unix")
+		} else {
+			ok, err = healthChecker.HealthCheck(server.Target, server.Port, proto)
+		}
+
+		if err != nil || !ok {
+			return HealthStatusUnhealthy, err
+		}
+		return HealthStatusHealthy, nil
+	})
+}
+
+// HealthResult is the result of a health check executed by CheckAll.
+type HealthResult struct {
+	// Server is the checked server, with the information of the last refresh.
+	Server Server
+
+	// Status is the health status reported by the health checker. If the check
+	// failed it is unhealthy.
+	Status HealthStatus
+
+	// Err is the error returned by the health checker, if any.
+	Err error
+
+	// Duration is the time spent checking the server.
+	Duration time.Duration
+}
+
+// CheckAll runs the configured health checker for every server retrieved in
+// the last refresh, concurrently, and returns the results in the same order of
+// Servers. The results don't affect the servers selection, so it can be used by
+// orchestration tools and readiness probes without interfering with the
+// discovery.
+func (d *discovery) CheckAll(ctx context.Context) []HealthResult {
+	servers := d.Servers()
+
+	d.healthCheckerLock.RLock()
+	healthChecker := d.healthChecker
+	d.healthCheckerLock.RUnlock()
+
+	results := make([]HealthResult, len(servers))
+
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server Server) {
+			defer wg.Done()
+
+			begin := time.Now()
+			status, err := d.checkHealth(ctx, healthChecker, server)
+			if err != nil {
+				status = HealthStatusUnhealthy
+			}
+
+			results[i] = HealthResult{
+				Server:   server,
+				Status:   status,
+				Err:      err,
+				Duration: time.Since(begin),
+			}
+		}(i, server)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// MarkUnhealthy flags the server as unhealthy until the next refresh, when it
+// is checked again. It should be used when a connection to the target fails
+// between the refreshes, so the next choices move to another server. The
+// servers that weren't retrieved in the last refresh are ignored. It is go
+// routine safe.
+func (d *discovery) MarkUnhealthy(target string, port uint16) {
+	d.statsStoreLock.RLock()
+	statsStore := d.statsStore
+	d.statsStoreLock.RUnlock()
+
+	d.serversLock.Lock()
+	defer d.serversLock.Unlock()
+
+	found := false
+	for i, server := range d.servers {
+		if server.Target != target || server.Port != port || server.HealthStatus == HealthStatusUnhealthy {
+			continue
+		}
+
+		d.servers[i].HealthStatus = HealthStatusUnhealthy
+		d.servers[i].Healthy = false
+		d.servers[i].HealthChecked = time.Now()
+		found = true
+
+		record := HealthRecord{Status: HealthStatusUnhealthy, Checked: d.servers[i].HealthChecked}
+		key := d.statsKey(target, port)
+		if err := statsStore.AddHealth(key, record); err != nil {
+			d.errorsLock.Lock()
+			d.errors = append(d.errors, err)
+			d.errorsLock.Unlock()
+		}
+
+		if history, err := statsStore.Health(key); err == nil {
+			d.servers[i].HealthHistory = history
+		}
+
+		d.emit(Event{
+			Type:                 EventHealthChanged,
+			Server:               d.servers[i],
+			PreviousHealthStatus: server.HealthStatus,
+		})
+	}
+
+	if !found {
+		return
+	}
+
+	d.changeServers()
+}
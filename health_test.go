@@ -0,0 +1,281 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestServerHealthChecker(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{
+				Target:   "server1.example.com.",
+				Port:     1111,
+				Priority: 10,
+				Weight:   10,
+			},
+			{
+				Target:   "server2.example.com.",
+				Port:     2222,
+				Priority: 20,
+				Weight:   10,
+			},
+			{
+				Target:   "server3.example.com.",
+				Port:     3333,
+				Priority: 30,
+				Weight:   10,
+			},
+			{
+				Target:   "server4.example.com.",
+				Port:     4444,
+				Priority: 40,
+				Weight:   10,
+			},
+		}, nil
+	}))
+
+	discovery.(dnsdisco.HealthManager).SetServerHealthChecker(dnsdisco.ServerHealthCheckerFunc(func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+		switch server.Priority {
+		case 10:
+			return dnsdisco.HealthStatusDraining, nil
+		case 20:
+			return dnsdisco.HealthStatusDegraded, nil
+		case 30:
+			return dnsdisco.HealthStatusHealthy, errors.New("timeout")
+		}
+		return dnsdisco.HealthStatusHealthy, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	var statuses []dnsdisco.HealthStatus
+	var healthy []bool
+
+	for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+		statuses = append(statuses, server.HealthStatus)
+		healthy = append(healthy, server.Healthy)
+	}
+
+	expectedStatuses := []dnsdisco.HealthStatus{
+		dnsdisco.HealthStatusDraining,
+		dnsdisco.HealthStatusDegraded,
+		dnsdisco.HealthStatusUnhealthy,
+		dnsdisco.HealthStatusHealthy,
+	}
+
+	if !reflect.DeepEqual(statuses, expectedStatuses) {
+		t.Errorf("mismatch health states. Expecting: “%v”; found “%v”", expectedStatuses, statuses)
+	}
+
+	expectedHealthy := []bool{false, true, false, true}
+	if !reflect.DeepEqual(healthy, expectedHealthy) {
+		t.Errorf("mismatch usable servers. Expecting: “%v”; found “%v”", expectedHealthy, healthy)
+	}
+
+	// the draining server has the lowest priority value, but it shouldn't be
+	// chosen, and the degraded one is only chosen without healthy servers
+	if target, _ := discovery.Choose(); target != "server4.example.com." {
+		t.Errorf("mismatch targets. Expecting: “server4.example.com.”; found “%s”", target)
+	}
+
+	expectedErrors := []error{errors.New("timeout")}
+	if errs := discovery.Errors(); !reflect.DeepEqual(errs, expectedErrors) {
+		t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", expectedErrors, errs)
+	}
+}
+
+// overloaded is a health status registered by the library user, that is only
+// chosen without healthy servers.
+var overloaded, overloadedErr = dnsdisco.RegisterHealthStatus("overloaded", dnsdisco.HealthUsageFallback)
+
+func TestDegradedFallback(t *testing.T) {
+	t.Parallel()
+
+	if overloadedErr != nil {
+		t.Fatalf("unexpected error while registering the health status. Details: %s", overloadedErr)
+	}
+
+	scenarios := []struct {
+		description    string
+		statuses       map[string]dnsdisco.HealthStatus
+		expectedTarget string
+	}{
+		{
+			description: "it should prefer the healthy server",
+			statuses: map[string]dnsdisco.HealthStatus{
+				"server1.example.com.": dnsdisco.HealthStatusDegraded,
+				"server2.example.com.": dnsdisco.HealthStatusHealthy,
+			},
+			expectedTarget: "server2.example.com.",
+		},
+		{
+			description: "it should choose the degraded server without healthy ones",
+			statuses: map[string]dnsdisco.HealthStatus{
+				"server1.example.com.": dnsdisco.HealthStatusDegraded,
+				"server2.example.com.": dnsdisco.HealthStatusUnhealthy,
+			},
+			expectedTarget: "server1.example.com.",
+		},
+		{
+			description: "it should use the registered health status",
+			statuses: map[string]dnsdisco.HealthStatus{
+				"server1.example.com.": overloaded,
+				"server2.example.com.": dnsdisco.HealthStatusDraining,
+			},
+			expectedTarget: "server1.example.com.",
+		},
+		{
+			description: "it should not choose the unusable servers",
+			statuses: map[string]dnsdisco.HealthStatus{
+				"server1.example.com.": dnsdisco.HealthStatusUnhealthy,
+				"server2.example.com.": dnsdisco.HealthStatusDraining,
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+					{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+				}, nil
+			}))
+			discovery.(dnsdisco.HealthManager).SetServerHealthChecker(dnsdisco.ServerHealthCheckerFunc(func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+				return scenario.statuses[server.Target], nil
+			}))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			if target, _ := discovery.Choose(); target != scenario.expectedTarget {
+				t.Errorf("mismatch targets. Expecting: “%s”; found “%s”", scenario.expectedTarget, target)
+			}
+		})
+	}
+}
+
+func TestRegisterHealthStatus(t *testing.T) {
+	t.Parallel()
+
+	if overloadedErr != nil {
+		t.Fatalf("unexpected error while registering the health status. Details: %s", overloadedErr)
+	}
+
+	if overloaded.String() != "overloaded" {
+		t.Errorf("mismatch names. Expecting: “overloaded”; found “%s”", overloaded)
+	}
+
+	if overloaded.Usage() != dnsdisco.HealthUsageFallback || !overloaded.Usable() {
+		t.Errorf("unexpected usage “%d” of the registered health status", overloaded.Usage())
+	}
+
+	if _, err := dnsdisco.RegisterHealthStatus("degraded", dnsdisco.HealthUsageAlways); err == nil {
+		t.Error("expected an error registering a built-in health status")
+	}
+
+	if _, err := dnsdisco.RegisterHealthStatus("overloaded", dnsdisco.HealthUsageAlways); err == nil {
+		t.Error("expected an error registering a duplicated health status")
+	}
+
+	var unknown dnsdisco.HealthStatus = 1000
+	if unknown.String() != "unknown" || unknown.Usable() {
+		t.Errorf("unexpected unknown health status “%s”", unknown)
+	}
+}
+
+func TestAdaptHealthChecker(t *testing.T) {
+	t.Parallel()
+
+	var checkedProto string
+	healthChecker := dnsdisco.AdaptHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		checkedProto = proto
+		return target == "server1.example.com.", nil
+	}), "udp")
+
+	server := dnsdisco.Server{SRV: net.SRV{Target: "server1.example.com.", Port: 1111}}
+	if status, err := healthChecker.HealthCheck(context.Background(), server); status != dnsdisco.HealthStatusHealthy || err != nil {
+		t.Errorf("unexpected health check result “%s” (%v)", status, err)
+	}
+
+	if checkedProto != "udp" {
+		t.Errorf("mismatch protos. Expecting: “udp”; found “%s”", checkedProto)
+	}
+
+	server.Target = "server2.example.com."
+	if status, err := healthChecker.HealthCheck(context.Background(), server); status != dnsdisco.HealthStatusUnhealthy || err != nil {
+		t.Errorf("unexpected health check result “%s” (%v)", status, err)
+	}
+}
+
+func TestCheckAll(t *testing.T) {
+	t.Parallel()
+
+	healthy := true
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{
+				Target:   "server1.example.com.",
+				Port:     1111,
+				Priority: 10,
+				Weight:   10,
+			},
+			{
+				Target:   "server2.example.com.",
+				Port:     2222,
+				Priority: 20,
+				Weight:   10,
+			},
+		}, nil
+	}))
+	discovery.(dnsdisco.HealthManager).SetServerHealthChecker(dnsdisco.ServerHealthCheckerFunc(func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+		if server.Target == "server1.example.com." && !healthy {
+			return dnsdisco.HealthStatusUnhealthy, errors.New("connection refused")
+		}
+		return dnsdisco.HealthStatusHealthy, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	healthy = false
+	results := discovery.(dnsdisco.HealthManager).CheckAll(context.Background())
+
+	if len(results) != 2 {
+		t.Fatalf("mismatch number of results. Expecting: “2”; found “%d”", len(results))
+	}
+
+	if result := results[0]; result.Server.Target != "server1.example.com." ||
+		result.Status != dnsdisco.HealthStatusUnhealthy || result.Err == nil {
+		t.Errorf("unexpected result for the first server: %#v", result)
+	}
+
+	if result := results[1]; result.Server.Target != "server2.example.com." ||
+		result.Status != dnsdisco.HealthStatusHealthy || result.Err != nil {
+		t.Errorf("unexpected result for the second server: %#v", result)
+	}
+
+	// the selection must not be affected by the checks
+	if target, _ := discovery.Choose(); target != "server1.example.com." {
+		t.Errorf("mismatch targets. Expecting: “server1.example.com.”; found “%s”", target)
+	}
+}
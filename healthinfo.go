@@ -0,0 +1,117 @@
+package dnsdisco
+
+import (
+	"context"
+	"time"
+)
+
+// HealthCheckInfo describes the previous checks of a server, so the health
+// checkers can escalate (e.g. a deeper probe after repeated failures) without
+// keeping their own state. It is available in the context of the checks (see
+// HealthCheckInfoFromContext).
+type HealthCheckInfo struct {
+	// Attempt is the number of the check since the last successful one,
+	// starting at 1. The retries of the error policy (see SetErrorPolicy)
+	// are also counted.
+	Attempt int
+
+	// LastStatus is the status of the server in the last check.
+	LastStatus HealthStatus
+
+	// LastChecked is the moment of the last check. It is zero when the server
+	// was never checked.
+	LastChecked time.Time
+
+	// LastSuccess is the moment of the last successful check. It is zero when
+	// the check never succeeded.
+	LastSuccess time.Time
+
+	// SinceLastSuccess is the time since the last successful check. It is zero
+	// when the check never succeeded.
+	SinceLastSuccess time.Duration
+}
+
+// healthCheckInfoKey is the context key of the HealthCheckInfo.
+type healthCheckInfoKey struct{}
+
+// HealthCheckInfoFromContext returns the information about the previous checks
+// of the server, stored in the context received by the ServerHealthChecker.
+func HealthCheckInfoFromContext(ctx context.Context) (HealthCheckInfo, bool) {
+	info, ok := ctx.Value(healthCheckInfoKey{}).(HealthCheckInfo)
+	return info, ok
+}
+
+// healthCheckState stores the result of the previous checks of a server.
+type healthCheckState struct {
+	failures    int
+	status      HealthStatus
+	checked     time.Time
+	lastSuccess time.Time
+}
+
+// healthCheckContext returns the context with the information about the
+// previous checks of the server.
+func (d *discovery) healthCheckContext(ctx context.Context, server Server, retry bool) context.Context {
+	d.healthChecksLock.Lock()
+	defer d.healthChecksLock.Unlock()
+
+	info := HealthCheckInfo{Attempt: 1}
+	if state, ok := d.healthChecks[server.address()]; ok {
+		info.Attempt += state.failures
+		info.LastStatus = state.status
+		info.LastChecked = state.checked
+		info.LastSuccess = state.lastSuccess
+	}
+
+	if retry {
+		info.Attempt++
+	}
+
+	if !info.LastSuccess.IsZero() {
+		info.SinceLastSuccess = time.Since(info.LastSuccess)
+	}
+
+	return context.WithValue(ctx, healthCheckInfoKey{}, info)
+}
+
+// recordHealthCheck stores the result of the check of the server.
+func (d *discovery) recordHealthCheck(server Server, status HealthStatus, err error) {
+	d.healthChecksLock.Lock()
+	defer d.healthChecksLock.Unlock()
+
+	if d.healthChecks == nil {
+		d.healthChecks = make(map[string]*healthCheckState)
+	}
+
+	state, ok := d.healthChecks[server.address()]
+	if !ok {
+		state = new(healthCheckState)
+		d.healthChecks[server.address()] = state
+	}
+
+	state.status, state.checked = status, time.Now()
+	if err == nil && status.Usable() {
+		state.failures = 0
+		state.lastSuccess = state.checked
+	} else {
+		state.failures++
+	}
+}
+
+// pruneHealthChecks removes the information about the previous checks of the
+// servers that aren't retrieved anymore.
+func (d *discovery) pruneHealthChecks(servers []Server) {
+	current := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		current[server.address()] = true
+	}
+
+	d.healthChecksLock.Lock()
+	defer d.healthChecksLock.Unlock()
+
+	for address := range d.healthChecks {
+		if !current[address] {
+			delete(d.healthChecks, address)
+		}
+	}
+}
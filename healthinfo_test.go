@@ -0,0 +1,75 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestHealthCheckInfoFromContext(t *testing.T) {
+	t.Parallel()
+
+	if _, ok := dnsdisco.HealthCheckInfoFromContext(context.Background()); ok {
+		t.Error("unexpected information in an empty context")
+	}
+
+	results := []error{errors.New("timeout"), errors.New("timeout"), nil, errors.New("timeout")}
+	var infos []dnsdisco.HealthCheckInfo
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		}, nil
+	}))
+	discovery.(dnsdisco.HealthManager).SetServerHealthChecker(dnsdisco.ServerHealthCheckerFunc(func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+		info, ok := dnsdisco.HealthCheckInfoFromContext(ctx)
+		if !ok {
+			t.Fatal("missing health check information")
+		}
+		infos = append(infos, info)
+
+		err := results[len(infos)-1]
+		if err != nil {
+			return dnsdisco.HealthStatusUnhealthy, err
+		}
+		return dnsdisco.HealthStatusHealthy, nil
+	}))
+
+	for range results {
+		discovery.Refresh()
+	}
+
+	expectedAttempts := []int{1, 2, 3, 1}
+	expectedStatus := []dnsdisco.HealthStatus{
+		dnsdisco.HealthStatusUnhealthy,
+		dnsdisco.HealthStatusUnhealthy,
+		dnsdisco.HealthStatusUnhealthy,
+		dnsdisco.HealthStatusHealthy,
+	}
+
+	for i, info := range infos {
+		if info.Attempt != expectedAttempts[i] {
+			t.Errorf("mismatch attempt of check %d. Expecting: “%d”; found “%d”", i, expectedAttempts[i], info.Attempt)
+		}
+
+		if i > 0 && info.LastStatus != expectedStatus[i] {
+			t.Errorf("mismatch last status of check %d. Expecting: “%s”; found “%s”", i, expectedStatus[i], info.LastStatus)
+		}
+
+		if (i == 0) != info.LastChecked.IsZero() {
+			t.Errorf("unexpected last checked of check %d: %s", i, info.LastChecked)
+		}
+
+		if (i < 3) != info.LastSuccess.IsZero() {
+			t.Errorf("unexpected last success of check %d: %s", i, info.LastSuccess)
+		}
+
+		if info.LastSuccess.IsZero() != (info.SinceLastSuccess == 0) {
+			t.Errorf("unexpected time since last success of check %d: %s", i, info.SinceLastSuccess)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package dnsdisco
+
+import (
+	"context"
+	"time"
+)
+
+// hedgeResult stores the outcome of a call made by the Hedge method.
+type hedgeResult struct {
+	target string
+	port   uint16
+	err    error
+}
+
+// Hedge calls fn with the best target, and if it doesn't succeed after the
+// delay, also calls fn with the second best healthy target. If the first call
+// fails before the delay the second one is issued immediately. The first
+// success is returned and the context of the other call is cancelled, so fn
+// must respect the context to avoid leaking resources. When both calls fail
+// the last error is returned, and if there's no server available ErrNoServer
+// is returned.
+//
+// This is useful to reduce the tail latency of the requests, as a slow server
+// doesn't hold the client for longer than the delay.
+func (d *discovery) Hedge(ctx context.Context, delay time.Duration, fn func(ctx context.Context, target string, port uint16) error) (target string, port uint16, err error) {
+	bestTarget, bestPort := d.Choose()
+	if bestTarget == "" && bestPort == 0 {
+		return "", 0, ErrNoServer
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the channel is buffered so the loser doesn't block after we return
+	results := make(chan hedgeResult, 2)
+	call := func(target string, port uint16) {
+		go func() {
+			results <- hedgeResult{target: target, port: port, err: fn(ctx, target, port)}
+		}()
+	}
+
+	call(bestTarget, bestPort)
+	pending, hedged := 1, false
+
+	hedge := func() {
+		hedged = true
+		if target, port, ok := d.secondBest(bestTarget, bestPort); ok {
+			call(target, port)
+			pending++
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedge()
+			}
+
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				return result.target, result.port, nil
+			}
+
+			err = result.err
+			if !hedged {
+				hedge()
+			}
+
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		}
+
+		if hedged && pending == 0 {
+			return "", 0, err
+		}
+	}
+}
+
+// secondBest returns the next usable server in the RFC 2782 order different
+// from the given one. It doesn't record a choice, so the usage counters, the
+// selection limits and the load balancer state are only affected by the best
+// target.
+func (d *discovery) secondBest(bestTarget string, bestPort uint16) (target string, port uint16, ok bool) {
+	servers := chooseable(d.Servers(), admissibleFilter(func(server Server) bool {
+		return server.Target != bestTarget || server.Port != bestPort
+	}, d.admissible))
+
+	if len(servers) == 0 {
+		return "", 0, false
+	}
+	return servers[0].Target, servers[0].Port, true
+}
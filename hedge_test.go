@@ -0,0 +1,132 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestHedge(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description    string
+		healthChecker  dnsdisco.HealthCheckerFunc
+		fn             func(ctx context.Context, target string, port uint16) error
+		expectedTarget string
+		expectedPort   uint16
+		expectedError  error
+	}{
+		{
+			description: "it should use the best target when it answers fast",
+			fn: func(ctx context.Context, target string, port uint16) error {
+				return nil
+			},
+			expectedTarget: "server1.example.com.",
+			expectedPort:   1111,
+		},
+		{
+			description: "it should use the second best target when the best is slow",
+			fn: func(ctx context.Context, target string, port uint16) error {
+				if target == "server1.example.com." {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-time.After(time.Second):
+					}
+				}
+				return nil
+			},
+			expectedTarget: "server2.example.com.",
+			expectedPort:   2222,
+		},
+		{
+			description: "it should use the second best target when the best fails",
+			fn: func(ctx context.Context, target string, port uint16) error {
+				if target == "server1.example.com." {
+					return errors.New("connection refused")
+				}
+				return nil
+			},
+			expectedTarget: "server2.example.com.",
+			expectedPort:   2222,
+		},
+		{
+			description: "it should fail when both targets fail",
+			fn: func(ctx context.Context, target string, port uint16) error {
+				return errors.New("connection refused")
+			},
+			expectedError: errors.New("connection refused"),
+		},
+		{
+			description: "it should fail when there's no server available",
+			healthChecker: dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return false, nil
+			}),
+			fn: func(ctx context.Context, target string, port uint16) error {
+				return nil
+			},
+			expectedError: dnsdisco.ErrNoServer,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{
+						Target:   "server1.example.com.",
+						Port:     1111,
+						Priority: 10,
+						Weight:   10,
+					},
+					{
+						Target:   "server2.example.com.",
+						Port:     2222,
+						Priority: 20,
+						Weight:   10,
+					},
+				}, nil
+			}))
+
+			if scenario.healthChecker != nil {
+				discovery.SetHealthChecker(scenario.healthChecker)
+			} else {
+				discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+					return true, nil
+				}))
+			}
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			target, port, err := discovery.(dnsdisco.Hedger).Hedge(context.Background(), 50*time.Millisecond, scenario.fn)
+
+			if target != scenario.expectedTarget {
+				t.Errorf("mismatch targets. Expecting: “%s”; found “%s”", scenario.expectedTarget, target)
+			}
+
+			if port != scenario.expectedPort {
+				t.Errorf("mismatch ports. Expecting: “%d”; found “%d”", scenario.expectedPort, port)
+			}
+
+			if !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+
+			// only the best target is recorded as chosen
+			for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+				if server.Target == "server2.example.com." && server.Used != 0 {
+					t.Errorf("mismatch usage of the second best target. Expecting: “0”; found “%d”", server.Used)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package dnsdisco
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// IPLiteral checks if the SRV target is an IP literal, published by some
+// private zones instead of a host name (e.g. "192.0.2.1.", "2001:db8::1." or
+// "[2001:db8::1]"). An IP literal must be used directly, without any A/AAAA
+// or CNAME lookup.
+func IPLiteral(target string) (net.IP, bool) {
+	host := strings.TrimSuffix(target, ".")
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+
+	// IPv6 zones (e.g. "fe80::1%eth0") aren't supported by net.ParseIP, and
+	// are only meaningful in the local host
+	ip := net.ParseIP(host)
+	return ip, ip != nil
+}
+
+// host returns the address used to connect to the target: the IP of an IP
+// literal, or the target itself.
+func host(target string) string {
+	if ip, ok := IPLiteral(target); ok {
+		return ip.String()
+	}
+	return target
+}
+
+// JoinHostPort builds the address used to connect to the SRV target and port
+// (e.g. "server1.example.com.:1111" or "[2001:db8::1]:1111"), with the IPv6
+// literals between brackets and without the trailing dot. It should be used
+// instead of formatting the address with fmt.Sprintf, that generates invalid
+// addresses for IPv6 targets.
+func JoinHostPort(target string, port uint16) string {
+	return net.JoinHostPort(host(target), strconv.FormatUint(uint64(port), 10))
+}
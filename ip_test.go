@@ -0,0 +1,147 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestIPLiteral(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		target     string
+		expectedIP net.IP
+	}{
+		{target: "192.0.2.1.", expectedIP: net.ParseIP("192.0.2.1")},
+		{target: "192.0.2.1", expectedIP: net.ParseIP("192.0.2.1")},
+		{target: "2001:db8::1.", expectedIP: net.ParseIP("2001:db8::1")},
+		{target: "[2001:db8::1]", expectedIP: net.ParseIP("2001:db8::1")},
+		{target: "server1.example.com."},
+		{target: "192.0.2.1.example.com."},
+		{target: ""},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.target, func(t *testing.T) {
+			ip, ok := dnsdisco.IPLiteral(scenario.target)
+			if ok != (scenario.expectedIP != nil) || !ip.Equal(scenario.expectedIP) {
+				t.Errorf("mismatch IPs. Expecting: “%s”; found “%s” (%t)", scenario.expectedIP, ip, ok)
+			}
+		})
+	}
+}
+
+func TestJoinHostPort(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		target          string
+		port            uint16
+		expectedAddress string
+	}{
+		{target: "server1.example.com.", port: 1111, expectedAddress: "server1.example.com.:1111"},
+		{target: "192.0.2.1.", port: 1111, expectedAddress: "192.0.2.1:1111"},
+		{target: "2001:db8::1", port: 1111, expectedAddress: "[2001:db8::1]:1111"},
+		{target: "2001:db8::1.", port: 1111, expectedAddress: "[2001:db8::1]:1111"},
+		{target: "[2001:db8::1]", port: 1111, expectedAddress: "[2001:db8::1]:1111"},
+		{target: "::ffff:192.0.2.1", port: 1111, expectedAddress: "192.0.2.1:1111"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.target, func(t *testing.T) {
+			address := dnsdisco.JoinHostPort(scenario.target, scenario.port)
+			if address != scenario.expectedAddress {
+				t.Errorf("mismatch addresses. Expecting: “%s”; found “%s”", scenario.expectedAddress, address)
+			}
+
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				t.Errorf("invalid address “%s”: %s", address, err)
+			}
+		})
+	}
+}
+
+func TestIPLiteralTargets(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description string
+		network     string
+		address     string
+		target      string
+	}{
+		{
+			description: "it should connect to an IPv4 literal",
+			network:     "tcp4",
+			address:     "127.0.0.1:0",
+			target:      "127.0.0.1.",
+		},
+		{
+			description: "it should connect to an IPv6 literal",
+			network:     "tcp6",
+			address:     "[::1]:0",
+			target:      "::1.",
+		},
+		{
+			description: "it should connect to an IPv6 literal between brackets",
+			network:     "tcp6",
+			address:     "[::1]:0",
+			target:      "[::1]",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			listener, err := net.Listen(scenario.network, scenario.address)
+			if err != nil {
+				t.Skipf("network not available: %s", err)
+			}
+			defer listener.Close()
+
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					conn.Close()
+				}
+			}()
+
+			port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: scenario.target, Port: port, Priority: 10, Weight: 10},
+				}, nil
+			}))
+
+			// IP literals must not be resolved
+			discovery.(dnsdisco.RecordConfigurer).SetCNAMEChasing(dnsdisco.CNAMEResolverFunc(func(name string) (string, error) {
+				return "", errors.New("unexpected lookup of " + name)
+			}), 5)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			if errs := discovery.Errors(); len(errs) > 0 {
+				t.Fatalf("unexpected errors “%v”", errs)
+			}
+
+			conn, err := discovery.(dnsdisco.Dialer).Dial(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+			conn.Close()
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package dnsdisco
+
+import "net"
+
+// Iter yields the healthy servers in the load balancer order, without
+// repeating them, for callers with custom retry loops. It isn't go routine
+// safe, each request should have its own iterator.
+type Iter struct {
+	discovery *discovery
+
+	// tried stores the addresses of the servers already returned.
+	tried map[string]bool
+
+	// last is the last server returned by Next.
+	last Server
+}
+
+// Iterator returns an iterator over the healthy servers of the last refresh.
+// Each server is selected by the configured load balancer, like Choose, among
+// the servers that weren't returned yet.
+func (d *discovery) Iterator() *Iter {
+	return &Iter{
+		discovery: d,
+		tried:     make(map[string]bool),
+	}
+}
+
+// Next returns the next server to try. When there's no other healthy server
+// false is returned.
+func (i *Iter) Next() (Server, bool) {
+	target, port := i.discovery.balancedCandidate(func(server Server) bool {
+		return !i.tried[server.address()]
+	})
+	i.discovery.recordChoice(target, port)
+
+	server, found := i.discovery.server(target, port)
+	if !found {
+		// custom load balancers may choose servers that aren't in the list
+		server = Server{SRV: net.SRV{Target: target, Port: port}}
+	}
+
+	if (target == "" && port == 0) || i.tried[server.address()] {
+		return Server{}, false
+	}
+
+	i.tried[server.address()] = true
+	i.last = server
+	return server, true
+}
+
+// Fail reports that the last server returned by Next failed, marking it as
+// unhealthy until the next refresh (see MarkUnhealthy), so other requests also
+// avoid it.
+func (i *Iter) Fail() {
+	if i.last.Target == "" && i.last.Port == 0 {
+		return
+	}
+	i.discovery.MarkUnhealthy(i.last.Target, i.last.Port)
+}
+
+// Reset restarts the iteration, so all healthy servers can be returned again.
+func (i *Iter) Reset() {
+	i.tried = make(map[string]bool)
+	i.last = Server{}
+}
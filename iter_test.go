@@ -0,0 +1,95 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestIterator(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+			{Target: "server3.example.com.", Port: 3333, Priority: 30, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return target != "server2.example.com.", nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	iterate := func(iterator *dnsdisco.Iter) []string {
+		var targets []string
+		for server, ok := iterator.Next(); ok; server, ok = iterator.Next() {
+			targets = append(targets, server.Target)
+		}
+		return targets
+	}
+
+	iterator := discovery.(dnsdisco.Selector).Iterator()
+
+	expected := []string{"server1.example.com.", "server3.example.com."}
+	if targets := iterate(iterator); !reflect.DeepEqual(targets, expected) {
+		t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", expected, targets)
+	}
+
+	// the default load balancer distributes the choices, so after the reset
+	// any healthy server can be the first one
+	iterator.Reset()
+	failed, ok := iterator.Next()
+	if !ok {
+		t.Fatal("no server after reset")
+	}
+
+	iterator.Fail()
+
+	expected = []string{"server1.example.com."}
+	if failed.Target == "server1.example.com." {
+		expected = []string{"server3.example.com."}
+	}
+
+	if targets := iterate(discovery.(dnsdisco.Selector).Iterator()); !reflect.DeepEqual(targets, expected) {
+		t.Errorf("mismatch targets after failure. Expecting: “%v”; found “%v”", expected, targets)
+	}
+}
+
+func TestIteratorLoadBalancerOrder(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+			{Target: "server3.example.com.", Port: 3333, Priority: 30, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}))
+	discovery.SetLoadBalancer(&lastLoadBalancer{})
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	var targets []string
+	iterator := discovery.(dnsdisco.Selector).Iterator()
+	for server, ok := iterator.Next(); ok; server, ok = iterator.Next() {
+		targets = append(targets, server.Target)
+	}
+
+	expected := []string{"server3.example.com.", "server2.example.com.", "server1.example.com."}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", expected, targets)
+	}
+}
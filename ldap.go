@@ -0,0 +1,112 @@
+package dnsdisco
+
+import (
+	"net"
+	"strings"
+)
+
+// LDAPScope identifies the DNS records where a domain controller was found by
+// DiscoverLDAP.
+type LDAPScope int
+
+// List of possible scopes of the domain controllers, from the most to the
+// least specific.
+const (
+	// LDAPScopeSite means that the domain controller serves the site of the
+	// client (_ldap._tcp.<site>._sites.dc._msdcs.<domain>).
+	LDAPScopeSite LDAPScope = iota
+
+	// LDAPScopeDomain means that the domain controller can be in any site of
+	// the domain (_ldap._tcp.dc._msdcs.<domain>).
+	LDAPScopeDomain
+
+	// LDAPScopeGeneric means that the server was published in the generic LDAP
+	// records (_ldap._tcp.<domain>), that may include servers that aren't
+	// domain controllers.
+	LDAPScopeGeneric
+)
+
+// LDAPServer is a LDAP server found by DiscoverLDAP.
+type LDAPServer struct {
+	net.SRV
+
+	// Scope identifies the DNS records where the server was found.
+	Scope LDAPScope
+}
+
+// DiscoverLDAP finds the domain controllers of an Active Directory domain,
+// following the DNS records registered by the domain controllers. The servers
+// are returned in the fallback order: first the ones of the site (when the
+// site name isn't empty), then the other ones of the domain and at last the
+// generic LDAP servers. Each group is sorted by priority and randomized by
+// weight inside the same priority, and a server is only returned in its most
+// specific group. There's no health check, as the client must try the servers
+// in the returned order. An error is returned only when all DNS requests fail.
+func DiscoverLDAP(domain, siteName string) ([]LDAPServer, error) {
+	return discoverLDAP(domain, siteName, configuredRetriever())
+}
+
+// ldapLookup describes the DNS records of a LDAP scope.
+type ldapLookup struct {
+	name  string
+	scope LDAPScope
+}
+
+// discoverLDAP finds the LDAP servers using the given retriever.
+func discoverLDAP(domain, siteName string, retriever Retriever) ([]LDAPServer, error) {
+	domain = strings.TrimSuffix(domain, ".")
+
+	var lookups []ldapLookup
+	if siteName != "" {
+		lookups = append(lookups, ldapLookup{name: siteName + "._sites.dc._msdcs." + domain, scope: LDAPScopeSite})
+	}
+	lookups = append(lookups,
+		ldapLookup{name: "dc._msdcs." + domain, scope: LDAPScopeDomain},
+		ldapLookup{name: domain, scope: LDAPScopeGeneric},
+	)
+
+	var servers []LDAPServer
+	var firstErr error
+	failures := 0
+	found := make(map[string]bool)
+
+	for _, lookup := range lookups {
+		srvs, err := retriever.Retrieve("ldap", "tcp", lookup.name)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failures++
+			continue
+		}
+
+		var selected []*net.SRV
+		for _, srv := range srvs {
+			// RFC 2782: a target of "." means that the service is decidedly not
+			// available at this domain
+			if srv.Target == "." {
+				continue
+			}
+
+			address := JoinHostPort(srv.Target, srv.Port)
+			if found[address] {
+				continue
+			}
+			found[address] = true
+
+			srv := *srv
+			selected = append(selected, &srv)
+		}
+
+		normalize(selected)
+		for _, srv := range selected {
+			servers = append(servers, LDAPServer{SRV: *srv, Scope: lookup.scope})
+		}
+	}
+
+	if failures == len(lookups) {
+		return nil, firstErr
+	}
+
+	return servers, nil
+}
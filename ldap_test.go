@@ -0,0 +1,106 @@
+package dnsdisco
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverLDAP(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		siteName        string
+		records         map[string][]*net.SRV
+		expectedNames   []string
+		expectedServers []LDAPServer
+		expectedError   error
+	}{
+		{
+			description: "it should find the servers in the fallback order",
+			siteName:    "Default-First-Site-Name",
+			records: map[string][]*net.SRV{
+				"Default-First-Site-Name._sites.dc._msdcs.example.com": {
+					{Target: "dc1.example.com.", Port: 389, Priority: 0, Weight: 100},
+				},
+				"dc._msdcs.example.com": {
+					{Target: "dc2.example.com.", Port: 389, Priority: 0, Weight: 100},
+					{Target: "dc1.example.com.", Port: 389, Priority: 0, Weight: 100},
+				},
+				"example.com": {
+					{Target: "ldap.example.com.", Port: 389, Priority: 0, Weight: 100},
+				},
+			},
+			expectedNames: []string{
+				"Default-First-Site-Name._sites.dc._msdcs.example.com",
+				"dc._msdcs.example.com",
+				"example.com",
+			},
+			expectedServers: []LDAPServer{
+				{SRV: net.SRV{Target: "dc1.example.com.", Port: 389, Priority: 0, Weight: 100}, Scope: LDAPScopeSite},
+				{SRV: net.SRV{Target: "dc2.example.com.", Port: 389, Priority: 0, Weight: 100}, Scope: LDAPScopeDomain},
+				{SRV: net.SRV{Target: "ldap.example.com.", Port: 389, Priority: 0, Weight: 100}, Scope: LDAPScopeGeneric},
+			},
+		},
+		{
+			description: "it should skip the site lookup when there's no site",
+			records: map[string][]*net.SRV{
+				"dc._msdcs.example.com": {
+					{Target: "dc2.example.com.", Port: 389, Priority: 10, Weight: 100},
+					{Target: "dc1.example.com.", Port: 389, Priority: 0, Weight: 100},
+				},
+				"example.com": {
+					{Target: ".", Port: 0},
+				},
+			},
+			expectedNames: []string{
+				"dc._msdcs.example.com",
+				"example.com",
+			},
+			expectedServers: []LDAPServer{
+				{SRV: net.SRV{Target: "dc1.example.com.", Port: 389, Priority: 0, Weight: 100}, Scope: LDAPScopeDomain},
+				{SRV: net.SRV{Target: "dc2.example.com.", Port: 389, Priority: 10, Weight: 100}, Scope: LDAPScopeDomain},
+			},
+		},
+		{
+			description: "it should fail when all requests fail",
+			siteName:    "Default-First-Site-Name",
+			expectedNames: []string{
+				"Default-First-Site-Name._sites.dc._msdcs.example.com",
+				"dc._msdcs.example.com",
+				"example.com",
+			},
+			expectedError: net.UnknownNetworkError("test"),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			var names []string
+			servers, err := discoverLDAP("example.com.", scenario.siteName, RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				names = append(names, name)
+				if service != "ldap" || proto != "tcp" {
+					t.Errorf("unexpected service “%s” and proto “%s”", service, proto)
+				}
+
+				if len(scenario.records) == 0 {
+					return nil, net.UnknownNetworkError("test")
+				}
+				return scenario.records[name], nil
+			}))
+
+			if !reflect.DeepEqual(names, scenario.expectedNames) {
+				t.Errorf("mismatch names. Expecting: “%v”; found “%v”", scenario.expectedNames, names)
+			}
+
+			if !reflect.DeepEqual(servers, scenario.expectedServers) {
+				t.Errorf("mismatch servers. Expecting: “%#v”; found “%#v”", scenario.expectedServers, servers)
+			}
+
+			if !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+		})
+	}
+}
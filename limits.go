@@ -0,0 +1,91 @@
+package dnsdisco
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+)
+
+// serverSize is the memory used by each server, without the target name.
+var serverSize = int(reflect.TypeOf(Server{}).Size())
+
+// Limits protects the discovery against pathological answers (e.g. from a
+// compromised or buggy authoritative server), limiting the servers accepted on
+// each refresh. A zero value means no limit.
+type Limits struct {
+	// MaxRecords is the maximum number of SRV records accepted.
+	MaxRecords int
+
+	// MaxTargetLength is the maximum length of the target name of a SRV
+	// record.
+	MaxTargetLength int
+
+	// MaxMemory is the maximum memory, in bytes, used to store the servers of a
+	// refresh. Each server uses the size of the Server type plus the length of
+	// the target name.
+	MaxMemory int
+
+	// Truncate drops the records that exceed the limits, keeping the ones with
+	// the best priority, instead of rejecting the whole answer. The dropped
+	// records are reported as LimitError in the Errors method.
+	Truncate bool
+}
+
+// LimitError is returned by Refresh when the answer exceeds one of the limits,
+// and the previous servers are kept. When the limits are configured to
+// truncate the answer it is reported as a warning in the Errors method.
+type LimitError struct {
+	// Limit is the name of the exceeded limit.
+	Limit string
+
+	// Value is the value found in the answer.
+	Value int
+
+	// Max is the configured limit.
+	Max int
+}
+
+// Error returns the description of the exceeded limit.
+func (l LimitError) Error() string {
+	return fmt.Sprintf("dnsdisco: %s limit exceeded (%d > %d)", l.Limit, l.Value, l.Max)
+}
+
+// apply checks the servers against the limits. The servers must be already
+// normalized, so when truncating the ones with the best priority are kept.
+// If the answer is rejected an error is returned, otherwise the accepted
+// servers are returned with the warnings of the dropped ones.
+func (l Limits) apply(srvs []*net.SRV) (accepted []*net.SRV, warnings []error, err error) {
+	memory := 0
+
+	for _, srv := range srvs {
+		if l.MaxTargetLength > 0 && len(srv.Target) > l.MaxTargetLength {
+			limitErr := LimitError{Limit: "target length", Value: len(srv.Target), Max: l.MaxTargetLength}
+			if !l.Truncate {
+				return nil, nil, limitErr
+			}
+			warnings = append(warnings, limitErr)
+			continue
+		}
+
+		if l.MaxRecords > 0 && len(accepted) == l.MaxRecords {
+			limitErr := LimitError{Limit: "records", Value: len(srvs), Max: l.MaxRecords}
+			if !l.Truncate {
+				return nil, nil, limitErr
+			}
+			return accepted, append(warnings, limitErr), nil
+		}
+
+		memory += serverSize + len(srv.Target)
+		if l.MaxMemory > 0 && memory > l.MaxMemory {
+			limitErr := LimitError{Limit: "memory", Value: memory, Max: l.MaxMemory}
+			if !l.Truncate {
+				return nil, nil, limitErr
+			}
+			return accepted, append(warnings, limitErr), nil
+		}
+
+		accepted = append(accepted, srv)
+	}
+
+	return accepted, warnings, nil
+}
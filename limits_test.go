@@ -0,0 +1,112 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetLimits(t *testing.T) {
+	t.Parallel()
+
+	servers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+		{Target: strings.Repeat("a", 300) + ".example.com.", Port: 3333, Priority: 5, Weight: 10},
+		{Target: "server4.example.com.", Port: 4444, Priority: 30, Weight: 10},
+	}
+
+	scenarios := []struct {
+		description     string
+		limits          dnsdisco.Limits
+		expectedTargets []string
+		expectedError   error
+		expectedErrors  []error
+	}{
+		{
+			description:     "it should accept all servers without limits",
+			expectedTargets: []string{servers[2].Target, "server1.example.com.", "server2.example.com.", "server4.example.com."},
+		},
+		{
+			description: "it should reject the answer",
+			limits: dnsdisco.Limits{
+				MaxRecords: 3,
+			},
+			expectedTargets: []string{"old.example.com."},
+			expectedError:   dnsdisco.LimitError{Limit: "records", Value: 4, Max: 3},
+		},
+		{
+			description: "it should truncate the answer",
+			limits: dnsdisco.Limits{
+				MaxRecords:      2,
+				MaxTargetLength: 255,
+				Truncate:        true,
+			},
+			expectedTargets: []string{"server1.example.com.", "server2.example.com."},
+			expectedErrors: []error{
+				dnsdisco.LimitError{Limit: "target length", Value: 313, Max: 255},
+				dnsdisco.LimitError{Limit: "records", Value: 4, Max: 2},
+			},
+		},
+		{
+			description: "it should reject an answer that uses too much memory",
+			limits: dnsdisco.Limits{
+				MaxMemory: 100,
+			},
+			expectedTargets: []string{"old.example.com."},
+			expectedError:   dnsdisco.LimitError{Limit: "memory", Value: 313 + serverSize(), Max: 100},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return true, nil
+			}))
+
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{{Target: "old.example.com.", Port: 1111}}, nil
+			}))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			discovery.(dnsdisco.RecordConfigurer).SetLimits(scenario.limits)
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				var srvs []*net.SRV
+				for _, srv := range servers {
+					copied := *srv
+					srvs = append(srvs, &copied)
+				}
+				return srvs, nil
+			}))
+
+			if err := discovery.Refresh(); !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch error. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+
+			var targets []string
+			for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+				targets = append(targets, server.Target)
+			}
+
+			if !reflect.DeepEqual(targets, scenario.expectedTargets) {
+				t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", scenario.expectedTargets, targets)
+			}
+
+			if errs := discovery.Errors(); !reflect.DeepEqual(errs, scenario.expectedErrors) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedErrors, errs)
+			}
+		})
+	}
+}
+
+// serverSize returns the memory used by each server, without the target name.
+func serverSize() int {
+	return int(reflect.TypeOf(dnsdisco.Server{}).Size())
+}
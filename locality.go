@@ -0,0 +1,122 @@
+package dnsdisco
+
+import (
+	"net"
+	"strings"
+)
+
+// List of priorities synthesized from the locality of the servers (see
+// SetLocality).
+const (
+	// LocalityPriorityDatacenter is the priority of the servers in the local
+	// datacenter.
+	LocalityPriorityDatacenter uint16 = 0
+
+	// LocalityPriorityRegion is the priority of the servers in other
+	// datacenters of the local region.
+	LocalityPriorityRegion uint16 = 1
+
+	// LocalityPriorityRemote is the priority of the other servers, including
+	// the ones without locality information.
+	LocalityPriorityRemote uint16 = 2
+)
+
+// Locality defines the location of the client, used to synthesize the
+// priorities of the servers for zones that publish flat SRV sets.
+type Locality struct {
+	// Datacenter is the local datacenter (e.g. "gru1").
+	Datacenter string
+
+	// Region is the local region (e.g. "sa-east").
+	Region string
+
+	// DatacenterKey is the metadata key (Server.Metadata) with the datacenter
+	// of the server. If empty "dc" is used.
+	DatacenterKey string
+
+	// RegionKey is the metadata key (Server.Metadata) with the region of the
+	// server. If empty "region" is used.
+	RegionKey string
+
+	// FromTarget extracts the datacenter and the region from the target name
+	// (e.g. "server1.gru1.sa-east.example.com."), for the servers without
+	// locality metadata. It can be nil.
+	FromTarget func(target string) (datacenter, region string)
+}
+
+// LocalityFromLabels returns a function for Locality.FromTarget that uses the
+// labels of the target name in the given positions (starting at 0) as the
+// datacenter and the region. A negative position ignores the information.
+func LocalityFromLabels(datacenterLabel, regionLabel int) func(target string) (datacenter, region string) {
+	return func(target string) (datacenter, region string) {
+		labels := strings.Split(strings.TrimSuffix(target, "."), ".")
+		if datacenterLabel >= 0 && datacenterLabel < len(labels) {
+			datacenter = labels[datacenterLabel]
+		}
+		if regionLabel >= 0 && regionLabel < len(labels) {
+			region = labels[regionLabel]
+		}
+		return
+	}
+}
+
+// SetLocality replaces the priorities published in the DNS with priorities
+// synthesized from the locality of the servers, relative to the local
+// datacenter and region, for locality-first routing: the servers of the local
+// datacenter (LocalityPriorityDatacenter) are used before the servers of the
+// local region (LocalityPriorityRegion), that are used before the others
+// (LocalityPriorityRemote). The locality of the servers is read from the
+// metadata (see MetadataRetriever), or from the target name. It is applied on
+// each refresh before the priority override (see SetPriorityOverride). An
+// empty locality disables it (default). It is go routine safe.
+func (d *discovery) SetLocality(locality Locality) {
+	if locality.DatacenterKey == "" {
+		locality.DatacenterKey = "dc"
+	}
+
+	if locality.RegionKey == "" {
+		locality.RegionKey = "region"
+	}
+
+	d.priorityOverrideLock.Lock()
+	defer d.priorityOverrideLock.Unlock()
+	d.locality = locality
+}
+
+// enabled checks if the local datacenter or region is defined.
+func (l Locality) enabled() bool {
+	return l.Datacenter != "" || l.Region != ""
+}
+
+// priority returns the synthesized priority of the server.
+func (l Locality) priority(srv *net.SRV, metadata map[string]string) uint16 {
+	datacenter, region := metadata[l.DatacenterKey], metadata[l.RegionKey]
+	if datacenter == "" && region == "" && l.FromTarget != nil {
+		datacenter, region = l.FromTarget(srv.Target)
+	}
+
+	switch {
+	case l.Datacenter != "" && strings.EqualFold(datacenter, l.Datacenter):
+		return LocalityPriorityDatacenter
+	case l.Region != "" && strings.EqualFold(region, l.Region):
+		return LocalityPriorityRegion
+	}
+	return LocalityPriorityRemote
+}
+
+// apply returns a copy of the servers with the synthesized priorities. The
+// records of the retriever aren't changed, as they may be cached, and the
+// metadata of the copies is kept.
+func (l Locality) apply(srvs []*net.SRV, metadata map[*net.SRV]map[string]string) []*net.SRV {
+	synthesized := make([]*net.SRV, 0, len(srvs))
+	for _, srv := range srvs {
+		copied := *srv
+		copied.Priority = l.priority(srv, metadata[srv])
+		synthesized = append(synthesized, &copied)
+
+		if serverMetadata, found := metadata[srv]; found {
+			metadata[&copied] = serverMetadata
+		}
+	}
+	return synthesized
+}
@@ -0,0 +1,124 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetLocality(t *testing.T) {
+	t.Parallel()
+
+	retriever := dnsdisco.NewTXTMetadataRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.gru1.sa-east.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+			{Target: "server3.example.com.", Port: 3333, Priority: 10, Weight: 10},
+			{Target: "server4.iad1.us-east.example.com.", Port: 4444, Priority: 10, Weight: 10},
+		}, nil
+	}), dnsdisco.TXTRetrieverFunc(func(name string) ([]string, error) {
+		switch name {
+		case "server2.example.com.":
+			return []string{"dc=GRU2 region=sa-east"}, nil
+		case "server3.example.com.":
+			return []string{"dc=gru1 region=sa-east"}, nil
+		}
+		return nil, nil
+	}))
+
+	scenarios := []struct {
+		description        string
+		locality           dnsdisco.Locality
+		priorityOverride   map[string]uint16
+		expectedPriorities map[string]uint16
+	}{
+		{
+			description: "it should keep the published priorities",
+			expectedPriorities: map[string]uint16{
+				"server1.gru1.sa-east.example.com.": 10,
+				"server2.example.com.":              10,
+				"server3.example.com.":              10,
+				"server4.iad1.us-east.example.com.": 10,
+			},
+		},
+		{
+			description: "it should synthesize the priorities from the metadata",
+			locality:    dnsdisco.Locality{Datacenter: "gru1", Region: "sa-east"},
+			expectedPriorities: map[string]uint16{
+				"server1.gru1.sa-east.example.com.": dnsdisco.LocalityPriorityRemote,
+				"server2.example.com.":              dnsdisco.LocalityPriorityRegion,
+				"server3.example.com.":              dnsdisco.LocalityPriorityDatacenter,
+				"server4.iad1.us-east.example.com.": dnsdisco.LocalityPriorityRemote,
+			},
+		},
+		{
+			description: "it should synthesize the priorities from the target names",
+			locality: dnsdisco.Locality{
+				Datacenter: "gru1",
+				Region:     "sa-east",
+				FromTarget: dnsdisco.LocalityFromLabels(1, 2),
+			},
+			expectedPriorities: map[string]uint16{
+				"server1.gru1.sa-east.example.com.": dnsdisco.LocalityPriorityDatacenter,
+				"server2.example.com.":              dnsdisco.LocalityPriorityRegion,
+				"server3.example.com.":              dnsdisco.LocalityPriorityDatacenter,
+				"server4.iad1.us-east.example.com.": dnsdisco.LocalityPriorityRemote,
+			},
+		},
+		{
+			description: "it should synthesize the priorities only from the region",
+			locality: dnsdisco.Locality{
+				Region:     "us-east",
+				FromTarget: dnsdisco.LocalityFromLabels(-1, 2),
+			},
+			expectedPriorities: map[string]uint16{
+				"server1.gru1.sa-east.example.com.": dnsdisco.LocalityPriorityRemote,
+				"server2.example.com.":              dnsdisco.LocalityPriorityRemote,
+				"server3.example.com.":              dnsdisco.LocalityPriorityRemote,
+				"server4.iad1.us-east.example.com.": dnsdisco.LocalityPriorityRegion,
+			},
+		},
+		{
+			description:      "it should give precedence to the priority override",
+			locality:         dnsdisco.Locality{Datacenter: "gru1", Region: "sa-east"},
+			priorityOverride: map[string]uint16{"server3.example.com": 50},
+			expectedPriorities: map[string]uint16{
+				"server1.gru1.sa-east.example.com.": dnsdisco.LocalityPriorityRemote,
+				"server2.example.com.":              dnsdisco.LocalityPriorityRegion,
+				"server3.example.com.":              50,
+				"server4.iad1.us-east.example.com.": dnsdisco.LocalityPriorityRemote,
+			},
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(retriever)
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+			discovery.(dnsdisco.BalancingConfigurer).SetLocality(item.locality)
+			discovery.(dnsdisco.BalancingConfigurer).SetPriorityOverride(item.priorityOverride)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			priorities := make(map[string]uint16)
+			for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+				priorities[server.Target] = server.Priority
+			}
+
+			if !reflect.DeepEqual(priorities, item.expectedPriorities) {
+				t.Errorf("mismatch priorities. Expecting: “%v”; found “%v”", item.expectedPriorities, priorities)
+			}
+		})
+	}
+}
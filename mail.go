@@ -0,0 +1,129 @@
+package dnsdisco
+
+import "net"
+
+// MailServer is a mail server found by DiscoverMail.
+type MailServer struct {
+	net.SRV
+
+	// ImplicitTLS is true when the TLS session starts immediately after the
+	// connection (imaps and pop3s), otherwise STARTTLS must be used.
+	ImplicitTLS bool
+}
+
+// Mail contains the mail servers of a domain as described in RFC 6186. Each
+// list is sorted by priority and randomized by weight inside the same
+// priority, as the client should try them in order.
+type Mail struct {
+	// Submission are the servers used to send messages (_submission._tcp).
+	Submission []MailServer
+
+	// IMAP are the servers used to access the mailbox using IMAP (_imap._tcp
+	// and _imaps._tcp).
+	IMAP []MailServer
+
+	// POP3 are the servers used to access the mailbox using POP3 (_pop3._tcp and
+	// _pop3s._tcp).
+	POP3 []MailServer
+}
+
+// PreferredAccess returns the mailbox access protocol that the domain prefers,
+// "imap" or "pop3", comparing the priorities of the best servers as defined in
+// RFC 6186 section 3.4. If both have the same priority IMAP is preferred, and
+// if there's no server an empty string is returned.
+func (m Mail) PreferredAccess() string {
+	switch {
+	case len(m.IMAP) > 0 && (len(m.POP3) == 0 || m.IMAP[0].Priority <= m.POP3[0].Priority):
+		return "imap"
+	case len(m.POP3) > 0:
+		return "pop3"
+	}
+
+	return ""
+}
+
+// mailService describes a SRV record defined in RFC 6186.
+type mailService struct {
+	service     string
+	implicitTLS bool
+	servers     *[]MailServer
+}
+
+// DiscoverMail finds the mail servers of the domain following RFC 6186. The
+// services that announce the target "." are considered decidedly not
+// available, and no server is returned for them. There's no health check, as
+// the mail client must try the servers in the returned order. An error is
+// returned only when all DNS requests fail.
+func DiscoverMail(domain string) (Mail, error) {
+	return discoverMail(domain, configuredRetriever())
+}
+
+// discoverMail finds the mail servers using the given retriever.
+func discoverMail(domain string, retriever Retriever) (Mail, error) {
+	var mail Mail
+	var imap, pop3 []MailServer
+
+	services := []mailService{
+		{service: "submission", servers: &mail.Submission},
+		{service: "imap", servers: &imap},
+		{service: "imaps", implicitTLS: true, servers: &imap},
+		{service: "pop3", servers: &pop3},
+		{service: "pop3s", implicitTLS: true, servers: &pop3},
+	}
+
+	var firstErr error
+	failures := 0
+
+	for _, service := range services {
+		srvs, err := retriever.Retrieve(service.service, "tcp", domain)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failures++
+			continue
+		}
+
+		for _, srv := range srvs {
+			// RFC 2782: a target of "." means that the service is decidedly not
+			// available at this domain
+			if srv.Target == "." {
+				continue
+			}
+
+			*service.servers = append(*service.servers, MailServer{
+				SRV:         *srv,
+				ImplicitTLS: service.implicitTLS,
+			})
+		}
+	}
+
+	if failures == len(services) {
+		return Mail{}, firstErr
+	}
+
+	mail.Submission = sortMailServers(mail.Submission)
+	mail.IMAP = sortMailServers(imap)
+	mail.POP3 = sortMailServers(pop3)
+	return mail, nil
+}
+
+// sortMailServers sorts the servers by priority and randomizes by weight inside
+// the same priority, as described in RFC 2782.
+func sortMailServers(servers []MailServer) []MailServer {
+	srvs := make([]*net.SRV, len(servers))
+	index := make(map[*net.SRV]MailServer, len(servers))
+
+	for i := range servers {
+		srvs[i] = &servers[i].SRV
+		index[srvs[i]] = servers[i]
+	}
+
+	normalize(srvs)
+
+	var sorted []MailServer
+	for _, srv := range srvs {
+		sorted = append(sorted, index[srv])
+	}
+	return sorted
+}
@@ -0,0 +1,103 @@
+package dnsdisco
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverMail(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description       string
+		records           map[string][]*net.SRV
+		expectedMail      Mail
+		expectedPreferred string
+		expectedError     error
+	}{
+		{
+			description: "it should find all mail services",
+			records: map[string][]*net.SRV{
+				"submission": {
+					{Target: "smtp.example.com.", Port: 587, Priority: 0, Weight: 1},
+				},
+				"imap": {
+					{Target: "imap.example.com.", Port: 143, Priority: 20, Weight: 1},
+				},
+				"imaps": {
+					{Target: "imap.example.com.", Port: 993, Priority: 10, Weight: 1},
+				},
+				"pop3s": {
+					{Target: "pop3.example.com.", Port: 995, Priority: 5, Weight: 1},
+				},
+			},
+			expectedMail: Mail{
+				Submission: []MailServer{
+					{SRV: net.SRV{Target: "smtp.example.com.", Port: 587, Priority: 0, Weight: 1}},
+				},
+				IMAP: []MailServer{
+					{SRV: net.SRV{Target: "imap.example.com.", Port: 993, Priority: 10, Weight: 1}, ImplicitTLS: true},
+					{SRV: net.SRV{Target: "imap.example.com.", Port: 143, Priority: 20, Weight: 1}},
+				},
+				POP3: []MailServer{
+					{SRV: net.SRV{Target: "pop3.example.com.", Port: 995, Priority: 5, Weight: 1}, ImplicitTLS: true},
+				},
+			},
+			expectedPreferred: "pop3",
+		},
+		{
+			description: "it should ignore services that are not available",
+			records: map[string][]*net.SRV{
+				"submission": {
+					{Target: "smtp.example.com.", Port: 587},
+				},
+				"imaps": {
+					{Target: "imap.example.com.", Port: 993},
+				},
+				"pop3": {
+					{Target: ".", Port: 0},
+				},
+				"pop3s": {
+					{Target: ".", Port: 0},
+				},
+			},
+			expectedMail: Mail{
+				Submission: []MailServer{
+					{SRV: net.SRV{Target: "smtp.example.com.", Port: 587}},
+				},
+				IMAP: []MailServer{
+					{SRV: net.SRV{Target: "imap.example.com.", Port: 993}, ImplicitTLS: true},
+				},
+			},
+			expectedPreferred: "imap",
+		},
+		{
+			description:   "it should fail when all requests fail",
+			expectedError: net.UnknownNetworkError("test"),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			mail, err := discoverMail("example.com", RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				if len(scenario.records) == 0 {
+					return nil, net.UnknownNetworkError("test")
+				}
+				return scenario.records[service], nil
+			}))
+
+			if !reflect.DeepEqual(mail, scenario.expectedMail) {
+				t.Errorf("mismatch mail servers. Expecting: “%#v”; found “%#v”", scenario.expectedMail, mail)
+			}
+
+			if preferred := mail.PreferredAccess(); preferred != scenario.expectedPreferred {
+				t.Errorf("mismatch preferred access. Expecting: “%s”; found “%s”", scenario.expectedPreferred, preferred)
+			}
+
+			if !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package dnsdisco
+
+import (
+	"sync"
+	"time"
+)
+
+// Manager shares the discoveries of the same service inside the process. Large
+// applications usually have many components looking for the same service, and
+// without a manager each one would have its own refresh loop and server set,
+// multiplying the DNS load.
+type Manager struct {
+	// discoveries stores the shared discovery of each service, indexed by
+	// _service._proto.name.
+	discoveries map[string]*sharedDiscovery
+
+	// discoveriesLock make it safe to request discoveries from different go
+	// routines.
+	discoveriesLock sync.Mutex
+
+	// cache stores the SRV answers shared by all discoveries of the manager.
+	cache *srvCache
+}
+
+// NewManager builds an empty manager. The returned type can be used globally as
+// it is go routine safe.
+func NewManager() *Manager {
+	return &Manager{
+		discoveries: make(map[string]*sharedDiscovery),
+		cache:       newSRVCache(),
+	}
+}
+
+// Discovery returns the discovery of the service. All calls with the same
+// service, proto and name receive the same server set, and the Refresh and
+// RefreshAsync calls are coalesced: concurrent refreshes send only one DNS
+// request (see SetRefreshConcurrency) and there's only one asynchronous
+// refresh loop, using the smallest requested interval. As the discovery is
+// shared, changing the retriever, health checker or load balancer affects all
+// users of the service. The retrievers are wrapped with the manager SRV cache
+// (see SetCache).
+func (m *Manager) Discovery(service, proto, name string) Discovery {
+	key := serviceKey(service, proto, name)
+
+	m.discoveriesLock.Lock()
+	defer m.discoveriesLock.Unlock()
+
+	if d, ok := m.discoveries[key]; ok {
+		return d
+	}
+
+	d := &sharedDiscovery{
+		discovery: buildDiscovery(service, proto, name),
+		manager:   m,
+	}
+	d.SetRetriever(configuredRetriever())
+	m.discoveries[key] = d
+	return d
+}
+
+// sharedDiscovery coalesces the refreshes of a discovery used in many places
+// of the application.
+type sharedDiscovery struct {
+	*discovery
+
+	// manager is the owner of the discovery, used to cache the retrievals.
+	manager *Manager
+
+	// subscribers is the number of RefreshAsync calls that weren't finished
+	// yet.
+	subscribers int
+
+	// interval is the interval of the running asynchronous refresh loop.
+	interval time.Duration
+
+	// finish stops the running asynchronous refresh loop.
+	finish chan<- bool
+
+	// lock make it safe to coalesce the refreshes.
+	lock sync.Mutex
+}
+
+// SetRetriever changes the retriever of all users of the service, wrapping it
+// with the manager SRV cache.
+func (s *sharedDiscovery) SetRetriever(r Retriever) {
+	s.discovery.SetRetriever(s.manager.CachedRetriever(r))
+}
+
+// RefreshAsync works exactly as Refresh, but is non-blocking and will repeat
+// the action on every interval. There's only one refresh loop for all callers,
+// using the smallest interval, and it stops when all returned channels are
+// closed.
+func (s *sharedDiscovery) RefreshAsync(interval time.Duration) chan<- bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.finish == nil || interval < s.interval {
+		if s.finish != nil {
+			close(s.finish)
+		}
+
+		s.finish = s.discovery.RefreshAsync(interval)
+		s.interval = interval
+	}
+
+	s.subscribers++
+
+	finish := make(chan bool)
+	go func() {
+		<-finish
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		s.subscribers--
+		if s.subscribers == 0 {
+			close(s.finish)
+			s.finish = nil
+			s.interval = 0
+		}
+	}()
+
+	return finish
+}
@@ -0,0 +1,116 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestManagerRefresh(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	release := make(chan bool)
+
+	manager := dnsdisco.NewManager()
+	discovery1 := manager.Discovery("jabber", "tcp", "registro.br")
+	discovery2 := manager.Discovery("JABBER", "tcp", "registro.br.")
+
+	discovery1.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		return []*net.SRV{
+			{
+				Target:   "server1.example.com.",
+				Port:     1111,
+				Priority: 10,
+				Weight:   20,
+			},
+		}, nil
+	}))
+	discovery1.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	}))
+
+	var wg sync.WaitGroup
+	for _, discovery := range []dnsdisco.Discovery{discovery1, discovery2, discovery1} {
+		wg.Add(1)
+		go func(discovery dnsdisco.Discovery) {
+			defer wg.Done()
+			if err := discovery.Refresh(); err != nil {
+				t.Errorf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+		}(discovery)
+	}
+
+	// give time for all refreshes to start before releasing the retriever
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("mismatch number of DNS requests. Expecting: “1”; found “%d”", calls)
+	}
+
+	if target, port := discovery2.Choose(); target != "server1.example.com." || port != 1111 {
+		t.Errorf("mismatch server. Expecting: “server1.example.com.:1111”; found “%s:%d”", target, port)
+	}
+
+	if discovery3 := manager.Discovery("jabber", "udp", "registro.br"); discovery3 == discovery1 {
+		t.Error("different services should not share the discovery")
+	}
+}
+
+func TestManagerRefreshAsync(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+
+	manager := dnsdisco.NewManager()
+	discovery := manager.Discovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, nil
+	}))
+
+	finish1 := discovery.RefreshAsync(time.Hour)
+	finish2 := manager.Discovery("jabber", "tcp", "registro.br").RefreshAsync(time.Hour)
+
+	time.Sleep(50 * time.Millisecond)
+
+	// only the first call starts the refresh loop
+	if c := atomic.LoadInt32(&calls); c != 1 {
+		t.Errorf("mismatch number of DNS requests. Expecting: “1”; found “%d”", c)
+	}
+
+	close(finish1)
+	close(finish2)
+}
+
+func TestManagerRefreshAsyncInterval(t *testing.T) {
+	t.Parallel()
+
+	manager := dnsdisco.NewManager()
+	discovery := manager.Discovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return nil, nil
+	}))
+	discovery.(dnsdisco.Prober).SetProbeThresholds(dnsdisco.ProbeThresholds{MaxRefreshAge: 10 * time.Millisecond})
+
+	// the smaller interval replaces the refresh loop, stopping the previous one
+	finish1 := discovery.RefreshAsync(time.Hour)
+	finish2 := manager.Discovery("jabber", "tcp", "registro.br").RefreshAsync(time.Minute)
+	defer close(finish1)
+	defer close(finish2)
+
+	time.Sleep(50 * time.Millisecond)
+
+	if discovery.(dnsdisco.Prober).Alive() {
+		t.Error("discovery should not be alive with a stale refresh")
+	}
+}
@@ -0,0 +1,267 @@
+package dnsdisco
+
+import (
+	"container/list"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig defines the SRV cache shared by all discoveries of a Manager.
+// The cache is disabled while MaxEntries or TTL is zero.
+type CacheConfig struct {
+	// MaxEntries is the maximum number of services stored. When the cache is
+	// full the least recently used service is evicted.
+	MaxEntries int
+
+	// TTL is how long a retrieved answer is reused before sending a new DNS
+	// request.
+	TTL time.Duration
+
+	// Clock is used to expire the entries. When nil the real clock is used.
+	Clock Clock
+}
+
+// CacheStats is a snapshot of the usage of the Manager SRV cache.
+type CacheStats struct {
+	// Hits is the number of retrievals answered by the cache.
+	Hits uint64
+
+	// Misses is the number of retrievals that sent a DNS request, because the
+	// service wasn't cached or the entry was expired.
+	Misses uint64
+
+	// Evictions is the number of entries removed to respect MaxEntries.
+	Evictions uint64
+
+	// Entries is the number of services currently stored.
+	Entries int
+}
+
+// srvCache is a LRU cache of SRV answers indexed by _service._proto.name.
+type srvCache struct {
+	config  CacheConfig
+	stats   CacheStats
+	entries map[string]*list.Element
+	order   *list.List
+	lock    sync.Mutex
+}
+
+// srvCacheEntry is an answer stored in the cache.
+type srvCacheEntry struct {
+	key     string
+	servers []*net.SRV
+	expires time.Time
+}
+
+// newSRVCache builds an empty and disabled cache.
+func newSRVCache() *srvCache {
+	return &srvCache{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// configure replaces the cache configuration, evicting the entries above the
+// new limit.
+func (c *srvCache) configure(config CacheConfig) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.config = config
+	if !c.enabled() {
+		c.entries = make(map[string]*list.Element)
+		c.order.Init()
+		return
+	}
+	c.evict()
+}
+
+// enabled returns true when the cache should store answers. The cache lock
+// must be held.
+func (c *srvCache) enabled() bool {
+	return c.config.MaxEntries > 0 && c.config.TTL > 0
+}
+
+// now returns the current time of the configured clock. The cache lock must be
+// held.
+func (c *srvCache) now() time.Time {
+	if c.config.Clock == nil {
+		return time.Now()
+	}
+	return c.config.Clock.Now()
+}
+
+// get returns a copy of the cached answer of the service, if it wasn't
+// expired yet.
+func (c *srvCache) get(key string) ([]*net.SRV, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.enabled() {
+		return nil, false
+	}
+
+	element, ok := c.entries[key]
+	if !ok || !c.now().Before(element.Value.(*srvCacheEntry).expires) {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	c.stats.Hits++
+	return copySRVs(element.Value.(*srvCacheEntry).servers), true
+}
+
+// set stores the answer of the service, evicting the least recently used
+// services when the cache is full.
+func (c *srvCache) set(key string, servers []*net.SRV) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.enabled() {
+		return
+	}
+
+	entry := &srvCacheEntry{
+		key:     key,
+		servers: copySRVs(servers),
+		expires: c.now().Add(c.config.TTL),
+	}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	c.evict()
+}
+
+// evict removes the least recently used entries above the limit. The cache
+// lock must be held.
+func (c *srvCache) evict() {
+	for c.order.Len() > c.config.MaxEntries {
+		element := c.order.Back()
+		c.order.Remove(element)
+		delete(c.entries, element.Value.(*srvCacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// remove drops the cached answer of the service.
+func (c *srvCache) remove(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// snapshot returns the current statistics of the cache.
+func (c *srvCache) snapshot() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+// copySRVs duplicates the records, so the cached answer isn't changed by the
+// discoveries that receive it.
+func copySRVs(servers []*net.SRV) []*net.SRV {
+	copied := make([]*net.SRV, len(servers))
+	for i, server := range servers {
+		server := *server
+		copied[i] = &server
+	}
+	return copied
+}
+
+// serviceKey builds the _service._proto.name key used to share the discoveries
+// and the cached answers of a service.
+func serviceKey(service, proto, name string) string {
+	return "_" + strings.ToLower(service) + "._" + strings.ToLower(proto) + "." +
+		strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// cachedRetriever answers the retrievals from the Manager SRV cache, only
+// sending DNS requests with the wrapped retriever on misses.
+type cachedRetriever struct {
+	Retriever
+
+	cache *srvCache
+}
+
+// Retrieve returns the cached answer of the service or, on misses, retrieves
+// and caches it. Errors are never cached.
+func (c cachedRetriever) Retrieve(service, proto, name string) ([]*net.SRV, error) {
+	key := serviceKey(service, proto, name)
+	if servers, ok := c.cache.get(key); ok {
+		return servers, nil
+	}
+
+	servers, err := c.Retriever.Retrieve(service, proto, name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.set(key, servers)
+	return servers, nil
+}
+
+// Invalidate removes the cached answer of the service, so ForceRefresh always
+// sends a new DNS request. The wrapped retriever cache is also invalidated
+// when it implements CachingRetriever.
+func (c cachedRetriever) Invalidate(service, proto, name string) {
+	c.cache.remove(serviceKey(service, proto, name))
+
+	if caching, ok := c.Retriever.(CachingRetriever); ok {
+		caching.Invalidate(service, proto, name)
+	}
+}
+
+// Migrate forwards the previous retriever to the wrapped one, unwrapping it
+// when it was also cached.
+func (c cachedRetriever) Migrate(previous interface{}) {
+	if cached, ok := previous.(cachedRetriever); ok {
+		previous = cached.Retriever
+	}
+	migrate(c.Retriever, previous)
+}
+
+// SetCache configures the SRV cache shared by all discoveries of the manager,
+// and by the retrievers wrapped with CachedRetriever. It is go routine safe,
+// and reducing MaxEntries evicts the least recently used services
+// immediately.
+func (m *Manager) SetCache(config CacheConfig) {
+	m.cache.configure(config)
+}
+
+// CacheStats returns the hit, miss and eviction counters of the manager SRV
+// cache.
+func (m *Manager) CacheStats() CacheStats {
+	return m.cache.snapshot()
+}
+
+// CachedRetriever wraps the retriever with the manager SRV cache, so
+// discoveries that aren't built by the manager (e.g. with different health
+// checkers) also share the retrieved answers. Retrievers that implement
+// MetadataRetriever are returned unchanged, as the cache doesn't store the
+// metadata.
+func (m *Manager) CachedRetriever(r Retriever) Retriever {
+	switch retriever := r.(type) {
+	case nil, MetadataRetriever:
+		return r
+	case cachedRetriever:
+		if retriever.cache == m.cache {
+			return r
+		}
+	}
+	return cachedRetriever{Retriever: r, cache: m.cache}
+}
@@ -0,0 +1,120 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/soaktest"
+)
+
+func TestManagerCache(t *testing.T) {
+	t.Parallel()
+
+	clock := soaktest.NewFakeClock(time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	manager := dnsdisco.NewManager()
+	manager.SetCache(dnsdisco.CacheConfig{
+		MaxEntries: 2,
+		TTL:        time.Minute,
+		Clock:      clock,
+	})
+
+	var calls int32
+	retriever := manager.CachedRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		atomic.AddInt32(&calls, 1)
+		return []*net.SRV{{Target: service + ".example.com.", Port: 1111}}, nil
+	}))
+
+	retrieve := func(service string) {
+		servers, err := retriever.Retrieve(service, "tcp", "example.com")
+		if err != nil {
+			t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+		}
+
+		if len(servers) != 1 || !strings.EqualFold(servers[0].Target, service+".example.com.") {
+			t.Fatalf("mismatch servers of “%s”. Found “%v”", service, servers)
+		}
+
+		// changing the answer must not affect the cached one
+		servers[0].Target = "changed.example.com."
+	}
+
+	retrieve("jabber")
+	retrieve("JABBER")
+	retrieve("ldap")
+	retrieve("jabber") // jabber becomes the most recently used
+	retrieve("http")   // evicts ldap
+	retrieve("jabber")
+	retrieve("ldap")
+
+	clock.Advance(time.Minute)
+	retrieve("ldap")
+
+	expected := dnsdisco.CacheStats{
+		Hits:      3,
+		Misses:    5,
+		Evictions: 2,
+		Entries:   2,
+	}
+
+	if stats := manager.CacheStats(); stats != expected {
+		t.Errorf("mismatch cache statistics. Expecting: “%+v”; found “%+v”", expected, stats)
+	}
+
+	if calls != 5 {
+		t.Errorf("mismatch number of DNS requests. Expecting: “5”; found “%d”", calls)
+	}
+
+	manager.SetCache(dnsdisco.CacheConfig{})
+	retrieve("jabber")
+
+	if calls != 6 {
+		t.Errorf("mismatch number of DNS requests with disabled cache. Expecting: “6”; found “%d”", calls)
+	}
+}
+
+func TestManagerCacheForceRefresh(t *testing.T) {
+	t.Parallel()
+
+	manager := dnsdisco.NewManager()
+	manager.SetCache(dnsdisco.CacheConfig{
+		MaxEntries: 10,
+		TTL:        time.Hour,
+	})
+
+	var calls int32
+	discovery := manager.Discovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		atomic.AddInt32(&calls, 1)
+		return []*net.SRV{{Target: "server1.example.com.", Port: 1111}}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		if err := discovery.Refresh(); err != nil {
+			t.Fatalf("unexpected error while refreshing. Details: %s", err)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("mismatch number of DNS requests. Expecting: “1”; found “%d”", calls)
+	}
+
+	if err := discovery.(dnsdisco.Refresher).ForceRefresh(); err != nil {
+		t.Fatalf("unexpected error while forcing the refresh. Details: %s", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("mismatch number of DNS requests after forced refresh. Expecting: “2”; found “%d”", calls)
+	}
+
+	if target, port := discovery.Choose(); target != "server1.example.com." || port != 1111 {
+		t.Errorf("mismatch server. Expecting: “server1.example.com.:1111”; found “%s:%d”", target, port)
+	}
+}
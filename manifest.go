@@ -0,0 +1,229 @@
+package dnsdisco
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// manifestTimeout limits the download of the manifest and its signature when
+// no HTTP client is defined.
+const manifestTimeout = 10 * time.Second
+
+// maxManifestSize limits the size of the manifest and its signature.
+const maxManifestSize = 1 << 20
+
+// Manifest is the signed document that lists the servers expected in the SRV
+// records of a service.
+type Manifest struct {
+	// Servers are the expected servers.
+	Servers []ManifestServer `json:"servers"`
+}
+
+// ManifestServer is a server expected in the SRV records.
+type ManifestServer struct {
+	Target   string `json:"target"`
+	Port     uint16 `json:"port"`
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+}
+
+// ManifestConfig defines where the signed manifest of the service is
+// published and how the mismatches are handled.
+type ManifestConfig struct {
+	// URL is the HTTPS address of the manifest, a JSON document in the format
+	// of the Manifest type. An empty URL disables the verification.
+	URL string
+
+	// SignatureURL is the HTTPS address of the detached signature of the
+	// manifest, the base64 Ed25519 signature of the manifest document (see
+	// SignManifest). When empty the URL with the ".sig" suffix is used.
+	SignatureURL string
+
+	// PublicKey verifies the signature of the manifest.
+	PublicKey ed25519.PublicKey
+
+	// Block removes the SRV records that don't match the manifest, and keeps
+	// the previous servers when the manifest can't be verified. Otherwise the
+	// mismatches are only reported.
+	Block bool
+
+	// Client downloads the manifest and its signature. When nil a client with
+	// a timeout of 10 seconds is used.
+	Client *http.Client
+}
+
+// ManifestError is a warning stored in the Errors list, and emitted in a
+// EventManifestMismatch event, when a SRV record doesn't match the signed
+// manifest. It is also used when the manifest can't be downloaded or
+// verified, without the target and the port.
+type ManifestError struct {
+	// Target and Port identify the SRV record that doesn't match.
+	Target string
+	Port   uint16
+
+	// Reason describes the problem.
+	Reason string
+}
+
+// Error returns the warning description.
+func (m ManifestError) Error() string {
+	if m.Target == "" && m.Port == 0 {
+		return fmt.Sprintf("dnsdisco: invalid manifest: %s", m.Reason)
+	}
+	return fmt.Sprintf("dnsdisco: server %s doesn't match the manifest: %s", JoinHostPort(m.Target, m.Port), m.Reason)
+}
+
+// SetManifest cross-checks the SRV records of each refresh against a manifest
+// fetched over HTTPS and signed with the private key of the public key, for
+// high-security environments that don't trust plain DNS. Each record that
+// isn't in the manifest, or has a different priority or weight, is reported as
+// a ManifestError in the Errors method and in a EventManifestMismatch event,
+// and when blocking is enabled it is removed. A ManifestError is returned, and
+// the previous configuration kept, when the public key doesn't have the Ed25519
+// size. It is go routine safe.
+func (d *discovery) SetManifest(config ManifestConfig) error {
+	if config.URL != "" && len(config.PublicKey) != ed25519.PublicKeySize {
+		return ManifestError{Reason: "invalid public key"}
+	}
+
+	d.manifestLock.Lock()
+	defer d.manifestLock.Unlock()
+	d.manifest = config
+	return nil
+}
+
+// SignManifest signs the manifest document with the private key, returning the
+// content of the detached signature.
+func SignManifest(manifest []byte, privateKey ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, manifest))
+}
+
+// verifyManifest cross-checks the records with the manifest, returning the
+// accepted ones and the warnings of the mismatches. An error is returned when
+// blocking and the manifest can't be verified.
+func (d *discovery) verifyManifest(srvs []*net.SRV) ([]*net.SRV, []error, error) {
+	d.manifestLock.RLock()
+	config := d.manifest
+	d.manifestLock.RUnlock()
+
+	if config.URL == "" {
+		return srvs, nil, nil
+	}
+
+	manifest, err := fetchManifest(config)
+	if err != nil {
+		if config.Block {
+			return nil, nil, err
+		}
+		return srvs, []error{err}, nil
+	}
+
+	expected := make(map[string]ManifestServer, len(manifest.Servers))
+	for _, server := range manifest.Servers {
+		expected[manifestKey(server.Target, server.Port)] = server
+	}
+
+	var accepted []*net.SRV
+	var warnings []error
+
+	for _, srv := range srvs {
+		var reason string
+		if server, ok := expected[manifestKey(srv.Target, srv.Port)]; !ok {
+			reason = "not listed"
+		} else if server.Priority != srv.Priority || server.Weight != srv.Weight {
+			reason = fmt.Sprintf("expected priority %d and weight %d, found %d and %d",
+				server.Priority, server.Weight, srv.Priority, srv.Weight)
+		}
+
+		if reason == "" {
+			accepted = append(accepted, srv)
+			continue
+		}
+
+		mismatch := ManifestError{Target: srv.Target, Port: srv.Port, Reason: reason}
+		warnings = append(warnings, mismatch)
+		d.emit(Event{Type: EventManifestMismatch, Server: Server{SRV: *srv}, Err: mismatch})
+
+		if !config.Block {
+			accepted = append(accepted, srv)
+		}
+	}
+
+	return accepted, warnings, nil
+}
+
+// manifestKey identifies a server in the manifest.
+func manifestKey(target string, port uint16) string {
+	return JoinHostPort(strings.ToLower(strings.TrimSuffix(target, ".")), port)
+}
+
+// fetchManifest downloads the manifest and verifies its signature.
+func fetchManifest(config ManifestConfig) (Manifest, error) {
+	// ed25519.Verify panics with a public key of the wrong size
+	if len(config.PublicKey) != ed25519.PublicKeySize {
+		return Manifest{}, ManifestError{Reason: "invalid public key"}
+	}
+
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: manifestTimeout}
+	}
+
+	signatureURL := config.SignatureURL
+	if signatureURL == "" {
+		signatureURL = config.URL + ".sig"
+	}
+
+	data, err := download(client, config.URL)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	signature, err := download(client, signatureURL)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(config.PublicKey, data, decoded) {
+		return Manifest{}, ManifestError{Reason: "invalid signature"}
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, ManifestError{Reason: err.Error()}
+	}
+	return manifest, nil
+}
+
+// download retrieves the content of the HTTPS address.
+func download(client *http.Client, rawURL string) ([]byte, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed.Scheme != "https" {
+		return nil, ManifestError{Reason: fmt.Sprintf("%s isn't an HTTPS address", rawURL)}
+	}
+
+	response, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, ManifestError{Reason: fmt.Sprintf("%s returned status %d", rawURL, response.StatusCode)}
+	}
+
+	return io.ReadAll(io.LimitReader(response.Body, maxManifestSize))
+}
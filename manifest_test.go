@@ -0,0 +1,159 @@
+package dnsdisco_test
+
+import (
+	"crypto/ed25519"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetManifest(t *testing.T) {
+	t.Parallel()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	manifest := []byte(`{"servers": [
+		{"target": "server1.example.com", "port": 1111, "priority": 10, "weight": 10},
+		{"target": "server2.example.com", "port": 2222, "priority": 20, "weight": 10}
+	]}`)
+
+	scenarios := []struct {
+		description     string
+		signature       string
+		publicKey       ed25519.PublicKey
+		block           bool
+		expectedTargets []string
+		expectedErrors  []error
+		expectedEvents  int
+		expectedError   bool
+		expectedSetErr  error
+	}{
+		{
+			description:     "it should report the mismatches",
+			signature:       dnsdisco.SignManifest(manifest, privateKey),
+			expectedTargets: []string{"server1.example.com.", "server2.example.com.", "evil.example.net."},
+			expectedErrors: []error{
+				dnsdisco.ManifestError{Target: "server2.example.com.", Port: 2222, Reason: "expected priority 20 and weight 10, found 20 and 90"},
+				dnsdisco.ManifestError{Target: "evil.example.net.", Port: 3333, Reason: "not listed"},
+			},
+			expectedEvents: 2,
+		},
+		{
+			description:     "it should block the mismatches",
+			signature:       dnsdisco.SignManifest(manifest, privateKey),
+			block:           true,
+			expectedTargets: []string{"server1.example.com."},
+			expectedErrors: []error{
+				dnsdisco.ManifestError{Target: "server2.example.com.", Port: 2222, Reason: "expected priority 20 and weight 10, found 20 and 90"},
+				dnsdisco.ManifestError{Target: "evil.example.net.", Port: 3333, Reason: "not listed"},
+			},
+			expectedEvents: 2,
+		},
+		{
+			description:     "it should report an invalid signature",
+			signature:       dnsdisco.SignManifest([]byte(`{"servers": []}`), privateKey),
+			expectedTargets: []string{"server1.example.com.", "server2.example.com.", "evil.example.net."},
+			expectedErrors: []error{
+				dnsdisco.ManifestError{Reason: "invalid signature"},
+			},
+		},
+		{
+			description:   "it should keep the previous servers when blocking with an invalid signature",
+			signature:     "invalid",
+			block:         true,
+			expectedError: true,
+		},
+		{
+			description:     "it should reject a public key with the wrong size",
+			signature:       dnsdisco.SignManifest(manifest, privateKey),
+			publicKey:       publicKey[:16],
+			block:           true,
+			expectedTargets: []string{"server1.example.com.", "server2.example.com.", "evil.example.net."},
+			expectedSetErr:  dnsdisco.ManifestError{Reason: "invalid public key"},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/jabber.json":
+					w.Write(manifest)
+				case "/jabber.json.sig":
+					w.Write([]byte(scenario.signature))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+					{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 90},
+					{Target: "evil.example.net.", Port: 3333, Priority: 30, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+			key := publicKey
+			if scenario.publicKey != nil {
+				key = scenario.publicKey
+			}
+
+			err := discovery.(dnsdisco.RecordConfigurer).SetManifest(dnsdisco.ManifestConfig{
+				URL:       server.URL + "/jabber.json",
+				PublicKey: key,
+				Block:     scenario.block,
+				Client:    server.Client(),
+			})
+
+			if !reflect.DeepEqual(err, scenario.expectedSetErr) {
+				t.Fatalf("mismatch error. Expecting: “%v”; found “%v”", scenario.expectedSetErr, err)
+			}
+
+			events := discovery.(dnsdisco.EventSource).Events()
+			defer discovery.(dnsdisco.EventSource).CloseEvents(events)
+
+			if err := discovery.Refresh(); (err != nil) != scenario.expectedError {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			var targets []string
+			for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+				targets = append(targets, server.Target)
+			}
+
+			if !reflect.DeepEqual(targets, scenario.expectedTargets) {
+				t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", scenario.expectedTargets, targets)
+			}
+
+			if errs := discovery.Errors(); !reflect.DeepEqual(errs, scenario.expectedErrors) {
+				t.Errorf("mismatch errors. Expecting: “%#v”; found “%#v”", scenario.expectedErrors, errs)
+			}
+
+			mismatches := 0
+			for len(events) > 0 {
+				if event := <-events; event.Type == dnsdisco.EventManifestMismatch {
+					mismatches++
+				}
+			}
+
+			if mismatches != scenario.expectedEvents {
+				t.Errorf("mismatch events. Expecting: “%d”; found “%d”", scenario.expectedEvents, mismatches)
+			}
+		})
+	}
+}
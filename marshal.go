@@ -0,0 +1,278 @@
+package dnsdisco
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Snapshot is the state of the discovery at a given moment, with all servers
+// retrieved in the last refresh. It is the document used by debug endpoints,
+// CLI output and persistence, encoded with the same schema in JSON and YAML.
+type Snapshot struct {
+	// Service, Proto and Name identifies the discovered service.
+	Service string
+	Proto   string
+	Name    string
+
+	// Taken is the moment of the snapshot.
+	Taken time.Time
+
+	// Servers are the servers retrieved in the last refresh.
+	Servers []Server
+}
+
+// Snapshot returns the current state of the discovery.
+func (d *discovery) Snapshot() Snapshot {
+	return Snapshot{
+		Service: d.service,
+		Proto:   d.proto,
+		Name:    d.name,
+		Taken:   time.Now(),
+		Servers: d.Servers(),
+	}
+}
+
+// snapshotDocument is the stable schema of the Snapshot type.
+type snapshotDocument struct {
+	Service string           `json:"service" yaml:"service"`
+	Proto   string           `json:"proto" yaml:"proto"`
+	Name    string           `json:"name" yaml:"name"`
+	Taken   string           `json:"taken,omitempty" yaml:"taken,omitempty"`
+	Servers []serverDocument `json:"servers" yaml:"servers"`
+}
+
+// document converts the snapshot to its stable schema.
+func (s Snapshot) document() snapshotDocument {
+	document := snapshotDocument{
+		Service: s.Service,
+		Proto:   s.Proto,
+		Name:    s.Name,
+		Taken:   formatTimestamp(s.Taken),
+		Servers: make([]serverDocument, 0, len(s.Servers)),
+	}
+
+	for _, server := range s.Servers {
+		document.Servers = append(document.Servers, server.document())
+	}
+	return document
+}
+
+// MarshalJSON encodes the snapshot with the timestamps in RFC 3339.
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.document())
+}
+
+// MarshalYAML encodes the snapshot with the same schema of MarshalJSON. It
+// implements the yaml.Marshaler interface of the gopkg.in/yaml packages.
+func (s Snapshot) MarshalYAML() (interface{}, error) {
+	return s.document(), nil
+}
+
+// UnmarshalJSON decodes a snapshot encoded by MarshalJSON.
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	var document snapshotDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+
+	taken, err := parseTimestamp(document.Taken)
+	if err != nil {
+		return err
+	}
+
+	snapshot := Snapshot{
+		Service: document.Service,
+		Proto:   document.Proto,
+		Name:    document.Name,
+		Taken:   taken,
+	}
+
+	for _, serverDocument := range document.Servers {
+		server, err := serverDocument.server()
+		if err != nil {
+			return err
+		}
+		snapshot.Servers = append(snapshot.Servers, server)
+	}
+
+	*s = snapshot
+	return nil
+}
+
+// serverDocument is the stable schema of the Server type.
+type serverDocument struct {
+	Target        string            `json:"target" yaml:"target"`
+	Port          uint16            `json:"port" yaml:"port"`
+	Priority      uint16            `json:"priority" yaml:"priority"`
+	Weight        uint16            `json:"weight" yaml:"weight"`
+	Healthy       bool              `json:"healthy" yaml:"healthy"`
+	HealthStatus  string            `json:"healthStatus" yaml:"healthStatus"`
+	Metadata      map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	UnixSocket    string            `json:"unixSocket,omitempty" yaml:"unixSocket,omitempty"`
+	CanonicalName string            `json:"canonicalName,omitempty" yaml:"canonicalName,omitempty"`
+	Used          int               `json:"used" yaml:"used"`
+	Retrieved     string            `json:"retrieved,omitempty" yaml:"retrieved,omitempty"`
+	HealthChecked string            `json:"healthChecked,omitempty" yaml:"healthChecked,omitempty"`
+	LastUsed      string            `json:"lastUsed,omitempty" yaml:"lastUsed,omitempty"`
+	WarmedUp      string            `json:"warmedUp,omitempty" yaml:"warmedUp,omitempty"`
+	HealthHistory []healthDocument  `json:"healthHistory,omitempty" yaml:"healthHistory,omitempty"`
+}
+
+// healthDocument is the stable schema of the HealthRecord type.
+type healthDocument struct {
+	Status  string `json:"status" yaml:"status"`
+	Checked string `json:"checked,omitempty" yaml:"checked,omitempty"`
+	Latency string `json:"latency,omitempty" yaml:"latency,omitempty"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// document converts the server to its stable schema.
+func (s Server) document() serverDocument {
+	document := serverDocument{
+		Target:        s.Target,
+		Port:          s.Port,
+		Priority:      s.Priority,
+		Weight:        s.Weight,
+		Healthy:       s.Healthy,
+		HealthStatus:  s.HealthStatus.String(),
+		Metadata:      s.Metadata,
+		UnixSocket:    s.UnixSocket,
+		CanonicalName: s.CanonicalName,
+		Used:          s.Used,
+		Retrieved:     formatTimestamp(s.Retrieved),
+		HealthChecked: formatTimestamp(s.HealthChecked),
+		LastUsed:      formatTimestamp(s.LastUsed),
+		WarmedUp:      formatTimestamp(s.WarmedUp),
+	}
+
+	for _, record := range s.HealthHistory {
+		health := healthDocument{
+			Status:  record.Status.String(),
+			Checked: formatTimestamp(record.Checked),
+			Error:   record.Error,
+		}
+		if record.Latency > 0 {
+			health.Latency = record.Latency.String()
+		}
+		document.HealthHistory = append(document.HealthHistory, health)
+	}
+
+	return document
+}
+
+// server converts the stable schema back to the server.
+func (s serverDocument) server() (Server, error) {
+	server := Server{
+		SRV: net.SRV{
+			Target:   s.Target,
+			Port:     s.Port,
+			Priority: s.Priority,
+			Weight:   s.Weight,
+		},
+		Healthy:       s.Healthy,
+		Metadata:      s.Metadata,
+		UnixSocket:    s.UnixSocket,
+		CanonicalName: s.CanonicalName,
+		Used:          s.Used,
+	}
+
+	var err error
+	if server.HealthStatus, err = parseHealthStatus(s.HealthStatus); err != nil {
+		return server, err
+	}
+
+	timestamps := []struct {
+		value  string
+		target *time.Time
+	}{
+		{s.Retrieved, &server.Retrieved},
+		{s.HealthChecked, &server.HealthChecked},
+		{s.LastUsed, &server.LastUsed},
+		{s.WarmedUp, &server.WarmedUp},
+	}
+
+	for _, timestamp := range timestamps {
+		if *timestamp.target, err = parseTimestamp(timestamp.value); err != nil {
+			return server, err
+		}
+	}
+
+	for _, health := range s.HealthHistory {
+		record := HealthRecord{Error: health.Error}
+		if record.Status, err = parseHealthStatus(health.Status); err != nil {
+			return server, err
+		}
+
+		if record.Checked, err = parseTimestamp(health.Checked); err != nil {
+			return server, err
+		}
+
+		if health.Latency != "" {
+			if record.Latency, err = time.ParseDuration(health.Latency); err != nil {
+				return server, err
+			}
+		}
+
+		server.HealthHistory = append(server.HealthHistory, record)
+	}
+
+	return server, nil
+}
+
+// MarshalJSON encodes the server with the health state and the timestamps in
+// RFC 3339. Zero timestamps are omitted.
+func (s Server) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.document())
+}
+
+// MarshalYAML encodes the server with the same schema of MarshalJSON. It
+// implements the yaml.Marshaler interface of the gopkg.in/yaml packages.
+func (s Server) MarshalYAML() (interface{}, error) {
+	return s.document(), nil
+}
+
+// UnmarshalJSON decodes a server encoded by MarshalJSON.
+func (s *Server) UnmarshalJSON(data []byte) error {
+	var document serverDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+
+	server, err := document.server()
+	if err != nil {
+		return err
+	}
+
+	*s = server
+	return nil
+}
+
+// parseHealthStatus converts the human readable name back to the health
+// status.
+func parseHealthStatus(value string) (HealthStatus, error) {
+	for _, status := range healthStatuses() {
+		if status.String() == value {
+			return status, nil
+		}
+	}
+	return HealthStatusUnhealthy, fmt.Errorf("dnsdisco: unknown health status %q", value)
+}
+
+// formatTimestamp encodes the time in RFC 3339, or returns an empty string for
+// the zero time.
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// parseTimestamp decodes a time in RFC 3339. An empty string is the zero time.
+func parseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
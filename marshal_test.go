@@ -0,0 +1,121 @@
+package dnsdisco_test
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestServerMarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	retrieved := time.Date(2016, 6, 1, 10, 30, 0, 0, time.UTC)
+
+	server := dnsdisco.Server{
+		SRV:           net.SRV{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 20},
+		Healthy:       true,
+		HealthStatus:  dnsdisco.HealthStatusDegraded,
+		Metadata:      map[string]string{"alpn": "h2"},
+		Used:          3,
+		Retrieved:     retrieved,
+		HealthChecked: retrieved.Add(time.Second),
+		HealthHistory: []dnsdisco.HealthRecord{
+			{
+				Status:  dnsdisco.HealthStatusUnhealthy,
+				Checked: retrieved,
+				Latency: 2 * time.Millisecond,
+				Error:   "connection refused",
+			},
+			{
+				Status:  dnsdisco.HealthStatusDegraded,
+				Checked: retrieved.Add(time.Second),
+			},
+		},
+	}
+
+	data, err := json.Marshal(server)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	expected := `{"target":"server1.example.com.","port":1111,"priority":10,"weight":20,"healthy":true,` +
+		`"healthStatus":"degraded","metadata":{"alpn":"h2"},"used":3,"retrieved":"2016-06-01T10:30:00Z",` +
+		`"healthChecked":"2016-06-01T10:30:01Z","healthHistory":[{"status":"unhealthy",` +
+		`"checked":"2016-06-01T10:30:00Z","latency":"2ms","error":"connection refused"},` +
+		`{"status":"degraded","checked":"2016-06-01T10:30:01Z"}]}`
+
+	if string(data) != expected {
+		t.Errorf("mismatch JSON. Expecting: “%s”; found “%s”", expected, string(data))
+	}
+
+	var decoded dnsdisco.Server
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if !reflect.DeepEqual(decoded, server) {
+		t.Errorf("mismatch servers. Expecting: “%#v”; found “%#v”", server, decoded)
+	}
+
+	document, err := server.MarshalYAML()
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	// the YAML document has the same schema of the JSON
+	yamlData, err := json.Marshal(document)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if string(yamlData) != expected {
+		t.Errorf("mismatch YAML document. Expecting: “%s”; found “%s”", expected, string(yamlData))
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	snapshot := discovery.(dnsdisco.Inspector).Snapshot()
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	var decoded dnsdisco.Snapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if len(decoded.Servers) != 1 || decoded.Servers[0].Target != "server1.example.com." || !decoded.Servers[0].Healthy {
+		t.Errorf("unexpected servers “%#v”", decoded.Servers)
+	}
+
+	// encoding the decoded snapshot must produce the same document
+	encoded, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if string(encoded) != string(data) {
+		t.Errorf("mismatch JSON. Expecting: “%s”; found “%s”", string(data), string(encoded))
+	}
+}
@@ -0,0 +1,771 @@
+// Package mdns advertises services in the local link using Multicast DNS (RFC
+// 6762) and DNS-Based Service Discovery (RFC 6763). It allows zero
+// configuration environments, where there's no DNS server to publish the SRV
+// records, to still be discovered using the _service._proto.local format.
+package mdns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultTTL is the TTL used in the announced records when the service
+	// doesn't define one. RFC 6762 section 10 recommends 120 seconds for records
+	// that contains host names.
+	defaultTTL = 120
+
+	// probeInterval is the time waited between each probe query, as defined in
+	// RFC 6762 section 8.1.
+	probeInterval = 250 * time.Millisecond
+
+	// probeAttempts is the number of probe queries sent before claiming the
+	// names, as defined in RFC 6762 section 8.1.
+	probeAttempts = 3
+
+	// maxConflicts is the number of times that the announcer will rename the
+	// service because of a conflict before giving up.
+	maxConflicts = 15
+
+	// cacheFlushBit is the top bit of the class field that indicates that the
+	// record is unique, as described in RFC 6762 section 10.2.
+	cacheFlushBit = 1 << 15
+
+	// unicastResponseBit is the top bit of the question class field that
+	// indicates that the querier wants an unicast response, as described in RFC
+	// 6762 section 5.4.
+	unicastResponseBit = 1 << 15
+)
+
+var (
+	// multicastAddress is the IPv4 multicast group and port used by Multicast
+	// DNS.
+	multicastAddress = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+	// ErrConflict is returned when the announcer couldn't find an unique name
+	// for the service after renaming it many times.
+	ErrConflict = errors.New("mdns: too many name conflicts")
+
+	// ErrAnnouncing is returned when Announce is called on an announcer that is
+	// already announcing a service.
+	ErrAnnouncing = errors.New("mdns: already announcing")
+)
+
+// Service contains all the information that describes an instance of a service
+// in the local link.
+type Service struct {
+	// Instance is the user friendly name of this instance of the service (e.g.
+	// "Living Room Printer"). It is the only part of the name that can contain
+	// dots and spaces.
+	Instance string
+
+	// Service is the name of the application without the underscore prefix
+	// (e.g. "ipp").
+	Service string
+
+	// Proto is the protocol used by the application. Could be "udp" or "tcp".
+	Proto string
+
+	// Host is the host name, without the ".local." suffix, where the service is
+	// running. If empty the name of the machine is used.
+	Host string
+
+	// Port is where the service is listening for requests.
+	Port uint16
+
+	// IPs are the addresses announced for the host. If empty all addresses of
+	// the active multicast interfaces are used.
+	IPs []net.IP
+
+	// Text stores the key/value pairs that are published in the TXT record of
+	// the instance, as described in RFC 6763 section 6.
+	Text map[string]string
+
+	// TTL is the time to live in seconds of the published records. If zero a
+	// default value of 120 seconds is used.
+	TTL uint32
+}
+
+// Announcer publishes a service in the local link. It probes the network to
+// make sure that the names are unique, renaming them on conflicts, announces
+// the records and then answers the queries until it is closed.
+type Announcer struct {
+	// service stores the data that is going to be published. The instance and
+	// host names can change when conflicts are detected.
+	service Service
+
+	// serviceLock make it safe to rename the service while the responder is
+	// answering queries.
+	serviceLock sync.RWMutex
+
+	// conn is the socket joined in the multicast group.
+	conn *net.UDPConn
+
+	// probing is true while the announcer is verifying that the names are
+	// unique. The responder doesn't answer queries in this state.
+	probing bool
+
+	// conflicts receives the conflicts detected by the responder while probing.
+	conflicts chan conflict
+
+	// finish stops the responder.
+	finish chan bool
+
+	// wait allows Close to block until the responder is done.
+	wait sync.WaitGroup
+
+	// errors stores all the error generated by the responder.
+	errors []error
+
+	// errorsLock guarantees that the errors list will be go routine safe.
+	errorsLock sync.Mutex
+}
+
+// conflict describes a problem found while probing.
+type conflict struct {
+	// host is true when the host name is in conflict, otherwise it's the
+	// instance name.
+	host bool
+
+	// deferred is true when the announcer lost a simultaneous probe tiebreak
+	// (RFC 6762 section 8.2) and should only wait before probing again.
+	deferred bool
+}
+
+// NewAnnouncer builds an announcer for the given service. Nothing is sent to
+// the network until the Announce method is called.
+func NewAnnouncer(service Service) *Announcer {
+	if service.TTL == 0 {
+		service.TTL = defaultTTL
+	}
+
+	return &Announcer{
+		service:   service,
+		conflicts: make(chan conflict, 1),
+	}
+}
+
+// Announce joins the multicast group, probes the network for conflicts and
+// announces the service. It blocks until the names are claimed, and after
+// that the announcer keeps answering queries in background until Close is
+// called. When a conflict is detected the instance (or host) is renamed and the
+// final name can be retrieved with the Instance method.
+func (a *Announcer) Announce() error {
+	if a.conn != nil {
+		return ErrAnnouncing
+	}
+
+	a.serviceLock.Lock()
+	if a.service.Host == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			a.serviceLock.Unlock()
+			return err
+		}
+		a.service.Host = strings.SplitN(hostname, ".", 2)[0]
+	}
+
+	if len(a.service.IPs) == 0 {
+		ips, err := localIPs()
+		if err != nil {
+			a.serviceLock.Unlock()
+			return err
+		}
+		a.service.IPs = ips
+	}
+	a.serviceLock.Unlock()
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, multicastAddress)
+	if err != nil {
+		return err
+	}
+
+	a.conn = conn
+	a.finish = make(chan bool)
+	a.probing = true
+
+	a.wait.Add(1)
+	go a.respond()
+
+	if err := a.probe(); err != nil {
+		a.Close()
+		return err
+	}
+
+	a.serviceLock.Lock()
+	a.probing = false
+	a.serviceLock.Unlock()
+
+	// RFC 6762 section 8.3 says that the responder must send at least two
+	// unsolicited responses, one second apart
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+
+		if err := a.send(a.announcement(false), multicastAddress); err != nil {
+			a.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Instance returns the current instance name of the service, that could be
+// different from the original one if a conflict was detected.
+func (a *Announcer) Instance() string {
+	a.serviceLock.RLock()
+	defer a.serviceLock.RUnlock()
+	return a.service.Instance
+}
+
+// Errors return all errors found while answering queries. Once this method is
+// called the internal errors buffer is cleared.
+func (a *Announcer) Errors() []error {
+	a.errorsLock.Lock()
+	defer a.errorsLock.Unlock()
+
+	errs := a.errors
+	a.errors = nil
+	return errs
+}
+
+// Close sends a goodbye packet (records with zero TTL) so the other hosts can
+// remove the service from their caches, and stops answering queries.
+func (a *Announcer) Close() error {
+	if a.conn == nil {
+		return nil
+	}
+
+	a.serviceLock.RLock()
+	probing := a.probing
+	a.serviceLock.RUnlock()
+
+	var err error
+	if !probing {
+		err = a.send(a.announcement(true), multicastAddress)
+	}
+
+	close(a.finish)
+	if closeErr := a.conn.Close(); err == nil {
+		err = closeErr
+	}
+	a.wait.Wait()
+
+	a.conn = nil
+	return err
+}
+
+// probe sends the probe queries as described in RFC 6762 section 8.1,
+// renaming the service every time that a conflict is detected.
+func (a *Announcer) probe() error {
+	// wait a random period between 0 and 250 milliseconds to avoid collisions
+	// with other hosts that were powered on at the same time
+	time.Sleep(time.Duration(rand.Int63n(int64(probeInterval))))
+
+	for conflicts := 0; conflicts < maxConflicts; {
+		found := false
+
+		for i := 0; i < probeAttempts && !found; i++ {
+			if err := a.send(a.probeQuery(), multicastAddress); err != nil {
+				return err
+			}
+
+			select {
+			case c := <-a.conflicts:
+				found = true
+
+				if c.deferred {
+					// RFC 6762 section 8.2: the host that lost the tiebreak should
+					// wait one second and probe again
+					time.Sleep(time.Second)
+					break
+				}
+
+				conflicts++
+				a.serviceLock.Lock()
+				if c.host {
+					a.service.Host = rename(a.service.Host, "-%d")
+				} else {
+					a.service.Instance = rename(a.service.Instance, " (%d)")
+				}
+				a.serviceLock.Unlock()
+
+			case <-time.After(probeInterval):
+			}
+		}
+
+		if !found {
+			return nil
+		}
+	}
+
+	return ErrConflict
+}
+
+// respond reads all the messages sent to the multicast group, detecting
+// conflicts and answering the queries about the announced service.
+func (a *Announcer) respond() {
+	defer a.wait.Done()
+
+	buffer := make([]byte, 9000)
+	for {
+		n, from, err := a.conn.ReadFromUDP(buffer)
+		if err != nil {
+			select {
+			case <-a.finish:
+				return
+			default:
+			}
+
+			a.addError(err)
+			continue
+		}
+
+		var msg dns.Msg
+		if err := msg.Unpack(buffer[:n]); err != nil {
+			// ignore malformed packets from other hosts
+			continue
+		}
+
+		a.serviceLock.RLock()
+		probing := a.probing
+		a.serviceLock.RUnlock()
+
+		if probing {
+			if c, ok := a.detectConflict(&msg); ok {
+				select {
+				case a.conflicts <- c:
+				default:
+				}
+			}
+			continue
+		}
+
+		response, unicast := a.answer(&msg)
+		if response == nil {
+			continue
+		}
+
+		to := multicastAddress
+		if unicast || from.Port != multicastAddress.Port {
+			// RFC 6762 section 6.7: legacy unicast queries (source port different
+			// from 5353) are answered directly to the querier
+			to = from
+			response.Id = msg.Id
+			response.Question = msg.Question
+		}
+
+		if err := a.send(response, to); err != nil {
+			a.addError(err)
+		}
+	}
+}
+
+// detectConflict checks if the message claims any of the unique names that the
+// announcer is probing.
+func (a *Announcer) detectConflict(msg *dns.Msg) (conflict, bool) {
+	unique := a.uniqueRecords(false)
+
+	if msg.Response {
+		for _, rr := range msg.Answer {
+			for _, ours := range unique {
+				if strings.EqualFold(rr.Header().Name, ours.Header().Name) && !sameRecord(rr, ours) {
+					return conflict{host: ours.Header().Rrtype == dns.TypeA || ours.Header().Rrtype == dns.TypeAAAA}, true
+				}
+			}
+		}
+		return conflict{}, false
+	}
+
+	// simultaneous probe tiebreaking (RFC 6762 section 8.2)
+	for _, name := range []string{a.instanceName(), a.hostName()} {
+		var theirs, ours []dns.RR
+		for _, rr := range msg.Ns {
+			if strings.EqualFold(rr.Header().Name, name) {
+				theirs = append(theirs, rr)
+			}
+		}
+
+		if len(theirs) == 0 {
+			continue
+		}
+
+		for _, rr := range unique {
+			if strings.EqualFold(rr.Header().Name, name) {
+				ours = append(ours, rr)
+			}
+		}
+
+		if compareRecords(ours, theirs) < 0 {
+			return conflict{deferred: true}, true
+		}
+	}
+
+	return conflict{}, false
+}
+
+// answer builds the response for the questions about the announced service.
+// It returns a nil message when there's nothing to answer. The unicast flag
+// indicates that the querier asked for a direct response.
+func (a *Announcer) answer(query *dns.Msg) (response *dns.Msg, unicast bool) {
+	if query.Response || query.Opcode != dns.OpcodeQuery {
+		return nil, false
+	}
+
+	records := append(a.sharedRecords(false), a.uniqueRecords(false)...)
+	response = new(dns.Msg)
+	response.Response = true
+	response.Authoritative = true
+
+	for _, question := range query.Question {
+		if question.Qclass&unicastResponseBit != 0 {
+			unicast = true
+		}
+
+		for _, rr := range records {
+			if !strings.EqualFold(rr.Header().Name, question.Name) {
+				continue
+			}
+
+			if question.Qtype != dns.TypeANY && question.Qtype != rr.Header().Rrtype {
+				continue
+			}
+
+			if knownAnswer(query, rr) || containsRecord(response.Answer, rr) {
+				continue
+			}
+
+			response.Answer = append(response.Answer, rr)
+		}
+	}
+
+	if len(response.Answer) == 0 {
+		return nil, false
+	}
+
+	// RFC 6763 section 12 recommends sending the SRV, TXT and address records
+	// as additional data, avoiding new queries from the client
+	for _, rr := range records {
+		if rr.Header().Rrtype == dns.TypePTR || containsRecord(response.Answer, rr) {
+			continue
+		}
+		response.Extra = append(response.Extra, rr)
+	}
+
+	setCacheFlush(response.Answer)
+	setCacheFlush(response.Extra)
+	return response, unicast
+}
+
+// probeQuery builds the query sent while probing, with the proposed records in
+// the authority section.
+func (a *Announcer) probeQuery() *dns.Msg {
+	query := new(dns.Msg)
+	query.Id = 0
+	query.RecursionDesired = false
+	query.Question = []dns.Question{
+		{Name: a.instanceName(), Qtype: dns.TypeANY, Qclass: dns.ClassINET | unicastResponseBit},
+		{Name: a.hostName(), Qtype: dns.TypeANY, Qclass: dns.ClassINET | unicastResponseBit},
+	}
+	query.Ns = a.uniqueRecords(false)
+	return query
+}
+
+// announcement builds the unsolicited response with all records of the
+// service. When goodbye is true all records will have a zero TTL.
+func (a *Announcer) announcement(goodbye bool) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Authoritative = true
+	msg.Answer = append(a.sharedRecords(goodbye), a.uniqueRecords(goodbye)...)
+	setCacheFlush(msg.Answer)
+	return msg
+}
+
+// sharedRecords returns the PTR records that could be also announced by other
+// hosts.
+func (a *Announcer) sharedRecords(goodbye bool) []dns.RR {
+	ttl := a.ttl(goodbye)
+	serviceName := a.serviceName()
+
+	return []dns.RR{
+		&dns.PTR{
+			Hdr: dns.RR_Header{Name: serviceName, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl},
+			Ptr: a.instanceName(),
+		},
+		&dns.PTR{
+			Hdr: dns.RR_Header{Name: "_services._dns-sd._udp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl},
+			Ptr: serviceName,
+		},
+	}
+}
+
+// uniqueRecords returns the SRV, TXT and address records that only this host
+// can announce.
+func (a *Announcer) uniqueRecords(goodbye bool) []dns.RR {
+	ttl := a.ttl(goodbye)
+	instanceName := a.instanceName()
+	hostName := a.hostName()
+
+	a.serviceLock.RLock()
+	defer a.serviceLock.RUnlock()
+
+	records := []dns.RR{
+		&dns.SRV{
+			Hdr:    dns.RR_Header{Name: instanceName, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: ttl},
+			Target: hostName,
+			Port:   a.service.Port,
+		},
+		&dns.TXT{
+			Hdr: dns.RR_Header{Name: instanceName, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl},
+			Txt: text(a.service.Text),
+		},
+	}
+
+	for _, ip := range a.service.IPs {
+		if ipv4 := ip.To4(); ipv4 != nil {
+			records = append(records, &dns.A{
+				Hdr: dns.RR_Header{Name: hostName, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+				A:   ipv4,
+			})
+		} else {
+			records = append(records, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: hostName, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl},
+				AAAA: ip,
+			})
+		}
+	}
+
+	return records
+}
+
+// ttl returns the TTL that should be used in the records.
+func (a *Announcer) ttl(goodbye bool) uint32 {
+	if goodbye {
+		return 0
+	}
+
+	a.serviceLock.RLock()
+	defer a.serviceLock.RUnlock()
+	return a.service.TTL
+}
+
+// serviceName returns the name used to browse the instances of the service
+// (e.g. _ipp._tcp.local.).
+func (a *Announcer) serviceName() string {
+	a.serviceLock.RLock()
+	defer a.serviceLock.RUnlock()
+	return fmt.Sprintf("_%s._%s.local.", a.service.Service, a.service.Proto)
+}
+
+// instanceName returns the full name of the instance (e.g. Living Room
+// Printer._ipp._tcp.local.), escaping the dots of the instance label.
+func (a *Announcer) instanceName() string {
+	a.serviceLock.RLock()
+	instance := a.service.Instance
+	a.serviceLock.RUnlock()
+
+	instance = strings.Replace(instance, `\`, `\\`, -1)
+	instance = strings.Replace(instance, ".", `\.`, -1)
+	return instance + "." + a.serviceName()
+}
+
+// hostName returns the full name of the host (e.g. myhost.local.).
+func (a *Announcer) hostName() string {
+	a.serviceLock.RLock()
+	defer a.serviceLock.RUnlock()
+	return a.service.Host + ".local."
+}
+
+// send packs and writes the message to the given address.
+func (a *Announcer) send(msg *dns.Msg, to *net.UDPAddr) error {
+	data, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	_, err = a.conn.WriteToUDP(data, to)
+	return err
+}
+
+// addError stores an error found while answering queries.
+func (a *Announcer) addError(err error) {
+	a.errorsLock.Lock()
+	defer a.errorsLock.Unlock()
+	a.errors = append(a.errors, err)
+}
+
+// rename adds a numeric suffix to the name, or increments it if it already
+// exists, using the given format (e.g. "My Printer" becomes "My Printer (2)").
+func rename(name, format string) string {
+	prefix := format[:strings.Index(format, "%d")]
+	suffix := format[strings.Index(format, "%d")+2:]
+
+	if strings.HasSuffix(name, suffix) {
+		if i := strings.LastIndex(name, prefix); i >= 0 {
+			number := name[i+len(prefix) : len(name)-len(suffix)]
+			if n, err := strconv.Atoi(number); err == nil {
+				return name[:i] + fmt.Sprintf(format, n+1)
+			}
+		}
+	}
+
+	return name + fmt.Sprintf(format, 2)
+}
+
+// text converts the key/value pairs to the TXT record strings. The keys are
+// sorted so the record is always the same for the same data.
+func text(data map[string]string) []string {
+	if len(data) == 0 {
+		// RFC 6763 section 6.1 requires at least one string, even if empty
+		return []string{""}
+	}
+
+	var keys []string
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var txt []string
+	for _, key := range keys {
+		if data[key] == "" {
+			txt = append(txt, key)
+		} else {
+			txt = append(txt, key+"="+data[key])
+		}
+	}
+	return txt
+}
+
+// localIPs returns the addresses of all active multicast interfaces.
+func localIPs() ([]net.IP, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+
+	return ips, nil
+}
+
+// setCacheFlush marks the unique records of a response with the cache-flush
+// bit. The bit is only used in responses, so the records are built without it.
+func setCacheFlush(records []dns.RR) {
+	for _, rr := range records {
+		if rr.Header().Rrtype != dns.TypePTR {
+			rr.Header().Class |= cacheFlushBit
+		}
+	}
+}
+
+// knownAnswer checks if the querier already has the record in its cache with
+// at least half of the TTL, as described in RFC 6762 section 7.1.
+func knownAnswer(query *dns.Msg, rr dns.RR) bool {
+	for _, known := range query.Answer {
+		if sameRecord(known, rr) && known.Header().Ttl >= rr.Header().Ttl/2 {
+			return true
+		}
+	}
+	return false
+}
+
+// containsRecord checks if the record is already in the list.
+func containsRecord(records []dns.RR, rr dns.RR) bool {
+	for _, record := range records {
+		if sameRecord(record, rr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameRecord compares the name, type, class (ignoring the cache-flush bit) and
+// data of two records.
+func sameRecord(rr1, rr2 dns.RR) bool {
+	h1, h2 := rr1.Header(), rr2.Header()
+	return strings.EqualFold(h1.Name, h2.Name) &&
+		h1.Rrtype == h2.Rrtype &&
+		h1.Class&^cacheFlushBit == h2.Class&^cacheFlushBit &&
+		bytes.Equal(rdata(rr1), rdata(rr2))
+}
+
+// compareRecords compares two sets of records lexicographically as described in
+// RFC 6762 section 8.2. It returns a negative number when the first set is
+// lexicographically earlier, a positive one when it is later and zero when they
+// are equal.
+func compareRecords(rrs1, rrs2 []dns.RR) int {
+	sortRecords(rrs1)
+	sortRecords(rrs2)
+
+	for i := 0; i < len(rrs1) && i < len(rrs2); i++ {
+		if c := compareRecord(rrs1[i], rrs2[i]); c != 0 {
+			return c
+		}
+	}
+
+	return len(rrs1) - len(rrs2)
+}
+
+// sortRecords sorts the records lexicographically by class, type and data.
+func sortRecords(rrs []dns.RR) {
+	sort.Slice(rrs, func(i, j int) bool {
+		return compareRecord(rrs[i], rrs[j]) < 0
+	})
+}
+
+// compareRecord compares two records lexicographically by class (ignoring the
+// cache-flush bit), type and raw data.
+func compareRecord(rr1, rr2 dns.RR) int {
+	h1, h2 := rr1.Header(), rr2.Header()
+
+	if c1, c2 := h1.Class&^cacheFlushBit, h2.Class&^cacheFlushBit; c1 != c2 {
+		return int(c1) - int(c2)
+	}
+
+	if h1.Rrtype != h2.Rrtype {
+		return int(h1.Rrtype) - int(h2.Rrtype)
+	}
+
+	return bytes.Compare(rdata(rr1), rdata(rr2))
+}
+
+// rdata returns the uncompressed wire format of the record data.
+func rdata(rr dns.RR) []byte {
+	buffer := make([]byte, dns.MaxMsgSize)
+	off, err := dns.PackRR(rr, buffer, 0, nil, false)
+	if err != nil {
+		return nil
+	}
+	return buffer[off-int(rr.Header().Rdlength) : off]
+}
@@ -0,0 +1,164 @@
+package mdns
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRename(t *testing.T) {
+	scenarios := []struct {
+		description string
+		name        string
+		format      string
+		expected    string
+	}{
+		{
+			description: "it should add a suffix to an instance name",
+			name:        "Living Room Printer",
+			format:      " (%d)",
+			expected:    "Living Room Printer (2)",
+		},
+		{
+			description: "it should increment the suffix of an instance name",
+			name:        "Living Room Printer (2)",
+			format:      " (%d)",
+			expected:    "Living Room Printer (3)",
+		},
+		{
+			description: "it should add a suffix to a host name with dashes",
+			name:        "my-host",
+			format:      "-%d",
+			expected:    "my-host-2",
+		},
+		{
+			description: "it should increment the suffix of a host name",
+			name:        "my-host-9",
+			format:      "-%d",
+			expected:    "my-host-10",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			if name := rename(scenario.name, scenario.format); name != scenario.expected {
+				t.Errorf("mismatch names. Expecting: “%s”; found “%s”", scenario.expected, name)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	txt := text(map[string]string{"txtvers": "1", "pdl": "application/postscript", "duplex": ""})
+	expected := []string{"duplex", "pdl=application/postscript", "txtvers=1"}
+
+	if !reflect.DeepEqual(txt, expected) {
+		t.Errorf("mismatch TXT. Expecting: “%#v”; found “%#v”", expected, txt)
+	}
+
+	if txt := text(nil); !reflect.DeepEqual(txt, []string{""}) {
+		t.Errorf("mismatch empty TXT. Expecting: “%#v”; found “%#v”", []string{""}, txt)
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	announcer := NewAnnouncer(Service{
+		Instance: "Living Room Printer",
+		Service:  "ipp",
+		Proto:    "tcp",
+		Host:     "printer",
+		Port:     631,
+		IPs:      []net.IP{net.ParseIP("192.168.1.10")},
+	})
+
+	var query dns.Msg
+	query.SetQuestion("_ipp._tcp.local.", dns.TypePTR)
+
+	response, unicast := announcer.answer(&query)
+	if response == nil {
+		t.Fatal("expected a response for the PTR query")
+	}
+
+	if unicast {
+		t.Error("unexpected unicast response")
+	}
+
+	if len(response.Answer) != 1 {
+		t.Fatalf("expected one answer, found %d", len(response.Answer))
+	}
+
+	if ptr, ok := response.Answer[0].(*dns.PTR); !ok || ptr.Ptr != "Living Room Printer._ipp._tcp.local." {
+		t.Errorf("unexpected answer “%s”", response.Answer[0])
+	}
+
+	// SRV, TXT and A records
+	if len(response.Extra) != 3 {
+		t.Errorf("expected three additional records, found %d", len(response.Extra))
+	}
+
+	query.Answer = response.Answer
+	if response, _ := announcer.answer(&query); response != nil {
+		t.Errorf("known answer should be suppressed, found “%s”", response)
+	}
+
+	query.SetQuestion("other._tcp.local.", dns.TypeANY)
+	query.Answer = nil
+	if response, _ := announcer.answer(&query); response != nil {
+		t.Errorf("unexpected response for a different name “%s”", response)
+	}
+}
+
+func TestDetectConflict(t *testing.T) {
+	announcer := NewAnnouncer(Service{
+		Instance: "Living Room Printer",
+		Service:  "ipp",
+		Proto:    "tcp",
+		Host:     "printer",
+		Port:     631,
+		IPs:      []net.IP{net.ParseIP("192.168.1.10")},
+	})
+
+	response := new(dns.Msg)
+	response.Response = true
+	response.Answer = []dns.RR{
+		&dns.A{
+			Hdr: dns.RR_Header{Name: "printer.local.", Rrtype: dns.TypeA, Class: dns.ClassINET | cacheFlushBit, Ttl: 120},
+			A:   net.ParseIP("192.168.1.20"),
+		},
+	}
+
+	if c, ok := announcer.detectConflict(response); !ok || !c.host {
+		t.Errorf("expected a host conflict, found %#v (%t)", c, ok)
+	}
+
+	// the same data announced by other host is not a conflict
+	response.Answer[0].(*dns.A).A = net.ParseIP("192.168.1.10")
+	if c, ok := announcer.detectConflict(response); ok {
+		t.Errorf("unexpected conflict %#v", c)
+	}
+
+	probe := new(dns.Msg)
+	probe.SetQuestion("Living Room Printer._ipp._tcp.local.", dns.TypeANY)
+	probe.Ns = []dns.RR{
+		&dns.SRV{
+			Hdr:    dns.RR_Header{Name: "Living Room Printer._ipp._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120},
+			Target: "printer.local.",
+			Port:   9100,
+		},
+		&dns.TXT{
+			Hdr: dns.RR_Header{Name: "Living Room Printer._ipp._tcp.local.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120},
+			Txt: []string{""},
+		},
+	}
+
+	if c, ok := announcer.detectConflict(probe); !ok || !c.deferred {
+		t.Errorf("expected to lose the tiebreak, found %#v (%t)", c, ok)
+	}
+
+	probe.Ns[0].(*dns.SRV).Port = 1
+	if c, ok := announcer.detectConflict(probe); ok {
+		t.Errorf("expected to win the tiebreak, found %#v", c)
+	}
+}
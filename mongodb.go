@@ -0,0 +1,167 @@
+package dnsdisco
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// mongoDBTXTOptions are the only options that can be defined in the TXT
+// record of a mongodb+srv URI.
+var mongoDBTXTOptions = map[string]bool{
+	"authSource":   true,
+	"replicaSet":   true,
+	"loadBalanced": true,
+}
+
+// MongoDBSeedlist is the result of the resolution of a mongodb+srv URI.
+type MongoDBSeedlist struct {
+	// Hosts are the addresses (host:port) of the servers, sorted by priority
+	// and randomized by weight inside the same priority.
+	Hosts []string
+
+	// Options are the connection options: the default ones (tls=true), the
+	// ones of the TXT record and the ones of the URI, in this order of
+	// precedence.
+	Options map[string]string
+}
+
+// MongoDBSeedlistError is returned when the mongodb+srv URI or its DNS
+// records don't follow the seedlist discovery rules.
+type MongoDBSeedlistError struct {
+	// URI is the resolved URI.
+	URI string
+
+	// Reason describes the problem.
+	Reason string
+}
+
+// Error returns the problem description.
+func (m MongoDBSeedlistError) Error() string {
+	return fmt.Sprintf("dnsdisco: invalid mongodb+srv URI %q: %s", m.URI, m.Reason)
+}
+
+// ResolveMongoDBSeedlist resolves a mongodb+srv URI following the MongoDB
+// Initial DNS Seedlist Discovery specification. The servers are retrieved from
+// the SRV records (_mongodb._tcp.<host>, or the service of the srvServiceName
+// option), and must belong to the parent domain of the host. The options
+// authSource, replicaSet and loadBalanced can be defined in a single TXT
+// record of the host. When the srvMaxHosts option is defined, only this number
+// of servers is returned. There's no health check, as the seed list is only
+// used to find the topology.
+func ResolveMongoDBSeedlist(uri string) (MongoDBSeedlist, error) {
+	return resolveMongoDBSeedlist(uri, configuredRetriever(), NewDefaultTXTRetriever())
+}
+
+// resolveMongoDBSeedlist resolves the URI using the given retrievers.
+func resolveMongoDBSeedlist(uri string, retriever Retriever, txtRetriever TXTRetriever) (MongoDBSeedlist, error) {
+	invalid := func(reason string) (MongoDBSeedlist, error) {
+		return MongoDBSeedlist{}, MongoDBSeedlistError{URI: uri, Reason: reason}
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return MongoDBSeedlist{}, err
+	}
+
+	if parsed.Scheme != "mongodb+srv" {
+		return invalid("the scheme must be mongodb+srv")
+	}
+
+	host := strings.ToLower(parsed.Host)
+	if strings.Contains(host, ",") {
+		return invalid("only one host can be defined")
+	}
+
+	if parsed.Port() != "" {
+		return invalid("the port can't be defined")
+	}
+
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if len(labels) < 3 {
+		return invalid("the host must have at least three labels")
+	}
+	parentDomain := "." + strings.Join(labels[1:], ".")
+
+	uriOptions := parsed.Query()
+
+	service := "mongodb"
+	if name := uriOptions.Get("srvServiceName"); name != "" {
+		service = name
+	}
+
+	srvs, err := retriever.Retrieve(service, "tcp", host)
+	if err != nil {
+		return MongoDBSeedlist{}, err
+	}
+
+	if len(srvs) == 0 {
+		return invalid("no SRV record found")
+	}
+
+	sorted := make([]*net.SRV, len(srvs))
+	for i, srv := range srvs {
+		target := strings.ToLower(strings.TrimSuffix(srv.Target, "."))
+		if !strings.HasSuffix(target, parentDomain) {
+			return invalid(fmt.Sprintf("the server %q doesn't belong to the domain %q", srv.Target, parentDomain[1:]))
+		}
+
+		srv := *srv
+		sorted[i] = &srv
+	}
+	normalize(sorted)
+
+	seedlist := MongoDBSeedlist{
+		Options: map[string]string{"tls": "true"},
+	}
+
+	txts, err := txtRetriever.RetrieveTXT(host)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return MongoDBSeedlist{}, err
+		}
+	}
+
+	if len(txts) > 1 {
+		return invalid("more than one TXT record found")
+	}
+
+	if len(txts) == 1 {
+		txtOptions, err := url.ParseQuery(txts[0])
+		if err != nil {
+			return invalid("the TXT record is malformed")
+		}
+
+		for name, values := range txtOptions {
+			if !mongoDBTXTOptions[name] {
+				return invalid(fmt.Sprintf("the option %q can't be defined in the TXT record", name))
+			}
+			seedlist.Options[name] = values[len(values)-1]
+		}
+	}
+
+	for name, values := range uriOptions {
+		seedlist.Options[name] = values[len(values)-1]
+	}
+
+	if maxHosts := uriOptions.Get("srvMaxHosts"); maxHosts != "" {
+		limit, err := strconv.Atoi(maxHosts)
+		if err != nil || limit < 0 {
+			return invalid("the srvMaxHosts option must be a non-negative number")
+		}
+
+		if limit > 0 && limit < len(sorted) {
+			sorted = sorted[:limit]
+		}
+	}
+
+	for _, srv := range sorted {
+		seedlist.Hosts = append(seedlist.Hosts, JoinHostPort(strings.TrimSuffix(srv.Target, "."), srv.Port))
+	}
+
+	return seedlist, nil
+}
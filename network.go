@@ -0,0 +1,152 @@
+package dnsdisco
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// NetworkPolicy restricts the networks where the targets can be, as a defense
+// in depth against DNS answers pointing to unexpected networks. A target is
+// only healthy when all its IP addresses are inside one of the allowed
+// networks (if any) and outside all denied networks.
+type NetworkPolicy struct {
+	// Allow are the networks where the targets can be. When empty, all
+	// networks that aren't denied are allowed.
+	Allow []*net.IPNet
+
+	// Deny are the networks where the targets can't be, even if also inside an
+	// allowed network.
+	Deny []*net.IPNet
+}
+
+// ParseNetworkPolicy builds the network policy from the allowed and denied
+// networks in CIDR notation (e.g. "10.0.0.0/8" or "2001:db8::/32").
+func ParseNetworkPolicy(allow, deny []string) (NetworkPolicy, error) {
+	var policy NetworkPolicy
+	var err error
+
+	if policy.Allow, err = parseCIDRs(allow); err != nil {
+		return NetworkPolicy{}, err
+	}
+
+	if policy.Deny, err = parseCIDRs(deny); err != nil {
+		return NetworkPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// parseCIDRs converts the networks in CIDR notation.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Allowed returns true if the IP address is inside an allowed network (or
+// there's no allowed network) and outside all denied networks.
+func (n NetworkPolicy) Allowed(ip net.IP) bool {
+	for _, network := range n.Deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(n.Allow) == 0 {
+		return true
+	}
+
+	for _, network := range n.Allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// empty returns true when the policy doesn't restrict any network.
+func (n NetworkPolicy) empty() bool {
+	return len(n.Allow) == 0 && len(n.Deny) == 0
+}
+
+// NetworkPolicyError is returned by the health check of a target resolved to
+// an IP address that isn't allowed by the network policy.
+type NetworkPolicyError struct {
+	// Target is the SRV target.
+	Target string
+
+	// IP is the address of the target outside the allowed networks.
+	IP net.IP
+}
+
+// Error returns the target and the address not allowed.
+func (n NetworkPolicyError) Error() string {
+	return fmt.Sprintf("dnsdisco: target %s resolved to %s, not allowed by the network policy", n.Target, n.IP)
+}
+
+// SetNetworkPolicy fails the health checks of the targets resolved to IP
+// addresses outside the allowed networks or inside the denied ones, without
+// running the health checker. The targets are resolved with the address
+// resolver (see SetAddressResolver), or the system resolver when there's none,
+// and a resolution failure also fails the health check. An empty policy
+// disables the verification. It is go routine safe.
+func (d *discovery) SetNetworkPolicy(policy NetworkPolicy) {
+	d.networkPolicyLock.Lock()
+	defer d.networkPolicyLock.Unlock()
+	d.networkPolicy = policy
+}
+
+// checkNetworkPolicy resolves the target, returning an error if any of its IP
+// addresses isn't allowed by the network policy.
+func (d *discovery) checkNetworkPolicy(ctx context.Context, target string) error {
+	d.networkPolicyLock.RLock()
+	policy := d.networkPolicy
+	d.networkPolicyLock.RUnlock()
+
+	if policy.empty() {
+		return nil
+	}
+
+	ips, err := d.targetAddresses(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range ips {
+		if !policy.Allowed(ip) {
+			return NetworkPolicyError{Target: target, IP: ip}
+		}
+	}
+	return nil
+}
+
+// targetAddresses returns the IP addresses of the target: the IP literal
+// itself, the addresses of the address resolver or, when there's none, the
+// addresses of the system resolver.
+func (d *discovery) targetAddresses(ctx context.Context, target string) ([]net.IP, error) {
+	if ip, ok := IPLiteral(target); ok {
+		return []net.IP{ip}, nil
+	}
+
+	ips, err := d.ResolveAddress(ctx, target)
+	if err != nil || len(ips) > 0 {
+		return ips, err
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host(target))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
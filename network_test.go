@@ -0,0 +1,134 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetNetworkPolicy(t *testing.T) {
+	t.Parallel()
+
+	resolver := dnsdisco.AddressResolverFunc(func(ctx context.Context, target string) ([]net.IP, error) {
+		switch target {
+		case "internal.example.com.":
+			return []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}, nil
+		case "mixed.example.com.":
+			return []net.IP{net.ParseIP("10.0.0.3"), net.ParseIP("203.0.113.1")}, nil
+		}
+		return nil, errors.New("unknown target")
+	})
+
+	scenarios := []struct {
+		description     string
+		allow           []string
+		deny            []string
+		expectedHealthy []string
+	}{
+		{
+			description: "it should keep all targets healthy without policy",
+			expectedHealthy: []string{
+				"10.1.0.1.",
+				"192.0.2.1.",
+				"internal.example.com.",
+				"mixed.example.com.",
+				"unknown.example.com.",
+			},
+		},
+		{
+			description: "it should fail targets outside the allowed networks",
+			allow:       []string{"10.0.0.0/8"},
+			expectedHealthy: []string{
+				"10.1.0.1.",
+				"internal.example.com.",
+			},
+		},
+		{
+			description: "it should fail targets inside the denied networks",
+			deny:        []string{"192.0.2.0/24", "10.0.0.2/32"},
+			expectedHealthy: []string{
+				"10.1.0.1.",
+				"mixed.example.com.",
+			},
+		},
+		{
+			description: "it should give precedence to the denied networks",
+			allow:       []string{"10.0.0.0/8"},
+			deny:        []string{"10.1.0.0/16"},
+			expectedHealthy: []string{
+				"internal.example.com.",
+			},
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			policy, err := dnsdisco.ParseNetworkPolicy(item.allow, item.deny)
+			if err != nil {
+				t.Fatalf("unexpected error parsing the network policy. Details: %s", err)
+			}
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.(dnsdisco.ConnectionConfigurer).SetAddressResolver(resolver)
+			discovery.(dnsdisco.ConnectionConfigurer).SetNetworkPolicy(policy)
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "10.1.0.1.", Port: 1111},
+					{Target: "192.0.2.1.", Port: 1111},
+					{Target: "internal.example.com.", Port: 1111},
+					{Target: "mixed.example.com.", Port: 1111},
+					{Target: "unknown.example.com.", Port: 1111},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return true, nil
+			}))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while refreshing. Details: %s", err)
+			}
+
+			var healthy []string
+			for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+				if server.HealthStatus == dnsdisco.HealthStatusHealthy {
+					healthy = append(healthy, server.Target)
+				}
+			}
+
+			sort.Strings(healthy)
+			if !reflect.DeepEqual(item.expectedHealthy, healthy) {
+				t.Errorf("mismatch healthy targets. Expecting: “%v”; found “%v”", item.expectedHealthy, healthy)
+			}
+		})
+	}
+}
+
+func TestParseNetworkPolicy(t *testing.T) {
+	t.Parallel()
+
+	if _, err := dnsdisco.ParseNetworkPolicy([]string{"10.0.0.0/8"}, []string{"invalid"}); err == nil {
+		t.Error("expected error parsing an invalid network")
+	}
+
+	policy, err := dnsdisco.ParseNetworkPolicy([]string{"2001:db8::/32"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the network policy. Details: %s", err)
+	}
+
+	if !policy.Allowed(net.ParseIP("2001:db8::1")) {
+		t.Error("address inside the allowed network should be allowed")
+	}
+
+	if policy.Allowed(net.ParseIP("2001:db9::1")) {
+		t.Error("address outside the allowed network should not be allowed")
+	}
+}
@@ -0,0 +1,96 @@
+package dnsdisco
+
+import (
+	"net"
+	"strconv"
+)
+
+// SetPriorityOverride replaces the priority of the servers, for emergency
+// traffic steering (e.g. forcing the traffic to the disaster recovery site)
+// without waiting for the DNS TTLs. The servers are identified by the target
+// (e.g. "server1.example.com") or by the target and port (e.g.
+// "server1.example.com:1111"), that has precedence. The override is applied
+// on each refresh, before sorting the servers, so a Refresh call applies it
+// immediately. Servers that aren't healthy or are draining are still never
+// chosen, whatever is their priority. A nil or empty map removes the override,
+// failing back to the published priorities on the next refresh. It is go
+// routine safe.
+func (d *discovery) SetPriorityOverride(priorities map[string]uint16) {
+	override := make(map[string]uint16, len(priorities))
+	for key, priority := range priorities {
+		override[priorityOverrideKey(key)] = priority
+	}
+
+	d.priorityOverrideLock.Lock()
+	defer d.priorityOverrideLock.Unlock()
+	d.priorityOverride = override
+}
+
+// SetWeightOverride replaces the weight of the servers, to shift the traffic
+// between the servers of the same priority without waiting for the DNS TTLs.
+// The servers are identified like in SetPriorityOverride, and the override is
+// also applied on each refresh. A nil or empty map removes the override,
+// failing back to the published weights on the next refresh. It is go routine
+// safe.
+func (d *discovery) SetWeightOverride(weights map[string]uint16) {
+	override := make(map[string]uint16, len(weights))
+	for key, weight := range weights {
+		override[priorityOverrideKey(key)] = weight
+	}
+
+	d.priorityOverrideLock.Lock()
+	defer d.priorityOverrideLock.Unlock()
+	d.weightOverride = override
+}
+
+// overridePriorities returns a copy of the servers with the overridden
+// priorities. The records of the retriever aren't changed, as they may be
+// cached, and the metadata of the copies is kept.
+func overridePriorities(srvs []*net.SRV, metadata map[*net.SRV]map[string]string, priorities map[string]uint16) []*net.SRV {
+	return overrideServers(srvs, metadata, priorities, func(srv *net.SRV, priority uint16) {
+		srv.Priority = priority
+	})
+}
+
+// overrideWeights returns a copy of the servers with the overridden weights,
+// like overridePriorities.
+func overrideWeights(srvs []*net.SRV, metadata map[*net.SRV]map[string]string, weights map[string]uint16) []*net.SRV {
+	return overrideServers(srvs, metadata, weights, func(srv *net.SRV, weight uint16) {
+		srv.Weight = weight
+	})
+}
+
+// overrideServers returns a copy of the servers found in the override, with
+// the value applied.
+func overrideServers(srvs []*net.SRV, metadata map[*net.SRV]map[string]string, override map[string]uint16, apply func(*net.SRV, uint16)) []*net.SRV {
+	overridden := make([]*net.SRV, 0, len(srvs))
+	for _, srv := range srvs {
+		key := canonicalKey(srv.Target)
+		value, ok := override[net.JoinHostPort(key, strconv.FormatUint(uint64(srv.Port), 10))]
+		if !ok {
+			value, ok = override[key]
+		}
+
+		if !ok {
+			overridden = append(overridden, srv)
+			continue
+		}
+
+		copied := *srv
+		apply(&copied, value)
+		overridden = append(overridden, &copied)
+
+		if serverMetadata, found := metadata[srv]; found {
+			metadata[&copied] = serverMetadata
+		}
+	}
+	return overridden
+}
+
+// priorityOverrideKey normalizes the target, keeping the port if any.
+func priorityOverrideKey(key string) string {
+	if host, port, err := net.SplitHostPort(key); err == nil {
+		return net.JoinHostPort(canonicalKey(host), port)
+	}
+	return canonicalKey(key)
+}
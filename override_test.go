@@ -0,0 +1,91 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestPriorityOverride(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description    string
+		override       map[string]uint16
+		unhealthy      string
+		expectedTarget string
+	}{
+		{
+			description:    "it should use the published priorities",
+			expectedTarget: "primary.example.com.",
+		},
+		{
+			description: "it should steer the traffic by target",
+			override: map[string]uint16{
+				"DR.example.com": 1,
+			},
+			expectedTarget: "dr.example.com.",
+		},
+		{
+			description: "it should prefer the target and port",
+			override: map[string]uint16{
+				"dr.example.com.":      1,
+				"dr.example.com.:2222": 50,
+			},
+			expectedTarget: "primary.example.com.",
+		},
+		{
+			description: "it should not choose an unhealthy server",
+			override: map[string]uint16{
+				"dr.example.com": 1,
+			},
+			unhealthy:      "dr.example.com.",
+			expectedTarget: "primary.example.com.",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			srvs := []*net.SRV{
+				{Target: "primary.example.com.", Port: 1111, Priority: 10, Weight: 10},
+				{Target: "dr.example.com.", Port: 2222, Priority: 20, Weight: 10},
+			}
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return srvs, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return target != scenario.unhealthy, nil
+			}))
+			discovery.(dnsdisco.BalancingConfigurer).SetPriorityOverride(scenario.override)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			if target, _ := discovery.Choose(); target != scenario.expectedTarget {
+				t.Errorf("mismatch targets. Expecting: “%s”; found “%s”", scenario.expectedTarget, target)
+			}
+
+			// the retrieved records must not be changed, as they may be cached
+			if srvs[0].Priority != 10 || srvs[1].Priority != 20 {
+				t.Errorf("retrieved priorities changed to “%d” and “%d”", srvs[0].Priority, srvs[1].Priority)
+			}
+
+			// removing the override fails back to the published priorities
+			discovery.(dnsdisco.BalancingConfigurer).SetPriorityOverride(nil)
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			if target, _ := discovery.Choose(); target != "primary.example.com." {
+				t.Errorf("mismatch targets after failback. Expecting: “primary.example.com.”; found “%s”", target)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package dnsdisco
+
+import (
+	"context"
+	"time"
+)
+
+// SetHealthCheckPacing spreads the health checks across the interval of the
+// asynchronous refreshes (see RefreshAsync), smoothing the probe load and
+// avoiding latency spikes aligned with the refreshes. When enabled, each
+// refresh only checks the new servers, keeping the status of the known ones,
+// and between the refreshes the known servers are checked one at a time,
+// evenly spaced in the interval. It has no effect on the synchronous
+// refreshes. It is go routine safe.
+func (d *discovery) SetHealthCheckPacing(enabled bool) {
+	d.healthCheckPacingLock.Lock()
+	defer d.healthCheckPacingLock.Unlock()
+	d.healthCheckPacing = enabled
+}
+
+// pacedHealthChecks returns true when the known servers are checked between
+// the asynchronous refreshes.
+func (d *discovery) pacedHealthChecks() bool {
+	d.healthCheckPacingLock.RLock()
+	enabled := d.healthCheckPacing
+	d.healthCheckPacingLock.RUnlock()
+
+	d.refreshStateLock.Lock()
+	defer d.refreshStateLock.Unlock()
+	return enabled && d.refreshInterval > 0
+}
+
+// paceHealthChecks checks the current servers one at a time, each one in the
+// middle of its slot of the interval, returning when the interval is over. It
+// returns false if the finish channel was closed or the context is done in the
+// meantime.
+func (d *discovery) paceHealthChecks(ctx context.Context, interval time.Duration, finish <-chan bool) bool {
+	servers := d.Servers()
+	clock := d.currentClock()
+	begin := clock.Now()
+
+	var slot time.Duration
+	if len(servers) > 0 {
+		slot = interval / time.Duration(len(servers))
+	}
+
+	for i, server := range servers {
+		if !wait(ctx, clock, begin.Add(time.Duration(i)*slot+slot/2).Sub(clock.Now()), finish) {
+			return false
+		}
+		d.checkServer(server)
+	}
+
+	return wait(ctx, clock, begin.Add(interval).Sub(clock.Now()), finish)
+}
+
+// checkServer runs the health checker for the server, updating its status if
+// it is still one of the current servers.
+func (d *discovery) checkServer(server Server) {
+	d.healthCheckerLock.RLock()
+	healthChecker := d.healthChecker
+	d.healthCheckerLock.RUnlock()
+
+	d.statsStoreLock.RLock()
+	statsStore := d.statsStore
+	d.statsStoreLock.RUnlock()
+
+	// the lock isn't held during the check, so slow servers don't block the
+	// choices
+	begin := time.Now()
+	status, err := d.checkHealth(d.BaseContext(), healthChecker, server)
+
+	record := HealthRecord{Latency: time.Since(begin)}
+	if err != nil {
+		d.errorsLock.Lock()
+		d.errors = append(d.errors, err)
+		d.errorsLock.Unlock()
+		status = HealthStatusUnhealthy
+		record.Error = err.Error()
+	}
+	record.Status, record.Checked = status, time.Now()
+
+	// the health history stores the check result, but the servers drained by
+	// the operators keep draining
+	if d.isDrained(server.Target, server.Port) {
+		status = HealthStatusDraining
+	}
+
+	key := d.statsKey(server.Target, server.Port)
+	if err := statsStore.AddHealth(key, record); err != nil {
+		d.errorsLock.Lock()
+		d.errors = append(d.errors, err)
+		d.errorsLock.Unlock()
+	}
+
+	history, err := statsStore.Health(key)
+	if err != nil {
+		d.errorsLock.Lock()
+		d.errors = append(d.errors, err)
+		d.errorsLock.Unlock()
+	}
+
+	d.serversLock.Lock()
+	defer d.serversLock.Unlock()
+
+	for i, current := range d.servers {
+		if current.address() != server.address() {
+			continue
+		}
+
+		d.servers[i].HealthStatus = status
+		d.servers[i].Healthy = status.Usable()
+		d.servers[i].HealthChecked = record.Checked
+		d.servers[i].HealthHistory = history
+
+		if current.HealthStatus == status {
+			return
+		}
+
+		d.emit(Event{
+			Type:                 EventHealthChanged,
+			Server:               d.servers[i],
+			PreviousHealthStatus: current.HealthStatus,
+		})
+
+		d.changeServers()
+		return
+	}
+}
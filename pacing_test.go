@@ -0,0 +1,86 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetHealthCheckPacing(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description       string
+		pacing            bool
+		expectedSpacedOut bool
+	}{
+		{
+			description:       "it should spread the health checks across the interval",
+			pacing:            true,
+			expectedSpacedOut: true,
+		},
+		{
+			description:       "it should check all servers on each refresh",
+			pacing:            false,
+			expectedSpacedOut: false,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			var checks []time.Time
+			var checksLock sync.Mutex
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+					{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				checksLock.Lock()
+				checks = append(checks, time.Now())
+				checksLock.Unlock()
+				return true, nil
+			}))
+			discovery.(dnsdisco.HealthManager).SetHealthCheckPacing(scenario.pacing)
+
+			interval := 200 * time.Millisecond
+			finish := discovery.RefreshAsync(interval)
+			time.Sleep(2*interval + interval/4)
+			close(finish)
+
+			checksLock.Lock()
+			defer checksLock.Unlock()
+
+			if len(checks) < 4 {
+				t.Fatalf("unexpected number of health checks “%d”", len(checks))
+			}
+
+			// the first refresh checks all the new servers at once
+			spacedOut := true
+			for i := 2; i < len(checks); i++ {
+				if checks[i].Sub(checks[i-1]) < interval/4 {
+					spacedOut = false
+				}
+			}
+
+			if spacedOut != scenario.expectedSpacedOut {
+				t.Errorf("mismatch spaced out health checks. Expecting: “%t”; found “%t”", scenario.expectedSpacedOut, spacedOut)
+			}
+
+			for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+				if !server.Healthy {
+					t.Errorf("server “%s” should be healthy", server.Target)
+				}
+			}
+		})
+	}
+}
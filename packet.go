@@ -0,0 +1,186 @@
+package dnsdisco
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// packetConnMaxWriteFailures is the number of failed writes, without a
+// datagram received from the target in between, that makes the connection
+// choose another target. A connected UDP socket reports an ICMP port
+// unreachable only once, so successful writes don't reset the counter.
+const packetConnMaxWriteFailures = 3
+
+// ListenPacketTo chooses the best target and returns a datagram connection
+// already connected to it, useful for SIP, DNS or QUIC-style clients. The
+// address of WriteTo is ignored, as the datagrams are always sent to the
+// chosen target. When the writes start failing (e.g. ICMP port unreachable),
+// another healthy target is chosen and the connection is re-established. The
+// discovery proto must be "udp", otherwise an UnknownNetworkError is returned,
+// and if there's no server available ErrNoServer is returned.
+func (d *discovery) ListenPacketTo(ctx context.Context) (net.PacketConn, error) {
+	if d.proto != "udp" {
+		return nil, net.UnknownNetworkError(d.proto)
+	}
+
+	target, port := d.Choose()
+	if target == "" && port == 0 {
+		return nil, ErrNoServer
+	}
+
+	conn, err := dialPacket(ctx, target, port)
+	if err != nil {
+		return nil, err
+	}
+
+	return &packetConn{
+		discovery: d,
+		conn:      conn,
+		target:    target,
+		port:      port,
+	}, nil
+}
+
+// dialPacket connects the UDP socket to the target.
+func dialPacket(ctx context.Context, target string, port uint16) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "udp", JoinHostPort(target, port))
+}
+
+// packetConn is a UDP socket connected to a target chosen by the discovery,
+// that moves to another target when the writes fail.
+type packetConn struct {
+	// discovery chooses the targets.
+	discovery *discovery
+
+	// conn is the socket connected to the current target.
+	conn net.Conn
+
+	// target and port identifies the current target.
+	target string
+	port   uint16
+
+	// failures is the number of failed writes since the last datagram received
+	// from the target.
+	failures int
+
+	// readDeadline and writeDeadline are kept to be applied when the target
+	// changes.
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// lock make it safe to change the target while reading and writing.
+	lock sync.RWMutex
+}
+
+// ReadFrom reads a datagram sent by the current target. Receiving a datagram
+// proves that the target is alive, so the write failures are forgotten.
+func (p *packetConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	p.lock.RLock()
+	conn := p.conn
+	p.lock.RUnlock()
+
+	if n, err = conn.Read(b); err == nil {
+		p.lock.Lock()
+		if p.conn == conn {
+			p.failures = 0
+		}
+		p.lock.Unlock()
+	}
+	return n, conn.RemoteAddr(), err
+}
+
+// WriteTo sends the datagram to the current target, ignoring the address.
+// After some failures without a response another target is chosen.
+func (p *packetConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	p.lock.RLock()
+	conn := p.conn
+	p.lock.RUnlock()
+
+	if n, err = conn.Write(b); err == nil {
+		return n, nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// another go routine may have already changed the target
+	if p.conn != conn {
+		return n, err
+	}
+
+	if p.failures++; p.failures >= packetConnMaxWriteFailures {
+		p.reconnect()
+	}
+	return n, err
+}
+
+// reconnect chooses another healthy target and connects to it. If there's no
+// other target the current connection is kept. The caller must hold the write
+// lock.
+func (p *packetConn) reconnect() {
+	target, port := p.discovery.ChooseWhere(func(server Server) bool {
+		return server.Target != p.target || server.Port != p.port
+	})
+
+	if target == "" && port == 0 {
+		return
+	}
+
+	conn, err := dialPacket(context.Background(), target, port)
+	if err != nil {
+		return
+	}
+
+	conn.SetReadDeadline(p.readDeadline)
+	conn.SetWriteDeadline(p.writeDeadline)
+
+	p.conn.Close()
+	p.conn = conn
+	p.target = target
+	p.port = port
+	p.failures = 0
+}
+
+// Close closes the connection.
+func (p *packetConn) Close() error {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.conn.Close()
+}
+
+// LocalAddr returns the local network address.
+func (p *packetConn) LocalAddr() net.Addr {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.conn.LocalAddr()
+}
+
+// SetDeadline sets the read and write deadlines.
+func (p *packetConn) SetDeadline(t time.Time) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.readDeadline, p.writeDeadline = t, t
+	return p.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future ReadFrom calls.
+func (p *packetConn) SetReadDeadline(t time.Time) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.readDeadline = t
+	return p.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future WriteTo calls.
+func (p *packetConn) SetWriteDeadline(t time.Time) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.writeDeadline = t
+	return p.conn.SetWriteDeadline(t)
+}
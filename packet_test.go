@@ -0,0 +1,91 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestListenPacketTo(t *testing.T) {
+	t.Parallel()
+
+	// the first target has nobody listening, so the writes fail with ICMP port
+	// unreachable
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := packetPort(closed.LocalAddr())
+	closed.Close()
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	discovery := dnsdisco.NewDiscovery("sip", "udp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "127.0.0.1", Port: closedPort, Priority: 10},
+			{Target: "127.0.0.1", Port: packetPort(server.LocalAddr()), Priority: 20},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	conn, err := discovery.(dnsdisco.Dialer).ListenPacketTo(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+	defer conn.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		buffer := make([]byte, 512)
+		n, _, err := server.ReadFrom(buffer)
+		if err == nil {
+			received <- string(buffer[:n])
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		conn.WriteTo([]byte("OPTIONS"), nil)
+
+		select {
+		case message := <-received:
+			if message != "OPTIONS" {
+				t.Errorf("unexpected message “%s”", message)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	t.Error("connection didn't move to the healthy target")
+}
+
+func TestListenPacketToInvalidProto(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	if _, err := discovery.(dnsdisco.Dialer).ListenPacketTo(context.Background()); err != net.UnknownNetworkError("tcp") {
+		t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", net.UnknownNetworkError("tcp"), err)
+	}
+}
+
+// packetPort returns the port of the UDP address.
+func packetPort(addr net.Addr) uint16 {
+	_, port, _ := net.SplitHostPort(addr.String())
+	value, _ := strconv.ParseUint(port, 10, 16)
+	return uint16(value)
+}
@@ -0,0 +1,114 @@
+package dnsdisco
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime/debug"
+)
+
+// PanicPolicy defines what happens when a component of the library user
+// (retriever, health checker or load balancer) panics.
+type PanicPolicy int
+
+const (
+	// PanicPropagate doesn't recover the panics, so they crash the process
+	// like any other panic. This is the default policy.
+	PanicPropagate PanicPolicy = iota
+
+	// PanicRecover converts the panics into PanicError errors: a retriever
+	// panic fails the refresh (keeping the previous servers), a health checker
+	// panic marks the server unhealthy and a load balancer panic returns no
+	// server. A EventPanicRecovered event is emitted for each panic.
+	PanicRecover
+)
+
+// PanicError is the error of a recovered panic of a component of the library
+// user.
+type PanicError struct {
+	// Component identifies the component that panicked ("retriever", "health
+	// checker" or "load balancer").
+	Component string
+
+	// Value is the value of the panic.
+	Value interface{}
+
+	// Stack is the stack trace of the go routine when it panicked.
+	Stack []byte
+}
+
+// Error returns the panic description.
+func (p PanicError) Error() string {
+	return fmt.Sprintf("dnsdisco: %s panicked: %v", p.Component, p.Value)
+}
+
+// SetPanicPolicy defines what happens when the retriever, the health checker
+// or the load balancer panic. By default the panics are propagated. It is go
+// routine safe.
+func (d *discovery) SetPanicPolicy(policy PanicPolicy) {
+	d.panicPolicyLock.Lock()
+	defer d.panicPolicyLock.Unlock()
+	d.panicPolicy = policy
+}
+
+// recoverPanic converts a panic of the component into a PanicError stored in
+// err, when the policy recovers the panics. It must be deferred.
+func (d *discovery) recoverPanic(component string, err *error) {
+	d.panicPolicyLock.RLock()
+	policy := d.panicPolicy
+	d.panicPolicyLock.RUnlock()
+
+	if policy != PanicRecover {
+		return
+	}
+
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	panicErr := PanicError{Component: component, Value: value, Stack: debug.Stack()}
+	d.emit(Event{Type: EventPanicRecovered, Err: panicErr})
+	*err = panicErr
+}
+
+// retrieve retrieves the servers of the name with the retriever, recovering
+// its panics according to the policy.
+func (d *discovery) retrieve(retriever Retriever, name string) (srvs []*net.SRV, metadata map[*net.SRV]map[string]string, err error) {
+	defer d.recoverPanic("retriever", &err)
+
+	if metadataRetriever, ok := retriever.(MetadataRetriever); ok {
+		return retrieveMetadata(metadataRetriever, d.service, d.proto, name)
+	}
+
+	srvs, err = retriever.Retrieve(d.service, d.proto, name)
+	return srvs, nil, err
+}
+
+// healthCheck checks the server with the health checker, recovering its
+// panics according to the policy.
+func (d *discovery) healthCheck(ctx context.Context, healthChecker ServerHealthChecker, server Server) (status HealthStatus, err error) {
+	defer d.recoverPanic("health checker", &err)
+	return healthChecker.HealthCheck(ctx, server)
+}
+
+// loadBalance chooses a server with the load balancer, recovering its panics
+// according to the policy. The recovered panics are stored in the Errors
+// list. When the filter isn't nil the load balancer must implement the
+// FilteredLoadBalancer interface. The caller must hold the load balancer lock.
+func (d *discovery) loadBalance(accept func(target string, port uint16) bool) (target string, port uint16) {
+	var err error
+	defer func() {
+		if err != nil {
+			d.errorsLock.Lock()
+			d.errors = append(d.errors, err)
+			d.errorsLock.Unlock()
+		}
+	}()
+	defer d.recoverPanic("load balancer", &err)
+
+	if accept != nil {
+		return d.loadBalancer.(FilteredLoadBalancer).LoadBalanceWhere(accept)
+	}
+	return d.loadBalancer.LoadBalance()
+}
@@ -0,0 +1,138 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetPanicPolicy(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description       string
+		retriever         dnsdisco.Retriever
+		healthChecker     dnsdisco.HealthChecker
+		loadBalancer      dnsdisco.LoadBalancer
+		expectedComponent string
+		expectedTarget    string
+		expectedPort      uint16
+	}{
+		{
+			description: "it should recover a retriever panic",
+			retriever: dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				panic("retriever failure")
+			}),
+			healthChecker: dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}),
+			expectedComponent: "retriever",
+		},
+		{
+			description: "it should recover a health checker panic marking the server unhealthy",
+			retriever: dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+				}, nil
+			}),
+			healthChecker: dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				panic("health checker failure")
+			}),
+			expectedComponent: "health checker",
+		},
+		{
+			description: "it should recover a load balancer panic returning no server",
+			retriever: dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+				}, nil
+			}),
+			healthChecker: dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}),
+			loadBalancer:      panicLoadBalancer{},
+			expectedComponent: "load balancer",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(scenario.retriever)
+			discovery.SetHealthChecker(scenario.healthChecker)
+			if scenario.loadBalancer != nil {
+				discovery.SetLoadBalancer(scenario.loadBalancer)
+			}
+			discovery.(dnsdisco.FailureConfigurer).SetPanicPolicy(dnsdisco.PanicRecover)
+
+			events := discovery.(dnsdisco.EventSource).Events()
+			defer discovery.(dnsdisco.EventSource).CloseEvents(events)
+
+			var err error
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Fatalf("unexpected panic: %v", r)
+					}
+				}()
+
+				err = discovery.Refresh()
+				if err == nil {
+					target, port := discovery.Choose()
+					if target != scenario.expectedTarget {
+						t.Errorf("mismatch target. Expecting: “%s”; found “%s”", scenario.expectedTarget, target)
+					}
+					if port != scenario.expectedPort {
+						t.Errorf("mismatch port. Expecting: “%d”; found “%d”", scenario.expectedPort, port)
+					}
+				}
+			}()
+
+			var panicErr dnsdisco.PanicError
+			for len(events) > 0 {
+				if event := <-events; event.Type == dnsdisco.EventPanicRecovered {
+					panicErr, _ = event.Err.(dnsdisco.PanicError)
+				}
+			}
+
+			if panicErr.Component != scenario.expectedComponent {
+				t.Errorf("mismatch component. Expecting: “%s”; found “%s”", scenario.expectedComponent, panicErr.Component)
+			}
+
+			if scenario.expectedComponent == "retriever" {
+				if _, ok := err.(dnsdisco.PanicError); !ok {
+					t.Errorf("mismatch error. Expecting: “PanicError”; found “%v”", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSetPanicPolicyPropagate(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		panic("retriever failure")
+	}))
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected the panic to be propagated")
+		}
+	}()
+
+	discovery.Refresh()
+}
+
+type panicLoadBalancer struct{}
+
+func (panicLoadBalancer) ChangeServers(servers []*net.SRV) {}
+
+func (panicLoadBalancer) LoadBalance() (target string, port uint16) {
+	panic("load balancer failure")
+}
@@ -0,0 +1,203 @@
+package dnsdisco
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// PolicyPrefix is the label prepended to the service name to build the name of
+// the TXT record with the selection policy (e.g. _disco-policy.example.com).
+const PolicyPrefix = "_disco-policy"
+
+// PolicyVersion identifies the TXT records with a selection policy.
+const PolicyVersion = "v=disco1"
+
+// LabelMetadata is the metadata key (Server.Metadata) with the label of a
+// server, used by the selection policy.
+const LabelMetadata = "label"
+
+// TXTRetriever allows the library user to define how the TXT records are
+// retrieved.
+type TXTRetriever interface {
+	// RetrieveTXT returns the TXT records of the name.
+	RetrieveTXT(name string) ([]string, error)
+}
+
+// TXTRetrieverFunc is an easy-to-use implementation of the interface that is
+// responsible for retrieving the TXT records.
+type TXTRetrieverFunc func(name string) ([]string, error)
+
+// RetrieveTXT returns the TXT records of the name.
+func (t TXTRetrieverFunc) RetrieveTXT(name string) ([]string, error) {
+	return t(name)
+}
+
+// NewDefaultTXTRetriever returns a TXT retriever that uses the local resolver.
+func NewDefaultTXTRetriever() TXTRetriever {
+	return TXTRetrieverFunc(net.LookupTXT)
+}
+
+// PolicyError is a warning stored in the Errors list when the selection policy
+// is invalid, and was ignored.
+type PolicyError struct {
+	// Name is the name of the TXT record.
+	Name string
+
+	// Reason describes the problem.
+	Reason string
+}
+
+// Error returns the warning description.
+func (p PolicyError) Error() string {
+	return fmt.Sprintf("dnsdisco: invalid policy in %s: %s", p.Name, p.Reason)
+}
+
+// SetPolicy enables the selection policy published in a control TXT record
+// (PolicyPrefix plus the service name), checked on each refresh. It allows
+// blue/green cutovers without changing the SRV records: the record
+// "v=disco1; prefer=green" makes the clients choose only the healthy servers
+// with the label "green", falling back to all servers when none of them is
+// healthy. A server has a label when it is one of the labels of the target
+// name (e.g. server1.green.example.com) or its label metadata (LabelMetadata).
+//
+// When a public key is given, only signed policies are accepted: the last
+// field must be "sig=" followed by the base64 Ed25519 signature of the other
+// fields (see SignPolicy). Invalid policies, or all of them when the public
+// key doesn't have the Ed25519 size, are ignored and reported as PolicyError
+// in the Errors list. A nil retriever disables the policy.
+func (d *discovery) SetPolicy(retriever TXTRetriever, publicKey ed25519.PublicKey) {
+	d.policyLock.Lock()
+	defer d.policyLock.Unlock()
+
+	d.policyRetriever = retriever
+	d.policyPublicKey = publicKey
+}
+
+// SignPolicy signs the policy fields (e.g. "v=disco1; prefer=green") with the
+// private key, returning the content of the TXT record.
+func SignPolicy(policy string, privateKey ed25519.PrivateKey) string {
+	payload := canonicalPolicy(strings.Split(policy, ";"))
+	signature := ed25519.Sign(privateKey, []byte(payload))
+	return payload + "; sig=" + base64.StdEncoding.EncodeToString(signature)
+}
+
+// canonicalPolicy joins the trimmed fields, that is the signed content.
+func canonicalPolicy(fields []string) string {
+	var trimmed []string
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			trimmed = append(trimmed, field)
+		}
+	}
+	return strings.Join(trimmed, "; ")
+}
+
+// retrievePolicy returns the preferred label of the policy published for the
+// service. When there's no policy an empty label is returned.
+func retrievePolicy(retriever TXTRetriever, publicKey ed25519.PublicKey, name string) (string, error) {
+	// ed25519.Verify panics with a public key of the wrong size
+	if publicKey != nil && len(publicKey) != ed25519.PublicKeySize {
+		return "", PolicyError{Name: name, Reason: "invalid public key"}
+	}
+
+	records, err := retriever.RetrieveTXT(name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+
+	for _, record := range records {
+		fields := strings.Split(record, ";")
+		if strings.TrimSpace(fields[0]) != PolicyVersion {
+			continue
+		}
+
+		var prefer, signature string
+		for i, field := range fields {
+			key, value := splitPolicyField(field)
+
+			switch key {
+			case "prefer":
+				prefer = value
+			case "sig":
+				if i != len(fields)-1 {
+					return "", PolicyError{Name: name, Reason: "signature must be the last field"}
+				}
+				signature = value
+				fields = fields[:i]
+			}
+		}
+
+		if publicKey != nil {
+			decoded, err := base64.StdEncoding.DecodeString(signature)
+			if signature == "" || err != nil || !ed25519.Verify(publicKey, []byte(canonicalPolicy(fields)), decoded) {
+				return "", PolicyError{Name: name, Reason: "invalid signature"}
+			}
+		}
+
+		return prefer, nil
+	}
+
+	return "", nil
+}
+
+// splitPolicyField returns the key and the value of a policy field.
+func splitPolicyField(field string) (key, value string) {
+	parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+	if len(parts) != 2 {
+		return parts[0], ""
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// hasLabel checks if the server has the label, in the target name or in the
+// metadata.
+func hasLabel(server Server, label string) bool {
+	if server.Metadata[LabelMetadata] == label {
+		return true
+	}
+
+	for _, targetLabel := range strings.Split(strings.TrimSuffix(server.Target, "."), ".") {
+		if strings.EqualFold(targetLabel, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// preferLabel returns only the chooseable servers with the label, or all of
+// them when none has the label.
+func preferLabel(servers []Server, srvs []*net.SRV, label string) []*net.SRV {
+	preferred := chooseable(servers, func(server Server) bool {
+		return hasLabel(server, label)
+	})
+
+	if len(preferred) == 0 {
+		return srvs
+	}
+	return preferred
+}
+
+// balancedServers returns the chooseable servers restricted by the selection
+// policy, that are sent to the load balancer. It must be called with the
+// servers lock.
+func (d *discovery) balancedServers() []*net.SRV {
+	servers := chooseable(d.servers, nil)
+	if d.preferredLabel != "" {
+		servers = preferLabel(d.servers, servers, d.preferredLabel)
+	}
+	return servers
+}
+
+// changeServers sends the balanced servers to the load balancer after any
+// change of the servers. It must be called with the servers write lock.
+func (d *discovery) changeServers() {
+	d.loadBalancerLock.RLock()
+	d.loadBalancer.ChangeServers(d.balancedServers())
+	d.loadBalancerLock.RUnlock()
+}
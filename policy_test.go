@@ -0,0 +1,134 @@
+package dnsdisco_test
+
+import (
+	"crypto/ed25519"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srvs := []*net.SRV{
+		{Target: "server1.blue.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		{Target: "server2.green.example.com.", Port: 2222, Priority: 20, Weight: 10},
+		{Target: "server3.green.example.com.", Port: 3333, Priority: 30, Weight: 10},
+	}
+
+	scenarios := []struct {
+		description    string
+		records        []string
+		publicKey      ed25519.PublicKey
+		unhealthy      []string
+		markUnhealthy  string
+		expectedTarget string
+		expectedErrors []error
+	}{
+		{
+			description:    "it should choose the best server without policy",
+			expectedTarget: "server1.blue.example.com.",
+		},
+		{
+			description:    "it should prefer the servers with the label",
+			records:        []string{"some other record", "v=disco1; prefer=green"},
+			expectedTarget: "server2.green.example.com.",
+		},
+		{
+			description:    "it should fallback when the preferred servers are unhealthy",
+			records:        []string{"v=disco1; prefer=green"},
+			unhealthy:      []string{"server2.green.example.com.", "server3.green.example.com."},
+			expectedTarget: "server1.blue.example.com.",
+		},
+		{
+			description:    "it should keep preferring the label when a server is marked unhealthy",
+			records:        []string{"v=disco1; prefer=green"},
+			markUnhealthy:  "server2.green.example.com.",
+			expectedTarget: "server3.green.example.com.",
+		},
+		{
+			description:    "it should accept a signed policy",
+			records:        []string{dnsdisco.SignPolicy("v=disco1;prefer=green", privateKey)},
+			publicKey:      publicKey,
+			expectedTarget: "server2.green.example.com.",
+		},
+		{
+			description:    "it should ignore a policy without signature",
+			records:        []string{"v=disco1; prefer=green"},
+			publicKey:      publicKey,
+			expectedTarget: "server1.blue.example.com.",
+			expectedErrors: []error{
+				dnsdisco.PolicyError{Name: "_disco-policy.registro.br", Reason: "invalid signature"},
+			},
+		},
+		{
+			description:    "it should ignore a tampered policy",
+			records:        []string{strings.Replace(dnsdisco.SignPolicy("v=disco1; prefer=blue", privateKey), "blue", "green", 1)},
+			publicKey:      publicKey,
+			expectedTarget: "server1.blue.example.com.",
+			expectedErrors: []error{
+				dnsdisco.PolicyError{Name: "_disco-policy.registro.br", Reason: "invalid signature"},
+			},
+		},
+		{
+			description:    "it should reject a public key with the wrong size",
+			records:        []string{dnsdisco.SignPolicy("v=disco1;prefer=green", privateKey)},
+			publicKey:      publicKey[:16],
+			expectedTarget: "server1.blue.example.com.",
+			expectedErrors: []error{
+				dnsdisco.PolicyError{Name: "_disco-policy.registro.br", Reason: "invalid public key"},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return srvs, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				for _, unhealthy := range scenario.unhealthy {
+					if target == unhealthy {
+						return false, nil
+					}
+				}
+				return true, nil
+			}))
+			discovery.(dnsdisco.BalancingConfigurer).SetPolicy(dnsdisco.TXTRetrieverFunc(func(name string) ([]string, error) {
+				if name != "_disco-policy.registro.br" {
+					t.Errorf("unexpected policy name “%s”", name)
+				}
+
+				if scenario.records == nil {
+					return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+				}
+				return scenario.records, nil
+			}), scenario.publicKey)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			if scenario.markUnhealthy != "" {
+				discovery.(dnsdisco.HealthManager).MarkUnhealthy(scenario.markUnhealthy, 2222)
+			}
+
+			if target, _ := discovery.Choose(); target != scenario.expectedTarget {
+				t.Errorf("mismatch targets. Expecting: “%s”; found “%s”", scenario.expectedTarget, target)
+			}
+
+			if errs := discovery.Errors(); !reflect.DeepEqual(errs, scenario.expectedErrors) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedErrors, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,446 @@
+package dnsdisco
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned when a connection is requested from a closed pool.
+var ErrPoolClosed = errors.New("dnsdisco: pool closed")
+
+// PoolConfig defines how the pool keeps the connections, following the same
+// semantics of database/sql.
+type PoolConfig struct {
+	// Network is the network used to connect to the servers. If empty "tcp" is
+	// used.
+	Network string
+
+	// MaxIdlePerTarget is the maximum number of idle connections kept for each
+	// target. If zero 2 connections are kept (database/sql default), and a
+	// negative value disables the idle connections.
+	MaxIdlePerTarget int
+
+	// MaxLifetime is the maximum amount of time a connection may be reused. If
+	// zero the connections are reused forever.
+	MaxLifetime time.Duration
+
+	// MaxIdleTime is the maximum amount of time a connection may be idle. If
+	// zero the connections are kept idle forever.
+	MaxIdleTime time.Duration
+
+	// CheckOnBorrow verifies an idle connection before returning it. When it
+	// fails the connection is closed and another one is used. If nil the idle
+	// connections aren't verified.
+	CheckOnBorrow func(net.Conn) error
+
+	// PortChangeDrain is the time the connections to the previous port of a
+	// target are kept when a refresh changes only its port (see Watch). If
+	// zero they are closed right away, as the connections of any removed
+	// server.
+	PortChangeDrain time.Duration
+}
+
+// PoolStats stores the metrics of the pool.
+type PoolStats struct {
+	// Idle is the number of idle connections.
+	Idle int
+
+	// Dials is the number of new connections.
+	Dials uint64
+
+	// Reused is the number of idle connections returned by Get.
+	Reused uint64
+
+	// MaxIdleClosed is the number of connections closed because of the
+	// MaxIdlePerTarget limit.
+	MaxIdleClosed uint64
+
+	// MaxLifetimeClosed is the number of connections closed because of the
+	// MaxLifetime limit.
+	MaxLifetimeClosed uint64
+
+	// MaxIdleTimeClosed is the number of connections closed because of the
+	// MaxIdleTime limit.
+	MaxIdleTimeClosed uint64
+
+	// CheckFailed is the number of idle connections closed because the
+	// CheckOnBorrow failed.
+	CheckFailed uint64
+
+	// RemovedClosed is the number of connections closed because their server
+	// was removed from the discovery (see Watch).
+	RemovedClosed uint64
+}
+
+// Pool keeps the connections to the servers chosen by the discovery, so they
+// can be reused between requests. It is go routine safe.
+type Pool struct {
+	// discovery chooses the servers.
+	discovery Discovery
+
+	// config defines how the connections are kept.
+	config PoolConfig
+
+	// idle stores the idle connections of each target, the most recently
+	// used at the end.
+	idle map[string][]*PoolConn
+
+	// active stores the connections of each target that are in use.
+	active map[string]map[*PoolConn]bool
+
+	// stats stores the metrics of the pool.
+	stats PoolStats
+
+	// closed is true when the pool was closed.
+	closed bool
+
+	// lock make it safe to use the pool from different go routines.
+	lock sync.Mutex
+}
+
+// NewPool builds a pool of connections to the servers chosen by the
+// discovery.
+func NewPool(discovery Discovery, config PoolConfig) *Pool {
+	if config.Network == "" {
+		config.Network = "tcp"
+	}
+
+	if config.MaxIdlePerTarget == 0 {
+		config.MaxIdlePerTarget = 2
+	}
+
+	return &Pool{
+		discovery: discovery,
+		config:    config,
+		idle:      make(map[string][]*PoolConn),
+		active:    make(map[string]map[*PoolConn]bool),
+	}
+}
+
+// Get chooses the best server and returns an idle connection to it, or a new
+// connection if there's no idle one. The connection must be closed to return
+// to the pool. If there's no server available ErrNoServer is returned.
+func (p *Pool) Get(ctx context.Context) (*PoolConn, error) {
+	target, port := p.discovery.Choose()
+	if target == "" && port == 0 {
+		return nil, ErrNoServer
+	}
+
+	address := JoinHostPort(target, port)
+
+	for {
+		conn, err := p.borrow(address)
+		if err != nil {
+			return nil, err
+		}
+
+		if conn == nil {
+			break
+		}
+
+		if p.config.CheckOnBorrow != nil {
+			if err := p.config.CheckOnBorrow(conn.Conn); err != nil {
+				conn.Conn.Close()
+				p.lock.Lock()
+				p.stats.CheckFailed++
+				p.lock.Unlock()
+				continue
+			}
+		}
+
+		p.lock.Lock()
+		p.stats.Reused++
+		p.activate(conn)
+		p.lock.Unlock()
+		return conn, nil
+	}
+
+	return p.dial(ctx, address)
+}
+
+// WarmUp connects to the server and keeps the connection idle in the pool. It
+// implements the WarmUp interface, so the pool can be filled with the new
+// servers of each refresh.
+func (p *Pool) WarmUp(ctx context.Context, proto string, server Server) error {
+	conn, err := p.dial(ctx, JoinHostPort(server.Target, server.Port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Stats returns the metrics of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	stats := p.stats
+	for _, conns := range p.idle {
+		stats.Idle += len(conns)
+	}
+	return stats
+}
+
+// Close closes all idle connections. The connections in use are closed when
+// they are returned.
+func (p *Pool) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	for address, conns := range p.idle {
+		for _, conn := range conns {
+			conn.Conn.Close()
+		}
+		delete(p.idle, address)
+	}
+	return nil
+}
+
+// borrow returns the most recently used idle connection of the address that
+// didn't expire, or nil if there's none.
+func (p *Pool) borrow(address string) (*PoolConn, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+
+	conns := p.idle[address]
+	for len(conns) > 0 {
+		conn := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		p.idle[address] = conns
+
+		if p.expired(conn) {
+			conn.Conn.Close()
+			continue
+		}
+
+		conn.returned = false
+		return conn, nil
+	}
+
+	return nil, nil
+}
+
+// dial creates a new connection to the address. The dial is also cancelled
+// when the base context of the discovery is done.
+func (p *Pool) dial(ctx context.Context, address string) (*PoolConn, error) {
+	ctx, cancel := mergeContext(ctx, baseContext(p.discovery))
+	defer cancel()
+
+	if err := context.Cause(ctx); err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, p.config.Network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	poolConn := &PoolConn{
+		Conn:    conn,
+		pool:    p,
+		address: address,
+		created: time.Now(),
+	}
+
+	p.lock.Lock()
+	p.stats.Dials++
+	p.activate(poolConn)
+	p.lock.Unlock()
+
+	return poolConn, nil
+}
+
+// put returns the connection to the pool, closing it if the pool is full or
+// the connection expired.
+func (p *Pool) put(conn *PoolConn) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.active[conn.address], conn)
+
+	// the connection may be already closed by the removal of its server
+	if conn.retired {
+		conn.retired = false
+		conn.Conn.Close()
+		return nil
+	}
+
+	if p.closed || conn.unusable {
+		return conn.Conn.Close()
+	}
+
+	if p.config.MaxLifetime > 0 && time.Since(conn.created) > p.config.MaxLifetime {
+		p.stats.MaxLifetimeClosed++
+		return conn.Conn.Close()
+	}
+
+	if len(p.idle[conn.address]) >= p.config.MaxIdlePerTarget {
+		p.stats.MaxIdleClosed++
+		return conn.Conn.Close()
+	}
+
+	conn.idleSince = time.Now()
+	p.idle[conn.address] = append(p.idle[conn.address], conn)
+	return nil
+}
+
+// activate stores the connection as in use. The caller must hold the lock.
+func (p *Pool) activate(conn *PoolConn) {
+	if p.active[conn.address] == nil {
+		p.active[conn.address] = make(map[*PoolConn]bool)
+	}
+	p.active[conn.address][conn] = true
+}
+
+// Watch keeps the pool in sync with the servers of the discovery, consuming
+// the events until the channel is closed (e.g. go
+// pool.Watch(discovery.Events())). The connections of a removed server are
+// closed right away, including the ones in use. When only the port of a
+// target changes (EventServerPortChanged) and PortChangeDrain is defined, the
+// connections to the previous port are drained instead: the ones in use keep
+// working until they are returned or the drain time expires.
+func (p *Pool) Watch(events <-chan Event) {
+	draining := make(map[string]bool)
+
+	for event := range events {
+		switch event.Type {
+		case EventServerPortChanged:
+			if p.config.PortChangeDrain <= 0 {
+				continue
+			}
+
+			address := JoinHostPort(event.Server.Target, event.PreviousPort)
+			draining[address] = true
+			conns := p.retire(address, false)
+
+			time.AfterFunc(p.config.PortChangeDrain, func() {
+				p.closeActive(conns)
+			})
+
+		case EventServerRemoved:
+			address := JoinHostPort(event.Server.Target, event.Server.Port)
+			if draining[address] {
+				delete(draining, address)
+				continue
+			}
+			p.retire(address, true)
+		}
+	}
+}
+
+// retire closes the idle connections of the address and flags the ones in
+// use, so they are closed when returned. Optionally the connections in use
+// are also closed right away. The flagged connections in use are returned.
+func (p *Pool) retire(address string, closeActive bool) []*PoolConn {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, conn := range p.idle[address] {
+		conn.Conn.Close()
+		p.stats.RemovedClosed++
+	}
+	delete(p.idle, address)
+
+	var conns []*PoolConn
+	for conn := range p.active[address] {
+		conn.retired = true
+		conns = append(conns, conn)
+
+		if closeActive {
+			conn.Conn.Close()
+			p.stats.RemovedClosed++
+		}
+	}
+	delete(p.active, address)
+
+	return conns
+}
+
+// closeActive closes the retired connections that are still in use, when the
+// drain time expires.
+func (p *Pool) closeActive(conns []*PoolConn) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, conn := range conns {
+		// the returned connections were already closed
+		if conn.retired {
+			conn.retired = false
+			conn.Conn.Close()
+			p.stats.RemovedClosed++
+		}
+	}
+}
+
+// expired checks if the idle connection reached the lifetime or the idle time
+// limits, updating the metrics. The caller must hold the lock.
+func (p *Pool) expired(conn *PoolConn) bool {
+	if p.config.MaxLifetime > 0 && time.Since(conn.created) > p.config.MaxLifetime {
+		p.stats.MaxLifetimeClosed++
+		return true
+	}
+
+	if p.config.MaxIdleTime > 0 && time.Since(conn.idleSince) > p.config.MaxIdleTime {
+		p.stats.MaxIdleTimeClosed++
+		return true
+	}
+
+	return false
+}
+
+// PoolConn is a connection of the pool. Closing it returns the connection to
+// the pool.
+type PoolConn struct {
+	net.Conn
+
+	// pool is where the connection returns when closed.
+	pool *Pool
+
+	// address is the target and port of the connection.
+	address string
+
+	// created is the moment the connection was established.
+	created time.Time
+
+	// idleSince is the moment the connection returned to the pool.
+	idleSince time.Time
+
+	// unusable is true when the connection must be closed instead of returned
+	// to the pool.
+	unusable bool
+
+	// retired is true when the server of the connection was removed from the
+	// discovery, so it must be closed when returned. It is protected by the
+	// pool lock.
+	retired bool
+
+	// returned is true when the connection was already returned to the pool.
+	returned bool
+}
+
+// Close returns the connection to the pool, or closes it if it can't be
+// reused. Calling Close more than once has no effect.
+func (c *PoolConn) Close() error {
+	if c.returned {
+		return nil
+	}
+	c.returned = true
+	return c.pool.put(c)
+}
+
+// MarkUnusable closes the connection when it is returned, instead of keeping
+// it in the pool. It should be called when the connection is in an unknown
+// state (e.g. after a network error), like driver.ErrBadConn in
+// database/sql.
+func (c *PoolConn) MarkUnusable() {
+	c.unusable = true
+}
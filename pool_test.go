@@ -0,0 +1,251 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				break
+			}
+			conns = append(conns, conn)
+		}
+
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.ParseUint(portStr, 10, 16)
+
+	scenarios := []struct {
+		description   string
+		config        dnsdisco.PoolConfig
+		simultaneous  int
+		rounds        int
+		pause         time.Duration
+		expectedStats dnsdisco.PoolStats
+	}{
+		{
+			description:  "it should reuse the idle connections",
+			simultaneous: 1,
+			rounds:       2,
+			expectedStats: dnsdisco.PoolStats{
+				Idle:   1,
+				Dials:  1,
+				Reused: 1,
+			},
+		},
+		{
+			description:  "it should limit the idle connections",
+			simultaneous: 3,
+			rounds:       1,
+			expectedStats: dnsdisco.PoolStats{
+				Idle:          2,
+				Dials:         3,
+				MaxIdleClosed: 1,
+			},
+		},
+		{
+			description: "it should limit the connection lifetime",
+			config: dnsdisco.PoolConfig{
+				MaxLifetime: 10 * time.Millisecond,
+			},
+			simultaneous: 1,
+			rounds:       2,
+			pause:        20 * time.Millisecond,
+			expectedStats: dnsdisco.PoolStats{
+				Dials:             2,
+				MaxLifetimeClosed: 2,
+			},
+		},
+		{
+			description: "it should limit the idle time",
+			config: dnsdisco.PoolConfig{
+				MaxIdleTime: 10 * time.Millisecond,
+			},
+			simultaneous: 1,
+			rounds:       2,
+			pause:        20 * time.Millisecond,
+			expectedStats: dnsdisco.PoolStats{
+				Idle:              1,
+				Dials:             2,
+				MaxIdleTimeClosed: 1,
+			},
+		},
+		{
+			description: "it should check the connection on borrow",
+			config: dnsdisco.PoolConfig{
+				CheckOnBorrow: func(net.Conn) error {
+					return errors.New("connection closed")
+				},
+			},
+			simultaneous: 1,
+			rounds:       2,
+			expectedStats: dnsdisco.PoolStats{
+				Idle:        1,
+				Dials:       2,
+				CheckFailed: 1,
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{{Target: "127.0.0.1", Port: uint16(port)}}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return true, nil
+			}))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			pool := dnsdisco.NewPool(discovery, scenario.config)
+			defer pool.Close()
+
+			for i := 0; i < scenario.rounds; i++ {
+				var conns []*dnsdisco.PoolConn
+				for j := 0; j < scenario.simultaneous; j++ {
+					conn, err := pool.Get(context.Background())
+					if err != nil {
+						t.Fatalf("unexpected error “%v”", err)
+					}
+					conns = append(conns, conn)
+				}
+
+				time.Sleep(scenario.pause)
+
+				for _, conn := range conns {
+					conn.Close()
+				}
+
+				time.Sleep(scenario.pause)
+			}
+
+			if stats := pool.Stats(); stats != scenario.expectedStats {
+				t.Errorf("mismatch stats. Expecting: “%#v”; found “%#v”", scenario.expectedStats, stats)
+			}
+		})
+	}
+}
+
+func TestPoolWatch(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description string
+		drain       time.Duration
+	}{
+		{
+			description: "it should close the connections of the previous port right away",
+		},
+		{
+			description: "it should drain the connections of the previous port",
+			drain:       200 * time.Millisecond,
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			var ports []uint16
+			for i := 0; i < 2; i++ {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer listener.Close()
+
+				go func() {
+					for {
+						conn, err := listener.Accept()
+						if err != nil {
+							return
+						}
+						defer conn.Close()
+					}
+				}()
+
+				ports = append(ports, uint16(listener.Addr().(*net.TCPAddr).Port))
+			}
+
+			port := ports[0]
+
+			discovery := dnsdisco.NewDiscovery("service", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "127.0.0.1", Port: port, Priority: 10, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			pool := dnsdisco.NewPool(discovery, dnsdisco.PoolConfig{PortChangeDrain: item.drain})
+			defer pool.Close()
+
+			events := discovery.(dnsdisco.EventSource).Events()
+			go pool.Watch(events)
+			defer discovery.(dnsdisco.EventSource).CloseEvents(events)
+
+			conn, err := pool.Get(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer conn.Close()
+
+			port = ports[1]
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if item.drain > 0 {
+				time.Sleep(item.drain / 4)
+
+				if _, err := conn.Write([]byte("ping")); err != nil {
+					t.Errorf("connection closed while draining: %s", err)
+				}
+			}
+
+			deadline := time.Now().Add(time.Second + item.drain)
+			for pool.Stats().RemovedClosed == 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if _, err := conn.Write([]byte("ping")); err == nil {
+				t.Error("connection to the previous port wasn't closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package dnsdisco
+
+import (
+	"net/http"
+	"time"
+)
+
+// defaultProbeIntervals is the number of asynchronous refresh intervals
+// without a successful refresh that makes the discovery not ready, when the
+// maximum age isn't defined.
+const defaultProbeIntervals = 3
+
+// ProbeThresholds defines when the discovery is considered ready or alive by
+// the Kubernetes probes (see Healthy, Alive, ReadinessHandler and
+// LivenessHandler).
+type ProbeThresholds struct {
+	// MaxRefreshAge is the maximum time since the last successful refresh, for
+	// the readiness, and since the last refresh attempt, for the liveness. If
+	// zero 3 intervals of the asynchronous refresh are used, and without the
+	// asynchronous refresh the age isn't checked.
+	MaxRefreshAge time.Duration
+
+	// MinHealthy is the minimum number of healthy servers for the readiness.
+	// If zero 1 is used.
+	MinHealthy int
+}
+
+// SetProbeThresholds defines when the discovery is considered ready or alive
+// by the Kubernetes probes. It is go routine safe.
+func (d *discovery) SetProbeThresholds(thresholds ProbeThresholds) {
+	d.refreshStateLock.Lock()
+	defer d.refreshStateLock.Unlock()
+	d.probeThresholds = thresholds
+}
+
+// Healthy checks if the discovery is ready to be used: the last successful
+// refresh is recent and there are enough healthy servers, according to the
+// thresholds (see SetProbeThresholds). It is go routine safe.
+func (d *discovery) Healthy() bool {
+	now := d.currentClock().Now()
+
+	d.refreshStateLock.Lock()
+	thresholds, lastSuccess := d.probeThresholds, d.lastSuccessfulRefresh
+	maxAge := d.probeMaxAge()
+	d.refreshStateLock.Unlock()
+
+	if lastSuccess.IsZero() || (maxAge > 0 && now.Sub(lastSuccess) > maxAge) {
+		return false
+	}
+
+	minHealthy := thresholds.MinHealthy
+	if minHealthy <= 0 {
+		minHealthy = 1
+	}
+
+	var healthy int
+	for _, server := range d.Servers() {
+		if server.Healthy {
+			healthy++
+		}
+	}
+	return healthy >= minHealthy
+}
+
+// Alive checks if the asynchronous refresh is still running: the last refresh
+// attempt, successful or not, is recent according to the thresholds (see
+// SetProbeThresholds). Without the asynchronous refresh the discovery is
+// always alive. It is go routine safe.
+func (d *discovery) Alive() bool {
+	now := d.currentClock().Now()
+
+	d.refreshStateLock.Lock()
+	defer d.refreshStateLock.Unlock()
+
+	maxAge := d.probeMaxAge()
+	if d.refreshInterval <= 0 || maxAge <= 0 || d.lastRefresh.IsZero() {
+		return true
+	}
+	return now.Sub(d.lastRefresh) <= maxAge
+}
+
+// probeMaxAge returns the maximum age of the refreshes for the probes. The
+// caller must hold the refresh state lock.
+func (d *discovery) probeMaxAge() time.Duration {
+	if d.probeThresholds.MaxRefreshAge > 0 {
+		return d.probeThresholds.MaxRefreshAge
+	}
+	return defaultProbeIntervals * d.refreshInterval
+}
+
+// ReadinessHandler returns an http.Handler for Kubernetes readiness probes,
+// that answers 200 (OK) when the discovery is ready to be used (see Healthy),
+// and 503 (Service Unavailable) otherwise. A discovery that doesn't implement
+// the Prober interface is never ready.
+func ReadinessHandler(discovery Discovery) http.Handler {
+	prober, ok := discovery.(Prober)
+	if !ok {
+		return probeHandler(func() bool { return false })
+	}
+	return probeHandler(prober.Healthy)
+}
+
+// LivenessHandler returns an http.Handler for Kubernetes liveness probes, that
+// answers 200 (OK) when the asynchronous refresh is still running (see
+// Alive), and 503 (Service Unavailable) otherwise. A discovery that doesn't
+// implement the Prober interface is never alive.
+func LivenessHandler(discovery Discovery) http.Handler {
+	prober, ok := discovery.(Prober)
+	if !ok {
+		return probeHandler(func() bool { return false })
+	}
+	return probeHandler(prober.Alive)
+}
+
+// probeHandler answers the probes with the result of the check.
+func probeHandler(check func() bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !check() {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok\n"))
+	})
+}
@@ -0,0 +1,152 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description    string
+		healthy        []bool
+		retrieveErr    error
+		refresh        bool
+		thresholds     dnsdisco.ProbeThresholds
+		wait           time.Duration
+		method         string
+		expectedStatus int
+	}{
+		{
+			description:    "it should be ready with a healthy server",
+			healthy:        []bool{true, false},
+			refresh:        true,
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "it should not be ready before the first refresh",
+			healthy:        []bool{true, true},
+			method:         http.MethodGet,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			description:    "it should not be ready when the refresh fails",
+			healthy:        []bool{true, true},
+			retrieveErr:    errors.New("timeout"),
+			refresh:        true,
+			method:         http.MethodGet,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			description:    "it should not be ready without enough healthy servers",
+			healthy:        []bool{true, false},
+			refresh:        true,
+			thresholds:     dnsdisco.ProbeThresholds{MinHealthy: 2},
+			method:         http.MethodHead,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			description:    "it should not be ready when the last refresh is old",
+			healthy:        []bool{true, true},
+			refresh:        true,
+			thresholds:     dnsdisco.ProbeThresholds{MaxRefreshAge: 10 * time.Millisecond},
+			wait:           50 * time.Millisecond,
+			method:         http.MethodGet,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			description:    "it should refuse other methods",
+			healthy:        []bool{true, true},
+			refresh:        true,
+			method:         http.MethodPost,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+					{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+				}, item.retrieveErr
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return item.healthy[port/1111-1], nil
+			}))
+			discovery.(dnsdisco.Prober).SetProbeThresholds(item.thresholds)
+
+			if item.refresh {
+				discovery.Refresh()
+			}
+			time.Sleep(item.wait)
+
+			w := httptest.NewRecorder()
+			dnsdisco.ReadinessHandler(discovery).ServeHTTP(w, httptest.NewRequest(item.method, "/ready", nil))
+
+			if w.Code != item.expectedStatus {
+				t.Errorf("mismatch status. Expecting: “%d”; found “%d”", item.expectedStatus, w.Code)
+			}
+
+			if healthy := item.expectedStatus == http.StatusOK; item.method != http.MethodPost && discovery.(dnsdisco.Prober).Healthy() != healthy {
+				t.Errorf("mismatch healthy. Expecting: “%t”; found “%t”", healthy, !healthy)
+			}
+		})
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		// the refreshes get stuck after some failures
+		if atomic.AddInt32(&calls, 1) > 2 {
+			<-stuck
+		}
+		return nil, errors.New("timeout")
+	}))
+	discovery.(dnsdisco.Prober).SetProbeThresholds(dnsdisco.ProbeThresholds{MaxRefreshAge: 100 * time.Millisecond})
+
+	handler := dnsdisco.LivenessHandler(discovery)
+	check := func(expectedStatus int) {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/live", nil))
+		if w.Code != expectedStatus {
+			t.Errorf("mismatch status. Expecting: “%d”; found “%d”", expectedStatus, w.Code)
+		}
+	}
+
+	// without the asynchronous refresh the discovery is always alive
+	check(http.StatusOK)
+
+	finish := discovery.RefreshAsync(20 * time.Millisecond)
+	defer close(finish)
+	time.Sleep(30 * time.Millisecond)
+
+	// the failed refreshes still keep the discovery alive
+	check(http.StatusOK)
+
+	time.Sleep(200 * time.Millisecond)
+	check(http.StatusServiceUnavailable)
+}
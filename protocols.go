@@ -0,0 +1,266 @@
+package dnsdisco
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// protocolHealthCheckTimeout limits the protocol health checks when no
+// timeout is defined.
+const protocolHealthCheckTimeout = 5 * time.Second
+
+// httpHealthCheckIdleTimeout closes the idle connections of the authenticated
+// HTTP health checks, so the connections of removed servers aren't kept.
+const httpHealthCheckIdleTimeout = 90 * time.Second
+
+// ErrUnexpectedProtocol is returned by the protocol health checkers when the
+// server answers something that isn't part of the expected protocol.
+var ErrUnexpectedProtocol = errors.New("dnsdisco: unexpected protocol response")
+
+// NewHTTPHealthChecker returns a health checker that sends a GET request to
+// the path of the server. The server is healthy when it answers with a 2xx or
+// 3xx status code (redirects aren't followed). The timeout limits the whole
+// check (5 seconds when zero). Only the tcp proto is supported.
+func NewHTTPHealthChecker(path string, timeout time.Duration) HealthChecker {
+	client := httpHealthCheckClient(timeout, nil)
+	path = httpHealthCheckPath(path)
+
+	return HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		if proto != "tcp" {
+			return false, net.UnknownNetworkError(proto)
+		}
+
+		if err := httpHealthCheck(context.Background(), client, "http://"+JoinHostPort(strings.TrimSuffix(target, "."), port)+path, ""); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+}
+
+// NewAuthenticatedHTTPHealthChecker works like NewHTTPHealthChecker, for
+// health check endpoints behind authentication. The credentials of each server
+// are loaded from the provider (see NewStaticCredentialsProvider,
+// NewEnvCredentialsProvider and CredentialsProviderFunc): the token is sent as
+// a bearer token, or the username and password with the basic
+// authentication, and the request uses HTTPS with the TLS configuration when
+// it is defined. The secrets are redacted from the returned errors, so they
+// aren't exposed in the logs and events.
+func NewAuthenticatedHTTPHealthChecker(path string, timeout time.Duration, provider CredentialsProvider) ServerHealthChecker {
+	client := httpHealthCheckClient(timeout, nil)
+	path = httpHealthCheckPath(path)
+
+	// a single client is shared by all the servers, the TLS configuration of
+	// each request is carried by its context to the TLS dialer
+	tlsClient := httpHealthCheckClient(timeout, &http.Transport{
+		DialTLSContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			tlsConfig, _ := ctx.Value(tlsConfigKey{}).(*tls.Config)
+			dialer := tls.Dialer{Config: tlsConfig}
+			return dialer.DialContext(ctx, network, address)
+		},
+		IdleConnTimeout: httpHealthCheckIdleTimeout,
+	})
+
+	return ServerHealthCheckerFunc(func(ctx context.Context, server Server) (HealthStatus, error) {
+		credentials, err := provider.Credentials(ctx, server)
+		if err != nil {
+			return HealthStatusUnhealthy, err
+		}
+
+		scheme, checkClient := "http://", client
+		if credentials.TLSConfig != nil {
+			scheme, checkClient = "https://", tlsClient
+			ctx = context.WithValue(ctx, tlsConfigKey{}, credentials.TLSConfig)
+		}
+
+		url := scheme + JoinHostPort(strings.TrimSuffix(server.Target, "."), server.Port) + path
+		if err := httpHealthCheck(ctx, checkClient, url, credentials.authorization()); err != nil {
+			return HealthStatusUnhealthy, credentials.RedactError(err)
+		}
+		return HealthStatusHealthy, nil
+	})
+}
+
+// tlsConfigKey stores the TLS configuration of the authenticated HTTP health
+// check in the context of the request.
+type tlsConfigKey struct{}
+
+// httpHealthCheckClient builds the client of the HTTP health checks, that
+// doesn't follow redirects. The timeout limits the whole check (5 seconds when
+// zero). When the transport is nil the default one is used.
+func httpHealthCheckClient(timeout time.Duration, transport http.RoundTripper) *http.Client {
+	if timeout == 0 {
+		timeout = protocolHealthCheckTimeout
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// httpHealthCheckPath makes sure that the path of the health check is
+// absolute.
+func httpHealthCheckPath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// httpHealthCheck sends the GET request with the Authorization header, if
+// any, expecting a 2xx or 3xx status code.
+func httpHealthCheck(ctx context.Context, client *http.Client, url, authorization string) error {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 400 {
+		return fmt.Errorf("dnsdisco: unexpected HTTP status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// NewXMPPHealthChecker returns a health checker that opens an XMPP stream with
+// the server, using the namespace "jabber:client" or "jabber:server". The
+// server is healthy when it answers with its own stream header, even if it
+// doesn't serve the target domain, as it is able to process the protocol. The
+// timeout limits the whole check (5 seconds when zero). Only the tcp proto is
+// supported.
+func NewXMPPHealthChecker(namespace string, timeout time.Duration) HealthChecker {
+	return protocolHealthChecker(timeout, func(conn net.Conn, target string) error {
+		header := fmt.Sprintf("<?xml version='1.0'?><stream:stream to='%s' xmlns='%s' "+
+			"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>",
+			strings.TrimSuffix(target, "."), namespace)
+
+		if _, err := conn.Write([]byte(header)); err != nil {
+			return err
+		}
+
+		var response []byte
+		buffer := make([]byte, 512)
+		for len(response) < 4096 {
+			n, err := conn.Read(buffer)
+			response = append(response, buffer[:n]...)
+			if strings.Contains(string(response), "<stream:stream") {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return ErrUnexpectedProtocol
+	})
+}
+
+// NewSIPHealthChecker returns a health checker that sends an OPTIONS request
+// (ping) to the server. The server is healthy when it answers with any SIP
+// response, except 503 (Service Unavailable), as most servers reject the
+// OPTIONS requests of unknown clients. The timeout limits the whole check (5
+// seconds when zero). The tcp and udp protos are supported.
+func NewSIPHealthChecker(timeout time.Duration) HealthChecker {
+	return protocolHealthChecker(timeout, func(conn net.Conn, target string) error {
+		host := strings.TrimSuffix(target, ".")
+		local := conn.LocalAddr().String()
+		transport := strings.ToUpper(conn.LocalAddr().Network())
+
+		request := "OPTIONS sip:" + host + " SIP/2.0\r\n" +
+			"Via: SIP/2.0/" + transport + " " + local + ";branch=z9hG4bK" + strconv.FormatInt(time.Now().UnixNano(), 36) + "\r\n" +
+			"Max-Forwards: 70\r\n" +
+			"From: <sip:dnsdisco@" + local + ">;tag=dnsdisco\r\n" +
+			"To: <sip:" + host + ">\r\n" +
+			"Call-ID: " + strconv.FormatInt(time.Now().UnixNano(), 36) + "@dnsdisco\r\n" +
+			"CSeq: 1 OPTIONS\r\n" +
+			"Content-Length: 0\r\n\r\n"
+
+		if _, err := conn.Write([]byte(request)); err != nil {
+			return err
+		}
+
+		status, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		fields := strings.Fields(status)
+		if len(fields) < 2 || fields[0] != "SIP/2.0" {
+			return ErrUnexpectedProtocol
+		}
+
+		if fields[1] == "503" {
+			return fmt.Errorf("dnsdisco: SIP server unavailable: %s", strings.TrimSpace(status))
+		}
+		return nil
+	})
+}
+
+// protocolHealthChecker connects to the server and runs the protocol check,
+// limiting the whole check with the timeout.
+func protocolHealthChecker(timeout time.Duration, check func(conn net.Conn, target string) error) HealthChecker {
+	if timeout == 0 {
+		timeout = protocolHealthCheckTimeout
+	}
+
+	return HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		if proto != "tcp" && proto != "udp" {
+			return false, net.UnknownNetworkError(proto)
+		}
+
+		conn, err := net.DialTimeout(proto, JoinHostPort(target, port), timeout)
+		if err != nil {
+			return false, err
+		}
+		defer conn.Close()
+
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return false, err
+		}
+
+		if err := check(conn, target); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+}
+
+// SetProtocolHealthCheck defines if the health checker chosen automatically
+// for the service (see RegisterServiceDefaults), e.g. an HTTP request for the
+// http service, is used. When disabled the plain connection check is used
+// instead. It doesn't affect the health checkers defined by the library user.
+// By default it is enabled. It is go routine safe.
+func (d *discovery) SetProtocolHealthCheck(enabled bool) {
+	d.healthCheckerLock.Lock()
+	defer d.healthCheckerLock.Unlock()
+
+	if !d.automaticHealthChecker {
+		return
+	}
+
+	if enabled {
+		d.healthChecker = serviceHealthChecker(d.service, d.proto)
+	} else {
+		d.healthChecker = AdaptHealthChecker(configuredHealthChecker(), d.proto)
+	}
+}
@@ -0,0 +1,323 @@
+package dnsdisco_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestNewHTTPHealthChecker(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description string
+		status      int
+		expectedOK  bool
+	}{
+		{
+			description: "it should accept a successful response",
+			status:      http.StatusOK,
+			expectedOK:  true,
+		},
+		{
+			description: "it should accept a redirect",
+			status:      http.StatusFound,
+			expectedOK:  true,
+		},
+		{
+			description: "it should reject a server error",
+			status:      http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/health" {
+					t.Errorf("mismatch path. Expecting: “/health”; found “%s”", r.URL.Path)
+				}
+				if scenario.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(scenario.status)
+			}))
+			defer server.Close()
+
+			target, port := splitAddress(t, server.Listener.Addr())
+			ok, err := dnsdisco.NewHTTPHealthChecker("health", time.Second).HealthCheck(target, port, "tcp")
+			if ok != scenario.expectedOK {
+				t.Errorf("mismatch health check result. Expecting: “%t”; found “%t” (%v)", scenario.expectedOK, ok, err)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticatedHTTPHealthChecker(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description    string
+		tls            bool
+		credentials    dnsdisco.Credentials
+		expectedStatus dnsdisco.HealthStatus
+	}{
+		{
+			description:    "it should send the bearer token",
+			credentials:    dnsdisco.Credentials{Token: "s3cr3t"},
+			expectedStatus: dnsdisco.HealthStatusHealthy,
+		},
+		{
+			description:    "it should send the basic authentication",
+			credentials:    dnsdisco.Credentials{Username: "monitor", Password: "s3cr3t"},
+			expectedStatus: dnsdisco.HealthStatusHealthy,
+		},
+		{
+			description:    "it should use HTTPS with the TLS configuration",
+			tls:            true,
+			credentials:    dnsdisco.Credentials{Token: "s3cr3t"},
+			expectedStatus: dnsdisco.HealthStatusHealthy,
+		},
+		{
+			description:    "it should reject refused credentials",
+			credentials:    dnsdisco.Credentials{Token: "wrong"},
+			expectedStatus: dnsdisco.HealthStatusUnhealthy,
+		},
+		{
+			description:    "it should reject missing credentials",
+			expectedStatus: dnsdisco.HealthStatusUnhealthy,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				username, password, _ := r.BasicAuth()
+				if r.Header.Get("Authorization") != "Bearer s3cr3t" && (username != "monitor" || password != "s3cr3t") {
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			})
+
+			server := httptest.NewUnstartedServer(handler)
+			if scenario.tls {
+				server.StartTLS()
+				scenario.credentials.TLSConfig = &tls.Config{RootCAs: x509.NewCertPool()}
+				scenario.credentials.TLSConfig.RootCAs.AddCert(server.Certificate())
+			} else {
+				server.Start()
+			}
+			defer server.Close()
+
+			target, port := splitAddress(t, server.Listener.Addr())
+			healthChecker := dnsdisco.NewAuthenticatedHTTPHealthChecker("health", time.Second,
+				dnsdisco.NewStaticCredentialsProvider(scenario.credentials))
+
+			status, err := healthChecker.HealthCheck(context.Background(), dnsdisco.Server{
+				SRV: net.SRV{Target: target, Port: port},
+			})
+			if status != scenario.expectedStatus {
+				t.Errorf("mismatch health check result. Expecting: “%s”; found “%s” (%v)", scenario.expectedStatus, status, err)
+			}
+		})
+	}
+}
+
+func TestNewXMPPHealthChecker(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description string
+		response    string
+		expectedOK  bool
+	}{
+		{
+			description: "it should accept a stream header",
+			response: "<?xml version='1.0'?><stream:stream from='example.com' " +
+				"xmlns='jabber:server' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>",
+			expectedOK: true,
+		},
+		{
+			description: "it should reject other protocols",
+			response:    "SSH-2.0-OpenSSH_7.4\r\n",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("error listening: %s", err)
+			}
+			defer listener.Close()
+
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				header := make([]byte, 512)
+				n, _ := conn.Read(header)
+				if !strings.Contains(string(header[:n]), "jabber:server") {
+					t.Errorf("mismatch stream namespace. Found “%s”", header[:n])
+				}
+				conn.Write([]byte(scenario.response))
+			}()
+
+			target, port := splitAddress(t, listener.Addr())
+			ok, err := dnsdisco.NewXMPPHealthChecker("jabber:server", time.Second).HealthCheck(target, port, "tcp")
+			if ok != scenario.expectedOK {
+				t.Errorf("mismatch health check result. Expecting: “%t”; found “%t” (%v)", scenario.expectedOK, ok, err)
+			}
+		})
+	}
+}
+
+func TestNewSIPHealthChecker(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description string
+		response    string
+		expectedOK  bool
+	}{
+		{
+			description: "it should accept a successful response",
+			response:    "SIP/2.0 200 OK\r\n\r\n",
+			expectedOK:  true,
+		},
+		{
+			description: "it should accept a rejected request",
+			response:    "SIP/2.0 403 Forbidden\r\n\r\n",
+			expectedOK:  true,
+		},
+		{
+			description: "it should reject an unavailable server",
+			response:    "SIP/2.0 503 Service Unavailable\r\n\r\n",
+		},
+		{
+			description: "it should reject other protocols",
+			response:    "HTTP/1.1 400 Bad Request\r\n\r\n",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("error listening: %s", err)
+			}
+			defer conn.Close()
+
+			go func() {
+				request := make([]byte, 2048)
+				n, addr, err := conn.ReadFrom(request)
+				if err != nil {
+					return
+				}
+
+				line, _ := bufio.NewReader(strings.NewReader(string(request[:n]))).ReadString('\n')
+				if !strings.HasPrefix(line, "OPTIONS sip:") {
+					t.Errorf("mismatch request. Found “%s”", line)
+				}
+				conn.WriteTo([]byte(scenario.response), addr)
+			}()
+
+			target, port := splitAddress(t, conn.LocalAddr())
+			ok, err := dnsdisco.NewSIPHealthChecker(time.Second).HealthCheck(target, port, "udp")
+			if ok != scenario.expectedOK {
+				t.Errorf("mismatch health check result. Expecting: “%t”; found “%t” (%v)", scenario.expectedOK, ok, err)
+			}
+		})
+	}
+}
+
+func TestSetProtocolHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description     string
+		enabled         bool
+		expectedHealthy bool
+	}{
+		{
+			description: "it should check the servers with the protocol",
+			enabled:     true,
+		},
+		{
+			description:     "it should check the servers with a plain connection",
+			enabled:         false,
+			expectedHealthy: true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			// the server accepts connections but answers with an HTTP error, so
+			// only the protocol health check detects the problem
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+
+			target, port := splitAddress(t, server.Listener.Addr())
+
+			discovery := dnsdisco.NewDiscovery("http", "tcp", "example.com")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: target, Port: port, Priority: 10, Weight: 10},
+				}, nil
+			}))
+			discovery.(dnsdisco.HealthManager).SetProtocolHealthCheck(scenario.enabled)
+			discovery.Refresh()
+
+			servers := discovery.(dnsdisco.Inspector).Servers()
+			if len(servers) != 1 {
+				t.Fatalf("mismatch number of servers. Expecting: “1”; found “%d”", len(servers))
+			}
+
+			if servers[0].Healthy != scenario.expectedHealthy {
+				t.Errorf("mismatch health. Expecting: “%t”; found “%t”", scenario.expectedHealthy, servers[0].Healthy)
+			}
+		})
+	}
+}
+
+// splitAddress converts the listener address into the SRV target and port.
+func splitAddress(t *testing.T, addr net.Addr) (string, uint16) {
+	host, portText, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		t.Fatalf("error splitting address: %s", err)
+	}
+
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		t.Fatalf("error parsing port: %s", err)
+	}
+	return host + ".", uint16(port)
+}
@@ -0,0 +1,96 @@
+package dnsdisco
+
+import (
+	"fmt"
+	"net"
+)
+
+// ProtoMismatchError is returned by Refresh when the service has no SRV
+// records with the proto of the discovery, but has records with another proto
+// (e.g. "_sip._udp" instead of "_sip._tcp"), what usually is a typo in the
+// proto. It is only detected when enabled with SetProtoMismatchDetection.
+type ProtoMismatchError struct {
+	// Service is the service of the discovery.
+	Service string
+
+	// Proto is the proto of the discovery, without SRV records.
+	Proto string
+
+	// Name is the domain of the discovery.
+	Name string
+
+	// Alternative is the proto with SRV records.
+	Alternative string
+
+	// Records is the number of SRV records found with the alternative proto.
+	Records int
+
+	// Err is the retrieval error with the proto of the discovery, if any.
+	Err error
+}
+
+// Error returns the description of the mismatch, with the hint of the
+// alternative proto.
+func (p ProtoMismatchError) Error() string {
+	return fmt.Sprintf("dnsdisco: no SRV records for _%s._%s.%s, but _%s._%s.%s has %d record(s); check the proto",
+		p.Service, p.Proto, p.Name, p.Service, p.Alternative, p.Name, p.Records)
+}
+
+// Unwrap returns the retrieval error.
+func (p ProtoMismatchError) Unwrap() error {
+	return p.Err
+}
+
+// SetProtoMismatchDetection checks the other protos ("tcp" and "udp") when the
+// service has no SRV records with the proto of the discovery, so a typo in the
+// proto is reported as a ProtoMismatchError instead of a generic lookup
+// error. It costs an extra DNS request for each failed retrieval, so it is
+// disabled by default. It is go routine safe.
+func (d *discovery) SetProtoMismatchDetection(enabled bool) {
+	d.protoMismatchLock.Lock()
+	defer d.protoMismatchLock.Unlock()
+	d.protoMismatch = enabled
+}
+
+// detectProtoMismatch looks for SRV records of the service with the other
+// protos, returning a ProtoMismatchError when they are found. The retrieval
+// error (if any) is returned when the detection is disabled or there's no
+// alternative proto.
+func (d *discovery) detectProtoMismatch(retriever Retriever, name string, err error) error {
+	d.protoMismatchLock.RLock()
+	enabled := d.protoMismatch
+	d.protoMismatchLock.RUnlock()
+
+	if !enabled {
+		return err
+	}
+
+	for _, alternative := range []string{"tcp", "udp"} {
+		if alternative == d.proto {
+			continue
+		}
+
+		srvs, alternativeErr := d.retrieveProto(retriever, alternative, name)
+		if alternativeErr != nil || len(srvs) == 0 {
+			continue
+		}
+
+		return ProtoMismatchError{
+			Service:     d.service,
+			Proto:       d.proto,
+			Name:        name,
+			Alternative: alternative,
+			Records:     len(srvs),
+			Err:         err,
+		}
+	}
+
+	return err
+}
+
+// retrieveProto retrieves the servers of the service with another proto,
+// recovering the retriever panics according to the policy.
+func (d *discovery) retrieveProto(retriever Retriever, proto, name string) (srvs []*net.SRV, err error) {
+	defer d.recoverPanic("retriever", &err)
+	return retriever.Retrieve(d.service, proto, name)
+}
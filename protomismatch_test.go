@@ -0,0 +1,92 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetProtoMismatchDetection(t *testing.T) {
+	t.Parallel()
+
+	retriever := dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		if proto != "udp" {
+			return nil, &net.DNSError{Err: "no such host", Name: "_" + service + "._" + proto + "." + name, IsNotFound: true}
+		}
+
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 5060, Priority: 10, Weight: 10},
+		}, nil
+	})
+
+	scenarios := []struct {
+		description         string
+		proto               string
+		detection           bool
+		expectedMismatch    bool
+		expectedAlternative string
+		expectedError       bool
+	}{
+		{
+			description:         "it should detect the records with another proto",
+			proto:               "tcp",
+			detection:           true,
+			expectedMismatch:    true,
+			expectedAlternative: "udp",
+			expectedError:       true,
+		},
+		{
+			description:         "it should detect a typo in the proto",
+			proto:               "xxx",
+			detection:           true,
+			expectedMismatch:    true,
+			expectedAlternative: "udp",
+			expectedError:       true,
+		},
+		{
+			description:   "it should not detect when disabled",
+			proto:         "tcp",
+			expectedError: true,
+		},
+		{
+			description: "it should not detect when the proto has records",
+			proto:       "udp",
+			detection:   true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("sip", scenario.proto, "example.com")
+			discovery.SetRetriever(retriever)
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+			discovery.(dnsdisco.RecordConfigurer).SetProtoMismatchDetection(scenario.detection)
+
+			err := discovery.Refresh()
+			if (err != nil) != scenario.expectedError {
+				t.Fatalf("mismatch error. Expecting error: “%t”; found “%v”", scenario.expectedError, err)
+			}
+
+			var mismatchErr dnsdisco.ProtoMismatchError
+			if errors.As(err, &mismatchErr) != scenario.expectedMismatch {
+				t.Fatalf("mismatch proto mismatch detection. Expecting: “%t”; found “%v”", scenario.expectedMismatch, err)
+			}
+
+			if mismatchErr.Alternative != scenario.expectedAlternative {
+				t.Errorf("mismatch alternative proto. Expecting: “%s”; found “%s”", scenario.expectedAlternative, mismatchErr.Alternative)
+			}
+
+			var dnsErr *net.DNSError
+			if scenario.expectedMismatch && !errors.As(err, &dnsErr) {
+				t.Errorf("the retrieval error wasn't kept. Found “%v”", err)
+			}
+		})
+	}
+}
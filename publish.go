@@ -0,0 +1,56 @@
+package dnsdisco
+
+import (
+	"context"
+	"time"
+)
+
+// SnapshotPublisher allows the library user to upload the state of the
+// discovery to a remote store (e.g. S3, GCS or an HTTP endpoint), so fleet-wide
+// dashboards can show the topology that each client believes in. The
+// snapshotstore package has implementations for common stores.
+type SnapshotPublisher interface {
+	// Publish uploads the snapshot. The context is done when the publication
+	// must be aborted.
+	Publish(ctx context.Context, snapshot Snapshot) error
+}
+
+// SnapshotPublisherFunc is an easy-to-use implementation of the interface that
+// is responsible for uploading the snapshots.
+type SnapshotPublisherFunc func(ctx context.Context, snapshot Snapshot) error
+
+// Publish uploads the snapshot.
+func (s SnapshotPublisherFunc) Publish(ctx context.Context, snapshot Snapshot) error {
+	return s(ctx, snapshot)
+}
+
+// PublishSnapshots uploads the snapshot of the discovery (see Snapshot) with
+// the publisher on every interval, until the returned channel is closed or the
+// base context is done (see WithBaseContext). Each publication is limited by
+// the interval, and the errors are stored in the Errors list. The intervals are
+// measured with the clock of the discovery (see SetClock). It is non-blocking.
+func (d *discovery) PublishSnapshots(publisher SnapshotPublisher, interval time.Duration) chan<- bool {
+	finish := make(chan bool)
+
+	base := d.BaseContext()
+
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(base, interval)
+			err := publisher.Publish(ctx, d.Snapshot())
+			cancel()
+
+			if err != nil {
+				d.errorsLock.Lock()
+				d.errors = append(d.errors, err)
+				d.errorsLock.Unlock()
+			}
+
+			if !wait(base, d.currentClock(), interval, finish) {
+				return
+			}
+		}
+	}()
+
+	return finish
+}
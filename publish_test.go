@@ -0,0 +1,96 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/soaktest"
+)
+
+func TestPublishSnapshots(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description    string
+		err            error
+		expectedErrors bool
+	}{
+		{
+			description: "it should publish the snapshots periodically",
+		},
+		{
+			description:    "it should store the publication errors",
+			err:            errors.New("access denied"),
+			expectedErrors: true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			clock := soaktest.NewFakeClock(time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC))
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.(dnsdisco.Scheduler).SetClock(clock)
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			var snapshots []dnsdisco.Snapshot
+			var snapshotsLock sync.Mutex
+
+			finish := discovery.(dnsdisco.Publisher).PublishSnapshots(dnsdisco.SnapshotPublisherFunc(func(ctx context.Context, snapshot dnsdisco.Snapshot) error {
+				snapshotsLock.Lock()
+				defer snapshotsLock.Unlock()
+				snapshots = append(snapshots, snapshot)
+				return scenario.err
+			}), time.Minute)
+
+			// the publisher waits for the next interval after each publication
+			for i := 0; i < 2; i++ {
+				if !clock.WaitForTimers(1, time.Second) {
+					t.Fatalf("publication %d not finished", i+1)
+				}
+				clock.Advance(time.Minute)
+			}
+
+			if !clock.WaitForTimers(1, time.Second) {
+				t.Fatal("publication 3 not finished")
+			}
+			close(finish)
+
+			snapshotsLock.Lock()
+			defer snapshotsLock.Unlock()
+
+			if len(snapshots) != 3 {
+				t.Fatalf("mismatch number of publications. Expecting: “3”; found “%d”", len(snapshots))
+			}
+
+			expected := []dnsdisco.Server{discovery.(dnsdisco.Inspector).Servers()[0]}
+			if servers := snapshots[0].Servers; len(servers) != 1 || !reflect.DeepEqual(servers[0].SRV, expected[0].SRV) {
+				t.Errorf("mismatch servers. Expecting: “%v”; found “%v”", expected, servers)
+			}
+
+			if errs := discovery.Errors(); (len(errs) > 0) != scenario.expectedErrors {
+				t.Errorf("unexpected errors “%v”", errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package dnsdisco
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQuarantined is the error wrapped by the errors of the refreshes whose
+// answer was quarantined, keeping the previous servers. It can be verified
+// with errors.Is.
+var ErrQuarantined = errors.New("dnsdisco: answer quarantined")
+
+// ShrinkError is returned by the refresh when its answer has much less servers
+// than the previous one, and was quarantined: the previous servers are kept,
+// as the answer may be partial or caused by a DNS outage. It wraps
+// ErrQuarantined.
+type ShrinkError struct {
+	// Previous is the number of servers before the refresh.
+	Previous int
+
+	// Current is the number of servers of the quarantined answer.
+	Current int
+
+	// MaxShrink is the configured maximum shrink percentage.
+	MaxShrink float64
+}
+
+// Error returns the warning description.
+func (s ShrinkError) Error() string {
+	return fmt.Sprintf("dnsdisco: answer shrank from %d to %d servers (more than %g%%), keeping the previous servers",
+		s.Previous, s.Current, s.MaxShrink)
+}
+
+// Unwrap returns ErrQuarantined, as the answer was quarantined.
+func (s ShrinkError) Unwrap() error {
+	return ErrQuarantined
+}
+
+// SetShrinkProtection quarantines the refresh answers that shrink the number of
+// servers by more than the percentage (0-100), keeping the previous servers.
+// The quarantined refresh fails with a ShrinkError, so it is reported by
+// LastRefresh, the refresh events and the probes (see Healthy) like the other
+// failures. It tolerates network partitions and DNS outages that return
+// partial answers. Intentional scale-downs can be accepted with AllowShrink. A
+// zero percentage disables the protection. It is go routine safe.
+func (d *discovery) SetShrinkProtection(maxShrink float64) {
+	d.shrinkLock.Lock()
+	defer d.shrinkLock.Unlock()
+	d.maxShrink = maxShrink
+}
+
+// AllowShrink accepts the answer of the next refresh, whatever is its size,
+// for intentional scale-downs of the service. It is go routine safe.
+func (d *discovery) AllowShrink() {
+	d.shrinkLock.Lock()
+	defer d.shrinkLock.Unlock()
+	d.allowShrink = true
+}
+
+// quarantine checks if the answer shrank too much compared with the previous
+// servers.
+func (d *discovery) quarantine(previous, current int) error {
+	d.shrinkLock.Lock()
+	defer d.shrinkLock.Unlock()
+
+	// the permission is only valid for one refresh
+	allowShrink := d.allowShrink
+	d.allowShrink = false
+
+	if d.maxShrink <= 0 || allowShrink || previous == 0 || current >= previous {
+		return nil
+	}
+
+	if float64(previous-current)/float64(previous)*100 > d.maxShrink {
+		return ShrinkError{Previous: previous, Current: current, MaxShrink: d.maxShrink}
+	}
+	return nil
+}
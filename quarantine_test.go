@@ -0,0 +1,87 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestShrinkProtection(t *testing.T) {
+	t.Parallel()
+
+	previous := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+		{Target: "server3.example.com.", Port: 3333, Priority: 10, Weight: 10},
+		{Target: "server4.example.com.", Port: 4444, Priority: 10, Weight: 10},
+	}
+
+	scenarios := []struct {
+		description     string
+		current         []*net.SRV
+		allowShrink     bool
+		expectedServers int
+		expectedError   error
+	}{
+		{
+			description:     "it should accept a small shrink",
+			current:         previous[:3],
+			expectedServers: 3,
+		},
+		{
+			description:     "it should quarantine a big shrink",
+			current:         previous[:1],
+			expectedServers: 4,
+			expectedError:   dnsdisco.ShrinkError{Previous: 4, Current: 1, MaxShrink: 50},
+		},
+		{
+			description:     "it should accept an intentional scale-down",
+			current:         previous[:1],
+			allowShrink:     true,
+			expectedServers: 1,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			srvs := previous
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return srvs, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return true, nil
+			}))
+			discovery.(dnsdisco.FailureConfigurer).SetShrinkProtection(50)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			srvs = scenario.current
+			if scenario.allowShrink {
+				discovery.(dnsdisco.FailureConfigurer).AllowShrink()
+			}
+
+			err := discovery.Refresh()
+			if err != scenario.expectedError {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+
+			if scenario.expectedError != nil && !errors.Is(err, dnsdisco.ErrQuarantined) {
+				t.Errorf("error “%v” should wrap the quarantine error", err)
+			}
+
+			if lastErr := discovery.(dnsdisco.Refresher).LastRefresh().Err; lastErr != scenario.expectedError {
+				t.Errorf("mismatch last refresh errors. Expecting: “%v”; found “%v”", scenario.expectedError, lastErr)
+			}
+
+			if servers := discovery.(dnsdisco.Inspector).Servers(); len(servers) != scenario.expectedServers {
+				t.Errorf("mismatch number of servers. Expecting: “%d”; found “%d”", scenario.expectedServers, len(servers))
+			}
+		})
+	}
+}
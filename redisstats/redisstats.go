@@ -0,0 +1,121 @@
+// Package redisstats stores the usage counters and the health history of the
+// servers in Redis, so many instances of an application can coordinate their
+// load balancing decisions.
+//
+// To avoid depending on a specific Redis client, the library only needs an
+// implementation of the Client interface, that can be easily written on top of
+// the most common clients.
+package redisstats
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+// Client is the subset of the Redis commands needed by the store.
+type Client interface {
+	// Incr increments the integer stored in the key (INCR), returning the new
+	// value.
+	Incr(key string) (int64, error)
+
+	// Get returns the value stored in the key (GET). When the key doesn't exist
+	// an empty string and no error must be returned.
+	Get(key string) (string, error)
+
+	// RPush appends the value to the list stored in the key (RPUSH).
+	RPush(key, value string) error
+
+	// LTrim keeps only the elements of the list between start and stop (LTRIM).
+	LTrim(key string, start, stop int64) error
+
+	// LRange returns the elements of the list between start and stop (LRANGE).
+	LRange(key string, start, stop int64) ([]string, error)
+}
+
+// Store implements the dnsdisco.StatsStore interface using Redis.
+type Store struct {
+	// client is the connection to the Redis server.
+	client Client
+
+	// prefix is prepended to all keys written by the store.
+	prefix string
+
+	// historySize is the number of health check results kept for each server.
+	historySize int64
+}
+
+// NewStore builds a store that writes the keys with the given prefix, keeping
+// only the last historySize health check results of each server.
+func NewStore(client Client, prefix string, historySize int) *Store {
+	return &Store{
+		client:      client,
+		prefix:      prefix,
+		historySize: int64(historySize),
+	}
+}
+
+// IncrementUsed increments the number of times that the server was chosen,
+// returning the new value. The increment is atomic, so it can be shared by
+// many instances of the application.
+func (s *Store) IncrementUsed(key string) (int, error) {
+	used, err := s.client.Incr(s.prefix + "used:" + key)
+	return int(used), err
+}
+
+// Used returns the number of times that the server was chosen.
+func (s *Store) Used(key string) (int, error) {
+	value, err := s.client.Get(s.prefix + "used:" + key)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// AddHealth stores the result of a health check of the server, discarding the
+// oldest results when the history is full.
+func (s *Store) AddHealth(key string, record dnsdisco.HealthRecord) error {
+	if s.historySize <= 0 {
+		return nil
+	}
+
+	value, err := json.Marshal(healthRecord(record))
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.RPush(s.prefix+"health:"+key, string(value)); err != nil {
+		return err
+	}
+	return s.client.LTrim(s.prefix+"health:"+key, -s.historySize, -1)
+}
+
+// Health returns the results of the last health checks of the server, from the
+// oldest to the newest.
+func (s *Store) Health(key string) ([]dnsdisco.HealthRecord, error) {
+	values, err := s.client.LRange(s.prefix+"health:"+key, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []dnsdisco.HealthRecord
+	for _, value := range values {
+		var record healthRecord
+		if err := json.Unmarshal([]byte(value), &record); err != nil {
+			return nil, err
+		}
+		records = append(records, dnsdisco.HealthRecord(record))
+	}
+	return records, nil
+}
+
+// healthRecord is the JSON representation of a health check result stored in
+// Redis.
+type healthRecord struct {
+	Status  dnsdisco.HealthStatus `json:"status"`
+	Checked time.Time             `json:"checked"`
+	Latency time.Duration         `json:"latency,omitempty"`
+	Error   string                `json:"error,omitempty"`
+}
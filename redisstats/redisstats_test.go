@@ -0,0 +1,121 @@
+package redisstats_test
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/redisstats"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	client := &clientMock{
+		values: make(map[string]string),
+		lists:  make(map[string][]string),
+	}
+
+	store := redisstats.NewStore(client, "dnsdisco:", 2)
+	key := dnsdisco.ServerStatsKey("jabber", "tcp", "registro.br.", "server1.example.com.", 1111)
+
+	if used, err := store.Used(key); used != 0 || err != nil {
+		t.Errorf("unexpected usage “%d” and error “%v” before any choice", used, err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if used, err := store.IncrementUsed(key); used != i || err != nil {
+			t.Errorf("unexpected usage “%d” and error “%v” when incrementing", used, err)
+		}
+	}
+
+	if used, err := store.Used(key); used != 3 || err != nil {
+		t.Errorf("unexpected usage “%d” and error “%v”", used, err)
+	}
+
+	if _, ok := client.values["dnsdisco:used:_jabber._tcp.registro.br./server1.example.com.:1111"]; !ok {
+		t.Errorf("usage key not found in “%v”", client.values)
+	}
+
+	checked := time.Date(2016, 10, 15, 12, 0, 0, 0, time.UTC)
+	records := []dnsdisco.HealthRecord{
+		{Status: dnsdisco.HealthStatusHealthy, Checked: checked},
+		{Status: dnsdisco.HealthStatusUnhealthy, Checked: checked.Add(time.Minute)},
+		{Status: dnsdisco.HealthStatusDegraded, Checked: checked.Add(2 * time.Minute)},
+	}
+
+	for _, record := range records {
+		if err := store.AddHealth(key, record); err != nil {
+			t.Fatalf("unexpected error “%v”", err)
+		}
+	}
+
+	health, err := store.Health(key)
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if !reflect.DeepEqual(health, records[1:]) {
+		t.Errorf("mismatch health history. Expecting: “%v”; found “%v”", records[1:], health)
+	}
+}
+
+type clientMock struct {
+	values map[string]string
+	lists  map[string][]string
+	lock   sync.Mutex
+}
+
+func (c *clientMock) Incr(key string) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	value, _ := strconv.ParseInt(c.values[key], 10, 64)
+	value++
+	c.values[key] = strconv.FormatInt(value, 10)
+	return value, nil
+}
+
+func (c *clientMock) Get(key string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.values[key], nil
+}
+
+func (c *clientMock) RPush(key, value string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lists[key] = append(c.lists[key], value)
+	return nil
+}
+
+func (c *clientMock) LTrim(key string, start, stop int64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lists[key] = c.lists[key][c.index(key, start) : c.index(key, stop)+1]
+	return nil
+}
+
+func (c *clientMock) LRange(key string, start, stop int64) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.lists[key]) == 0 {
+		return nil, nil
+	}
+	return c.lists[key][c.index(key, start) : c.index(key, stop)+1], nil
+}
+
+// index converts negative Redis indexes to slice indexes.
+func (c *clientMock) index(key string, i int64) int64 {
+	size := int64(len(c.lists[key]))
+	if i < 0 {
+		i += size
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
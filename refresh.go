@@ -0,0 +1,76 @@
+package dnsdisco
+
+import (
+	"fmt"
+	"time"
+)
+
+// RefreshInfo describes the last refresh of the discovery, so readiness probes
+// and dashboards can verify that the discovery is alive.
+type RefreshInfo struct {
+	// Time is the moment when the refresh started. It is zero before the
+	// first refresh.
+	Time time.Time
+
+	// Duration is the time spent in the refresh, including the health checks.
+	Duration time.Duration
+
+	// Records is the number of servers retrieved. It is zero when the refresh
+	// failed.
+	Records int
+
+	// Resolver identifies the retriever used (its Go type, e.g.
+	// "*dnsclient.Retriever").
+	Resolver string
+
+	// Name is the name of the retrieved servers, that may be the external name
+	// (see SetExternalName).
+	Name string
+
+	// Err is the error of the refresh, if any.
+	Err error
+
+	// Changed is true when the refresh added or removed servers.
+	Changed bool
+}
+
+// LastRefresh returns the information of the last refresh, synchronous or
+// asynchronous. It is go routine safe.
+func (d *discovery) LastRefresh() RefreshInfo {
+	d.refreshStateLock.Lock()
+	defer d.refreshStateLock.Unlock()
+	return d.lastRefreshInfo
+}
+
+// newRefreshInfo builds the information of a refresh that started at the
+// given moment, comparing the servers before and after it.
+func (d *discovery) newRefreshInfo(begin time.Time, retriever Retriever, previous []Server, err error) RefreshInfo {
+	info := RefreshInfo{
+		Time:     begin,
+		Duration: time.Since(begin),
+		Resolver: fmt.Sprintf("%T", retriever),
+		Name:     d.ActiveName(),
+		Err:      err,
+	}
+
+	if err != nil {
+		return info
+	}
+
+	current := d.Servers()
+	info.Records = len(current)
+
+	addresses := make(map[string]bool, len(previous))
+	for _, server := range previous {
+		addresses[server.address()] = true
+	}
+
+	info.Changed = len(current) != len(previous)
+	for _, server := range current {
+		if !addresses[server.address()] {
+			info.Changed = true
+		}
+	}
+
+	return info
+}
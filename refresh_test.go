@@ -0,0 +1,256 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestLastRefresh(t *testing.T) {
+	t.Parallel()
+
+	failure := errors.New("server failure")
+
+	answers := []struct {
+		srvs []*net.SRV
+		err  error
+	}{
+		{
+			srvs: []*net.SRV{
+				{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+				{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+			},
+		},
+		{
+			srvs: []*net.SRV{
+				{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+				{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			},
+		},
+		{
+			srvs: []*net.SRV{
+				{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			},
+		},
+		{
+			err: failure,
+		},
+	}
+
+	scenarios := []struct {
+		description     string
+		expectedRecords int
+		expectedChanged bool
+		expectedError   error
+	}{
+		{
+			description:     "it should detect the new servers",
+			expectedRecords: 2,
+			expectedChanged: true,
+		},
+		{
+			description:     "it should detect that the servers didn't change",
+			expectedRecords: 2,
+		},
+		{
+			description:     "it should detect the removed servers",
+			expectedRecords: 1,
+			expectedChanged: true,
+		},
+		{
+			description:   "it should store the error",
+			expectedError: failure,
+		},
+	}
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}))
+
+	if info := discovery.(dnsdisco.Refresher).LastRefresh(); !info.Time.IsZero() {
+		t.Errorf("unexpected refresh before the first one “%#v”", info)
+	}
+
+	// the scenarios depend on the previous refresh, so they can't run in
+	// parallel
+	for i, scenario := range scenarios {
+		answer := answers[i]
+		t.Run(scenario.description, func(t *testing.T) {
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return answer.srvs, answer.err
+			}))
+
+			begin := time.Now()
+			discovery.Refresh()
+			info := discovery.(dnsdisco.Refresher).LastRefresh()
+
+			if info.Time.Before(begin) || info.Duration < 0 {
+				t.Errorf("unexpected refresh time “%s” and duration “%s”", info.Time, info.Duration)
+			}
+
+			if info.Records != scenario.expectedRecords {
+				t.Errorf("mismatch records. Expecting: “%d”; found “%d”", scenario.expectedRecords, info.Records)
+			}
+
+			if info.Changed != scenario.expectedChanged {
+				t.Errorf("mismatch changed. Expecting: “%t”; found “%t”", scenario.expectedChanged, info.Changed)
+			}
+
+			if info.Err != scenario.expectedError {
+				t.Errorf("mismatch error. Expecting: “%v”; found “%v”", scenario.expectedError, info.Err)
+			}
+
+			if expected := "dnsdisco.RetrieverFunc"; info.Resolver != expected {
+				t.Errorf("mismatch resolver. Expecting: “%s”; found “%s”", expected, info.Resolver)
+			}
+		})
+	}
+}
+
+func TestSetRefreshConcurrency(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description    string
+		mode           dnsdisco.RefreshConcurrency
+		expectedErrors []error
+	}{
+		{
+			description:    "it should share the result of the refresh in progress",
+			mode:           dnsdisco.RefreshConcurrencyWait,
+			expectedErrors: []error{nil, nil, nil},
+		},
+		{
+			description:    "it should reject the refreshes while one is in progress",
+			mode:           dnsdisco.RefreshConcurrencyReject,
+			expectedErrors: []error{dnsdisco.ErrRefreshInProgress, dnsdisco.ErrRefreshInProgress, nil},
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			var calls int32
+			started := make(chan bool, 1)
+			release := make(chan bool)
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.(dnsdisco.Refresher).SetRefreshConcurrency(item.mode)
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					started <- true
+					<-release
+				}
+
+				return []*net.SRV{{Target: "server1.example.com.", Port: 1111}}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return true, nil
+			}))
+
+			errs := make([]error, len(item.expectedErrors))
+			var wg sync.WaitGroup
+
+			// the last refresh is the one in progress
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[len(errs)-1] = discovery.Refresh()
+			}()
+			<-started
+
+			for i := 0; i < len(errs)-1; i++ {
+				if item.mode == dnsdisco.RefreshConcurrencyReject {
+					// the rejected refreshes don't block
+					errs[i] = discovery.Refresh()
+					continue
+				}
+
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs[i] = discovery.Refresh()
+				}(i)
+			}
+
+			// give time for the refreshes to wait for the one in progress
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if calls != 1 {
+				t.Errorf("mismatch number of DNS requests. Expecting: “1”; found “%d”", calls)
+			}
+
+			if !reflect.DeepEqual(item.expectedErrors, errs) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", item.expectedErrors, errs)
+			}
+		})
+	}
+}
+
+func TestRefreshDoesNotBlockChoose(t *testing.T) {
+	t.Parallel()
+
+	var checks int32
+	started := make(chan bool, 1)
+	release := make(chan bool)
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{{Target: "server1.example.com.", Port: 1111}}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		// the health check of the second refresh is slow
+		if atomic.AddInt32(&checks, 1) == 2 {
+			started <- true
+			<-release
+		}
+		return true, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	refreshed := make(chan error, 1)
+	go func() {
+		refreshed <- discovery.Refresh()
+	}()
+	<-started
+
+	chosen := make(chan string, 1)
+	go func() {
+		target, _ := discovery.Choose()
+		chosen <- target
+	}()
+
+	select {
+	case target := <-chosen:
+		if target != "server1.example.com." {
+			t.Errorf("mismatch target. Expecting: “server1.example.com.”; found “%s”", target)
+		}
+	case <-time.After(time.Second):
+		t.Error("choice blocked by the health checks of the refresh")
+	}
+
+	close(release)
+	if err := <-refreshed; err != nil {
+		t.Errorf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	// the choice made during the refresh is kept
+	if used := discovery.(dnsdisco.Inspector).Servers()[0].Used; used != 1 {
+		t.Errorf("mismatch usage. Expecting: “1”; found “%d”", used)
+	}
+}
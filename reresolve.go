@@ -0,0 +1,61 @@
+package dnsdisco
+
+import "time"
+
+// SetReResolution triggers an immediate refresh, out of the RefreshAsync
+// interval, when the fraction (0-1) of healthy servers of a refresh drops
+// below the threshold, as the DNS answer may already point to the replacement
+// hosts. The cooldown is the minimum time between two triggered refreshes, so
+// a service that is really down doesn't flood the resolver. A zero threshold
+// disables the re-resolution. The errors of the triggered refreshes are
+// stored in the Errors list.
+func (d *discovery) SetReResolution(threshold float64, cooldown time.Duration) {
+	d.reResolutionLock.Lock()
+	defer d.reResolutionLock.Unlock()
+
+	d.reResolutionThreshold = threshold
+	d.reResolutionCooldown = cooldown
+}
+
+// checkReResolution triggers a refresh when the fraction of healthy servers is
+// below the threshold and the cooldown has passed. It is called during a
+// refresh, so the triggered one is only recorded as pending, and started by
+// startReResolution after the current refresh finishes, instead of sharing its
+// result.
+func (d *discovery) checkReResolution(healthy, total int) {
+	d.reResolutionLock.Lock()
+	defer d.reResolutionLock.Unlock()
+
+	if d.reResolutionThreshold <= 0 {
+		return
+	}
+
+	if total > 0 && float64(healthy)/float64(total) >= d.reResolutionThreshold {
+		return
+	}
+
+	if time.Since(d.lastReResolution) < d.reResolutionCooldown {
+		return
+	}
+	d.lastReResolution = time.Now()
+	d.reResolutionPending = true
+}
+
+// startReResolution starts the pending refresh in background, if any.
+func (d *discovery) startReResolution() {
+	d.reResolutionLock.Lock()
+	defer d.reResolutionLock.Unlock()
+
+	if !d.reResolutionPending {
+		return
+	}
+	d.reResolutionPending = false
+
+	go func() {
+		if err := d.singleFlightRefresh(RefreshConcurrencyWait); err != nil {
+			d.errorsLock.Lock()
+			d.errors = append(d.errors, err)
+			d.errorsLock.Unlock()
+		}
+	}()
+}
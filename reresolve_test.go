@@ -0,0 +1,67 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestReResolution(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description        string
+		cooldown           time.Duration
+		unhealthyChecks    int32
+		expectedRetrievals int32
+	}{
+		{
+			description:        "it should refresh again when the servers are unhealthy",
+			unhealthyChecks:    2,
+			expectedRetrievals: 2,
+		},
+		{
+			description:        "it should respect the cooldown",
+			cooldown:           time.Hour,
+			unhealthyChecks:    -1,
+			expectedRetrievals: 2,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			var retrievals, checks int32
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				atomic.AddInt32(&retrievals, 1)
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+					{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				check := atomic.AddInt32(&checks, 1)
+				return scenario.unhealthyChecks >= 0 && check > scenario.unhealthyChecks, nil
+			}))
+			discovery.(dnsdisco.Refresher).SetReResolution(0.5, scenario.cooldown)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			if n := atomic.LoadInt32(&retrievals); n != scenario.expectedRetrievals {
+				t.Errorf("mismatch retrievals. Expecting: “%d”; found “%d”", scenario.expectedRetrievals, n)
+			}
+
+			if target, _ := discovery.Choose(); scenario.unhealthyChecks >= 0 && target == "" {
+				t.Error("servers weren't refreshed")
+			}
+		})
+	}
+}
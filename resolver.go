@@ -0,0 +1,101 @@
+package dnsdisco
+
+import (
+	"context"
+	"net"
+)
+
+// AddressResolver allows the library user to define how the chosen targets are
+// converted to IP addresses by the Dial, DialTLS and RoundTripper helpers
+// (e.g. consulting an internal IPAM or a hosts file overlay), independently of
+// the SRV retriever.
+type AddressResolver interface {
+	// ResolveAddress returns the IP addresses of the target, in the order
+	// they should be tried.
+	ResolveAddress(ctx context.Context, target string) ([]net.IP, error)
+}
+
+// AddressResolverFunc is an easy-to-use implementation of the interface that
+// is responsible for resolving the addresses of the targets.
+type AddressResolverFunc func(ctx context.Context, target string) ([]net.IP, error)
+
+// ResolveAddress returns the IP addresses of the target.
+func (a AddressResolverFunc) ResolveAddress(ctx context.Context, target string) ([]net.IP, error) {
+	return a(ctx, target)
+}
+
+// SetAddressResolver defines the resolver used by the dial helpers to convert
+// the chosen targets to IP addresses. A nil resolver restores the system
+// resolver. It is go routine safe.
+func (d *discovery) SetAddressResolver(resolver AddressResolver) {
+	d.addressResolverLock.Lock()
+	defer d.addressResolverLock.Unlock()
+	d.addressResolver = resolver
+}
+
+// ResolveAddress returns the IP addresses of the target using the resolver
+// defined with SetAddressResolver. When there's no resolver or the target is
+// an IP literal, no address is returned, and the target should be used as is.
+func (d *discovery) ResolveAddress(ctx context.Context, target string) ([]net.IP, error) {
+	d.addressResolverLock.RLock()
+	resolver := d.addressResolver
+	d.addressResolverLock.RUnlock()
+
+	if resolver == nil {
+		return nil, nil
+	}
+
+	if _, ok := IPLiteral(target); ok {
+		return nil, nil
+	}
+
+	return resolver.ResolveAddress(ctx, target)
+}
+
+// dialFunc connects to the address in the network.
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// resolvedDialer wraps the dial function, so the host of the address is
+// converted to IP addresses with the resolve function, trying each address
+// until one connects. When the resolve function doesn't return any address,
+// the address is dialed as is.
+func resolvedDialer(resolve func(ctx context.Context, target string) ([]net.IP, error), dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if network == "unix" {
+			return dial(ctx, network, address)
+		}
+
+		target, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := resolve(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ips) == 0 {
+			return dial(ctx, network, address)
+		}
+
+		for _, ip := range ips {
+			var conn net.Conn
+			if conn, err = dial(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+				return conn, nil
+			}
+
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, err
+	}
+}
+
+// dialContext connects to the address with the default dialer, using the
+// address resolver of the discovery.
+func (d *discovery) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return resolvedDialer(d.ResolveAddress, dialer.DialContext)(ctx, network, address)
+}
@@ -0,0 +1,160 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetAddressResolver(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description   string
+		target        string
+		resolver      func(addr net.IP) dnsdisco.AddressResolver
+		expectedError bool
+	}{
+		{
+			description: "it should connect to the resolved address",
+			target:      "service.internal.",
+			resolver: func(addr net.IP) dnsdisco.AddressResolver {
+				return dnsdisco.AddressResolverFunc(func(ctx context.Context, target string) ([]net.IP, error) {
+					return []net.IP{addr}, nil
+				})
+			},
+		},
+		{
+			description: "it should try the next resolved address",
+			target:      "service.internal.",
+			resolver: func(addr net.IP) dnsdisco.AddressResolver {
+				return dnsdisco.AddressResolverFunc(func(ctx context.Context, target string) ([]net.IP, error) {
+					// the port 0 of the unspecified address can't be dialed
+					return []net.IP{net.IPv4zero, addr}, nil
+				})
+			},
+		},
+		{
+			description: "it should not resolve IP literals",
+			target:      "127.0.0.1",
+			resolver: func(addr net.IP) dnsdisco.AddressResolver {
+				return dnsdisco.AddressResolverFunc(func(ctx context.Context, target string) ([]net.IP, error) {
+					return nil, errors.New("unexpected resolution")
+				})
+			},
+		},
+		{
+			description: "it should fail when the resolver fails",
+			target:      "service.internal.",
+			resolver: func(addr net.IP) dnsdisco.AddressResolver {
+				return dnsdisco.AddressResolverFunc(func(ctx context.Context, target string) ([]net.IP, error) {
+					return nil, errors.New("ipam unavailable")
+				})
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("error creating listener: %s", err)
+			}
+			defer listener.Close()
+
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					conn.Close()
+				}
+			}()
+
+			port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+			discovery := dnsdisco.NewDiscovery("service", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: item.target, Port: port, Priority: 10, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+			discovery.(dnsdisco.ConnectionConfigurer).SetAddressResolver(item.resolver(net.IPv4(127, 0, 0, 1)))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			conn, err := discovery.(dnsdisco.Dialer).Dial(context.Background())
+			if item.expectedError {
+				if err == nil {
+					conn.Close()
+					t.Error("expected an error and got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			conn.Close()
+		})
+	}
+}
+
+func TestRoundTripperAddressResolver(t *testing.T) {
+	t.Parallel()
+
+	hosts := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+	}))
+	defer server.Close()
+
+	port := serverPort(t, server.URL)
+
+	discovery := dnsdisco.NewDiscovery("http", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "web.internal.", Port: port, Priority: 10, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}))
+	discovery.(dnsdisco.ConnectionConfigurer).SetAddressResolver(dnsdisco.AddressResolverFunc(func(ctx context.Context, target string) ([]net.IP, error) {
+		if target != "web.internal." {
+			return nil, errors.New("unknown target")
+		}
+		return []net.IP{net.IPv4(127, 0, 0, 1)}, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	client := http.Client{Transport: dnsdisco.NewRoundTripper(discovery, nil)}
+	response, err := client.Get("http://api.registro.br/domains")
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+	response.Body.Close()
+
+	if host := <-hosts; host != "api.registro.br" {
+		t.Errorf("mismatch host. Expecting: “api.registro.br”; found “%s”", host)
+	}
+}
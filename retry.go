@@ -0,0 +1,81 @@
+package dnsdisco
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// RetryPolicy defines how the DNS queries of the built-in retrievers are
+// retried. Timeouts and server failures (SERVFAIL) are retried, as they are
+// usually temporary, but a name that doesn't exist (NXDOMAIN) is returned
+// immediately.
+type RetryPolicy struct {
+	// Retries is the number of extra attempts after a failed query.
+	Retries int
+
+	// TryTimeout limits the duration of each attempt. Zero means that only the
+	// budget limits the attempt.
+	TryTimeout time.Duration
+
+	// Budget limits the total duration of all attempts. Zero means no limit.
+	Budget time.Duration
+}
+
+// NewDefaultRetrieverWithRetries returns an instance of the default retriever
+// algorithm, that uses the local resolver to retrieve the SRV records, retrying
+// the failed queries according to the policy. A lost UDP packet won't fail the
+// whole refresh.
+func NewDefaultRetrieverWithRetries(policy RetryPolicy) Retriever {
+	return RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return policy.retry(context.Background(), func(ctx context.Context) (servers []*net.SRV, err error) {
+			_, servers, err = net.DefaultResolver.LookupSRV(ctx, service, proto, name)
+			return
+		})
+	})
+}
+
+// retry executes the query until it succeeds, fails with an error that can't be
+// retried, or the retries or the budget are exhausted.
+func (p RetryPolicy) retry(ctx context.Context, query func(ctx context.Context) ([]*net.SRV, error)) ([]*net.SRV, error) {
+	if p.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Budget)
+		defer cancel()
+	}
+
+	var err error
+	for attempt := 0; attempt <= p.Retries; attempt++ {
+		tryCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.TryTimeout > 0 {
+			tryCtx, cancel = context.WithTimeout(ctx, p.TryTimeout)
+		}
+
+		var servers []*net.SRV
+		servers, err = query(tryCtx)
+		cancel()
+
+		if err == nil || !IsRetryable(err) || ctx.Err() != nil {
+			return servers, err
+		}
+	}
+
+	return nil, err
+}
+
+// IsRetryable checks if a DNS error is temporary (timeout or server failure),
+// and the query can be retried. A name that doesn't exist (NXDOMAIN) is not
+// retryable.
+func IsRetryable(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	if !ok {
+		return false
+	}
+
+	if dnsErr.IsNotFound {
+		return false
+	}
+
+	// server failures (SERVFAIL) are reported as "server misbehaving"
+	return dnsErr.IsTimeout || dnsErr.IsTemporary || dnsErr.Err == "server misbehaving"
+}
@@ -0,0 +1,96 @@
+package dnsdisco
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	servers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+	}
+
+	timeoutErr := &net.DNSError{Err: "i/o timeout", Name: "_jabber._tcp.registro.br.", IsTimeout: true}
+	serverFailureErr := &net.DNSError{Err: "server misbehaving", Name: "_jabber._tcp.registro.br."}
+	notFoundErr := &net.DNSError{Err: "no such host", Name: "_jabber._tcp.registro.br.", IsNotFound: true}
+
+	scenarios := []struct {
+		description      string
+		policy           RetryPolicy
+		errs             []error
+		delay            time.Duration
+		expectedServers  []*net.SRV
+		expectedAttempts int
+		expectedError    error
+	}{
+		{
+			description:      "it should retry after a timeout",
+			policy:           RetryPolicy{Retries: 2},
+			errs:             []error{timeoutErr, nil},
+			expectedServers:  servers,
+			expectedAttempts: 2,
+		},
+		{
+			description:      "it should retry after a server failure",
+			policy:           RetryPolicy{Retries: 2},
+			errs:             []error{serverFailureErr, serverFailureErr, nil},
+			expectedServers:  servers,
+			expectedAttempts: 3,
+		},
+		{
+			description:      "it should not retry when the name doesn't exist",
+			policy:           RetryPolicy{Retries: 2},
+			errs:             []error{notFoundErr, nil},
+			expectedAttempts: 1,
+			expectedError:    notFoundErr,
+		},
+		{
+			description:      "it should stop when the retries are exhausted",
+			policy:           RetryPolicy{Retries: 1},
+			errs:             []error{timeoutErr, timeoutErr, nil},
+			expectedAttempts: 2,
+			expectedError:    timeoutErr,
+		},
+		{
+			description:      "it should stop when the budget is exhausted",
+			policy:           RetryPolicy{Retries: 10, Budget: 50 * time.Millisecond},
+			errs:             []error{timeoutErr, timeoutErr, nil},
+			delay:            40 * time.Millisecond,
+			expectedAttempts: 2,
+			expectedError:    timeoutErr,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			attempts := 0
+			found, err := scenario.policy.retry(context.Background(), func(ctx context.Context) ([]*net.SRV, error) {
+				err := scenario.errs[attempts]
+				attempts++
+
+				time.Sleep(scenario.delay)
+				if err != nil {
+					return nil, err
+				}
+				return servers, nil
+			})
+
+			if !reflect.DeepEqual(found, scenario.expectedServers) {
+				t.Errorf("mismatch servers. Expecting: “%#v”; found “%#v”", scenario.expectedServers, found)
+			}
+
+			if attempts != scenario.expectedAttempts {
+				t.Errorf("mismatch attempts. Expecting: “%d”; found “%d”", scenario.expectedAttempts, attempts)
+			}
+
+			if !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+		})
+	}
+}
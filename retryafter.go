@@ -0,0 +1,109 @@
+package dnsdisco
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// minRetryAfter is the shortest retry suggestion.
+	minRetryAfter = time.Second
+
+	// maxRetryAfter is the longest retry suggestion.
+	maxRetryAfter = time.Minute
+)
+
+// RetryAfterError is returned by ChooseServer when no server can be chosen,
+// suggesting when the caller should try again, so it can retry politely
+// instead of busy-looping. It matches ErrNoServer with errors.Is.
+type RetryAfterError struct {
+	// RetryAfter is the suggested time to wait before choosing again.
+	RetryAfter time.Duration
+}
+
+// Error returns the description with the suggested time.
+func (r RetryAfterError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrNoServer, r.RetryAfter)
+}
+
+// Unwrap returns ErrNoServer.
+func (r RetryAfterError) Unwrap() error {
+	return ErrNoServer
+}
+
+// ChooseServer works like Choose, but returns all the information of the
+// chosen server. When there's no server available a RetryAfterError is
+// returned. If the servers are refreshed with RefreshAsync the suggestion is
+// the time until the next refresh, when the health states will be checked
+// again; otherwise it grows exponentially with the consecutive refresh
+// failures. When the healthy servers are only blocked by the selection limits
+// (see SetSelectionLimit) the time until one of them has a selection available
+// is suggested, if it comes first. The suggestion is always between 1 second
+// and 1 minute.
+func (d *discovery) ChooseServer() (Server, error) {
+	target, port := d.Choose()
+	if target == "" && port == 0 {
+		return Server{}, RetryAfterError{RetryAfter: d.retryAfter()}
+	}
+
+	for _, server := range d.Servers() {
+		if server.Target == target && server.Port == port {
+			return server, nil
+		}
+	}
+
+	// custom load balancers may choose servers that aren't in the list
+	return Server{SRV: net.SRV{Target: target, Port: port}}, nil
+}
+
+// retryAfter suggests when the servers may be available again.
+func (d *discovery) retryAfter() time.Duration {
+	now := d.currentClock().Now()
+	refill, limited := d.selectionRefill(now)
+
+	d.refreshStateLock.Lock()
+	defer d.refreshStateLock.Unlock()
+
+	var retryAfter time.Duration
+	switch {
+	case d.refreshInterval > 0 && !d.lastRefresh.IsZero():
+		retryAfter = d.lastRefresh.Add(d.refreshInterval).Sub(now)
+		if limited && refill < retryAfter {
+			retryAfter = refill
+		}
+	case limited:
+		retryAfter = refill
+	default:
+		failures := d.refreshFailures
+		if failures > 6 {
+			failures = 6
+		}
+		retryAfter = minRetryAfter << uint(failures)
+	}
+
+	if retryAfter < minRetryAfter {
+		return minRetryAfter
+	} else if retryAfter > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return retryAfter
+}
+
+// recordRefresh stores the outcome of a refresh, used to suggest the retries
+// and returned by LastRefresh.
+func (d *discovery) recordRefresh(info RefreshInfo) {
+	now := d.currentClock().Now()
+
+	d.refreshStateLock.Lock()
+	defer d.refreshStateLock.Unlock()
+
+	d.lastRefresh = now
+	d.lastRefreshInfo = info
+	if info.Err != nil {
+		d.refreshFailures++
+	} else {
+		d.refreshFailures = 0
+		d.lastSuccessfulRefresh = d.lastRefresh
+	}
+}
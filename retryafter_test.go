@@ -0,0 +1,134 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestChooseServer(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description        string
+		retrieveErr        error
+		healthy            bool
+		refreshes          int
+		refreshInterval    time.Duration
+		selectionLimit     dnsdisco.SelectionLimit
+		choices            int
+		expectedTarget     string
+		expectedRetryAfter time.Duration
+		expectedMaximum    time.Duration
+	}{
+		{
+			description:    "it should return the chosen server",
+			healthy:        true,
+			refreshes:      1,
+			expectedTarget: "server1.example.com.",
+		},
+		{
+			description:        "it should suggest the minimum retry without failures",
+			refreshes:          1,
+			expectedRetryAfter: time.Second,
+			expectedMaximum:    time.Second,
+		},
+		{
+			description:        "it should back off with the consecutive failures",
+			retrieveErr:        errors.New("timeout"),
+			refreshes:          3,
+			expectedRetryAfter: 8 * time.Second,
+			expectedMaximum:    8 * time.Second,
+		},
+		{
+			description:        "it should limit the backoff",
+			retrieveErr:        errors.New("timeout"),
+			refreshes:          20,
+			expectedRetryAfter: time.Minute,
+			expectedMaximum:    time.Minute,
+		},
+		{
+			description:        "it should suggest the next asynchronous refresh",
+			refreshInterval:    30 * time.Second,
+			expectedRetryAfter: 25 * time.Second,
+			expectedMaximum:    30 * time.Second,
+		},
+		{
+			description:        "it should suggest the refill of the selection limits",
+			healthy:            true,
+			refreshes:          1,
+			selectionLimit:     dnsdisco.SelectionLimit{Rate: 0.2},
+			choices:            1,
+			expectedRetryAfter: 4 * time.Second,
+			expectedMaximum:    5 * time.Second,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+				}, scenario.retrieveErr
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return scenario.healthy, nil
+			}))
+
+			discovery.(dnsdisco.BalancingConfigurer).SetSelectionLimit(scenario.selectionLimit)
+
+			for i := 0; i < scenario.refreshes; i++ {
+				discovery.Refresh()
+			}
+
+			for i := 0; i < scenario.choices; i++ {
+				discovery.Choose()
+			}
+
+			if scenario.refreshInterval > 0 {
+				events := discovery.(dnsdisco.EventSource).Events()
+				finish := discovery.RefreshAsync(scenario.refreshInterval)
+				defer close(finish)
+
+				for event := range events {
+					if event.Type == dnsdisco.EventRefreshSucceeded {
+						break
+					}
+				}
+			}
+
+			server, err := discovery.(dnsdisco.Selector).ChooseServer()
+			if scenario.expectedTarget != "" {
+				if err != nil {
+					t.Fatalf("unexpected error “%v”", err)
+				}
+
+				if server.Target != scenario.expectedTarget || !server.Healthy {
+					t.Errorf("mismatch servers. Expecting: “%s”; found “%s” (healthy: %t)", scenario.expectedTarget, server.Target, server.Healthy)
+				}
+				return
+			}
+
+			if !errors.Is(err, dnsdisco.ErrNoServer) {
+				t.Errorf("expected an error matching ErrNoServer; found “%v”", err)
+			}
+
+			var retryAfterErr dnsdisco.RetryAfterError
+			if !errors.As(err, &retryAfterErr) {
+				t.Fatalf("expected a RetryAfterError; found “%v”", err)
+			}
+
+			if retryAfterErr.RetryAfter < scenario.expectedRetryAfter || retryAfterErr.RetryAfter > scenario.expectedMaximum {
+				t.Errorf("mismatch retry suggestions. Expecting: “%s”-“%s”; found “%s”",
+					scenario.expectedRetryAfter, scenario.expectedMaximum, retryAfterErr.RetryAfter)
+			}
+		})
+	}
+}
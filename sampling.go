@@ -0,0 +1,74 @@
+package dnsdisco
+
+// DecisionSampling defines how the load balancer decisions are sampled for a
+// post-hoc analysis of balancing issues, without the overhead of logging all
+// choices.
+type DecisionSampling struct {
+	// Every records one decision in each Every choices (e.g. 100 records 1% of
+	// the decisions). Zero disables the sampling.
+	Every uint64
+
+	// Capacity is the maximum number of samples kept. When full, the oldest
+	// sample is discarded. Zero disables the sampling.
+	Capacity int
+}
+
+// DecisionSample is a load balancer decision recorded by the sampler, with the
+// servers considered (inputs), the load balancer reason (scores) and the
+// chosen target (winner). It can be serialized to JSON.
+type DecisionSample struct {
+	// Decision is the sequence number of the choice since the sampling was
+	// enabled, starting at 1.
+	Decision uint64 `json:"decision"`
+
+	Explanation
+}
+
+// SetDecisionSampling enables the recording of 1 in each Every load balancer
+// decisions in a bounded buffer, retrievable with DecisionSamples. Changing
+// the sampling discards the samples recorded so far. It is go routine safe.
+func (d *discovery) SetDecisionSampling(sampling DecisionSampling) {
+	d.decisionSamplingLock.Lock()
+	defer d.decisionSamplingLock.Unlock()
+
+	d.decisionSampling = sampling
+	d.decisions = 0
+	d.decisionSamples = nil
+}
+
+// DecisionSamples returns the recorded decisions, from the oldest to the most
+// recent one. The samples are kept, so the method can be called many times.
+func (d *discovery) DecisionSamples() []DecisionSample {
+	d.decisionSamplingLock.Lock()
+	defer d.decisionSamplingLock.Unlock()
+
+	samples := make([]DecisionSample, len(d.decisionSamples))
+	copy(samples, d.decisionSamples)
+	return samples
+}
+
+// sampleDecision counts the last choice, recording it when it is selected by
+// the sampling. The caller must hold the servers read lock and the choice lock.
+func (d *discovery) sampleDecision() {
+	d.decisionSamplingLock.Lock()
+	defer d.decisionSamplingLock.Unlock()
+
+	sampling := d.decisionSampling
+	if sampling.Every == 0 || sampling.Capacity <= 0 {
+		return
+	}
+
+	d.decisions++
+	if d.decisions%sampling.Every != 0 {
+		return
+	}
+
+	if len(d.decisionSamples) >= sampling.Capacity {
+		d.decisionSamples = append(d.decisionSamples[:0], d.decisionSamples[len(d.decisionSamples)-sampling.Capacity+1:]...)
+	}
+
+	d.decisionSamples = append(d.decisionSamples, DecisionSample{
+		Decision:    d.decisions,
+		Explanation: d.explain(),
+	})
+}
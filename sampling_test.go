@@ -0,0 +1,92 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetDecisionSampling(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description       string
+		sampling          dnsdisco.DecisionSampling
+		choices           int
+		expectedDecisions []uint64
+	}{
+		{
+			description: "it should not sample by default",
+			choices:     10,
+		},
+		{
+			description:       "it should sample 1 in N decisions",
+			sampling:          dnsdisco.DecisionSampling{Every: 3, Capacity: 10},
+			choices:           10,
+			expectedDecisions: []uint64{3, 6, 9},
+		},
+		{
+			description:       "it should keep only the most recent samples",
+			sampling:          dnsdisco.DecisionSampling{Every: 2, Capacity: 2},
+			choices:           10,
+			expectedDecisions: []uint64{8, 10},
+		},
+		{
+			description:       "it should sample all decisions",
+			sampling:          dnsdisco.DecisionSampling{Every: 1, Capacity: 3},
+			choices:           2,
+			expectedDecisions: []uint64{1, 2},
+		},
+	}
+
+	for _, item := range scenarios {
+		item := item
+
+		t.Run(item.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 20},
+					{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return true, nil
+			}))
+			discovery.(dnsdisco.DecisionSampler).SetDecisionSampling(item.sampling)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while refreshing. Details: %s", err)
+			}
+
+			winners := make(map[uint64]string)
+			for i := 1; i <= item.choices; i++ {
+				target, _ := discovery.Choose()
+				winners[uint64(i)] = target
+			}
+
+			var decisions []uint64
+			for _, sample := range discovery.(dnsdisco.DecisionSampler).DecisionSamples() {
+				decisions = append(decisions, sample.Decision)
+
+				if sample.Target != winners[sample.Decision] {
+					t.Errorf("mismatch winner of decision %d. Expecting: “%s”; found “%s”",
+						sample.Decision, winners[sample.Decision], sample.Target)
+				}
+
+				if len(sample.Servers) != 2 {
+					t.Errorf("mismatch number of servers in decision %d. Expecting: “2”; found “%d”",
+						sample.Decision, len(sample.Servers))
+				}
+			}
+
+			if !reflect.DeepEqual(item.expectedDecisions, decisions) {
+				t.Errorf("mismatch sampled decisions. Expecting: “%v”; found “%v”", item.expectedDecisions, decisions)
+			}
+		})
+	}
+}
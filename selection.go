@@ -0,0 +1,145 @@
+package dnsdisco
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// selectionBucket is the granularity of the selection windows.
+	selectionBucket = 5 * time.Second
+
+	// selectionBuckets is the number of buckets needed to cover the largest
+	// selection window (15 minutes).
+	selectionBuckets = int(15 * time.Minute / selectionBucket)
+)
+
+// selectionWindows are the sliding windows reported by the Stats method.
+var selectionWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// SelectionRate stores how many times a server was chosen in a sliding window.
+type SelectionRate struct {
+	// Window is the size of the sliding window.
+	Window time.Duration
+
+	// Selections is the number of times that the server was chosen in the
+	// window.
+	Selections int
+
+	// Rate is the number of selections per second in the window.
+	Rate float64
+
+	// Share is the fraction (0-1) of all selections in the window that chose
+	// the server. It can be compared with the weight share of the server inside
+	// its priority.
+	Share float64
+}
+
+// TargetStats stores the selection statistics of a server.
+type TargetStats struct {
+	Target   string
+	Port     uint16
+	Priority uint16
+	Weight   uint16
+
+	// Windows stores the selections of the last 1, 5 and 15 minutes.
+	Windows []SelectionRate
+}
+
+// selectionRing counts the selections of a server in buckets of
+// selectionBucket, reusing the buckets older than the largest window.
+type selectionRing struct {
+	epochs [selectionBuckets]int64
+	counts [selectionBuckets]int
+}
+
+// add counts a selection at the given time.
+func (r *selectionRing) add(now time.Time) {
+	epoch := now.UnixNano() / int64(selectionBucket)
+	i := int(epoch % int64(selectionBuckets))
+	if r.epochs[i] != epoch {
+		r.epochs[i] = epoch
+		r.counts[i] = 0
+	}
+	r.counts[i]++
+}
+
+// count returns the number of selections in the window ending at the given
+// time.
+func (r *selectionRing) count(now time.Time, window time.Duration) int {
+	epoch := now.UnixNano() / int64(selectionBucket)
+	oldest := epoch - int64(window/selectionBucket)
+
+	var total int
+	for i := range r.epochs {
+		if r.epochs[i] > oldest && r.epochs[i] <= epoch {
+			total += r.counts[i]
+		}
+	}
+	return total
+}
+
+// recordSelection adds the chosen server to the selection windows. The caller
+// must hold the servers read lock and the choice lock.
+func (d *discovery) recordSelection(target string, port uint16, now time.Time) {
+	if d.selections == nil {
+		d.selections = make(map[string]*selectionRing)
+	}
+
+	key := net.JoinHostPort(target, strconv.FormatUint(uint64(port), 10))
+	ring, ok := d.selections[key]
+	if !ok {
+		ring = new(selectionRing)
+		d.selections[key] = ring
+	}
+	ring.add(now)
+}
+
+// Stats returns how many times each known server was chosen in the last 1, 5
+// and 15 minutes, so the operators can verify that the real distribution of
+// the load balancer matches the published weights. It is go routine safe.
+func (d *discovery) Stats() []TargetStats {
+	d.serversLock.RLock()
+	defer d.serversLock.RUnlock()
+
+	d.choiceLock.Lock()
+	defer d.choiceLock.Unlock()
+
+	now := time.Now()
+
+	totals := make([]int, len(selectionWindows))
+	for _, ring := range d.selections {
+		for i, window := range selectionWindows {
+			totals[i] += ring.count(now, window)
+		}
+	}
+
+	stats := make([]TargetStats, 0, len(d.servers))
+	for _, server := range d.servers {
+		targetStats := TargetStats{
+			Target:   server.Target,
+			Port:     server.Port,
+			Priority: server.Priority,
+			Weight:   server.Weight,
+			Windows:  make([]SelectionRate, 0, len(selectionWindows)),
+		}
+
+		ring := d.selections[server.address()]
+		for i, window := range selectionWindows {
+			rate := SelectionRate{Window: window}
+			if ring != nil {
+				rate.Selections = ring.count(now, window)
+			}
+			rate.Rate = float64(rate.Selections) / window.Seconds()
+			if totals[i] > 0 {
+				rate.Share = float64(rate.Selections) / float64(totals[i])
+			}
+			targetStats.Windows = append(targetStats.Windows, rate)
+		}
+
+		stats = append(stats, targetStats)
+	}
+
+	return stats
+}
@@ -0,0 +1,115 @@
+package dnsdisco
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSelectionRing(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		description   string
+		selections    []time.Duration
+		window        time.Duration
+		expectedCount int
+	}{
+		{
+			description:   "it should count the selections inside the window",
+			selections:    []time.Duration{0, 10 * time.Second, 50 * time.Second},
+			window:        time.Minute,
+			expectedCount: 3,
+		},
+		{
+			description:   "it should ignore the selections outside the window",
+			selections:    []time.Duration{0, 2 * time.Minute, 10 * time.Minute},
+			window:        time.Minute,
+			expectedCount: 1,
+		},
+		{
+			description:   "it should reuse the buckets older than the largest window",
+			selections:    []time.Duration{0, 15 * time.Minute, 30 * time.Minute},
+			window:        15 * time.Minute,
+			expectedCount: 1,
+		},
+		{
+			description:   "it should count the selections of the largest window",
+			selections:    []time.Duration{0, 6 * time.Minute, 14 * time.Minute},
+			window:        15 * time.Minute,
+			expectedCount: 3,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			var ring selectionRing
+			var last time.Time
+			for _, selection := range scenario.selections {
+				last = now.Add(selection)
+				ring.add(last)
+			}
+
+			if count := ring.count(last, scenario.window); count != scenario.expectedCount {
+				t.Errorf("mismatch count. Expecting: “%d”; found “%d”", scenario.expectedCount, count)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	discovery := buildDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 30},
+			{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		return true, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for i := 0; i < 40; i++ {
+		discovery.Choose()
+	}
+
+	stats := discovery.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("mismatch number of targets. Expecting: “2”; found “%d”", len(stats))
+	}
+
+	for i, window := range selectionWindows {
+		var selections int
+		var share float64
+		for _, targetStats := range stats {
+			if targetStats.Windows[i].Window != window {
+				t.Errorf("mismatch window. Expecting: “%s”; found “%s”", window, targetStats.Windows[i].Window)
+			}
+			selections += targetStats.Windows[i].Selections
+			share += targetStats.Windows[i].Share
+		}
+
+		if selections != 40 {
+			t.Errorf("mismatch selections in window %s. Expecting: “40”; found “%d”", window, selections)
+		}
+
+		if share < 0.999 || share > 1.001 {
+			t.Errorf("mismatch share in window %s. Expecting: “1”; found “%f”", window, share)
+		}
+	}
+
+	if rate := stats[0].Windows[0].Rate; rate != float64(stats[0].Windows[0].Selections)/60 {
+		t.Errorf("mismatch rate. Expecting: “%f”; found “%f”", float64(stats[0].Windows[0].Selections)/60, rate)
+	}
+}
@@ -0,0 +1,84 @@
+package dnsdisco
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// ServiceDefaults stores the well-known settings of a service, used when the
+// library user doesn't define them.
+type ServiceDefaults struct {
+	// Port is the default port of the service. Discover returns the name with
+	// this port when the domain doesn't publish SRV records for the service,
+	// as the clients of most protocols do. A zero port disables the fallback.
+	Port uint16
+
+	// HealthChecker is the health check strategy of the servers. If nil the
+	// default health checker (simple connection) is used.
+	HealthChecker HealthChecker
+}
+
+var (
+	// serviceDefaults stores the settings of each service name.
+	serviceDefaults = map[string]ServiceDefaults{
+		"http":        {Port: 80, HealthChecker: NewHTTPHealthChecker("/", 0)},
+		"xmpp-client": {Port: 5222, HealthChecker: NewXMPPHealthChecker("jabber:client", 0)},
+		"xmpp-server": {Port: 5269, HealthChecker: NewXMPPHealthChecker("jabber:server", 0)},
+		"sip":         {Port: 5060, HealthChecker: NewSIPHealthChecker(0)},
+		"sips":        {Port: 5061},
+		"ldap":        {Port: 389},
+		"minecraft":   {Port: 25565},
+		"mongodb":     {Port: 27017},
+	}
+
+	// serviceDefaultsLock make it safe to register services while the library
+	// is executing the operations.
+	serviceDefaultsLock sync.RWMutex
+)
+
+// RegisterServiceDefaults defines the settings of the service, replacing the
+// built-in ones (http, xmpp-client, xmpp-server, sip, sips, ldap, minecraft
+// and mongodb). The built-in http, xmpp-client, xmpp-server and sip services
+// check the servers with the protocol (see SetProtocolHealthCheck). The
+// settings are used by the discoveries built after the registration. It is go
+// routine safe, but the services are usually registered in the package
+// initialization.
+func RegisterServiceDefaults(service string, defaults ServiceDefaults) {
+	serviceDefaultsLock.Lock()
+	defer serviceDefaultsLock.Unlock()
+	serviceDefaults[service] = defaults
+}
+
+// LookupServiceDefaults returns the settings of the service, if registered.
+func LookupServiceDefaults(service string) (ServiceDefaults, bool) {
+	serviceDefaultsLock.RLock()
+	defer serviceDefaultsLock.RUnlock()
+
+	defaults, ok := serviceDefaults[service]
+	return defaults, ok
+}
+
+// serviceHealthChecker returns the health checker of the service, or the
+// default one when there's no registered strategy.
+func serviceHealthChecker(service, proto string) ServerHealthChecker {
+	if defaults, ok := LookupServiceDefaults(service); ok && defaults.HealthChecker != nil {
+		return AdaptHealthChecker(defaults.HealthChecker, proto)
+	}
+	return AdaptHealthChecker(configuredHealthChecker(), proto)
+}
+
+// defaultPort returns the default port of the service when the lookup failed
+// because the domain doesn't publish the SRV records.
+func defaultPort(service string, err error) (uint16, bool) {
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		return 0, false
+	}
+
+	defaults, ok := LookupServiceDefaults(service)
+	if !ok || defaults.Port == 0 {
+		return 0, false
+	}
+	return defaults.Port, true
+}
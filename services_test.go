@@ -0,0 +1,92 @@
+package dnsdisco
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestDefaultPort(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description  string
+		service      string
+		err          error
+		expectedPort uint16
+		expectedOK   bool
+	}{
+		{
+			description:  "it should use the default port when there's no SRV record",
+			service:      "xmpp-server",
+			err:          &net.DNSError{Err: "no such host", Name: "_xmpp-server._tcp.example.com", IsNotFound: true},
+			expectedPort: 5269,
+			expectedOK:   true,
+		},
+		{
+			description: "it should not use the default port when the lookup fails",
+			service:     "xmpp-server",
+			err:         &net.DNSError{Err: "i/o timeout", Name: "_xmpp-server._tcp.example.com", IsTimeout: true},
+		},
+		{
+			description: "it should not use the default port of an unknown service",
+			service:     "unknown",
+			err:         &net.DNSError{Err: "no such host", Name: "_unknown._tcp.example.com", IsNotFound: true},
+		},
+		{
+			description: "it should not use the default port for other errors",
+			service:     "ldap",
+			err:         errors.New("generic error"),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			port, ok := defaultPort(scenario.service, scenario.err)
+			if port != scenario.expectedPort || ok != scenario.expectedOK {
+				t.Errorf("mismatch default ports. Expecting: “%d” (%t); found “%d” (%t)", scenario.expectedPort, scenario.expectedOK, port, ok)
+			}
+		})
+	}
+}
+
+func TestRegisterServiceDefaults(t *testing.T) {
+	t.Parallel()
+
+	var checked []string
+	RegisterServiceDefaults("dnsdisco-registry", ServiceDefaults{
+		Port: 1234,
+		HealthChecker: HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+			checked = append(checked, target)
+			return target == "server2.example.com.", nil
+		}),
+	})
+
+	defaults, ok := LookupServiceDefaults("dnsdisco-registry")
+	if !ok || defaults.Port != 1234 {
+		t.Fatalf("mismatch service defaults. Expecting: “1234”; found “%d” (%t)", defaults.Port, ok)
+	}
+
+	discovery := NewDiscovery("dnsdisco-registry", "tcp", "example.com")
+	discovery.SetRetriever(RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1234, Priority: 10, Weight: 10},
+			{Target: "server2.example.com.", Port: 1234, Priority: 20, Weight: 10},
+		}, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	if len(checked) != 2 {
+		t.Errorf("the registered health checker wasn't used. Checked servers: %v", checked)
+	}
+
+	if target, _ := discovery.Choose(); target != "server2.example.com." {
+		t.Errorf("mismatch targets. Expecting: “server2.example.com.”; found “%s”", target)
+	}
+}
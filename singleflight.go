@@ -0,0 +1,82 @@
+package dnsdisco
+
+import "errors"
+
+// ErrRefreshInProgress is returned by Refresh when there's already a refresh
+// in progress and the RefreshConcurrencyReject mode is defined.
+var ErrRefreshInProgress = errors.New("dnsdisco: refresh in progress")
+
+// RefreshConcurrency defines what happens when Refresh is called while another
+// refresh is still in progress. In all modes only one refresh is executed at a
+// time, so concurrent refreshes don't send duplicate DNS requests that race to
+// overwrite the servers.
+type RefreshConcurrency int
+
+const (
+	// RefreshConcurrencyWait waits for the refresh in progress and returns its
+	// result. It is the default mode.
+	RefreshConcurrencyWait RefreshConcurrency = iota
+
+	// RefreshConcurrencyReject returns ErrRefreshInProgress immediately.
+	RefreshConcurrencyReject
+)
+
+// refreshCall stores the result of a refresh shared by many callers.
+type refreshCall struct {
+	// done is closed when the refresh finishes.
+	done chan struct{}
+
+	// err is the result of the refresh, only valid after done is closed.
+	err error
+}
+
+// SetRefreshConcurrency defines what the Refresh calls do when there's
+// already a refresh in progress: wait and share its result (default) or
+// return ErrRefreshInProgress. The asynchronous refreshes always wait. It is go
+// routine safe.
+func (d *discovery) SetRefreshConcurrency(mode RefreshConcurrency) {
+	d.refreshCallLock.Lock()
+	defer d.refreshCallLock.Unlock()
+	d.refreshConcurrency = mode
+}
+
+// refreshConcurrencyMode returns the mode defined with SetRefreshConcurrency.
+func (d *discovery) refreshConcurrencyMode() RefreshConcurrency {
+	d.refreshCallLock.Lock()
+	defer d.refreshCallLock.Unlock()
+	return d.refreshConcurrency
+}
+
+// singleFlightRefresh refreshes the servers, unless there's already a refresh
+// in progress. In this case it waits and returns the same result, or returns
+// ErrRefreshInProgress, according to the mode.
+func (d *discovery) singleFlightRefresh(mode RefreshConcurrency) error {
+	d.refreshCallLock.Lock()
+	if call := d.refreshCall; call != nil {
+		d.refreshCallLock.Unlock()
+
+		if mode == RefreshConcurrencyReject {
+			return ErrRefreshInProgress
+		}
+
+		<-call.done
+		return call.err
+	}
+
+	call := &refreshCall{done: make(chan struct{})}
+	d.refreshCall = call
+	d.refreshCallLock.Unlock()
+
+	// the waiting callers must be released even if a component panics
+	defer func() {
+		d.refreshCallLock.Lock()
+		d.refreshCall = nil
+		d.refreshCallLock.Unlock()
+
+		close(call.done)
+		d.startReResolution()
+	}()
+
+	call.err = d.refreshServers()
+	return call.err
+}
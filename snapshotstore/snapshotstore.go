@@ -0,0 +1,321 @@
+// Package snapshotstore uploads the snapshots of the discoveries to remote
+// stores (HTTP endpoints, Amazon S3 and Google Cloud Storage), implementing
+// the dnsdisco.SnapshotPublisher interface, so fleet-wide dashboards can show
+// the topology that each client believes in.
+//
+// To avoid depending on the cloud providers SDKs, the objects are uploaded
+// with plain HTTP PUT requests, signed with AWS Signature Version 4 for S3 and
+// authenticated with an OAuth 2.0 access token for GCS.
+package snapshotstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+// UploadError is returned when the store doesn't accept the snapshot.
+type UploadError struct {
+	// URL is the address where the snapshot was uploaded.
+	URL string
+
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Body is the beginning of the response body, that usually describes the
+	// problem.
+	Body string
+}
+
+// Error returns the problem description.
+func (u UploadError) Error() string {
+	return fmt.Sprintf("snapshotstore: upload to %s failed with status %d: %s", u.URL, u.StatusCode, u.Body)
+}
+
+// maxErrorBody limits the response body stored in the UploadError.
+const maxErrorBody = 512
+
+// NewHTTPPublisher builds a publisher that uploads the snapshots in JSON to the
+// URL with HTTP PUT requests, adding the headers (e.g. Authorization). Any
+// response status 2xx is a success. If the client is nil the
+// http.DefaultClient is used.
+func NewHTTPPublisher(rawURL string, header http.Header, client *http.Client) dnsdisco.SnapshotPublisher {
+	return dnsdisco.SnapshotPublisherFunc(func(ctx context.Context, snapshot dnsdisco.Snapshot) error {
+		body, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+
+		request, err := newRequest(ctx, rawURL, body)
+		if err != nil {
+			return err
+		}
+
+		for key, values := range header {
+			for _, value := range values {
+				request.Header.Add(key, value)
+			}
+		}
+
+		return send(client, request)
+	})
+}
+
+// S3Config stores the location of the snapshot in Amazon S3 (or a compatible
+// store) and the credentials used to sign the requests.
+type S3Config struct {
+	// Region is the region of the bucket (e.g. "us-east-1").
+	Region string
+
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Key is the name of the object, usually unique for each client (e.g.
+	// "dnsdisco/host1.json").
+	Key string
+
+	// AccessKeyID and SecretAccessKey are the credentials used to sign the
+	// requests.
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is the token of temporary credentials, if any.
+	SessionToken string
+
+	// Endpoint replaces the address of Amazon S3, for compatible stores (e.g.
+	// "https://minio.example.com:9000"). The bucket is used in the path.
+	// When empty the virtual-hosted style address of the bucket is used.
+	Endpoint string
+}
+
+// url returns the address of the object.
+func (s S3Config) url() string {
+	if s.Endpoint != "" {
+		return strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + "/" + escapePath(s.Key)
+	}
+	return "https://" + s.Bucket + ".s3." + s.Region + ".amazonaws.com/" + escapePath(s.Key)
+}
+
+// NewS3Publisher builds a publisher that uploads the snapshots in JSON to an
+// object of Amazon S3, signing the requests with AWS Signature Version 4. If
+// the client is nil the http.DefaultClient is used.
+func NewS3Publisher(config S3Config, client *http.Client) dnsdisco.SnapshotPublisher {
+	return dnsdisco.SnapshotPublisherFunc(func(ctx context.Context, snapshot dnsdisco.Snapshot) error {
+		body, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+
+		request, err := newRequest(ctx, config.url(), body)
+		if err != nil {
+			return err
+		}
+
+		if config.SessionToken != "" {
+			request.Header.Set("X-Amz-Security-Token", config.SessionToken)
+		}
+
+		signV4(request, body, config.AccessKeyID, config.SecretAccessKey, config.Region, "s3", time.Now())
+		return send(client, request)
+	})
+}
+
+// GCSConfig stores the location of the snapshot in Google Cloud Storage and
+// how the requests are authenticated.
+type GCSConfig struct {
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Object is the name of the object, usually unique for each client (e.g.
+	// "dnsdisco/host1.json").
+	Object string
+
+	// Token returns the OAuth 2.0 access token used in the requests, so it can
+	// be refreshed (e.g. with the golang.org/x/oauth2 token sources).
+	Token func(ctx context.Context) (string, error)
+
+	// Endpoint replaces the address of Google Cloud Storage, for tests and
+	// emulators. When empty "https://storage.googleapis.com" is used.
+	Endpoint string
+}
+
+// NewGCSPublisher builds a publisher that uploads the snapshots in JSON to an
+// object of Google Cloud Storage, using the XML API. If the client is nil the
+// http.DefaultClient is used.
+func NewGCSPublisher(config GCSConfig, client *http.Client) dnsdisco.SnapshotPublisher {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://storage.googleapis.com"
+	}
+	rawURL := strings.TrimSuffix(endpoint, "/") + "/" + config.Bucket + "/" + escapePath(config.Object)
+
+	return dnsdisco.SnapshotPublisherFunc(func(ctx context.Context, snapshot dnsdisco.Snapshot) error {
+		body, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+
+		token, err := config.Token(ctx)
+		if err != nil {
+			return err
+		}
+
+		request, err := newRequest(ctx, rawURL, body)
+		if err != nil {
+			return err
+		}
+
+		request.Header.Set("Authorization", "Bearer "+token)
+		return send(client, request)
+	})
+}
+
+// newRequest builds the PUT request of the snapshot.
+func newRequest(ctx context.Context, rawURL string, body []byte) (*http.Request, error) {
+	request, err := http.NewRequest(http.MethodPut, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	return request.WithContext(ctx), nil
+}
+
+// send executes the request, checking the response status.
+func send(client *http.Client, request *http.Request) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		io.Copy(io.Discard, response.Body)
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+	return UploadError{
+		URL:        request.URL.String(),
+		StatusCode: response.StatusCode,
+		Body:       string(body),
+	}
+}
+
+// signV4 signs the request with AWS Signature Version 4, using all headers of
+// the request and the host.
+func signV4(request *http.Request, body []byte, accessKeyID, secretAccessKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256.Sum256(body)
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": request.URL.Host}
+	for key, values := range request.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery returns the query string sorted by key, as required by the
+// signature.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, escape(key)+"="+escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath escapes each segment of the object name, keeping the slashes.
+func escapePath(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// escape encodes all characters except the unreserved ones (RFC 3986), as
+// required by the signature.
+func escape(value string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
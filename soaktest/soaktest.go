@@ -0,0 +1,232 @@
+// Package soaktest runs the background operations of a discovery (asynchronous
+// refreshes, paced health checks and the user extensions called by them) for
+// long simulated durations, using a fake clock, and checks that no go routine
+// or timer is leaked along the way. A leak of a single resource per refresh is
+// invisible in a short test, but exhausts the process after some days. The
+// extensions that need timers should receive the same clock (see FakeClock),
+// so their timers are also tracked.
+//
+// The go routines are counted for the whole process, so the soak tests must
+// not run in parallel with other tests.
+package soaktest
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+// settleTimeout is the real time that the background operations have to finish
+// their work after each step of the simulation.
+const settleTimeout = time.Second
+
+// FakeClock is a dnsdisco.Clock that only moves when Advance is called. It
+// tracks the active timers, so the timers created and never stopped are
+// detected.
+type FakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+	lock   sync.Mutex
+}
+
+// NewFakeClock returns a fake clock starting at the given time.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the current time of the fake clock.
+func (f *FakeClock) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// NewTimer creates a timer that fires when the fake clock reaches the
+// duration.
+func (f *FakeClock) NewTimer(d time.Duration) dnsdisco.Timer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	timer := &fakeTimer{
+		clock:    f,
+		deadline: f.now.Add(d),
+		c:        make(chan time.Time, 1),
+	}
+
+	if d <= 0 {
+		timer.c <- f.now
+		return timer
+	}
+
+	f.timers = append(f.timers, timer)
+	return timer
+}
+
+// Advance moves the fake clock, firing the timers in the order of their
+// deadlines.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.now = f.now.Add(d)
+
+	sort.Slice(f.timers, func(i, j int) bool {
+		return f.timers[i].deadline.Before(f.timers[j].deadline)
+	})
+
+	var active []*fakeTimer
+	for _, timer := range f.timers {
+		if timer.deadline.After(f.now) {
+			active = append(active, timer)
+			continue
+		}
+		timer.c <- timer.deadline
+	}
+	f.timers = active
+}
+
+// ActiveTimers returns the number of timers that weren't fired or stopped.
+func (f *FakeClock) ActiveTimers() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.timers)
+}
+
+// WaitForTimers waits (in real time) until there are at least n active timers,
+// what means that the background operations are waiting for the clock again.
+// It returns false if the timeout expires before.
+func (f *FakeClock) WaitForTimers(n int, timeout time.Duration) bool {
+	return eventually(timeout, func() bool {
+		return f.ActiveTimers() >= n
+	})
+}
+
+// fakeTimer is a timer of the FakeClock.
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	c        chan time.Time
+}
+
+// C returns the channel that receives the time when the timer fires.
+func (f *fakeTimer) C() <-chan time.Time {
+	return f.c
+}
+
+// Stop removes the timer from the active ones.
+func (f *fakeTimer) Stop() bool {
+	f.clock.lock.Lock()
+	defer f.clock.lock.Unlock()
+
+	for i, timer := range f.clock.timers {
+		if timer == f {
+			f.clock.timers = append(f.clock.timers[:i], f.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Config defines the soak test.
+type Config struct {
+	// Interval is the interval of the asynchronous refreshes.
+	Interval time.Duration
+
+	// Duration is the simulated duration of the test (e.g. 30 days).
+	Duration time.Duration
+
+	// Start is the initial time of the fake clock. If zero the current time is
+	// used.
+	Start time.Time
+}
+
+// Run starts the asynchronous refreshes of the discovery with a fake clock,
+// advancing it by the interval until the duration is simulated, and reports a
+// test error when the number of go routines or active timers grows during the
+// simulation, or when they aren't released after the refreshes are stopped.
+// The discovery should be configured with all extensions under test (retriever,
+// health checker, load balancer, etc.) before calling Run, and must implement
+// the dnsdisco.Scheduler interface to use the fake clock.
+func Run(t testing.TB, discovery dnsdisco.Discovery, config Config) {
+	t.Helper()
+
+	scheduler, ok := discovery.(dnsdisco.Scheduler)
+	if !ok {
+		t.Fatal("soaktest: the discovery doesn't accept a clock")
+	}
+
+	if config.Interval <= 0 {
+		t.Fatal("soaktest: the interval must be positive")
+	}
+
+	if config.Start.IsZero() {
+		config.Start = time.Now()
+	}
+
+	baseline := runtime.NumGoroutine()
+
+	clock := NewFakeClock(config.Start)
+	scheduler.SetClock(clock)
+	finish := discovery.RefreshAsync(config.Interval)
+
+	if !clock.WaitForTimers(1, settleTimeout) {
+		close(finish)
+		t.Fatal("soaktest: the asynchronous refreshes aren't waiting for the clock")
+	}
+
+	goroutines := runtime.NumGoroutine()
+	timers := clock.ActiveTimers()
+
+	for elapsed := time.Duration(0); elapsed < config.Duration; elapsed += config.Interval {
+		clock.Advance(config.Interval)
+		if !clock.WaitForTimers(timers, settleTimeout) {
+			close(finish)
+			t.Fatalf("soaktest: the asynchronous refreshes stopped after %s", elapsed+config.Interval)
+		}
+	}
+
+	if !eventually(settleTimeout, func() bool { return runtime.NumGoroutine() <= goroutines }) {
+		t.Errorf("soaktest: go routines leaked after %s: %d at the start, %d at the end",
+			config.Duration, goroutines, runtime.NumGoroutine())
+	}
+
+	if active := clock.ActiveTimers(); active > timers {
+		t.Errorf("soaktest: timers leaked after %s: %d at the start, %d at the end", config.Duration, timers, active)
+	}
+
+	close(finish)
+
+	if !eventually(settleTimeout, func() bool { return runtime.NumGoroutine() <= baseline }) {
+		t.Errorf("soaktest: go routines not released after stopping the refreshes: %d before, %d after",
+			baseline, runtime.NumGoroutine())
+	}
+
+	if !eventually(settleTimeout, func() bool { return clock.ActiveTimers() == 0 }) {
+		t.Errorf("soaktest: timers not stopped after stopping the refreshes: %d", clock.ActiveTimers())
+	}
+}
+
+// eventually checks the condition until it is true or the timeout expires. It
+// yields the processor before sleeping, as the background operations usually
+// finish their work in a few scheduling rounds.
+func eventually(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for i := 0; ; i++ {
+		if condition() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		if i < 100 {
+			runtime.Gosched()
+		} else {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
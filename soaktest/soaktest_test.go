@@ -0,0 +1,169 @@
+package soaktest_test
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+	"github.com/rafaeljusto/dnsdisco/soaktest"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := soaktest.NewFakeClock(start)
+
+	first := clock.NewTimer(time.Minute)
+	second := clock.NewTimer(time.Hour)
+	stopped := clock.NewTimer(time.Minute)
+
+	if !stopped.Stop() {
+		t.Error("the active timer wasn't stopped")
+	}
+
+	if active := clock.ActiveTimers(); active != 2 {
+		t.Errorf("mismatch active timers. Expecting: “2”; found “%d”", active)
+	}
+
+	clock.Advance(2 * time.Minute)
+
+	select {
+	case fired := <-first.C():
+		if !fired.Equal(start.Add(time.Minute)) {
+			t.Errorf("mismatch fire time. Expecting: “%s”; found “%s”", start.Add(time.Minute), fired)
+		}
+	default:
+		t.Error("the timer didn't fire")
+	}
+
+	select {
+	case <-second.C():
+		t.Error("the timer fired too early")
+	case <-stopped.C():
+		t.Error("the stopped timer fired")
+	default:
+	}
+
+	if active := clock.ActiveTimers(); active != 1 {
+		t.Errorf("mismatch active timers. Expecting: “1”; found “%d”", active)
+	}
+
+	if now := clock.Now(); !now.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("mismatch current time. Expecting: “%s”; found “%s”", start.Add(2*time.Minute), now)
+	}
+}
+
+// The soak tests aren't parallel, as they count the go routines of the whole
+// process.
+func TestRun(t *testing.T) {
+	scenarios := []struct {
+		description    string
+		pacing         bool
+		leak           bool
+		expectedErrors bool
+	}{
+		{
+			description: "it should not detect leaks",
+		},
+		{
+			description: "it should not detect leaks with paced health checks",
+			pacing:      true,
+		},
+		{
+			description:    "it should detect a go routine leaked by the health checker",
+			leak:           true,
+			expectedErrors: true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			release := make(chan struct{})
+			defer close(release)
+
+			var retrievals int
+			var retrievalsLock sync.Mutex
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				retrievalsLock.Lock()
+				retrievals++
+				retrievalsLock.Unlock()
+
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+					{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				if scenario.leak {
+					go func() { <-release }()
+				}
+				return true, nil
+			}))
+			discovery.(dnsdisco.HealthManager).SetHealthCheckPacing(scenario.pacing)
+
+			recorder := &testRecorder{TB: t}
+			recorder.run(func() {
+				soaktest.Run(recorder, discovery, soaktest.Config{
+					Interval: time.Minute,
+					Duration: 24 * time.Hour,
+				})
+			})
+
+			if (len(recorder.errors) > 0) != scenario.expectedErrors {
+				t.Errorf("mismatch errors. Expecting errors: “%t”; found “%v”", scenario.expectedErrors, recorder.errors)
+			}
+
+			retrievalsLock.Lock()
+			defer retrievalsLock.Unlock()
+
+			// one refresh at the start and one for each simulated minute
+			if retrievals != 24*60+1 {
+				t.Errorf("mismatch refreshes. Expecting: “%d”; found “%d”", 24*60+1, retrievals)
+			}
+		})
+	}
+}
+
+// testRecorder stores the errors reported by the soak test, so the detection
+// of leaks can be tested.
+type testRecorder struct {
+	testing.TB
+
+	errors []string
+	lock   sync.Mutex
+}
+
+func (t *testRecorder) Helper() {}
+
+func (t *testRecorder) Errorf(format string, args ...interface{}) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *testRecorder) Fatal(args ...interface{}) {
+	t.lock.Lock()
+	t.errors = append(t.errors, fmt.Sprint(args...))
+	t.lock.Unlock()
+	runtime.Goexit()
+}
+
+func (t *testRecorder) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// run executes the function in a separated go routine, as Fatal stops it.
+func (t *testRecorder) run(f func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	<-done
+}
@@ -0,0 +1,75 @@
+package dnsdisco
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errNoHealthyServers is returned internally when the servers of the internal
+// name aren't used because none of them is healthy.
+var errNoHealthyServers = errors.New("dnsdisco: no healthy servers")
+
+// SplitHorizonError is a warning stored in the Errors list when the internal
+// name couldn't be used and the discovery failed over to the external name.
+type SplitHorizonError struct {
+	// Internal is the name that was queried first.
+	Internal string
+
+	// External is the name used instead.
+	External string
+
+	// Err is the problem of the internal name.
+	Err error
+}
+
+// Error returns the warning description.
+func (s SplitHorizonError) Error() string {
+	return fmt.Sprintf("dnsdisco: using %s, as %s failed: %s", s.External, s.Internal, s.Err)
+}
+
+// Unwrap returns the problem of the internal name.
+func (s SplitHorizonError) Unwrap() error {
+	return s.Err
+}
+
+// SetExternalName enables the split-horizon failover for clients that roam
+// between corporate and public networks. The name of the discovery is queried
+// first, and when the lookup fails or returns no healthy servers the external
+// name is used, storing a SplitHorizonError warning in the Errors list. An
+// empty name disables the failover. It is go routine safe.
+func (d *discovery) SetExternalName(name string) {
+	d.externalNameLock.Lock()
+	defer d.externalNameLock.Unlock()
+	d.externalName = name
+}
+
+// ActiveName returns the name of the servers retrieved in the last successful
+// refresh. Before the first refresh it is empty.
+func (d *discovery) ActiveName() string {
+	d.serversLock.RLock()
+	defer d.serversLock.RUnlock()
+	return d.activeName
+}
+
+// refreshSplitHorizon refreshes the servers of the internal name, failing over
+// to the external name.
+func (d *discovery) refreshSplitHorizon(externalName string) error {
+	// a quarantined answer keeps the previous servers, so there's no failover
+	internalErr := d.refresh(d.name, false)
+	if internalErr == nil || errors.Is(internalErr, ErrQuarantined) {
+		return internalErr
+	}
+
+	if err := d.refresh(externalName, true); err != nil {
+		return err
+	}
+
+	d.errorsLock.Lock()
+	d.errors = append(d.errors, SplitHorizonError{
+		Internal: d.name,
+		External: externalName,
+		Err:      internalErr,
+	})
+	d.errorsLock.Unlock()
+	return nil
+}
@@ -0,0 +1,111 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSplitHorizon(t *testing.T) {
+	t.Parallel()
+
+	internalErr := errors.New("no such host")
+
+	scenarios := []struct {
+		description        string
+		internalServers    []*net.SRV
+		internalErr        error
+		internalHealthy    bool
+		externalErr        error
+		expectedError      error
+		expectedActiveName string
+		expectedTarget     string
+		expectedErrors     int
+	}{
+		{
+			description: "it should use the internal name",
+			internalServers: []*net.SRV{
+				{Target: "internal.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			},
+			internalHealthy:    true,
+			expectedActiveName: "corp.example.com",
+			expectedTarget:     "internal.example.com.",
+		},
+		{
+			description:        "it should fail over when the internal lookup fails",
+			internalErr:        internalErr,
+			expectedActiveName: "example.com",
+			expectedTarget:     "external.example.com.",
+			expectedErrors:     1,
+		},
+		{
+			description: "it should fail over when no internal server is healthy",
+			internalServers: []*net.SRV{
+				{Target: "internal.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			},
+			expectedActiveName: "example.com",
+			expectedTarget:     "external.example.com.",
+			expectedErrors:     1,
+		},
+		{
+			description:    "it should return the error of the external name",
+			internalErr:    internalErr,
+			externalErr:    errors.New("timeout"),
+			expectedError:  errors.New("timeout"),
+			expectedErrors: 0,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "corp.example.com")
+			discovery.(dnsdisco.RecordConfigurer).SetExternalName("example.com")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				if name == "corp.example.com" {
+					return scenario.internalServers, scenario.internalErr
+				}
+
+				return []*net.SRV{
+					{Target: "external.example.com.", Port: 2222, Priority: 10, Weight: 10},
+				}, scenario.externalErr
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+				return target != "internal.example.com." || scenario.internalHealthy, nil
+			}))
+
+			if err := discovery.Refresh(); !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Fatalf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+
+			if name := discovery.(dnsdisco.Inspector).ActiveName(); name != scenario.expectedActiveName {
+				t.Errorf("mismatch active names. Expecting: “%s”; found “%s”", scenario.expectedActiveName, name)
+			}
+
+			if target, _ := discovery.Choose(); target != scenario.expectedTarget {
+				t.Errorf("mismatch targets. Expecting: “%s”; found “%s”", scenario.expectedTarget, target)
+			}
+
+			var splitHorizonErrors int
+			for _, err := range discovery.Errors() {
+				var splitHorizonErr dnsdisco.SplitHorizonError
+				if errors.As(err, &splitHorizonErr) {
+					splitHorizonErrors++
+
+					if splitHorizonErr.Internal != "corp.example.com" || splitHorizonErr.External != "example.com" {
+						t.Errorf("unexpected names in the warning “%s”", splitHorizonErr)
+					}
+				}
+			}
+
+			if splitHorizonErrors != scenario.expectedErrors {
+				t.Errorf("mismatch number of warnings. Expecting: “%d”; found “%d”", scenario.expectedErrors, splitHorizonErrors)
+			}
+		})
+	}
+}
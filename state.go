@@ -0,0 +1,81 @@
+package dnsdisco
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrStateVersion is returned when the saved state was generated by an
+// incompatible version of the library.
+var ErrStateVersion = errors.New("dnsdisco: unsupported state version")
+
+// stateVersion identifies the format of the state saved by the discovery.
+const stateVersion = 1
+
+// StateSaver is an optional interface that a LoadBalancer can implement to
+// export and import its state (e.g. usage counters and affinity maps), so the
+// traffic distribution is kept after a process restart. The default load
+// balancer implements it.
+type StateSaver interface {
+	// SaveState returns the current state of the load balancer.
+	SaveState() ([]byte, error)
+
+	// LoadState restores a state returned by SaveState. It can be called
+	// before the servers are known, so the state of the servers that aren't
+	// available yet must be kept until they appear.
+	LoadState([]byte) error
+}
+
+// discoveryState is the document that stores the state of the discovery.
+type discoveryState struct {
+	Version      int    `json:"version"`
+	LoadBalancer []byte `json:"loadBalancer,omitempty"`
+}
+
+// SaveState returns the state of the discovery, that can be stored and
+// restored with LoadState after a restart (e.g. blue-green deploys). The load
+// balancer state is only included when it implements the StateSaver
+// interface.
+func (d *discovery) SaveState() ([]byte, error) {
+	d.serversLock.Lock()
+	defer d.serversLock.Unlock()
+
+	d.loadBalancerLock.RLock()
+	defer d.loadBalancerLock.RUnlock()
+
+	state := discoveryState{Version: stateVersion}
+
+	if stateSaver, ok := d.loadBalancer.(StateSaver); ok {
+		var err error
+		if state.LoadBalancer, err = stateSaver.SaveState(); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(state)
+}
+
+// LoadState restores the state returned by SaveState. It can be called before
+// the first refresh. The load balancer state is only restored when it
+// implements the StateSaver interface.
+func (d *discovery) LoadState(data []byte) error {
+	var state discoveryState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	if state.Version != stateVersion {
+		return ErrStateVersion
+	}
+
+	d.serversLock.Lock()
+	defer d.serversLock.Unlock()
+
+	d.loadBalancerLock.RLock()
+	defer d.loadBalancerLock.RUnlock()
+
+	if stateSaver, ok := d.loadBalancer.(StateSaver); ok && state.LoadBalancer != nil {
+		return stateSaver.LoadState(state.LoadBalancer)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSaveState(t *testing.T) {
+	t.Parallel()
+
+	newDiscovery := func() dnsdisco.Discovery {
+		discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+		discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+			return []*net.SRV{
+				{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+				{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+			}, nil
+		}))
+		discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+			return true, nil
+		}))
+		return discovery
+	}
+
+	discovery := newDiscovery()
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	// with equal weights the least used server is always chosen
+	first, _ := discovery.Choose()
+
+	state, err := discovery.(dnsdisco.StatePersister).SaveState()
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	restarted := newDiscovery()
+	if err := restarted.(dnsdisco.StatePersister).LoadState(state); err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+
+	if err := restarted.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	if target, _ := restarted.Choose(); target == first {
+		t.Errorf("usage counters weren't restored, “%s” chosen again", target)
+	}
+
+	if err := restarted.(dnsdisco.StatePersister).LoadState([]byte(`{"version":2}`)); err != dnsdisco.ErrStateVersion {
+		t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", dnsdisco.ErrStateVersion, err)
+	}
+}
@@ -0,0 +1,165 @@
+package dnsdisco
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultHealthHistorySize is the number of health check results kept for each
+// server by the default StatsStore.
+const defaultHealthHistorySize = 10
+
+// StatsStore allows the library user to define where the usage counters and
+// the health history of the servers are stored. When many instances of an
+// application share the same store (e.g. Redis) they can coordinate the load
+// balancing decisions. The key identifies the server of a service, and it is
+// built with the ServerStatsKey function.
+type StatsStore interface {
+	// IncrementUsed increments the number of times that the server was chosen,
+	// returning the new value.
+	IncrementUsed(key string) (int, error)
+
+	// Used returns the number of times that the server was chosen.
+	Used(key string) (int, error)
+
+	// AddHealth stores the result of a health check of the server.
+	AddHealth(key string, record HealthRecord) error
+
+	// Health returns the results of the last health checks of the server, from
+	// the oldest to the newest.
+	Health(key string) ([]HealthRecord, error)
+}
+
+// UsageLoadBalancer is an optional interface that a LoadBalancer can implement
+// to base its decisions on the usage counters of a shared StatsStore instead
+// of its own counters. The default load balancer implements it.
+type UsageLoadBalancer interface {
+	// SetUsage defines the function that returns the number of times that a
+	// server was chosen.
+	SetUsage(usage func(target string, port uint16) int)
+}
+
+// HealthRecord is the result of a health check stored in the StatsStore.
+type HealthRecord struct {
+	// Status is the health status of the server.
+	Status HealthStatus
+
+	// Checked is the moment of the health check.
+	Checked time.Time
+
+	// Latency is the time spent checking the server.
+	Latency time.Duration
+
+	// Error is the description of the health check failure, if any.
+	Error string
+}
+
+// ServerStatsKey builds the key that identifies a server of a service in the
+// StatsStore.
+func ServerStatsKey(service, proto, name, target string, port uint16) string {
+	return "_" + service + "._" + proto + "." + name + "/" + Server{SRV: net.SRV{Target: target, Port: port}}.address()
+}
+
+// NewMemoryStatsStore returns a StatsStore that keeps the statistics in memory,
+// and can only be shared between the discoveries of the same process. Only the
+// last historySize health check results are kept for each server. This is the
+// store used by default.
+func NewMemoryStatsStore(historySize int) StatsStore {
+	return &memoryStatsStore{
+		historySize: historySize,
+		stats:       make(map[string]*memoryStats),
+	}
+}
+
+// memoryStatsStore is the default implementation used when the library client
+// doesn't replace it using the SetStatsStore method.
+type memoryStatsStore struct {
+	historySize int
+	stats       map[string]*memoryStats
+
+	// statsLock make it safe to share the store between discoveries.
+	statsLock sync.RWMutex
+}
+
+// memoryStats stores the statistics of a server.
+type memoryStats struct {
+	used int
+
+	// health is a ring buffer with the last health check results, where next
+	// is the position of the next result.
+	health []HealthRecord
+	next   int
+}
+
+// IncrementUsed increments the number of times that the server was chosen,
+// returning the new value.
+func (m *memoryStatsStore) IncrementUsed(key string) (int, error) {
+	m.statsLock.Lock()
+	defer m.statsLock.Unlock()
+
+	stats := m.get(key)
+	stats.used++
+	return stats.used, nil
+}
+
+// Used returns the number of times that the server was chosen.
+func (m *memoryStatsStore) Used(key string) (int, error) {
+	m.statsLock.RLock()
+	defer m.statsLock.RUnlock()
+
+	if stats, ok := m.stats[key]; ok {
+		return stats.used, nil
+	}
+	return 0, nil
+}
+
+// AddHealth stores the result of a health check of the server, discarding the
+// oldest results when the history is full.
+func (m *memoryStatsStore) AddHealth(key string, record HealthRecord) error {
+	if m.historySize <= 0 {
+		return nil
+	}
+
+	m.statsLock.Lock()
+	defer m.statsLock.Unlock()
+
+	stats := m.get(key)
+	if len(stats.health) < m.historySize {
+		stats.health = append(stats.health, record)
+	} else {
+		stats.health[stats.next] = record
+	}
+	stats.next = (stats.next + 1) % m.historySize
+	return nil
+}
+
+// Health returns the results of the last health checks of the server, from the
+// oldest to the newest.
+func (m *memoryStatsStore) Health(key string) ([]HealthRecord, error) {
+	m.statsLock.RLock()
+	defer m.statsLock.RUnlock()
+
+	stats, ok := m.stats[key]
+	if !ok {
+		return nil, nil
+	}
+
+	// the oldest result is in the next position, or in the beginning while
+	// the ring buffer isn't full
+	health := make([]HealthRecord, 0, len(stats.health))
+	health = append(health, stats.health[stats.next:]...)
+	health = append(health, stats.health[:stats.next]...)
+	return health, nil
+}
+
+// get returns the statistics of the server, creating them if necessary. The
+// caller must hold the write lock.
+func (m *memoryStatsStore) get(key string) *memoryStats {
+	stats, ok := m.stats[key]
+	if !ok {
+		stats = new(memoryStats)
+		m.stats[key] = stats
+	}
+	return stats
+}
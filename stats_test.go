@@ -0,0 +1,175 @@
+package dnsdisco_test
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetStatsStore(t *testing.T) {
+	t.Parallel()
+
+	retriever := dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+		}, nil
+	})
+
+	healthChecker := dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	})
+
+	store := dnsdisco.NewMemoryStatsStore(5)
+
+	var discoveries []dnsdisco.Discovery
+	for i := 0; i < 2; i++ {
+		discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br.")
+		discovery.SetRetriever(retriever)
+		discovery.SetHealthChecker(healthChecker)
+		discovery.(dnsdisco.BalancingConfigurer).SetStatsStore(store)
+
+		if err := discovery.Refresh(); err != nil {
+			t.Fatalf("unexpected error “%v”", err)
+		}
+		discoveries = append(discoveries, discovery)
+	}
+
+	// the instances share the usage counters, so they alternate the servers
+	chosen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		target, _ := discoveries[i%2].Choose()
+		chosen[target]++
+	}
+
+	if chosen["server1.example.com."] != 2 || chosen["server2.example.com."] != 2 {
+		t.Errorf("servers weren't shared between the instances: “%v”", chosen)
+	}
+
+	for _, server := range discoveries[0].(dnsdisco.Inspector).Servers() {
+		key := dnsdisco.ServerStatsKey("jabber", "tcp", "registro.br.", server.Target, server.Port)
+
+		if used, err := store.Used(key); used != 2 || err != nil {
+			t.Errorf("unexpected usage “%d” and error “%v” for “%s”", used, err, key)
+		}
+
+		health, err := store.Health(key)
+		if err != nil {
+			t.Fatalf("unexpected error “%v”", err)
+		}
+
+		if len(health) != 2 || health[0].Status != dnsdisco.HealthStatusHealthy {
+			t.Errorf("unexpected health history “%v” for “%s”", health, key)
+		}
+	}
+}
+
+func TestMemoryStatsStoreHealth(t *testing.T) {
+	t.Parallel()
+
+	checked := time.Date(2016, 6, 1, 10, 30, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		description     string
+		records         int
+		expectedChecked []time.Time
+	}{
+		{
+			description:     "it should keep all records while the history isn't full",
+			records:         2,
+			expectedChecked: []time.Time{checked, checked.Add(time.Second)},
+		},
+		{
+			description: "it should discard the oldest records",
+			records:     5,
+			expectedChecked: []time.Time{
+				checked.Add(2 * time.Second),
+				checked.Add(3 * time.Second),
+				checked.Add(4 * time.Second),
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			store := dnsdisco.NewMemoryStatsStore(3)
+			for i := 0; i < scenario.records; i++ {
+				record := dnsdisco.HealthRecord{
+					Status:  dnsdisco.HealthStatusHealthy,
+					Checked: checked.Add(time.Duration(i) * time.Second),
+				}
+
+				if err := store.AddHealth("key", record); err != nil {
+					t.Fatalf("unexpected error “%v”", err)
+				}
+			}
+
+			health, err := store.Health("key")
+			if err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			var found []time.Time
+			for _, record := range health {
+				found = append(found, record.Checked)
+			}
+
+			if !reflect.DeepEqual(found, scenario.expectedChecked) {
+				t.Errorf("mismatch health history. Expecting: “%v”; found “%v”", scenario.expectedChecked, found)
+			}
+		})
+	}
+}
+
+func TestServersHealthHistory(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br.")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		}, nil
+	}))
+
+	// the server flaps between the health checks
+	healthy := false
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		healthy = !healthy
+		if !healthy {
+			return false, errors.New("connection refused")
+		}
+		return true, nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		if err := discovery.Refresh(); err != nil {
+			t.Fatalf("unexpected error “%v”", err)
+		}
+	}
+
+	var statuses []dnsdisco.HealthStatus
+	var errs []string
+	for _, record := range discovery.(dnsdisco.Inspector).Servers()[0].HealthHistory {
+		statuses = append(statuses, record.Status)
+		errs = append(errs, record.Error)
+	}
+
+	expectedStatuses := []dnsdisco.HealthStatus{
+		dnsdisco.HealthStatusHealthy,
+		dnsdisco.HealthStatusUnhealthy,
+		dnsdisco.HealthStatusHealthy,
+	}
+
+	if !reflect.DeepEqual(statuses, expectedStatuses) {
+		t.Errorf("mismatch health history. Expecting: “%v”; found “%v”", expectedStatuses, statuses)
+	}
+
+	expectedErrors := []string{"", "connection refused", ""}
+	if !reflect.DeepEqual(errs, expectedErrors) {
+		t.Errorf("mismatch health history errors. Expecting: “%v”; found “%v”", expectedErrors, errs)
+	}
+}
@@ -0,0 +1,60 @@
+package dnsdisco
+
+import "net"
+
+// RFC2782Iterator yields the servers in the order defined by the client
+// algorithm of RFC 2782, for protocol implementations that must be compliant
+// (e.g. SIP and XMPP servers). The client tries to connect to each server
+// returned by Next, moving to the next one when the connection fails, until
+// one succeeds or there are no more servers. It isn't go routine safe, each
+// connection should have its own iterator.
+type RFC2782Iterator struct {
+	servers []Server
+	next    int
+}
+
+// StrictRFC2782 returns an iterator over the servers retrieved in the last
+// refresh, following strictly the client algorithm of RFC 2782: the servers
+// are sorted by priority and, inside the same priority, selected randomly
+// proportionally to their weights, with a new order for each iterator (each
+// connection). As the RFC client tries all servers, the health checks, the
+// load balancer and the usage counters aren't used. When the only server has
+// the target ".", the service is decidedly not available and the iterator is
+// empty.
+func (d *discovery) StrictRFC2782() *RFC2782Iterator {
+	current := d.Servers()
+
+	// RFC 2782: a target of "." means that the service is decidedly not
+	// available at this domain
+	if len(current) == 1 && current[0].Target == "." {
+		return &RFC2782Iterator{}
+	}
+
+	srvs := make([]*net.SRV, len(current))
+	servers := make(map[*net.SRV]Server, len(current))
+	for i, server := range current {
+		srv := server.SRV
+		srvs[i] = &srv
+		servers[&srv] = server
+	}
+
+	byPriorityWeight(srvs).sort(ZeroWeightEqual)
+
+	iterator := &RFC2782Iterator{servers: make([]Server, len(srvs))}
+	for i, srv := range srvs {
+		iterator.servers[i] = servers[srv]
+	}
+	return iterator
+}
+
+// Next returns the next server to try. When all servers were returned, false
+// is returned.
+func (r *RFC2782Iterator) Next() (Server, bool) {
+	if r.next >= len(r.servers) {
+		return Server{}, false
+	}
+
+	server := r.servers[r.next]
+	r.next++
+	return server, true
+}
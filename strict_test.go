@@ -0,0 +1,93 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestStrictRFC2782(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description   string
+		srvs          []*net.SRV
+		expectedOrder [][]string
+	}{
+		{
+			description: "it should iterate over all servers by priority",
+			srvs: []*net.SRV{
+				{Target: "server3.example.com.", Port: 3333, Priority: 30, Weight: 10},
+				{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 50},
+				{Target: "unhealthy.example.com.", Port: 4444, Priority: 20, Weight: 10},
+				{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 50},
+			},
+			expectedOrder: [][]string{
+				{"server1.example.com.", "server2.example.com."},
+				{"server1.example.com.", "server2.example.com."},
+				{"unhealthy.example.com."},
+				{"server3.example.com."},
+			},
+		},
+		{
+			description: "it should not iterate when the service is not available",
+			srvs: []*net.SRV{
+				{Target: ".", Port: 0, Priority: 0, Weight: 0},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("sip", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return scenario.srvs, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return target != "unhealthy.example.com.", nil
+			}))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			// each iterator (connection) has its own order
+			firsts := make(map[string]bool)
+			for i := 0; i < 100; i++ {
+				iterator := discovery.(dnsdisco.Selector).StrictRFC2782()
+
+				var targets []string
+				for server, ok := iterator.Next(); ok; server, ok = iterator.Next() {
+					targets = append(targets, server.Target)
+				}
+
+				if len(targets) != len(scenario.expectedOrder) {
+					t.Fatalf("mismatch number of servers. Expecting: “%d”; found “%d”", len(scenario.expectedOrder), len(targets))
+				}
+
+				for j, target := range targets {
+					found := false
+					for _, expected := range scenario.expectedOrder[j] {
+						found = found || target == expected
+					}
+
+					if !found {
+						t.Fatalf("unexpected target “%s” in position %d", target, j)
+					}
+				}
+
+				if len(targets) > 0 {
+					firsts[targets[0]] = true
+				}
+			}
+
+			if len(scenario.expectedOrder) > 0 && len(firsts) != len(scenario.expectedOrder[0]) {
+				t.Errorf("the servers weren't reordered for each connection: “%v”", firsts)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package dnsdisco
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TargetSuffixError is a warning stored in the Errors list, and emitted in a
+// EventTargetRejected event, when a SRV record is rejected because its target
+// doesn't belong to the expected domains.
+type TargetSuffixError struct {
+	// Target is the target of the rejected record.
+	Target string
+
+	// Port is the port of the rejected record.
+	Port uint16
+
+	// Suffixes are the expected domain suffixes.
+	Suffixes []string
+}
+
+// Error returns the warning description.
+func (t TargetSuffixError) Error() string {
+	return fmt.Sprintf("dnsdisco: target %q doesn't end in any of the expected suffixes (%s), rejecting the record",
+		t.Target, strings.Join(t.Suffixes, ", "))
+}
+
+// SetTargetSuffixes rejects the SRV records with targets that don't end in one
+// of the domain suffixes (e.g. ".example.com."), mitigating cross-domain
+// redirections from a compromised zone. The suffixes are compared label by
+// label and case insensitively, so "example.com" accepts "example.com." and
+// "server1.example.com." but not "badexample.com.". Each rejected record is
+// reported as a TargetSuffixError in the Errors method and in a
+// EventTargetRejected event. An empty list accepts all targets. It is go
+// routine safe.
+func (d *discovery) SetTargetSuffixes(suffixes []string) {
+	d.targetSuffixesLock.Lock()
+	defer d.targetSuffixesLock.Unlock()
+
+	d.targetSuffixes = make([]string, len(suffixes))
+	copy(d.targetSuffixes, suffixes)
+}
+
+// verifyTargetSuffixes returns the records with an expected target and the
+// warnings of the rejected ones, emitting their events.
+func (d *discovery) verifyTargetSuffixes(srvs []*net.SRV) ([]*net.SRV, []error) {
+	d.targetSuffixesLock.RLock()
+	suffixes := d.targetSuffixes
+	d.targetSuffixesLock.RUnlock()
+
+	if len(suffixes) == 0 {
+		return srvs, nil
+	}
+
+	var accepted []*net.SRV
+	var warnings []error
+
+	for _, srv := range srvs {
+		if hasTargetSuffix(srv.Target, suffixes) {
+			accepted = append(accepted, srv)
+			continue
+		}
+
+		err := TargetSuffixError{Target: srv.Target, Port: srv.Port, Suffixes: suffixes}
+		warnings = append(warnings, err)
+		d.emit(Event{Type: EventTargetRejected, Server: Server{SRV: *srv}, Err: err})
+	}
+
+	return accepted, warnings
+}
+
+// hasTargetSuffix checks if the target is one of the domains or belongs to
+// them.
+func hasTargetSuffix(target string, suffixes []string) bool {
+	target = strings.ToLower(strings.TrimSuffix(target, "."))
+
+	for _, suffix := range suffixes {
+		suffix = strings.ToLower(strings.Trim(suffix, "."))
+		if target == suffix || strings.HasSuffix(target, "."+suffix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetTargetSuffixes(t *testing.T) {
+	t.Parallel()
+
+	servers := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		{Target: "server2.EXAMPLE.com.", Port: 2222, Priority: 20, Weight: 10},
+		{Target: "server3.badexample.com.", Port: 3333, Priority: 30, Weight: 10},
+		{Target: "server4.example.net.", Port: 4444, Priority: 40, Weight: 10},
+	}
+
+	scenarios := []struct {
+		description     string
+		suffixes        []string
+		expectedTargets []string
+		expectedErrors  []error
+	}{
+		{
+			description:     "it should accept all targets without suffixes",
+			expectedTargets: []string{"server1.example.com.", "server2.EXAMPLE.com.", "server3.badexample.com.", "server4.example.net."},
+		},
+		{
+			description:     "it should reject the targets outside the domain",
+			suffixes:        []string{".example.com."},
+			expectedTargets: []string{"server1.example.com.", "server2.EXAMPLE.com."},
+			expectedErrors: []error{
+				dnsdisco.TargetSuffixError{Target: "server3.badexample.com.", Port: 3333, Suffixes: []string{".example.com."}},
+				dnsdisco.TargetSuffixError{Target: "server4.example.net.", Port: 4444, Suffixes: []string{".example.com."}},
+			},
+		},
+		{
+			description:     "it should accept the targets of any of the domains",
+			suffixes:        []string{"example.com", "example.net."},
+			expectedTargets: []string{"server1.example.com.", "server2.EXAMPLE.com.", "server4.example.net."},
+			expectedErrors: []error{
+				dnsdisco.TargetSuffixError{Target: "server3.badexample.com.", Port: 3333, Suffixes: []string{"example.com", "example.net."}},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return servers, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+			discovery.(dnsdisco.RecordConfigurer).SetTargetSuffixes(scenario.suffixes)
+
+			events := discovery.(dnsdisco.EventSource).Events()
+			defer discovery.(dnsdisco.EventSource).CloseEvents(events)
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			var targets []string
+			for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+				targets = append(targets, server.Target)
+			}
+
+			if !reflect.DeepEqual(targets, scenario.expectedTargets) {
+				t.Errorf("mismatch targets. Expecting: “%v”; found “%v”", scenario.expectedTargets, targets)
+			}
+
+			if errs := discovery.Errors(); !reflect.DeepEqual(errs, scenario.expectedErrors) {
+				t.Errorf("mismatch errors. Expecting: “%#v”; found “%#v”", scenario.expectedErrors, errs)
+			}
+
+			rejected := 0
+			for len(events) > 0 {
+				if event := <-events; event.Type == dnsdisco.EventTargetRejected {
+					rejected++
+				}
+			}
+
+			if rejected != len(scenario.expectedErrors) {
+				t.Errorf("mismatch rejected events. Expecting: “%d”; found “%d”", len(scenario.expectedErrors), rejected)
+			}
+		})
+	}
+}
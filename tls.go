@@ -0,0 +1,167 @@
+package dnsdisco
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// PinError is returned when none of the certificates presented by the target
+// matches the expected SPKI pins.
+type PinError struct {
+	// Target is the server that presented the certificates.
+	Target string
+}
+
+// Error returns the error description.
+func (p PinError) Error() string {
+	return fmt.Sprintf("dnsdisco: certificate of %s doesn't match any pin", p.Target)
+}
+
+// TLSPolicy defines how the certificate of a target is verified.
+type TLSPolicy struct {
+	// SPKIPins are the base64 encoded SHA-256 hashes of the certificate
+	// SubjectPublicKeyInfo that are accepted for the target. At least one
+	// certificate of the verified chain must match one of the pins. When the
+	// verification is disabled (InsecureSkipVerify) only the target
+	// certificate is matched. If empty no pinning is done.
+	SPKIPins []string
+
+	// RootCAs is the set of root certificate authorities used to verify the
+	// target certificate. If nil the host's root CA set (or the one from the
+	// base tls.Config) is used.
+	RootCAs *x509.CertPool
+}
+
+// TLSPolicies stores the TLS policy of each target. The key can be a target
+// name (e.g. "server1.example.com") or a domain suffix starting with a dot
+// (e.g. ".example.com"), that applies for all targets below the domain. The
+// exact target name has precedence, and between suffixes the longest wins.
+type TLSPolicies map[string]TLSPolicy
+
+// Policy returns the TLS policy of the target, if any.
+func (t TLSPolicies) Policy(target string) (policy TLSPolicy, ok bool) {
+	target = normalizeTLSName(target)
+
+	longestSuffix := -1
+	for key, p := range t {
+		if !strings.HasPrefix(key, ".") {
+			if normalizeTLSName(key) == target {
+				return p, true
+			}
+			continue
+		}
+
+		suffix := normalizeTLSName(key)
+		if strings.HasSuffix("."+target, suffix) && len(suffix) > longestSuffix {
+			policy, ok = p, true
+			longestSuffix = len(suffix)
+		}
+	}
+
+	return
+}
+
+// Config builds the TLS configuration to connect to the target, based on the
+// base configuration (that can be nil) and on the target policy. If the base
+// configuration doesn't define a server name, the target is used.
+func (t TLSPolicies) Config(base *tls.Config, target string) *tls.Config {
+	var config *tls.Config
+	if base != nil {
+		config = base.Clone()
+	} else {
+		config = new(tls.Config)
+	}
+
+	if config.ServerName == "" {
+		config.ServerName = strings.TrimSuffix(host(target), ".")
+	}
+
+	policy, ok := t.Policy(target)
+	if !ok {
+		return config
+	}
+
+	if policy.RootCAs != nil {
+		config.RootCAs = policy.RootCAs
+	}
+
+	if len(policy.SPKIPins) > 0 {
+		pins := make(map[string]bool)
+		for _, pin := range policy.SPKIPins {
+			pins[pin] = true
+		}
+
+		// without verification the chain presented by the target can't be
+		// trusted, so only its own certificate (the first one) can match
+		insecure := config.InsecureSkipVerify
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if insecure {
+				if len(rawCerts) == 0 {
+					return PinError{Target: target}
+				}
+
+				cert, err := x509.ParseCertificate(rawCerts[0])
+				if err != nil {
+					return err
+				}
+
+				if pins[SPKIPin(cert)] {
+					return nil
+				}
+				return PinError{Target: target}
+			}
+
+			for _, chain := range verifiedChains {
+				for _, cert := range chain {
+					if pins[SPKIPin(cert)] {
+						return nil
+					}
+				}
+			}
+
+			return PinError{Target: target}
+		}
+	}
+
+	return config
+}
+
+// SPKIPin returns the base64 encoded SHA-256 hash of the certificate
+// SubjectPublicKeyInfo, in the format expected by TLSPolicy.
+func SPKIPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// NewTLSHealthChecker returns a health checker that completes a TLS handshake
+// with the server, verifying the certificate according to the base
+// configuration and to the target policy. It detects misissued certificates
+// or a man in the middle before the server is used. The handshake is limited
+// to 5 seconds. Only the tcp proto is supported.
+func NewTLSHealthChecker(config *tls.Config, policies TLSPolicies) HealthChecker {
+	return HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		if proto != "tcp" {
+			return false, net.UnknownNetworkError(proto)
+		}
+
+		address := JoinHostPort(target, port)
+		dialer := &net.Dialer{Timeout: protocolHealthCheckTimeout}
+		conn, err := tls.DialWithDialer(dialer, proto, address, policies.Config(config, target))
+		if err != nil {
+			return false, err
+		}
+		conn.Close()
+		return true, nil
+	})
+}
+
+// normalizeTLSName converts the name to lower case and removes the trailing
+// dot, so the policies are found no matter how the target was written.
+func normalizeTLSName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
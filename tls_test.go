@@ -0,0 +1,175 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestTLSPolicies(t *testing.T) {
+	t.Parallel()
+
+	policies := dnsdisco.TLSPolicies{
+		"server1.example.com":   dnsdisco.TLSPolicy{SPKIPins: []string{"exact"}},
+		".example.com.":         dnsdisco.TLSPolicy{SPKIPins: []string{"domain"}},
+		".internal.example.com": dnsdisco.TLSPolicy{SPKIPins: []string{"subdomain"}},
+	}
+
+	scenarios := []struct {
+		target      string
+		expectedPin string
+	}{
+		{target: "server1.example.com.", expectedPin: "exact"},
+		{target: "SERVER2.example.com.", expectedPin: "domain"},
+		{target: "server3.internal.example.com.", expectedPin: "subdomain"},
+		{target: "server4.example.net.", expectedPin: ""},
+		{target: "anotherexample.com.", expectedPin: ""},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.target, func(t *testing.T) {
+			var pin string
+			if policy, ok := policies.Policy(scenario.target); ok {
+				pin = policy.SPKIPins[0]
+			}
+
+			if pin != scenario.expectedPin {
+				t.Errorf("mismatch pins. Expecting: “%s”; found “%s”", scenario.expectedPin, pin)
+			}
+		})
+	}
+}
+
+func TestTLSHealthChecker(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	cert, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(cert)
+
+	host, p, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		description string
+		config      *tls.Config
+		policies    dnsdisco.TLSPolicies
+		expectedOK  bool
+	}{
+		{
+			description: "it should accept a certificate matching the pin",
+			policies: dnsdisco.TLSPolicies{
+				host: dnsdisco.TLSPolicy{
+					SPKIPins: []string{"wrong", dnsdisco.SPKIPin(cert)},
+					RootCAs:  rootCAs,
+				},
+			},
+			expectedOK: true,
+		},
+		{
+			description: "it should reject a certificate that doesn't match the pin",
+			policies: dnsdisco.TLSPolicies{
+				host: dnsdisco.TLSPolicy{
+					SPKIPins: []string{"wrong"},
+					RootCAs:  rootCAs,
+				},
+			},
+		},
+		{
+			description: "it should reject a certificate from an unknown authority",
+			policies: dnsdisco.TLSPolicies{
+				host: dnsdisco.TLSPolicy{
+					SPKIPins: []string{dnsdisco.SPKIPin(cert)},
+				},
+			},
+		},
+		{
+			description: "it should match the target certificate without verification",
+			config:      &tls.Config{InsecureSkipVerify: true},
+			policies: dnsdisco.TLSPolicies{
+				host: dnsdisco.TLSPolicy{
+					SPKIPins: []string{dnsdisco.SPKIPin(cert)},
+				},
+			},
+			expectedOK: true,
+		},
+		{
+			description: "it should reject a target certificate without verification that doesn't match the pin",
+			config:      &tls.Config{InsecureSkipVerify: true},
+			policies: dnsdisco.TLSPolicies{
+				host: dnsdisco.TLSPolicy{
+					SPKIPins: []string{"wrong"},
+				},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			healthChecker := dnsdisco.NewTLSHealthChecker(scenario.config, scenario.policies)
+			ok, err := healthChecker.HealthCheck(host, uint16(port), "tcp")
+
+			if ok != scenario.expectedOK {
+				t.Errorf("mismatch health check result. Expecting: “%t”; found “%t” (%v)", scenario.expectedOK, ok, err)
+			}
+
+			if !ok && err == nil {
+				t.Error("expected an error for the failed health check")
+			}
+		})
+	}
+
+	discovery := dnsdisco.NewDiscovery("https", "tcp", "example.com")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{{Target: host, Port: uint16(port)}}, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	discovery.(dnsdisco.ConnectionConfigurer).SetTLSPolicies(dnsdisco.TLSPolicies{
+		host: dnsdisco.TLSPolicy{
+			SPKIPins: []string{"wrong"},
+			RootCAs:  rootCAs,
+		},
+	})
+
+	if _, err := discovery.(dnsdisco.Dialer).DialTLS(context.Background(), nil); err == nil {
+		t.Error("expected an error dialing a target that doesn't match the pin")
+	}
+
+	discovery.(dnsdisco.ConnectionConfigurer).SetTLSPolicies(dnsdisco.TLSPolicies{
+		host: dnsdisco.TLSPolicy{
+			SPKIPins: []string{dnsdisco.SPKIPin(cert)},
+			RootCAs:  rootCAs,
+		},
+	})
+
+	conn, err := discovery.(dnsdisco.Dialer).DialTLS(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error dialing the target. Details: %s", err)
+	}
+	conn.Close()
+}
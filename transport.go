@@ -0,0 +1,268 @@
+package dnsdisco
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CanaryMetadata is the metadata key (Server.Metadata) that flags the canary
+// servers, with the value "true". By default they are the targets of the
+// mirrored requests of the RoundTripper.
+const CanaryMetadata = "canary"
+
+// defaultMirrorTimeout limits the duration of a mirrored request when no
+// timeout is defined.
+const defaultMirrorTimeout = 10 * time.Second
+
+// MirrorStats stores the results of the requests mirrored by the RoundTripper.
+type MirrorStats struct {
+	// Mirrored is the number of requests sent to the mirror targets.
+	Mirrored uint64
+
+	// Failed is the number of mirrored requests that failed to be sent.
+	Failed uint64
+
+	// Skipped is the number of requests that should be mirrored, but weren't
+	// because there was no mirror target or the body couldn't be copied.
+	Skipped uint64
+}
+
+// RoundTripper is an http.RoundTripper that sends each request to the target
+// chosen by the discovery, replacing the host of the URL. The Host header is
+// kept, so virtual hosts still work. The credentials of the target (see
+// SetCredentialsProvider) are added to the request when it doesn't have an
+// Authorization header, and its TLS configuration is used when the transport
+// is an *http.Transport. Optionally a percentage of the requests
+// can be mirrored to a second target (shadow traffic), to test new backends
+// with real requests without affecting the clients.
+type RoundTripper struct {
+	// discovery chooses the targets.
+	discovery Discovery
+
+	// transport sends the requests.
+	transport http.RoundTripper
+
+	// mirrorPercentage is the percentage (0-100) of the requests that are
+	// mirrored.
+	mirrorPercentage float64
+
+	// mirrorFilter identifies the servers that can receive mirrored requests.
+	mirrorFilter func(Server) bool
+
+	// mirrorTimeout limits the duration of each mirrored request.
+	mirrorTimeout time.Duration
+
+	// mirrorStats stores the results of the mirrored requests.
+	mirrorStats MirrorStats
+
+	// tlsTransports stores a copy of the transport for each TLS configuration
+	// of the targets credentials, so the connections are reused.
+	tlsTransports map[*tls.Config]http.RoundTripper
+
+	// lock make it possible to change the mirroring options and read the
+	// statistics while the requests are being sent.
+	lock sync.Mutex
+}
+
+// NewRoundTripper builds an http.RoundTripper that sends the requests to the
+// targets chosen by the discovery, using the given transport. If the
+// transport is nil http.DefaultTransport is used. When the transport is an
+// *http.Transport a copy of it is used, that converts the targets to IP
+// addresses with the address resolver of the discovery (see
+// SetAddressResolver).
+func NewRoundTripper(discovery Discovery, transport http.RoundTripper) *RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if httpTransport, ok := transport.(*http.Transport); ok {
+		cloned := httpTransport.Clone()
+
+		dial := cloned.DialContext
+		if dial == nil {
+			var dialer net.Dialer
+			dial = dialer.DialContext
+		}
+		cloned.DialContext = resolvedDialer(resolveAddress(discovery), dial)
+		transport = cloned
+	}
+
+	return &RoundTripper{
+		discovery:     discovery,
+		transport:     transport,
+		tlsTransports: make(map[*tls.Config]http.RoundTripper),
+	}
+}
+
+// SetMirror mirrors the percentage (0-100) of the requests to a target chosen
+// between the healthy servers accepted by the filter, in a fire-and-forget
+// way: the mirrored response is discarded and never delays the original
+// request. When the filter is nil the servers flagged with the canary metadata
+// (CanaryMetadata) are used. Each mirrored request is limited by the timeout
+// (10 seconds when zero). Requests with a body are only mirrored when it can
+// be copied (http.Request.GetBody). It is go routine safe.
+func (r *RoundTripper) SetMirror(percentage float64, filter func(Server) bool, timeout time.Duration) {
+	if filter == nil {
+		filter = func(server Server) bool {
+			return server.Metadata[CanaryMetadata] == "true"
+		}
+	}
+
+	if timeout <= 0 {
+		timeout = defaultMirrorTimeout
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.mirrorPercentage = percentage
+	r.mirrorFilter = filter
+	r.mirrorTimeout = timeout
+}
+
+// MirrorStats returns the results of the mirrored requests.
+func (r *RoundTripper) MirrorStats() MirrorStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.mirrorStats
+}
+
+// RoundTrip sends the request to the chosen target. If there's no server
+// available ErrNoServer is returned.
+func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, port := r.discovery.Choose()
+	if target == "" && port == 0 {
+		return nil, ErrNoServer
+	}
+
+	r.lock.Lock()
+	percentage, filter, timeout := r.mirrorPercentage, r.mirrorFilter, r.mirrorTimeout
+	r.lock.Unlock()
+
+	if percentage > 0 && randomSource.Float64()*100 < percentage {
+		r.mirror(req, target, port, filter, timeout)
+	}
+
+	redirected := redirectRequest(req.Context(), req, target, port)
+	transport, err := r.authenticate(redirected, target, port)
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(redirected)
+}
+
+// authenticate adds the credentials of the target to the request, returning
+// the transport that uses its TLS configuration.
+func (r *RoundTripper) authenticate(req *http.Request, target string, port uint16) (http.RoundTripper, error) {
+	dialer, ok := r.discovery.(Dialer)
+	if !ok {
+		return r.transport, nil
+	}
+
+	credentials, err := dialer.Credentials(req.Context(), target, port)
+	if err != nil {
+		return nil, err
+	}
+
+	if authorization := credentials.authorization(); authorization != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	transport, ok := r.transport.(*http.Transport)
+	if credentials.TLSConfig == nil || !ok {
+		return r.transport, nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	tlsTransport, found := r.tlsTransports[credentials.TLSConfig]
+	if !found {
+		cloned := transport.Clone()
+		cloned.TLSClientConfig = credentials.TLSConfig
+		tlsTransport = cloned
+		r.tlsTransports[credentials.TLSConfig] = tlsTransport
+	}
+	return tlsTransport, nil
+}
+
+// mirror sends a copy of the request to a mirror target in background.
+func (r *RoundTripper) mirror(req *http.Request, target string, port uint16, filter func(Server) bool, timeout time.Duration) {
+	mirrorTarget, mirrorPort := chooseWhere(r.discovery, func(server Server) bool {
+		return (server.Target != target || server.Port != port) && filter(server)
+	})
+
+	var body io.ReadCloser
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody != nil {
+			var err error
+			if body, err = req.GetBody(); err != nil {
+				body = nil
+			}
+		}
+
+		// the original body can't be consumed by the mirror
+		if body == nil {
+			mirrorTarget, mirrorPort = "", 0
+		}
+	}
+
+	if mirrorTarget == "" && mirrorPort == 0 {
+		if body != nil {
+			body.Close()
+		}
+
+		r.lock.Lock()
+		r.mirrorStats.Skipped++
+		r.lock.Unlock()
+		return
+	}
+
+	// the mirrored request must not be canceled when the original one
+	// finishes
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	mirrorReq := redirectRequest(ctx, req, mirrorTarget, mirrorPort)
+	mirrorReq.Body = body
+
+	go func() {
+		defer cancel()
+
+		transport, err := r.authenticate(mirrorReq, mirrorTarget, mirrorPort)
+
+		var response *http.Response
+		if err == nil {
+			response, err = transport.RoundTrip(mirrorReq)
+		} else if body != nil {
+			body.Close()
+		}
+
+		r.lock.Lock()
+		r.mirrorStats.Mirrored++
+		if err != nil {
+			r.mirrorStats.Failed++
+		}
+		r.lock.Unlock()
+
+		if err == nil {
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+	}()
+}
+
+// redirectRequest copies the request replacing the host of the URL with the
+// target, keeping the original Host header.
+func redirectRequest(ctx context.Context, req *http.Request, target string, port uint16) *http.Request {
+	redirected := req.Clone(ctx)
+	if redirected.Host == "" {
+		redirected.Host = req.URL.Host
+	}
+	redirected.URL.Host = JoinHostPort(target, port)
+	return redirected
+}
@@ -0,0 +1,103 @@
+package dnsdisco_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestRoundTripperMirror(t *testing.T) {
+	t.Parallel()
+
+	stable := make(chan string, 1)
+	stableServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		stable <- r.Host + " " + string(body)
+	}))
+	defer stableServer.Close()
+
+	canary := make(chan string, 1)
+	canaryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		canary <- r.Host + " " + string(body)
+	}))
+	defer canaryServer.Close()
+
+	discovery := dnsdisco.NewDiscovery("http", "tcp", "registro.br")
+	discovery.SetRetriever(canaryRetrieverMock{
+		stable: serverPort(t, stableServer.URL),
+		canary: serverPort(t, canaryServer.URL),
+	})
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return true, nil
+	}))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	roundTripper := dnsdisco.NewRoundTripper(discovery, nil)
+	roundTripper.SetMirror(100, nil, time.Second)
+
+	client := http.Client{Transport: roundTripper}
+	response, err := client.Post("http://api.registro.br/domains", "text/plain", strings.NewReader("registro.br"))
+	if err != nil {
+		t.Fatalf("unexpected error “%v”", err)
+	}
+	response.Body.Close()
+
+	expected := "api.registro.br registro.br"
+	if request := <-stable; request != expected {
+		t.Errorf("mismatch stable requests. Expecting: “%s”; found “%s”", expected, request)
+	}
+
+	select {
+	case request := <-canary:
+		if request != expected {
+			t.Errorf("mismatch mirrored requests. Expecting: “%s”; found “%s”", expected, request)
+		}
+	case <-time.After(time.Second):
+		t.Error("request wasn't mirrored")
+	}
+}
+
+type canaryRetrieverMock struct {
+	stable uint16
+	canary uint16
+}
+
+func (c canaryRetrieverMock) Retrieve(service, proto, name string) ([]*net.SRV, error) {
+	return nil, nil
+}
+
+func (c canaryRetrieverMock) RetrieveMetadata(service, proto, name string) ([]*net.SRV, []map[string]string, error) {
+	return []*net.SRV{
+		{Target: "127.0.0.1", Port: c.stable, Priority: 10},
+		{Target: "127.0.0.1", Port: c.canary, Priority: 20},
+	}, []map[string]string{
+		nil,
+		{dnsdisco.CanaryMetadata: "true"},
+	}, nil
+}
+
+// serverPort returns the port of the test server URL.
+func serverPort(t *testing.T, rawURL string) uint16 {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := strconv.ParseUint(u.Port(), 10, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uint16(port)
+}
@@ -0,0 +1,49 @@
+package dnsdisco
+
+// UnixSocketMetadata is the metadata key (Server.Metadata) with the path of the
+// Unix domain socket of a server.
+const UnixSocketMetadata = "unix"
+
+// UnixSocketMapping maps a server to the path of the Unix domain socket where
+// it listens. When ok is false the server is reached using the network.
+type UnixSocketMapping func(server Server) (path string, ok bool)
+
+// SetUnixSockets defines how the servers are mapped to Unix domain sockets,
+// useful for colocated services (sidecars and local daemons) that are
+// announced with SRV records but listen on a socket. When the mapping is nil
+// only the path in the server metadata (UnixSocketMetadata) is used. The
+// servers mapped to a socket are health checked with the "unix" proto and
+// Dial and DialTLS connect to the socket. The mapping is applied on the next
+// refresh.
+func (d *discovery) SetUnixSockets(mapping UnixSocketMapping) {
+	d.unixSocketsLock.Lock()
+	defer d.unixSocketsLock.Unlock()
+	d.unixSockets = mapping
+}
+
+// unixSocket returns the path of the Unix domain socket of the server, if any.
+func unixSocket(mapping UnixSocketMapping, server Server) string {
+	if mapping != nil {
+		if path, ok := mapping(server); ok {
+			return path
+		}
+	}
+	return server.Metadata[UnixSocketMetadata]
+}
+
+// dialAddress returns the network and the address used to connect to the
+// chosen target, that can be a Unix domain socket.
+func (d *discovery) dialAddress(target string, port uint16) (network, address string) {
+	d.serversLock.RLock()
+	defer d.serversLock.RUnlock()
+
+	// the servers aren't copied, as the usage counters can change during the
+	// choices
+	for i := range d.servers {
+		if d.servers[i].Target == target && d.servers[i].Port == port && d.servers[i].UnixSocket != "" {
+			return "unix", d.servers[i].UnixSocket
+		}
+	}
+
+	return d.proto, JoinHostPort(target, port)
+}
@@ -0,0 +1,100 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestUnixSockets(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "dnsdisco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sidecar.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	scenarios := []struct {
+		description     string
+		path            string
+		expectedHealthy bool
+		expectedError   error
+	}{
+		{
+			description:     "it should connect to the Unix domain socket",
+			path:            path,
+			expectedHealthy: true,
+		},
+		{
+			description:   "it should detect a missing Unix domain socket",
+			path:          filepath.Join(dir, "missing.sock"),
+			expectedError: dnsdisco.ErrNoServer,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "localhost.", Port: 5222, Priority: 10, Weight: 10},
+				}, nil
+			}))
+			discovery.(dnsdisco.ConnectionConfigurer).SetUnixSockets(func(server dnsdisco.Server) (string, bool) {
+				return scenario.path, server.Target == "localhost."
+			})
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			servers := discovery.(dnsdisco.Inspector).Servers()
+			if len(servers) != 1 {
+				t.Fatalf("unexpected number of servers: %d", len(servers))
+			}
+
+			if servers[0].UnixSocket != scenario.path {
+				t.Errorf("mismatch sockets. Expecting: “%s”; found “%s”", scenario.path, servers[0].UnixSocket)
+			}
+
+			if servers[0].Healthy != scenario.expectedHealthy {
+				t.Errorf("mismatch health. Expecting: “%t”; found “%t”", scenario.expectedHealthy, servers[0].Healthy)
+			}
+
+			conn, err := discovery.(dnsdisco.Dialer).Dial(context.Background())
+			if err != scenario.expectedError {
+				t.Fatalf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+
+			if conn != nil {
+				if network := conn.RemoteAddr().Network(); network != "unix" {
+					t.Errorf("mismatch networks. Expecting: “unix”; found “%s”", network)
+				}
+				conn.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package dnsdisco
+
+import "sync"
+
+// SetWarmStart makes the refreshes return without waiting for the health
+// checks, so the first Choose after the startup doesn't pay the latency of
+// checking every server one after the other. When the concurrency is greater
+// than zero, the new servers of a refresh are considered healthy and the known
+// servers keep their status; right after the refresh all servers are checked
+// in background, with at most concurrency checks at the same time, and their
+// status is updated as soon as each check finishes. A zero concurrency
+// disables it (default). It is go routine safe.
+func (d *discovery) SetWarmStart(concurrency int) {
+	if concurrency < 0 {
+		concurrency = 0
+	}
+
+	d.warmStartLock.Lock()
+	defer d.warmStartLock.Unlock()
+	d.warmStart = concurrency
+}
+
+// warmStartConcurrency returns the maximum number of background health checks
+// after a refresh, or zero when the warm start is disabled.
+func (d *discovery) warmStartConcurrency() int {
+	d.warmStartLock.RLock()
+	defer d.warmStartLock.RUnlock()
+	return d.warmStart
+}
+
+// checkServers checks the servers in background, with at most concurrency
+// checks at the same time.
+func (d *discovery) checkServers(servers []Server, concurrency int) {
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		slots <- struct{}{}
+		wg.Add(1)
+
+		go func(server Server) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			d.checkServer(server)
+		}(server)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,82 @@
+package dnsdisco_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetWarmStart(t *testing.T) {
+	t.Parallel()
+
+	var running, maxRunning int
+	var runningLock sync.Mutex
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+			{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+			{Target: "server3.example.com.", Port: 3333, Priority: 10, Weight: 10},
+			{Target: "server4.example.com.", Port: 4444, Priority: 10, Weight: 10},
+		}, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+		runningLock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		runningLock.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		runningLock.Lock()
+		running--
+		runningLock.Unlock()
+		return target != "server1.example.com.", nil
+	}))
+	discovery.(dnsdisco.Refresher).SetWarmStart(2)
+
+	begin := time.Now()
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if elapsed := time.Since(begin); elapsed >= 50*time.Millisecond {
+		t.Errorf("refresh waited for the health checks (%s)", elapsed)
+	}
+
+	if target, _ := discovery.Choose(); target == "" {
+		t.Error("no server was chosen right after the refresh")
+	}
+
+	for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+		if !server.Healthy {
+			t.Errorf("server “%s” should be healthy before the background checks", server.Target)
+		}
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+		expectedHealthy := server.Target != "server1.example.com."
+		if server.Healthy != expectedHealthy {
+			t.Errorf("mismatch health of “%s”. Expecting: “%t”; found “%t”", server.Target, expectedHealthy, server.Healthy)
+		}
+
+		if server.HealthChecked.IsZero() {
+			t.Errorf("server “%s” wasn't checked in background", server.Target)
+		}
+	}
+
+	runningLock.Lock()
+	defer runningLock.Unlock()
+
+	if maxRunning != 2 {
+		t.Errorf("mismatch concurrent health checks. Expecting: “2”; found “%d”", maxRunning)
+	}
+}
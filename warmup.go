@@ -0,0 +1,102 @@
+package dnsdisco
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"time"
+)
+
+// WarmUp allows the library user to prepare the new servers of a refresh
+// before the first real request, e.g. establishing a connection to pay the
+// TCP/TLS handshake latency in advance, or filling a connection pool.
+type WarmUp interface {
+	// WarmUp prepares the server, that uses the proto ("udp" or "tcp") of the
+	// discovery. The context is cancelled when the warm-up timeout expires.
+	WarmUp(ctx context.Context, proto string, server Server) error
+}
+
+// WarmUpFunc is an easy-to-use implementation of the interface that is
+// responsible for preparing the new servers.
+type WarmUpFunc func(ctx context.Context, proto string, server Server) error
+
+// WarmUp prepares the server, that uses the proto ("udp" or "tcp") of the
+// discovery.
+func (w WarmUpFunc) WarmUp(ctx context.Context, proto string, server Server) error {
+	return w(ctx, proto, server)
+}
+
+// NewDialWarmUp returns a warm-up that connects to the server and closes the
+// connection immediately. It resolves the target address and fills the
+// caches along the way (e.g. DNS, ARP).
+func NewDialWarmUp() WarmUp {
+	return WarmUpFunc(func(ctx context.Context, proto string, server Server) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, proto, JoinHostPort(server.Target, server.Port))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// NewTLSWarmUp returns a warm-up that does the TLS handshake with the server
+// and closes the connection immediately. When the configuration has a
+// ClientSessionCache, the next connections to the server can resume the TLS
+// session, avoiding the full handshake.
+func NewTLSWarmUp(config *tls.Config) WarmUp {
+	return WarmUpFunc(func(ctx context.Context, proto string, server Server) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, proto, JoinHostPort(server.Target, server.Port))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		var serverConfig *tls.Config
+		if config != nil {
+			serverConfig = config.Clone()
+		} else {
+			serverConfig = new(tls.Config)
+		}
+
+		if serverConfig.ServerName == "" {
+			serverConfig.ServerName = strings.TrimSuffix(server.Target, ".")
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		return tls.Client(conn, serverConfig).Handshake()
+	})
+}
+
+// warmUpServers prepares the new servers in background. The moment of the
+// warm-up is stored in the server, and the failures are reported in the Errors
+// method.
+func (d *discovery) warmUpServers(warmUp WarmUp, timeout time.Duration, servers []Server) {
+	for _, server := range servers {
+		go func(server Server) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			if err := warmUp.WarmUp(ctx, d.proto, server); err != nil {
+				d.errorsLock.Lock()
+				d.errors = append(d.errors, err)
+				d.errorsLock.Unlock()
+				return
+			}
+
+			d.serversLock.Lock()
+			defer d.serversLock.Unlock()
+
+			for i := range d.servers {
+				if d.servers[i].address() == server.address() {
+					d.servers[i].WarmedUp = time.Now()
+					break
+				}
+			}
+		}(server)
+	}
+}
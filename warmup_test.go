@@ -0,0 +1,96 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestSetWarmUp(t *testing.T) {
+	t.Parallel()
+
+	srvs := []*net.SRV{
+		{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+		{Target: "server2.example.com.", Port: 2222, Priority: 10, Weight: 10},
+		{Target: "sick.example.com.", Port: 3333, Priority: 10, Weight: 10},
+	}
+
+	retrieved := srvs[:1]
+	var retrievedLock sync.Mutex
+
+	discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+	discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+		retrievedLock.Lock()
+		defer retrievedLock.Unlock()
+
+		var copied []*net.SRV
+		for _, srv := range retrieved {
+			c := *srv
+			copied = append(copied, &c)
+		}
+		return copied, nil
+	}))
+	discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (ok bool, err error) {
+		return target != "sick.example.com.", nil
+	}))
+
+	warmedUp := make(chan string, len(srvs))
+	discovery.(dnsdisco.ConnectionConfigurer).SetWarmUp(dnsdisco.WarmUpFunc(func(ctx context.Context, proto string, server dnsdisco.Server) error {
+		if proto != "tcp" {
+			t.Errorf("unexpected proto “%s”", proto)
+		}
+		warmedUp <- server.Target
+		return nil
+	}), time.Second)
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	if target := <-warmedUp; target != "server1.example.com." {
+		t.Errorf("unexpected server “%s” warmed up", target)
+	}
+
+	retrievedLock.Lock()
+	retrieved = srvs
+	retrievedLock.Unlock()
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+	}
+
+	// only the new healthy server should be prepared
+	select {
+	case target := <-warmedUp:
+		if target != "server2.example.com." {
+			t.Errorf("unexpected server “%s” warmed up", target)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("new server wasn't warmed up")
+	}
+
+	select {
+	case target := <-warmedUp:
+		t.Errorf("unexpected server “%s” warmed up", target)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var targets []string
+	for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+		if !server.WarmedUp.IsZero() {
+			targets = append(targets, server.Target)
+		}
+	}
+	sort.Strings(targets)
+
+	expectedTargets := []string{"server1.example.com.", "server2.example.com."}
+	if !reflect.DeepEqual(targets, expectedTargets) {
+		t.Errorf("mismatch warmed up servers. Expecting: “%v”; found “%v”", expectedTargets, targets)
+	}
+}
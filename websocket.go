@@ -0,0 +1,247 @@
+package dnsdisco
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webSocketGUID is concatenated with the handshake key to build the expected
+// accept value (RFC 6455, section 1.3).
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocketConfig defines how the WebSocket connections are established by
+// DialWebSocket.
+type WebSocketConfig struct {
+	// Scheme is "ws" or "wss". If empty "ws" is used.
+	Scheme string
+
+	// Path is the path of the WebSocket endpoint, with an optional query (e.g.
+	// "/chat?room=1"). If empty "/" is used.
+	Path string
+
+	// Host is the Host header of the opening handshake, for servers with
+	// virtual hosts. If empty the chosen target and port are used.
+	Host string
+
+	// Header stores additional headers of the opening handshake (e.g. Origin,
+	// Sec-WebSocket-Protocol or Authorization).
+	Header http.Header
+
+	// TLSConfig is used by the "wss" scheme. If the server name is empty the
+	// chosen target is verified.
+	TLSConfig *tls.Config
+
+	// MaxAttempts is the maximum number of targets tried. If zero all healthy
+	// servers are tried.
+	MaxAttempts int
+}
+
+// WebSocketHandshakeError is returned when the server doesn't accept the
+// WebSocket opening handshake.
+type WebSocketHandshakeError struct {
+	// Target and Port identifies the server that refused the handshake.
+	Target string
+	Port   uint16
+
+	// StatusCode is the HTTP status of the server response.
+	StatusCode int
+
+	// Reason describes the failure.
+	Reason string
+}
+
+// Error returns the handshake failure description.
+func (w WebSocketHandshakeError) Error() string {
+	return fmt.Sprintf("dnsdisco: websocket handshake with %s failed (status %d): %s",
+		JoinHostPort(w.Target, w.Port), w.StatusCode, w.Reason)
+}
+
+// DialWebSocket chooses the best target and establishes a WebSocket
+// connection with it, for chat and streaming clients that discover the
+// WebSocket endpoints with SRV records. When the connection or the opening
+// handshake fails the next healthy target is tried, until the MaxAttempts
+// limit, and the last error is returned. If there's no server available
+// ErrNoServer is returned.
+//
+// The returned connection is positioned after the opening handshake, so it
+// can be used by any WebSocket framing library. The server response is also
+// returned, to check the negotiated subprotocol and extensions.
+func DialWebSocket(ctx context.Context, discovery Discovery, config WebSocketConfig) (net.Conn, *http.Response, error) {
+	tried := make(map[string]bool)
+	err := ErrNoServer
+
+	var dialer net.Dialer
+	dial := resolvedDialer(resolveAddress(discovery), dialer.DialContext)
+
+	for config.MaxAttempts <= 0 || len(tried) < config.MaxAttempts {
+		target, port := chooseWhere(discovery, func(server Server) bool {
+			return !tried[JoinHostPort(server.Target, server.Port)]
+		})
+		if target == "" && port == 0 {
+			break
+		}
+		tried[JoinHostPort(target, port)] = true
+
+		var conn net.Conn
+		var response *http.Response
+		if conn, response, err = dialWebSocket(ctx, dial, target, port, config); err == nil {
+			return conn, response, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	return nil, nil, err
+}
+
+// dialWebSocket connects to the target with the dial function and runs the
+// opening handshake.
+func dialWebSocket(ctx context.Context, dial dialFunc, target string, port uint16, config WebSocketConfig) (net.Conn, *http.Response, error) {
+	address := JoinHostPort(target, port)
+
+	conn, err := dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if config.Scheme == "wss" {
+		tlsConfig := new(tls.Config)
+		if config.TLSConfig != nil {
+			tlsConfig = config.TLSConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = strings.TrimSuffix(host(target), ".")
+		}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	reader, response, err := webSocketHandshake(conn, target, port, config)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return &webSocketConn{Conn: conn, reader: reader}, response, nil
+}
+
+// webSocketHandshake sends the opening handshake and verifies the server
+// response (RFC 6455, section 4.1).
+func webSocketHandshake(conn net.Conn, target string, port uint16, config WebSocketConfig) (*bufio.Reader, *http.Response, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	path := config.Path
+	if path == "" {
+		path = "/"
+	}
+
+	hostHeader := config.Host
+	if hostHeader == "" {
+		hostHeader = net.JoinHostPort(strings.TrimSuffix(host(target), "."), strconv.FormatUint(uint64(port), 10))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+JoinHostPort(target, port)+path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for name, values := range config.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	req.Host = hostHeader
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err := req.Write(conn); err != nil {
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	handshakeErr := WebSocketHandshakeError{
+		Target:     target,
+		Port:       port,
+		StatusCode: response.StatusCode,
+	}
+
+	switch {
+	case response.StatusCode != http.StatusSwitchingProtocols:
+		handshakeErr.Reason = "unexpected status"
+	case !strings.EqualFold(response.Header.Get("Upgrade"), "websocket"):
+		handshakeErr.Reason = "missing upgrade header"
+	case !headerContains(response.Header, "Connection", "upgrade"):
+		handshakeErr.Reason = "missing connection header"
+	case response.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key):
+		handshakeErr.Reason = "invalid accept key"
+	default:
+		return reader, response, nil
+	}
+
+	return nil, nil, handshakeErr
+}
+
+// webSocketAccept returns the accept value expected for the handshake key.
+func webSocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// headerContains checks if the comma separated header has the token, ignoring
+// the case.
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// webSocketConn is the connection returned after the opening handshake. The
+// frames that the server sent together with the handshake response are read
+// first.
+type webSocketConn struct {
+	net.Conn
+
+	// reader stores the data already received from the server.
+	reader *bufio.Reader
+}
+
+// Read reads the data from the connection.
+func (w *webSocketConn) Read(b []byte) (int, error) {
+	return w.reader.Read(b)
+}
@@ -0,0 +1,122 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestDialWebSocket(t *testing.T) {
+	t.Parallel()
+
+	accepting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat" || r.Header.Get("Origin") != "https://example.com" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		hash := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// the first frame is sent together with the handshake response
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n" +
+			"\x81\x02hi")
+		rw.Flush()
+	}))
+	defer accepting.Close()
+
+	refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer refusing.Close()
+
+	scenarios := []struct {
+		description   string
+		maxAttempts   int
+		expectedFrame []byte
+		expectedError error
+	}{
+		{
+			description:   "it should try the next target when the handshake fails",
+			expectedFrame: []byte("\x81\x02hi"),
+		},
+		{
+			description: "it should respect the maximum number of attempts",
+			maxAttempts: 1,
+			expectedError: dnsdisco.WebSocketHandshakeError{
+				Target:     "127.0.0.1",
+				Port:       serverPort(t, refusing.URL),
+				StatusCode: http.StatusServiceUnavailable,
+				Reason:     "unexpected status",
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			discovery := dnsdisco.NewDiscovery("chat", "tcp", "example.com")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "127.0.0.1", Port: serverPort(t, refusing.URL), Priority: 10, Weight: 10},
+					{Target: "127.0.0.1", Port: serverPort(t, accepting.URL), Priority: 20, Weight: 10},
+				}, nil
+			}))
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error while retrieving DNS records. Details: %s", err)
+			}
+
+			conn, response, err := dnsdisco.DialWebSocket(context.Background(), discovery, dnsdisco.WebSocketConfig{
+				Path:        "/chat",
+				Header:      http.Header{"Origin": []string{"https://example.com"}},
+				MaxAttempts: scenario.maxAttempts,
+			})
+
+			if !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Fatalf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			if response.StatusCode != http.StatusSwitchingProtocols {
+				t.Errorf("mismatch status. Expecting: “%d”; found “%d”", http.StatusSwitchingProtocols, response.StatusCode)
+			}
+
+			frame := make([]byte, len(scenario.expectedFrame))
+			if _, err := io.ReadFull(conn, frame); err != nil {
+				t.Fatalf("unexpected error while reading the frame. Details: %s", err)
+			}
+
+			if !reflect.DeepEqual(frame, scenario.expectedFrame) {
+				t.Errorf("mismatch frames. Expecting: “%q”; found “%q”", scenario.expectedFrame, frame)
+			}
+		})
+	}
+}
+
+func TestDialWebSocketNoServer(t *testing.T) {
+	t.Parallel()
+
+	discovery := dnsdisco.NewDiscovery("chat", "tcp", "example.com")
+	if _, _, err := dnsdisco.DialWebSocket(context.Background(), discovery, dnsdisco.WebSocketConfig{}); err != dnsdisco.ErrNoServer {
+		t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", dnsdisco.ErrNoServer, err)
+	}
+}
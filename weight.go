@@ -0,0 +1,27 @@
+package dnsdisco
+
+// ZeroWeightStrategy defines how the servers of the same priority are selected
+// when all of them have weight zero. When only some servers have weight zero,
+// the normalization places them after the weighted servers, so they are only
+// chosen when the weighted servers were already used more times, as the Go
+// runtime resolver does.
+type ZeroWeightStrategy int
+
+const (
+	// ZeroWeightEqual gives the same chance to all servers, as required by RFC
+	// 2782. This is the default strategy.
+	ZeroWeightEqual ZeroWeightStrategy = iota
+
+	// ZeroWeightOrdered always prefers the servers in the order that they were
+	// retrieved, so the record order can be used to define a fallback sequence.
+	ZeroWeightOrdered
+)
+
+// ZeroWeightLoadBalancer is an optional interface that a LoadBalancer can
+// implement to receive the strategy defined with the SetZeroWeightStrategy
+// method. The default load balancer implements it.
+type ZeroWeightLoadBalancer interface {
+	// SetZeroWeightStrategy defines how the servers are selected when all of
+	// them have weight zero.
+	SetZeroWeightStrategy(ZeroWeightStrategy)
+}
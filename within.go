@@ -0,0 +1,108 @@
+package dnsdisco
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// ChooseWithin works like Choose, but health checks the chosen server before
+// returning it, so a server that went down after the last refresh isn't used.
+// The usable servers are checked in the order of the configured load balancer,
+// only until one of them passes or the timeout expires, instead of checking
+// all servers. The servers that fail the check are marked unhealthy (see
+// MarkUnhealthy). When the timeout expires the candidate being checked, or the
+// next one, that isn't known to be bad is returned. Only the returned server
+// is recorded as chosen. If there's no server or all candidates fail the
+// check, an empty target, a zero port and ErrNoServer are returned.
+func (d *discovery) ChooseWithin(timeout time.Duration) (target string, port uint16, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	d.healthCheckerLock.RLock()
+	healthChecker := d.healthChecker
+	d.healthCheckerLock.RUnlock()
+
+	tried := make(map[string]bool)
+	for {
+		target, port := d.balancedCandidate(func(server Server) bool {
+			return !tried[server.address()]
+		})
+
+		server, found := d.server(target, port)
+		if !found {
+			// custom load balancers may choose servers that aren't in the list
+			server = Server{SRV: net.SRV{Target: target, Port: port}}
+		}
+
+		if (target == "" && port == 0) || tried[server.address()] {
+			return "", 0, ErrNoServer
+		}
+		tried[server.address()] = true
+
+		// after the deadline the candidates aren't checked anymore, and the
+		// first one that isn't known to be bad is used
+		if ctx.Err() == nil {
+			// the checker may not respect the context, so the deadline is
+			// enforced here
+			healthy := make(chan bool, 1)
+			go func() {
+				status, err := d.checkHealth(ctx, healthChecker, server)
+				healthy <- err == nil && status.Usable()
+			}()
+
+			select {
+			case <-ctx.Done():
+			case ok := <-healthy:
+				if !ok {
+					d.MarkUnhealthy(server.Target, server.Port)
+					continue
+				}
+			}
+		}
+
+		d.recordChoice(server.Target, server.Port)
+		return server.Target, server.Port, nil
+	}
+}
+
+// balancedCandidate chooses with the load balancer one of the servers accepted
+// by the filter with available selections, without recording the choice.
+func (d *discovery) balancedCandidate(filter func(Server) bool) (target string, port uint16) {
+	d.serversLock.RLock()
+	defer d.serversLock.RUnlock()
+
+	d.choiceLock.Lock()
+	defer d.choiceLock.Unlock()
+
+	return d.loadBalanceWhere(admissibleFilter(filter, d.admissible))
+}
+
+// recordChoice records the server as chosen, consuming one of its
+// selections.
+func (d *discovery) recordChoice(target string, port uint16) {
+	d.serversLock.RLock()
+	defer d.serversLock.RUnlock()
+
+	d.choiceLock.Lock()
+	defer d.choiceLock.Unlock()
+
+	d.admit(target, port)
+	d.markChosen(target, port)
+}
+
+// server returns the current information of the server.
+func (d *discovery) server(target string, port uint16) (Server, bool) {
+	d.serversLock.RLock()
+	defer d.serversLock.RUnlock()
+
+	d.choiceLock.Lock()
+	defer d.choiceLock.Unlock()
+
+	for _, server := range d.servers {
+		if server.Target == target && server.Port == port {
+			return server, true
+		}
+	}
+	return Server{}, false
+}
@@ -0,0 +1,168 @@
+package dnsdisco_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/dnsdisco"
+)
+
+func TestChooseWithin(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		description       string
+		loadBalancer      dnsdisco.LoadBalancer
+		healthChecker     dnsdisco.ServerHealthCheckerFunc
+		expectedTarget    string
+		expectedPort      uint16
+		expectedUnhealthy []string
+		expectedError     error
+	}{
+		{
+			description: "it should choose the best server when it passes the check",
+			healthChecker: func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+				return dnsdisco.HealthStatusHealthy, nil
+			},
+			expectedTarget: "server1.example.com.",
+			expectedPort:   1111,
+		},
+		{
+			description: "it should choose the next server when the best fails the check",
+			healthChecker: func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+				if server.Target == "server1.example.com." {
+					return dnsdisco.HealthStatusUnhealthy, errors.New("connection refused")
+				}
+				return dnsdisco.HealthStatusHealthy, nil
+			},
+			expectedTarget:    "server2.example.com.",
+			expectedPort:      2222,
+			expectedUnhealthy: []string{"server1.example.com."},
+		},
+		{
+			description: "it should fail when all servers fail the check",
+			healthChecker: func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+				return dnsdisco.HealthStatusUnhealthy, nil
+			},
+			expectedUnhealthy: []string{"server1.example.com.", "server2.example.com."},
+			expectedError:     dnsdisco.ErrNoServer,
+		},
+		{
+			description: "it should choose the best known server when the deadline expires",
+			healthChecker: func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+				time.Sleep(time.Second)
+				return dnsdisco.HealthStatusHealthy, nil
+			},
+			expectedTarget: "server1.example.com.",
+			expectedPort:   1111,
+		},
+		{
+			description:  "it should check the servers in the load balancer order",
+			loadBalancer: &lastLoadBalancer{},
+			healthChecker: func(ctx context.Context, server dnsdisco.Server) (dnsdisco.HealthStatus, error) {
+				if server.Target == "server2.example.com." {
+					return dnsdisco.HealthStatusUnhealthy, errors.New("connection refused")
+				}
+				return dnsdisco.HealthStatusHealthy, nil
+			},
+			expectedTarget:    "server1.example.com.",
+			expectedPort:      1111,
+			expectedUnhealthy: []string{"server2.example.com."},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.description, func(t *testing.T) {
+			t.Parallel()
+
+			discovery := dnsdisco.NewDiscovery("jabber", "tcp", "registro.br")
+			discovery.SetRetriever(dnsdisco.RetrieverFunc(func(service, proto, name string) ([]*net.SRV, error) {
+				return []*net.SRV{
+					{Target: "server1.example.com.", Port: 1111, Priority: 10, Weight: 10},
+					{Target: "server2.example.com.", Port: 2222, Priority: 20, Weight: 10},
+				}, nil
+			}))
+			discovery.SetHealthChecker(dnsdisco.HealthCheckerFunc(func(target string, port uint16, proto string) (bool, error) {
+				return true, nil
+			}))
+
+			if scenario.loadBalancer != nil {
+				discovery.SetLoadBalancer(scenario.loadBalancer)
+			}
+
+			if err := discovery.Refresh(); err != nil {
+				t.Fatalf("unexpected error “%v”", err)
+			}
+
+			discovery.(dnsdisco.HealthManager).SetServerHealthChecker(scenario.healthChecker)
+
+			begin := time.Now()
+			target, port, err := discovery.(dnsdisco.Selector).ChooseWithin(100 * time.Millisecond)
+
+			if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+				t.Errorf("deadline not respected, took “%s”", elapsed)
+			}
+
+			if target != scenario.expectedTarget {
+				t.Errorf("mismatch targets. Expecting: “%s”; found “%s”", scenario.expectedTarget, target)
+			}
+
+			if port != scenario.expectedPort {
+				t.Errorf("mismatch ports. Expecting: “%d”; found “%d”", scenario.expectedPort, port)
+			}
+
+			if err != scenario.expectedError {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+
+			var unhealthy []string
+			var used int
+			for _, server := range discovery.(dnsdisco.Inspector).Servers() {
+				if !server.Healthy {
+					unhealthy = append(unhealthy, server.Target)
+				}
+				used += server.Used
+			}
+
+			// only the returned server is recorded as chosen
+			expectedUsed := 0
+			if scenario.expectedTarget != "" {
+				expectedUsed = 1
+			}
+
+			if used != expectedUsed {
+				t.Errorf("mismatch number of choices. Expecting: “%d”; found “%d”", expectedUsed, used)
+			}
+
+			if len(unhealthy) != len(scenario.expectedUnhealthy) {
+				t.Errorf("mismatch unhealthy servers. Expecting: “%v”; found “%v”", scenario.expectedUnhealthy, unhealthy)
+			}
+		})
+	}
+}
+
+// lastLoadBalancer always chooses the last server accepted by the filter.
+type lastLoadBalancer struct {
+	servers []*net.SRV
+}
+
+func (l *lastLoadBalancer) ChangeServers(servers []*net.SRV) {
+	l.servers = servers
+}
+
+func (l *lastLoadBalancer) LoadBalance() (target string, port uint16) {
+	return l.LoadBalanceWhere(nil)
+}
+
+func (l *lastLoadBalancer) LoadBalanceWhere(accept func(target string, port uint16) bool) (target string, port uint16) {
+	for i := len(l.servers) - 1; i >= 0; i-- {
+		if accept == nil || accept(l.servers[i].Target, l.servers[i].Port) {
+			return l.servers[i].Target, l.servers[i].Port
+		}
+	}
+	return "", 0
+}
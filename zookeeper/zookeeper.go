@@ -0,0 +1,161 @@
+// Package zookeeper retrieves the servers of a service from a ZooKeeper
+// service registry, following the layout and the JSON format used by Apache
+// Curator ServiceDiscovery. It is a bridge for environments where the services
+// still register themselves as ephemeral znodes.
+//
+// To avoid depending on a specific ZooKeeper client, the library only needs an
+// implementation of the Client interface.
+package zookeeper
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"path"
+	"sync"
+)
+
+var (
+	// ErrSessionLost must be returned by the Client implementation when the
+	// ZooKeeper session expired or the connection was lost. In this case the
+	// retriever keeps the last known set of servers.
+	ErrSessionLost = errors.New("zookeeper: session lost")
+
+	// ErrNoNode must be returned by the Client implementation when the znode
+	// doesn't exist anymore. This is common with ephemeral znodes, that can be
+	// removed between listing and reading them.
+	ErrNoNode = errors.New("zookeeper: node does not exist")
+)
+
+// Client is the subset of the ZooKeeper operations needed by the retriever.
+type Client interface {
+	// Children returns the names of the child znodes of the given path.
+	Children(path string) ([]string, error)
+
+	// Get returns the data stored in the znode.
+	Get(path string) ([]byte, error)
+}
+
+// Instance is the JSON document stored by Curator ServiceDiscovery in each
+// ephemeral znode. Only the fields used by the retriever are mapped.
+type Instance struct {
+	// Name is the name of the service.
+	Name string `json:"name"`
+
+	// ID identifies the instance of the service.
+	ID string `json:"id"`
+
+	// Address is where the instance is running.
+	Address string `json:"address"`
+
+	// Port is where the instance is listening for requests.
+	Port *uint16 `json:"port"`
+
+	// SSLPort is where the instance is listening for TLS requests.
+	SSLPort *uint16 `json:"sslPort"`
+}
+
+// Retriever lists the ephemeral znodes under <basePath>/<service> and
+// converts each Curator instance to a SRV record. It implements the
+// dnsdisco.Retriever interface. As ZooKeeper has no concept of priority and
+// weight, all servers are returned with zero values, and the proto and name
+// arguments are ignored.
+type Retriever struct {
+	// client is the connection to the ZooKeeper ensemble.
+	client Client
+
+	// basePath is the root znode where the services are registered.
+	basePath string
+
+	// sslPort defines if the retriever should use the TLS port of the
+	// instances.
+	sslPort bool
+
+	// lastServers stores the last set of servers retrieved with success, used
+	// when the session is lost.
+	lastServers map[string][]*net.SRV
+
+	// lastServersLock make it safe to retrieve different services at the same
+	// time.
+	lastServersLock sync.Mutex
+}
+
+// NewRetriever builds a retriever that looks for the services under the given
+// base path. When sslPort is true the instances TLS port is used instead of
+// the plain one, ignoring the instances that don't have it.
+func NewRetriever(client Client, basePath string, sslPort bool) *Retriever {
+	return &Retriever{
+		client:      client,
+		basePath:    basePath,
+		sslPort:     sslPort,
+		lastServers: make(map[string][]*net.SRV),
+	}
+}
+
+// Retrieve lists and reads all instances of the service. If the ZooKeeper
+// session is lost, the last known set of servers is returned without errors,
+// so the discovery keeps working until the session is restored.
+func (r *Retriever) Retrieve(service, proto, name string) ([]*net.SRV, error) {
+	servicePath := path.Join(r.basePath, service)
+
+	servers, err := r.retrieve(servicePath)
+	if err == ErrSessionLost {
+		r.lastServersLock.Lock()
+		defer r.lastServersLock.Unlock()
+
+		if lastServers, ok := r.lastServers[servicePath]; ok {
+			return lastServers, nil
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.lastServersLock.Lock()
+	r.lastServers[servicePath] = servers
+	r.lastServersLock.Unlock()
+
+	return servers, nil
+}
+
+// retrieve reads all the instances stored in the service path.
+func (r *Retriever) retrieve(servicePath string) ([]*net.SRV, error) {
+	children, err := r.client.Children(servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []*net.SRV
+	for _, child := range children {
+		data, err := r.client.Get(path.Join(servicePath, child))
+		if err == ErrNoNode {
+			// the ephemeral znode was removed after we listed it
+			continue
+
+		} else if err != nil {
+			return nil, err
+		}
+
+		var instance Instance
+		if err := json.Unmarshal(data, &instance); err != nil {
+			return nil, err
+		}
+
+		port := instance.Port
+		if r.sslPort {
+			port = instance.SSLPort
+		}
+
+		if port == nil {
+			continue
+		}
+
+		servers = append(servers, &net.SRV{
+			Target: instance.Address,
+			Port:   *port,
+		})
+	}
+
+	return servers, nil
+}
@@ -0,0 +1,128 @@
+package zookeeper_test
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rafaeljusto/dnsdisco/zookeeper"
+)
+
+func TestRetrieve(t *testing.T) {
+	t.Parallel()
+
+	instances := map[string][]byte{
+		"/services/jabber/1": []byte(`{"name":"jabber","id":"1","address":"10.0.0.1","port":5222,"sslPort":5223}`),
+		"/services/jabber/2": []byte(`{"name":"jabber","id":"2","address":"10.0.0.2","port":5222,"sslPort":null}`),
+	}
+
+	scenarios := []struct {
+		description     string
+		client          clientMock
+		sslPort         bool
+		previousClient  *clientMock
+		expectedServers []*net.SRV
+		expectedError   error
+	}{
+		{
+			description: "it should convert the instances to SRV records",
+			client: clientMock{
+				children: []string{"1", "2", "3"},
+				data:     instances,
+			},
+			expectedServers: []*net.SRV{
+				{Target: "10.0.0.1", Port: 5222},
+				{Target: "10.0.0.2", Port: 5222},
+			},
+		},
+		{
+			description: "it should use only the instances with TLS port",
+			client: clientMock{
+				children: []string{"1", "2"},
+				data:     instances,
+			},
+			sslPort: true,
+			expectedServers: []*net.SRV{
+				{Target: "10.0.0.1", Port: 5223},
+			},
+		},
+		{
+			description: "it should keep the last known set when the session is lost",
+			client: clientMock{
+				err: zookeeper.ErrSessionLost,
+			},
+			previousClient: &clientMock{
+				children: []string{"2"},
+				data:     instances,
+			},
+			expectedServers: []*net.SRV{
+				{Target: "10.0.0.2", Port: 5222},
+			},
+		},
+		{
+			description: "it should fail when the session is lost without a known set",
+			client: clientMock{
+				err: zookeeper.ErrSessionLost,
+			},
+			expectedError: zookeeper.ErrSessionLost,
+		},
+		{
+			description: "it should fail with other errors",
+			client: clientMock{
+				err: errors.New("generic error"),
+			},
+			previousClient: &clientMock{
+				children: []string{"2"},
+				data:     instances,
+			},
+			expectedError: errors.New("generic error"),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.description, func(t *testing.T) {
+			client := new(clientMock)
+			retriever := zookeeper.NewRetriever(client, "/services", scenario.sslPort)
+
+			if scenario.previousClient != nil {
+				*client = *scenario.previousClient
+				if _, err := retriever.Retrieve("jabber", "tcp", "registro.br"); err != nil {
+					t.Fatalf("unexpected error retrieving the previous set. Details: %s", err)
+				}
+			}
+
+			*client = scenario.client
+			servers, err := retriever.Retrieve("jabber", "tcp", "registro.br")
+
+			if !reflect.DeepEqual(servers, scenario.expectedServers) {
+				t.Errorf("mismatch servers. Expecting: “%#v”; found “%#v”", scenario.expectedServers, servers)
+			}
+
+			if !reflect.DeepEqual(err, scenario.expectedError) {
+				t.Errorf("mismatch errors. Expecting: “%v”; found “%v”", scenario.expectedError, err)
+			}
+		})
+	}
+}
+
+// clientMock simulates a ZooKeeper client with fixed znodes.
+type clientMock struct {
+	children []string
+	data     map[string][]byte
+	err      error
+}
+
+// Children returns the names of the child znodes of the given path.
+func (c *clientMock) Children(path string) ([]string, error) {
+	return c.children, c.err
+}
+
+// Get returns the data stored in the znode.
+func (c *clientMock) Get(path string) ([]byte, error) {
+	data, ok := c.data[path]
+	if !ok {
+		return nil, zookeeper.ErrNoNode
+	}
+	return data, nil
+}